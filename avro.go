@@ -0,0 +1,795 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AvroOptions configure an AvroEncoder.
+type AvroOptions struct {
+	// ServerName is the prefix of topic names, and of the namespaces of
+	// schemas.
+	ServerName string
+
+	// Registry keeps the schemas of records; nil means a new
+	// MemoryAvroRegistry.
+	Registry AvroRegistry
+
+	// Schemas names the columns of tables whose table maps don't; see
+	// NewChangeStream.
+	Schemas func(database, table string) *TableSchema
+}
+
+// An AvroRecord is a Kafka record in the wire format of Confluent's Avro
+// serializers: a 0 byte, the big-endian 4-byte ID of the schema, then the
+// Avro binary encoding of the record.
+type AvroRecord struct {
+	Topic string
+	Key   []byte // nil for tables without a primary key
+	Value []byte
+}
+
+// An AvroEncoder turns row changes and snapshot rows into Avro records, to
+// the topic ServerName.database.table. Their schemas, registered under the
+// subjects topic-key and topic-value, are derived from the table maps of the
+// tables:
+//   - the key is a record Key of the primary key columns
+//   - the value is a record Envelope of the row before and after the change,
+//     as records Value of every column, the op (c, u, d or r), a record Source
+//     of where the change was logged, and a record Transaction
+//
+// Columns are named as ChangeStream names them, with characters Avro doesn't
+// allow in names replaced by underscores. They are nullable if the table map
+// says so, and every field has a default. Columns have these Avro types:
+//   - int for integers of up to 32 bits, and long for wider ones and BIT;
+//     BIGINT UNSIGNED is a decimal
+//   - float and double for FLOAT and DOUBLE, and decimal bytes for DECIMAL
+//   - date for DATE, local-timestamp-micros for DATETIME, timestamp-micros for
+//     TIMESTAMP and time-micros for TIME; temporal columns are always
+//     nullable, as zero dates are null
+//   - string for text, ENUM and SET labels and JSON, and bytes for binary
+//     strings and GEOMETRY
+//
+// When a table changes, its schemas evolve so that they can read records of
+// the last ones: columns keep the wider of their old and new types and stay
+// nullable, and changes Avro can't resolve, such as from text to numbers,
+// fail.
+//
+// Rows must hold every column, as with binlog_row_image=FULL, and ENUM and
+// SET values must be labels, parsed with ParserOptions.DecodeEnums.
+type AvroEncoder struct {
+	o       AvroOptions
+	tracker changeTracker
+	topics  map[string]*avroTopic
+}
+
+// avroTopic is the schemas of the records of a table.
+type avroTopic struct {
+	table          *changeSchema // the definition they were last derived from
+	value, key     []avroField   // key is nil without a primary key
+	valueID, keyID int
+}
+
+func NewAvroEncoder(o AvroOptions) *AvroEncoder {
+	if o.Registry == nil {
+		o.Registry = NewMemoryAvroRegistry()
+	}
+	return &AvroEncoder{o: o, tracker: changeTracker{schemas: o.Schemas}, topics: make(map[string]*avroTopic)}
+}
+
+// Encode returns the records of an event. Events must be passed in the order
+// they were streamed, for the encoder to follow binlog positions and
+// transactions.
+func (enc *AvroEncoder) Encode(e *EventContainer) ([]AvroRecord, error) {
+	changes, err := enc.tracker.changes(e)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]AvroRecord, 0, len(changes))
+	for _, c := range changes {
+		r, err := enc.encodeChange(c)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// EncodeStream encodes the events of a stream, passing their records to emit,
+// until the stream or emit fail, and returns their error.
+func (enc *AvroEncoder) EncodeStream(s *Streamer, emit func(AvroRecord) error) error {
+	for {
+		e, err := s.GetEvent()
+		if err != nil {
+			return err
+		}
+		records, err := enc.Encode(e)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := emit(r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (enc *AvroEncoder) encodeChange(c *ChangeEvent) (AvroRecord, error) {
+	name := c.Database + "." + c.Table
+	if enc.o.ServerName != "" {
+		name = enc.o.ServerName + "." + name
+	}
+	t, err := enc.topic(name, c)
+	if err != nil {
+		return AvroRecord{}, err
+	}
+	record := AvroRecord{Topic: name}
+
+	if t.key != nil && c.Key.Values != nil {
+		row := c.After
+		if row.Values == nil {
+			row = c.Before
+		}
+		var b bytes.Buffer
+		writeAvroHeader(&b, t.keyID)
+		if err := writeAvroRow(&b, t.key, row); err != nil {
+			return AvroRecord{}, fmt.Errorf("%s: key %v", name, err)
+		}
+		record.Key = b.Bytes()
+	}
+
+	var b bytes.Buffer
+	writeAvroHeader(&b, t.valueID)
+	for _, row := range []struct {
+		name string
+		r    Row
+	}{{"before", c.Before}, {"after", c.After}} {
+		if row.r.Values == nil {
+			writeAvroLong(&b, 0)
+			continue
+		}
+		writeAvroLong(&b, 1)
+		if err := writeAvroRow(&b, t.value, row.r); err != nil {
+			return AvroRecord{}, fmt.Errorf("%s: %s %v", name, row.name, err)
+		}
+	}
+	writeAvroString(&b, string(c.Op))
+
+	s := &c.Source
+	writeAvroLong(&b, int64(s.ServerID))
+	writeAvroString(&b, s.File)
+	writeAvroLong(&b, int64(s.Pos))
+	writeAvroLong(&b, int64(s.Row))
+	if s.GTID != "" {
+		writeAvroLong(&b, 1)
+		writeAvroString(&b, s.GTID)
+	} else {
+		writeAvroLong(&b, 0)
+	}
+	writeAvroLong(&b, s.Timestamp.Unix()*1000+int64(s.Timestamp.Nanosecond()/1000000))
+	if s.Snapshot {
+		b.WriteByte(1)
+	} else {
+		b.WriteByte(0)
+	}
+
+	if tx := c.Transaction; tx != nil {
+		writeAvroLong(&b, 1)
+		writeAvroString(&b, tx.ID)
+		writeAvroLong(&b, int64(tx.Sequence))
+	} else {
+		writeAvroLong(&b, 0)
+	}
+	record.Value = b.Bytes()
+	return record, nil
+}
+
+// topic returns the schemas of the records of a change to a table, deriving
+// and registering them again only when the definition of the table changes.
+func (enc *AvroEncoder) topic(name string, c *ChangeEvent) (*avroTopic, error) {
+	if c.table == nil {
+		return nil, fmt.Errorf("%s: change wasn't read from a rows event", name)
+	}
+	t := enc.topics[name]
+	if t != nil && t.table.sameDefinition(c.table) {
+		return t, nil
+	}
+
+	var prevValue, prevKey []avroField
+	if t != nil {
+		prevValue, prevKey = t.value, t.key
+	} else {
+		var err error
+		if prevValue, err = enc.latest(name+"-value", true); err != nil {
+			return nil, err
+		}
+		if prevKey, err = enc.latest(name+"-key", false); err != nil {
+			return nil, err
+		}
+	}
+
+	value := avroFields(c.table)
+	var key []avroField
+	for _, j := range c.table.keys {
+		if j < len(value) {
+			key = append(key, value[j])
+		}
+	}
+
+	namespace := avroNamespace(enc.o.ServerName, c.Database, c.Table)
+	next := &avroTopic{table: c.table}
+	var err error
+	next.value, next.valueID, err = enc.evolve(name+"-value", prevValue, value, func(fields []avroField) string {
+		return avroEnvelopeSchema(namespace, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		next.key, next.keyID, err = enc.evolve(name+"-key", prevKey, key, func(fields []avroField) string {
+			return avroKeySchema(namespace, fields)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	enc.topics[name] = next
+	return next, nil
+}
+
+// latest returns the row fields of the latest schema of a subject, or nil if
+// it has none. envelope tells value schemas from key schemas.
+func (enc *AvroEncoder) latest(subject string, envelope bool) ([]avroField, error) {
+	schema, _, err := enc.o.Registry.Latest(subject)
+	if err != nil || schema == "" {
+		return nil, err
+	}
+	fields, err := parseAvroFields(schema, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", subject, err)
+	}
+	return fields, nil
+}
+
+// evolve registers the schema of fields, evolved from the previous fields of
+// a subject, and returns them and the schema's ID.
+func (enc *AvroEncoder) evolve(subject string, prev, fields []avroField,
+	schema func([]avroField) string) ([]avroField, int, error) {
+	fields, err := evolveAvroFields(prev, fields)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", subject, err)
+	}
+	id, err := enc.o.Registry.Register(subject, schema(fields))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", subject, err)
+	}
+	return fields, id, nil
+}
+
+// An avroType is the Avro type of the values of a column.
+type avroType struct {
+	primitive string // int, long, float, double, string or bytes
+	logical   string // date, time-micros, timestamp-micros, local-timestamp-micros, decimal or ""
+	precision int    // of decimals
+	scale     int
+}
+
+// An avroField is a column of the records of rows.
+type avroField struct {
+	name     string
+	column   int // index of the column in rows
+	tp       avroType
+	nullable bool
+}
+
+// avroFields returns the fields of the columns of a table, as AvroEncoder
+// describes.
+func avroFields(c *changeSchema) []avroField {
+	tme := c.table
+	fields := make([]avroField, len(tme.ColumnTypes))
+	for j := range fields {
+		tp, meta := tme.ColumnTypes[j], tme.ColumnMetadata[j]
+		if tp == MYSQL_TYPE_STRING {
+			tp, _ = stringRealType(meta)
+		}
+
+		f := avroField{
+			name:     avroName(c.names[j]),
+			column:   j,
+			nullable: j/8 < len(tme.NullBitVector) && tme.NullBitVector[j/8]&(1<<uint(j%8)) != 0,
+		}
+		unsigned := c.columns[j].Unsigned
+		switch tp {
+		case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_INT24, MYSQL_TYPE_YEAR:
+			f.tp = avroType{primitive: "int"}
+		case MYSQL_TYPE_LONG:
+			f.tp = avroType{primitive: "int"}
+			if unsigned {
+				f.tp.primitive = "long"
+			}
+		case MYSQL_TYPE_LONGLONG:
+			f.tp = avroType{primitive: "long"}
+			if unsigned {
+				f.tp = avroType{primitive: "bytes", logical: "decimal", precision: 20}
+			}
+		case MYSQL_TYPE_BIT:
+			f.tp = avroType{primitive: "long"}
+		case MYSQL_TYPE_FLOAT:
+			f.tp = avroType{primitive: "float"}
+		case MYSQL_TYPE_DOUBLE:
+			f.tp = avroType{primitive: "double"}
+		case MYSQL_TYPE_NEWDECIMAL:
+			f.tp = avroType{primitive: "bytes", logical: "decimal", precision: int(meta >> 8), scale: int(meta & 0xff)}
+		case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
+			f.tp = avroType{primitive: "int", logical: "date"}
+			f.nullable = true
+		case MYSQL_TYPE_DATETIME, MYSQL_TYPE_DATETIME2:
+			f.tp = avroType{primitive: "long", logical: "local-timestamp-micros"}
+			f.nullable = true
+		case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2:
+			f.tp = avroType{primitive: "long", logical: "timestamp-micros"}
+			f.nullable = true
+		case MYSQL_TYPE_TIME, MYSQL_TYPE_TIME2:
+			f.tp = avroType{primitive: "long", logical: "time-micros"}
+		case MYSQL_TYPE_ENUM, MYSQL_TYPE_SET, MYSQL_TYPE_JSON:
+			f.tp = avroType{primitive: "string"}
+		case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_STRING:
+			f.tp = avroType{primitive: "string"}
+			if c.binary[j] {
+				f.tp.primitive = "bytes"
+			}
+		case MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB:
+			f.tp = avroType{primitive: "bytes"}
+			if c.columns[j].Charset != "" {
+				f.tp.primitive = "string"
+			}
+		default:
+			f.tp = avroType{primitive: "bytes"}
+		}
+		fields[j] = f
+	}
+	return fields
+}
+
+// avroName makes a valid Avro name of s.
+func avroName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || b[0] >= '0' && b[0] <= '9' {
+		b = append([]byte{'_'}, b...)
+	}
+	return string(b)
+}
+
+// avroNamespace makes a valid Avro namespace of names, leaving out empty ones.
+func avroNamespace(names ...string) string {
+	var parts []string
+	for _, name := range names {
+		for _, part := range strings.Split(name, ".") {
+			if part != "" {
+				parts = append(parts, avroName(part))
+			}
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// evolveAvroFields returns the fields of a table's columns evolved from its
+// previous fields, so that their schema can read records of the previous
+// one: columns of both keep the wider of their types, and stay nullable.
+func evolveAvroFields(prev, fields []avroField) ([]avroField, error) {
+	old := make(map[string]avroField, len(prev))
+	for _, f := range prev {
+		old[f.name] = f
+	}
+
+	evolved := make([]avroField, len(fields))
+	for i, f := range fields {
+		evolved[i] = f
+		p, ok := old[f.name]
+		if !ok {
+			continue
+		}
+		tp, err := widerAvroType(p.tp, f.tp)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", f.name, err)
+		}
+		evolved[i].tp = tp
+		evolved[i].nullable = f.nullable || p.nullable
+	}
+	return evolved, nil
+}
+
+// widerAvroType returns whichever of two types can read values of both, by
+// Avro's rules for promoting types.
+func widerAvroType(a, b avroType) (avroType, error) {
+	switch {
+	case a == b:
+		return b, nil
+	case a.logical != b.logical:
+	case a.logical == "decimal":
+		if a.scale == b.scale {
+			if a.precision > b.precision {
+				return a, nil
+			}
+			return b, nil
+		}
+	case avroPromotes(a.primitive, b.primitive):
+		return b, nil
+	case avroPromotes(b.primitive, a.primitive):
+		return a, nil
+	}
+	return avroType{}, fmt.Errorf("can't change %s to %s", a, b)
+}
+
+// avroPromotes reports whether values written as from can be read as to.
+func avroPromotes(from, to string) bool {
+	switch from {
+	case "int":
+		return to == "long" || to == "float" || to == "double"
+	case "long":
+		return to == "float" || to == "double"
+	case "float":
+		return to == "double"
+	case "string":
+		return to == "bytes"
+	case "bytes":
+		return to == "string"
+	}
+	return false
+}
+
+func (t avroType) String() string {
+	switch t.logical {
+	case "":
+		return t.primitive
+	case "decimal":
+		return fmt.Sprintf("decimal(%d,%d)", t.precision, t.scale)
+	}
+	return t.logical
+}
+
+// avroEnvelopeSchema returns the schema of values, with fields for the
+// columns of rows.
+func avroEnvelopeSchema(namespace string, fields []avroField) string {
+	var b bytes.Buffer
+	b.WriteString(`{"type":"record","name":"Envelope","namespace":`)
+	writeJSONString(&b, namespace)
+	b.WriteString(`,"fields":[{"name":"before","type":["null",{"type":"record","name":"Value","fields":`)
+	writeAvroFieldsSchema(&b, fields)
+	b.WriteString(`}],"default":null},{"name":"after","type":["null","Value"],"default":null},` +
+		`{"name":"op","type":"string"},` +
+		`{"name":"source","type":{"type":"record","name":"Source","fields":[` +
+		`{"name":"server_id","type":"long"},{"name":"file","type":"string"},{"name":"pos","type":"long"},` +
+		`{"name":"row","type":"int"},{"name":"gtid","type":["null","string"],"default":null},` +
+		`{"name":"ts_ms","type":"long"},{"name":"snapshot","type":"boolean"}]}},` +
+		`{"name":"transaction","type":["null",{"type":"record","name":"Transaction","fields":[` +
+		`{"name":"id","type":"string"},{"name":"sequence","type":"long"}]}],"default":null}]}`)
+	return b.String()
+}
+
+// avroKeySchema returns the schema of keys, with fields for the primary key
+// columns.
+func avroKeySchema(namespace string, fields []avroField) string {
+	var b bytes.Buffer
+	b.WriteString(`{"type":"record","name":"Key","namespace":`)
+	writeJSONString(&b, namespace)
+	b.WriteString(`,"fields":`)
+	writeAvroFieldsSchema(&b, fields)
+	b.WriteString("}")
+	return b.String()
+}
+
+// writeAvroFieldsSchema writes the fields of a record schema. Nullable
+// fields default to null and others to zero values.
+func writeAvroFieldsSchema(b *bytes.Buffer, fields []avroField) {
+	b.WriteString("[")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"name":`)
+		writeJSONString(b, f.name)
+		b.WriteString(`,"type":`)
+		if f.nullable {
+			b.WriteString(`["null",`)
+			writeAvroTypeSchema(b, f.tp)
+			b.WriteString(`],"default":null}`)
+			continue
+		}
+		writeAvroTypeSchema(b, f.tp)
+		b.WriteString(`,"default":`)
+		switch {
+		case f.tp.logical == "decimal":
+			b.WriteString(`"\u0000"`)
+		case f.tp.primitive == "string", f.tp.primitive == "bytes":
+			b.WriteString(`""`)
+		default:
+			b.WriteString("0")
+		}
+		b.WriteString("}")
+	}
+	b.WriteString("]")
+}
+
+func writeAvroTypeSchema(b *bytes.Buffer, t avroType) {
+	switch t.logical {
+	case "":
+		fmt.Fprintf(b, `"%s"`, t.primitive)
+	case "decimal":
+		fmt.Fprintf(b, `{"type":"bytes","logicalType":"decimal","precision":%d,"scale":%d}`, t.precision, t.scale)
+	default:
+		fmt.Fprintf(b, `{"type":"%s","logicalType":"%s"}`, t.primitive, t.logical)
+	}
+}
+
+// avroRecordSchema is as much of a record schema as parseAvroFields reads.
+type avroRecordSchema struct {
+	Fields []struct {
+		Name string          `json:"name"`
+		Type json.RawMessage `json:"type"`
+	} `json:"fields"`
+}
+
+// parseAvroFields returns the row fields of a schema made by
+// avroEnvelopeSchema, if envelope is true, or by avroKeySchema.
+func parseAvroFields(schema string, envelope bool) ([]avroField, error) {
+	var record avroRecordSchema
+	if err := json.Unmarshal([]byte(schema), &record); err != nil {
+		return nil, err
+	}
+
+	if envelope {
+		var union []json.RawMessage
+		for _, f := range record.Fields {
+			if f.Name == "before" {
+				if err := json.Unmarshal(f.Type, &union); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(union) != 2 {
+			return nil, fmt.Errorf("schema has no before field of a nullable record")
+		}
+		record = avroRecordSchema{}
+		if err := json.Unmarshal(union[1], &record); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := make([]avroField, len(record.Fields))
+	for i, f := range record.Fields {
+		fields[i] = avroField{name: f.Name, column: i}
+
+		raw := f.Type
+		var union []json.RawMessage
+		if json.Unmarshal(raw, &union) == nil {
+			if len(union) != 2 || string(union[0]) != `"null"` {
+				return nil, fmt.Errorf("field %s: unsupported union %s", f.Name, raw)
+			}
+			fields[i].nullable = true
+			raw = union[1]
+		}
+
+		var t struct {
+			Type        string `json:"type"`
+			LogicalType string `json:"logicalType"`
+			Precision   int    `json:"precision"`
+			Scale       int    `json:"scale"`
+		}
+		if err := json.Unmarshal(raw, &t.Type); err != nil {
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+		fields[i].tp = avroType{primitive: t.Type, logical: t.LogicalType, precision: t.Precision, scale: t.Scale}
+	}
+	return fields, nil
+}
+
+// writeAvroHeader writes the header of Confluent's wire format.
+func writeAvroHeader(b *bytes.Buffer, id int) {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(id))
+	b.Write(header[:])
+}
+
+// writeAvroLong writes an Avro int or long: a zig-zag varint.
+func writeAvroLong(b *bytes.Buffer, n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+func writeAvroBytes(b *bytes.Buffer, data []byte) {
+	writeAvroLong(b, int64(len(data)))
+	b.Write(data)
+}
+
+func writeAvroString(b *bytes.Buffer, s string) {
+	writeAvroLong(b, int64(len(s)))
+	b.WriteString(s)
+}
+
+// writeAvroRow writes a row as a record of fields.
+func writeAvroRow(b *bytes.Buffer, fields []avroField, r Row) error {
+	for _, f := range fields {
+		if err := writeAvroValue(b, f, r.Index(f.column)); err != nil {
+			return fmt.Errorf("column %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// writeAvroValue writes a value of a field; zero dates are null.
+func writeAvroValue(b *bytes.Buffer, f avroField, v Value) error {
+	if !v.IsPresent() {
+		return fmt.Errorf("not in the row image")
+	}
+
+	null := v.IsNull()
+	if v.Kind() == TimeKind {
+		if _, err := v.Time(); err != nil {
+			_, null = v.Interface().(string)
+		}
+	}
+	if f.nullable {
+		if null {
+			writeAvroLong(b, 0)
+			return nil
+		}
+		writeAvroLong(b, 1)
+	} else if null {
+		return fmt.Errorf("NULL value of NOT NULL column")
+	}
+
+	switch f.tp.logical {
+	case "decimal":
+		d, err := v.Decimal()
+		if err != nil {
+			return err
+		}
+		n, err := unscaledDecimal(d, f.tp.scale)
+		if err != nil {
+			return err
+		}
+		writeAvroBytes(b, twosComplement(n))
+		return nil
+	case "date":
+		t, err := v.Time()
+		if err != nil {
+			return err
+		}
+		writeAvroLong(b, time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix()/86400)
+		return nil
+	case "local-timestamp-micros", "timestamp-micros":
+		t, err := v.Time()
+		if err != nil {
+			return err
+		}
+		if f.tp.logical == "local-timestamp-micros" {
+			// DATETIME values are wall clock times, taken to be in UTC
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		writeAvroLong(b, t.Unix()*1000000+int64(t.Nanosecond()/1000))
+		return nil
+	case "time-micros":
+		d, err := v.Duration()
+		if err != nil {
+			return err
+		}
+		writeAvroLong(b, int64(d/time.Microsecond))
+		return nil
+	}
+
+	switch f.tp.primitive {
+	case "int", "long":
+		n, err := avroInt(v)
+		if err != nil {
+			return err
+		}
+		writeAvroLong(b, n)
+	case "float":
+		x, err := avroFloat(v)
+		if err != nil {
+			return err
+		}
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(x)))
+		b.Write(buf[:])
+	case "double":
+		x, err := avroFloat(v)
+		if err != nil {
+			return err
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(x))
+		b.Write(buf[:])
+	case "string", "bytes":
+		switch v.Kind() {
+		case SetKind:
+			labels, _ := v.Labels()
+			writeAvroString(b, strings.Join(labels, ","))
+		case StringKind, BytesKind, JSONKind:
+			data, err := v.Bytes()
+			if err != nil {
+				return err
+			}
+			writeAvroBytes(b, data)
+		case JSONDiffKind:
+			return fmt.Errorf("partial JSON updates need ParserOptions.ApplyJSONDiffs")
+		default:
+			if v.tp == MYSQL_TYPE_ENUM || v.tp == MYSQL_TYPE_SET {
+				return fmt.Errorf("ENUM and SET values need ParserOptions.DecodeEnums")
+			}
+			return fmt.Errorf("can't write %s value as %s", v.Kind(), f.tp)
+		}
+	default:
+		return fmt.Errorf("can't write %s values", f.tp)
+	}
+	return nil
+}
+
+// avroInt returns integer values, and the bits of BIT values.
+func avroInt(v Value) (int64, error) {
+	switch v.Kind() {
+	case UintKind:
+		u, err := v.Uint64()
+		return int64(u), err
+	case StringKind: // ParserOptions.BitStrings
+		if v.tp == MYSQL_TYPE_BIT {
+			u, err := strconv.ParseUint(v.String(), 2, 64)
+			return int64(u), err
+		}
+	}
+	return v.Int64()
+}
+
+// avroFloat returns floating point values, and integer values of columns
+// whose fields evolved to float or double from FLOAT or DOUBLE columns.
+func avroFloat(v Value) (float64, error) {
+	switch v.Kind() {
+	case FloatKind:
+		return v.Float64()
+	case UintKind:
+		u, err := v.Uint64()
+		return float64(u), err
+	}
+	n, err := avroInt(v)
+	return float64(n), err
+}
+
+// unscaledDecimal returns decimal text as an integer of scale fractional
+// digits, failing if that would round it.
+func unscaledDecimal(d string, scale int) (*big.Int, error) {
+	digits, frac := d, ""
+	if i := strings.IndexByte(d, '.'); i >= 0 {
+		digits, frac = d[:i], d[i+1:]
+	}
+	if len(frac) > scale {
+		if strings.Trim(frac[scale:], "0") != "" {
+			return nil, fmt.Errorf("%s has more than %d fractional digits", d, scale)
+		}
+		frac = frac[:scale]
+	}
+
+	n, ok := new(big.Int).SetString(digits+frac+strings.Repeat("0", scale-len(frac)), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", d)
+	}
+	return n, nil
+}
@@ -0,0 +1,383 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	avroTestValueFields = `[{"name":"id","type":{"type":"bytes","logicalType":"decimal","precision":20,"scale":0},"default":"\u0000"},` +
+		`{"name":"name","type":["null","string"],"default":null},` +
+		`{"name":"size","type":["null",{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}],"default":null},` +
+		`{"name":"data","type":["null","bytes"],"default":null}]`
+	avroTestKey = `{"type":"record","name":"Key","namespace":"dbserver1.shard767.uploads","fields":[` +
+		`{"name":"id","type":{"type":"bytes","logicalType":"decimal","precision":20,"scale":0},"default":"\u0000"}]}`
+)
+
+func encodeAvro(t *testing.T, enc *AvroEncoder, events []*EventContainer) []AvroRecord {
+	var records []AvroRecord
+	for _, e := range events {
+		r, err := enc.Encode(e)
+		require.NoError(t, err)
+		records = append(records, r...)
+	}
+	return records
+}
+
+// avroSnapshot returns snapshot events of a row of a table.
+func avroSnapshot(table *TableMapEvent, row ...interface{}) []*EventContainer {
+	return []*EventContainer{
+		snapshotEvent(TABLE_MAP_EVENT, table),
+		snapshotEvent(WRITE_ROWS_EVENT_V2, &RowsEvent{Table: table, TableID: table.TableID,
+			ColumnCount: uint64(len(row)), ColumnBitmap1: []byte{0xff}, Rows: [][]interface{}{row}}),
+	}
+}
+
+func TestAvroEncoderWritesChangeRecords(t *testing.T) {
+	registry := NewMemoryAvroRegistry()
+	enc := NewAvroEncoder(AvroOptions{ServerName: "dbserver1", Registry: registry})
+
+	events := changeTransactions(changeTable())
+	// The update's before image is full, as the encoder needs
+	events[6].e.(*RowsEvent).ColumnBitmap2 = []byte{0x0f}
+	events[6].e.(*RowsEvent).Rows[1] = []interface{}{int64(2), nil, "12345678.90", nil}
+	// and so is the delete's
+	events[11].e.(*RowsEvent).ColumnBitmap1 = []byte{0x0f}
+	events[11].e.(*RowsEvent).Rows[0] = []interface{}{int64(-1), "first", "1.50", []byte{0xff, 0x00}}
+	parsed := parseChangeEvents(t, ParserOptions{ExactDecimals: true}, events)
+
+	records := encodeAvro(t, enc, parsed)
+	require.Len(t, records, 4)
+
+	value, id, err := registry.Latest("dbserver1.shard767.uploads-value")
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.True(t, json.Valid([]byte(value)), value)
+	assert.Contains(t, value, `{"type":"record","name":"Envelope","namespace":"dbserver1.shard767.uploads",`+
+		`"fields":[{"name":"before","type":["null",{"type":"record","name":"Value","fields":`+avroTestValueFields+`}]`)
+	key, id, err := registry.Latest("dbserver1.shard767.uploads-key")
+	require.NoError(t, err)
+	assert.Equal(t, 2, id)
+	assert.Equal(t, avroTestKey, key)
+
+	r := records[0]
+	assert.Equal(t, "dbserver1.shard767.uploads", r.Topic)
+	unsignedMax := []byte{0x12, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	assert.Equal(t, append([]byte{0, 0, 0, 0, 2}, unsignedMax...), r.Key)
+
+	var want bytes.Buffer
+	want.Write([]byte{0, 0, 0, 0, 1})
+	want.Write([]byte{0x00, 0x02}) // no before, an after
+	want.Write(unsignedMax)
+	want.Write([]byte{0x02, 0x0a, 'f', 'i', 'r', 's', 't'})
+	want.Write([]byte{0x02, 0x04, 0x00, 0x96})
+	want.Write([]byte{0x02, 0x04, 0xff, 0x00})
+	want.Write([]byte{0x02, 'c'})
+	gtid := "30313233-3435-3637-3839-616263646566:23"
+	writeAvroLong(&want, 1)
+	writeAvroString(&want, "mysql-bin.000003")
+	writeAvroLong(&want, int64(parsed[5].Header.LogPos))
+	writeAvroLong(&want, 0)
+	want.WriteByte(0x02)
+	writeAvroString(&want, gtid)
+	want.Write([]byte{0x80, 0x80, 0xf4, 0xf6, 0x90, 0x5d, 0x00}) // ts_ms and snapshot
+	want.WriteByte(0x02)
+	writeAvroString(&want, gtid)
+	writeAvroLong(&want, 1)
+	assert.Equal(t, want.Bytes(), r.Value)
+
+	// Updates have both images, and deletes only before
+	assert.Equal(t, []byte{0, 0, 0, 0, 1, 0x02, 0x02, 0x02}, records[2].Value[:8])
+	assert.Equal(t, append([]byte{0, 0, 0, 0, 1, 0x02}, unsignedMax...), records[3].Value[:16])
+	assert.Equal(t, records[0].Key, records[3].Key)
+
+	// Rows must be full
+	enc = NewAvroEncoder(AvroOptions{Registry: registry})
+	for _, e := range parseChangeEvents(t, ParserOptions{ExactDecimals: true}, changeTransactions(changeTable())) {
+		if _, err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	assert.EqualError(t, err, "shard767.uploads: after column name: not in the row image")
+}
+
+// countingAvroRegistry counts the schemas registered with it.
+type countingAvroRegistry struct {
+	AvroRegistry
+	registered int
+}
+
+func (r *countingAvroRegistry) Register(subject, schema string) (int, error) {
+	r.registered++
+	return r.AvroRegistry.Register(subject, schema)
+}
+
+func TestAvroEncoderRegistersSchemasOncePerTableDefinition(t *testing.T) {
+	registry := &countingAvroRegistry{AvroRegistry: NewMemoryAvroRegistry()}
+	enc := NewAvroEncoder(AvroOptions{ServerName: "dbserver1", Registry: registry})
+
+	// Each transaction has a table map of its own, all of one definition
+	events := changeTransactions(changeTable())
+	events[6].e.(*RowsEvent).ColumnBitmap2 = []byte{0x0f}
+	events[6].e.(*RowsEvent).Rows[1] = []interface{}{int64(2), nil, "12345678.90", nil}
+	events[11].e.(*RowsEvent).ColumnBitmap1 = []byte{0x0f}
+	events[11].e.(*RowsEvent).Rows[0] = []interface{}{int64(-1), "first", "1.50", []byte{0xff, 0x00}}
+	encodeAvro(t, enc, parseChangeEvents(t, ParserOptions{ExactDecimals: true}, events))
+	assert.Equal(t, 2, registry.registered)
+
+	// A changed definition registers the value and key schemas again
+	table := changeTable()
+	table.ColumnMetadata[2] = metaFromPrecAndDec(12, 2)
+	encodeAvro(t, enc, avroSnapshot(table, int64(1), "a", "1.50", nil))
+	assert.Equal(t, 4, registry.registered)
+}
+
+func TestAvroEncoderEvolvesSchemas(t *testing.T) {
+	registry := NewMemoryAvroRegistry()
+	enc := NewAvroEncoder(AvroOptions{ServerName: "dbserver1", Registry: registry})
+	encodeAvro(t, enc, avroSnapshot(changeTable(), int64(1), "a", "1.50", nil))
+
+	// Columns keep the wider of their types, and stay nullable
+	table := changeTable()
+	table.ColumnCount = 5
+	table.ColumnTypes = []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_LONG, MYSQL_TYPE_DATE}
+	table.ColumnMetadata = []uint16{0, 255, metaFromPrecAndDec(8, 2), 0, 0}
+	table.NullBitVector = []byte{0x00}
+	table.ColumnCollations = []uint16{0, 255, 0, 0, 0}
+	table.ColumnUnsigned = []bool{true, false, false, false}
+	table.ColumnNames = []string{"id", "name", "size", "count", "day"}
+	records := encodeAvro(t, enc, avroSnapshot(table, int64(2), "b", "2.50", int32(3), "2021-03-04"))
+	require.Len(t, records, 1)
+	assert.Equal(t, []byte{0, 0, 0, 0, 3}, records[0].Value[:5])
+	assert.Equal(t, []byte{0, 0, 0, 0, 2}, records[0].Key[:5])
+
+	value, _, err := registry.Latest("dbserver1.shard767.uploads-value")
+	require.NoError(t, err)
+	assert.Contains(t, value, `"fields":[`+
+		`{"name":"id","type":{"type":"bytes","logicalType":"decimal","precision":20,"scale":0},"default":"\u0000"},`+
+		`{"name":"name","type":["null","string"],"default":null},`+
+		`{"name":"size","type":["null",{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}],"default":null},`+
+		`{"name":"count","type":"int","default":0},`+
+		`{"name":"day","type":["null",{"type":"int","logicalType":"date"}],"default":null}]}`)
+
+	// A new encoder evolves schemas from the registry's
+	enc = NewAvroEncoder(AvroOptions{ServerName: "dbserver1", Registry: registry})
+	records = encodeAvro(t, enc, avroSnapshot(table, int64(2), "b", "2.50", int32(3), "2021-03-04"))
+	assert.Equal(t, []byte{0, 0, 0, 0, 3}, records[0].Value[:5])
+
+	table = changeTable()
+	table.ColumnTypes[1] = MYSQL_TYPE_LONG
+	_, err = enc.Encode(snapshotEvent(TABLE_MAP_EVENT, table))
+	require.NoError(t, err)
+	_, err = enc.Encode(avroSnapshot(table, int64(2), int32(1), "2.50", nil)[1])
+	assert.EqualError(t, err, "dbserver1.shard767.uploads-value: column name: can't change string to int")
+}
+
+func TestAvroEncoderEvolvesIntsAndFloats(t *testing.T) {
+	registry := NewMemoryAvroRegistry()
+	enc := NewAvroEncoder(AvroOptions{ServerName: "dbserver1", Registry: registry})
+
+	float := changeTable()
+	float.ColumnTypes[1], float.ColumnMetadata[1], float.ColumnCollations[1] = MYSQL_TYPE_FLOAT, 4, 0
+	encodeAvro(t, enc, avroSnapshot(float, int64(1), float32(1.5), "1.50", nil))
+
+	// INT values of a column that was FLOAT are written as floats
+	integer := changeTable()
+	integer.ColumnTypes[1], integer.ColumnMetadata[1], integer.ColumnCollations[1] = MYSQL_TYPE_LONG, 0, 0
+	records := encodeAvro(t, enc, avroSnapshot(integer, int64(2), int32(3), "2.50", nil))
+	require.Len(t, records, 1)
+	value, _, err := registry.Latest("dbserver1.shard767.uploads-value")
+	require.NoError(t, err)
+	assert.Contains(t, value, `{"name":"name","type":["null","float"],"default":null}`)
+	assert.Contains(t, string(records[0].Value), string([]byte{0x02, 0x00, 0x00, 0x40, 0x40}))
+
+	// and so are FLOAT values of a column that was INT
+	records = encodeAvro(t, enc, avroSnapshot(float, int64(3), float32(0.5), "3.50", nil))
+	require.Len(t, records, 1)
+	assert.Contains(t, string(records[0].Value), string([]byte{0x02, 0x00, 0x00, 0x00, 0x3f}))
+}
+
+func TestAvroEncoderEncodesStreams(t *testing.T) {
+	s := newStreamer()
+	for _, e := range avroSnapshot(changeTable(), int64(1), "a", "1.50", nil) {
+		s.ch <- e
+	}
+	s.closeWithError(errEndOfChanges)
+
+	var records []AvroRecord
+	err := NewAvroEncoder(AvroOptions{}).EncodeStream(s, func(r AvroRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	assert.Equal(t, errEndOfChanges, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "shard767.uploads", records[0].Topic)
+}
+
+func TestAvroFieldsOfColumns(t *testing.T) {
+	table := &TableMapEvent{
+		ColumnTypes: []byte{MYSQL_TYPE_TINY, MYSQL_TYPE_LONG, MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG, MYSQL_TYPE_BIT,
+			MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE, MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_DATETIME2, MYSQL_TYPE_TIME2,
+			MYSQL_TYPE_STRING, MYSQL_TYPE_STRING, MYSQL_TYPE_BLOB, MYSQL_TYPE_JSON, MYSQL_TYPE_GEOMETRY},
+		ColumnMetadata:   []uint16{0, 0, 0, 0, 1, 4, 8, 0, 0, 0, 0xf701, 0xfe04, 2, 4, 4},
+		NullBitVector:    []byte{0x01, 0x00},
+		ColumnUnsigned:   []bool{false, false, true, false, false, false, false},
+		ColumnCollations: []uint16{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 63, 255, 0, 0},
+		ColumnNames: []string{"tiny", "int", "uint", "big", "bit", "float", "double", "ts", "dt", "time",
+			"enum", "char", "blob", "doc", "shape"},
+	}
+	table.ColumnCount = uint64(len(table.ColumnTypes))
+
+	var types []string
+	for _, f := range avroFields(newChangeSchema(table, nil)) {
+		types = append(types, f.name+" "+f.tp.String())
+		if f.nullable {
+			types[len(types)-1] += " null"
+		}
+	}
+	assert.Equal(t, []string{"tiny int null", "int int", "uint long", "big long", "bit long", "float float",
+		"double double", "ts timestamp-micros null", "dt local-timestamp-micros null", "time time-micros",
+		"enum string", "char bytes", "blob string", "doc string", "shape bytes"}, types)
+
+	assert.Equal(t, "_1a_b", avroName("1a-b"))
+	assert.Equal(t, "_", avroName(""))
+	assert.Equal(t, "a.b_c.d", avroNamespace("", "a", "b-c.d"))
+}
+
+func TestWidenAvroTypes(t *testing.T) {
+	decimal := func(precision, scale int) avroType {
+		return avroType{primitive: "bytes", logical: "decimal", precision: precision, scale: scale}
+	}
+	for _, tc := range []struct {
+		a, b, want avroType
+	}{
+		{avroType{primitive: "int"}, avroType{primitive: "long"}, avroType{primitive: "long"}},
+		{avroType{primitive: "long"}, avroType{primitive: "int"}, avroType{primitive: "long"}},
+		{avroType{primitive: "float"}, avroType{primitive: "double"}, avroType{primitive: "double"}},
+		{avroType{primitive: "string"}, avroType{primitive: "bytes"}, avroType{primitive: "bytes"}},
+		{decimal(12, 2), decimal(10, 2), decimal(12, 2)},
+		{decimal(10, 2), decimal(12, 2), decimal(12, 2)},
+	} {
+		got, err := widerAvroType(tc.a, tc.b)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.want, got)
+		}
+	}
+
+	for _, tc := range [][2]avroType{
+		{avroType{primitive: "string"}, avroType{primitive: "int"}},
+		{decimal(10, 2), decimal(10, 3)},
+		{avroType{primitive: "int", logical: "date"}, avroType{primitive: "int"}},
+		{avroType{primitive: "long"}, decimal(20, 0)},
+	} {
+		_, err := widerAvroType(tc[0], tc[1])
+		assert.Error(t, err, "%s to %s", tc[0], tc[1])
+	}
+}
+
+func TestParseAvroFields(t *testing.T) {
+	fields := []avroField{
+		{name: "id", column: 0, tp: avroType{primitive: "long"}},
+		{name: "size", column: 1, tp: avroType{primitive: "bytes", logical: "decimal", precision: 10, scale: 2}, nullable: true},
+		{name: "day", column: 2, tp: avroType{primitive: "int", logical: "date"}, nullable: true},
+	}
+
+	parsed, err := parseAvroFields(avroEnvelopeSchema("shard767.uploads", fields), true)
+	require.NoError(t, err)
+	assert.Equal(t, fields, parsed)
+	parsed, err = parseAvroFields(avroKeySchema("shard767.uploads", fields[:1]), false)
+	require.NoError(t, err)
+	assert.Equal(t, fields[:1], parsed)
+
+	_, err = parseAvroFields(avroKeySchema("shard767.uploads", fields), true)
+	assert.Error(t, err)
+}
+
+func TestAvroValues(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.FixedZone("", 3600))
+	unsigned := &Column{Unsigned: true}
+	field := func(primitive, logical string, nullable bool) avroField {
+		f := avroField{name: "c", tp: avroType{primitive: primitive, logical: logical}, nullable: nullable}
+		if logical == "decimal" {
+			f.tp.precision, f.tp.scale = 10, 2
+		}
+		return f
+	}
+
+	for _, tc := range []struct {
+		f    avroField
+		v    Value
+		want []byte
+	}{
+		{field("int", "", false), NewValue(int32(-7), MYSQL_TYPE_LONG, 0, nil), []byte{0x0d}},
+		{field("int", "", true), NewValue(int32(-7), MYSQL_TYPE_LONG, 0, nil), []byte{0x02, 0x0d}},
+		{field("int", "", true), NewValue(nil, MYSQL_TYPE_LONG, 0, nil), []byte{0x00}},
+		{field("int", "", false), NewValue("2021", MYSQL_TYPE_YEAR, 0, nil), []byte{0xca, 0x1f}},
+		{field("long", "", false), NewValue(int32(-1), MYSQL_TYPE_LONG, 0, unsigned), []byte{0xfe, 0xff, 0xff, 0xff, 0x1f}},
+		{field("long", "", false), NewValue(int64(5), MYSQL_TYPE_BIT, 3, nil), []byte{0x0a}},
+		{field("long", "", false), NewValue("101", MYSQL_TYPE_BIT, 3, nil), []byte{0x0a}},
+		{field("float", "", false), NewValue(float32(1.5), MYSQL_TYPE_FLOAT, 4, nil), []byte{0x00, 0x00, 0xc0, 0x3f}},
+		{field("float", "", false), NewValue(int32(3), MYSQL_TYPE_LONG, 0, nil), []byte{0x00, 0x00, 0x40, 0x40}},
+		{field("double", "", false), NewValue(int8(-1), MYSQL_TYPE_TINY, 0, unsigned),
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0xe0, 0x6f, 0x40}},
+		{field("double", "", false), NewValue(-2.5, MYSQL_TYPE_DOUBLE, 8, nil),
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0xc0}},
+		{field("bytes", "decimal", false), NewValue("1.5", MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 1), nil),
+			[]byte{0x04, 0x00, 0x96}},
+		{field("bytes", "decimal", false), NewValue(-1.5, MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 2), nil),
+			[]byte{0x04, 0xff, 0x6a}},
+		{field("int", "date", true), NewValue("2021-03-04", MYSQL_TYPE_DATE, 0, nil), []byte{0x02, 0x84, 0xa4, 0x02}},
+		{field("int", "date", true), NewValue("0000-00-00", MYSQL_TYPE_DATE, 0, nil), []byte{0x00}},
+		{field("long", "local-timestamp-micros", true), NewValue("2021-03-04 05:06:07.5", MYSQL_TYPE_DATETIME2, 1, nil),
+			[]byte{0x02, 0xc0, 0xbb, 0xc4, 0xcd, 0xdd, 0xab, 0xde, 0x05}},
+		{field("long", "timestamp-micros", true), NewValue(ts, MYSQL_TYPE_TIMESTAMP2, 2, nil),
+			[]byte{0x02, 0xa0, 0xf9, 0xd6, 0xe4, 0xc2, 0xab, 0xde, 0x05}},
+		{field("long", "time-micros", false), NewValue("-00:00:01", MYSQL_TYPE_TIME2, 0, nil), []byte{0xff, 0x88, 0x7a}},
+		{field("string", "", false), NewValue([]string{"a", "c"}, MYSQL_TYPE_SET, 1, nil), []byte{0x06, 'a', ',', 'c'}},
+		{field("string", "", false), NewValue("small", MYSQL_TYPE_ENUM, 1, nil), []byte{0x0a, 's', 'm', 'a', 'l', 'l'}},
+		{field("string", "", false), NewValue([]byte(`{}`), MYSQL_TYPE_JSON, 4, nil), []byte{0x04, '{', '}'}},
+		{field("bytes", "", false), NewValue("x", MYSQL_TYPE_VARCHAR, 255, nil), []byte{0x02, 'x'}},
+	} {
+		var b bytes.Buffer
+		if assert.NoError(t, writeAvroValue(&b, tc.f, tc.v), "%s %v", tc.f.tp, tc.v) {
+			assert.Equal(t, tc.want, b.Bytes(), "%s %v", tc.f.tp, tc.v)
+		}
+	}
+
+	for _, tc := range []struct {
+		f avroField
+		v Value
+	}{
+		{field("int", "", true), Value{}},
+		{field("int", "", false), NewValue(nil, MYSQL_TYPE_LONG, 0, nil)},
+		{field("string", "", false), NewValue(int64(2), MYSQL_TYPE_ENUM, 1, nil)},
+		{field("string", "", false), NewValue([]JSONDiff{{Operation: JSON_DIFF_REMOVE, Path: []byte("$.a")}}, MYSQL_TYPE_JSON, 4, nil)},
+		{field("bytes", "decimal", false), NewValue("1.505", MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 3), nil)},
+	} {
+		var b bytes.Buffer
+		assert.Error(t, writeAvroValue(&b, tc.f, tc.v), "%s %v", tc.f.tp, tc.v)
+	}
+}
+
+func TestWriteAvroLong(t *testing.T) {
+	for _, tc := range []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{-1, []byte{0x01}},
+		{1, []byte{0x02}},
+		{-64, []byte{0x7f}},
+		{64, []byte{0x80, 0x01}},
+		{-65, []byte{0x81, 0x01}},
+	} {
+		var b bytes.Buffer
+		writeAvroLong(&b, tc.n)
+		assert.Equal(t, tc.want, b.Bytes(), "%d", tc.n)
+	}
+}
@@ -0,0 +1,168 @@
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// An AvroRegistry keeps Avro schemas under IDs, and the versions of the
+// schemas of subjects, as Confluent's Schema Registry does. Clients of a
+// live registry can implement it; MemoryAvroRegistry and FileAvroRegistry
+// need none.
+type AvroRegistry interface {
+	// Register returns the ID of a schema, registering it as the latest
+	// version of subject if the subject doesn't have it yet.
+	Register(subject, schema string) (int, error)
+
+	// Latest returns the latest schema of a subject and its ID, or "" and 0
+	// if the subject has none.
+	Latest(subject string) (string, int, error)
+
+	// Schema returns the schema with an ID.
+	Schema(id int) (string, error)
+}
+
+// A MemoryAvroRegistry keeps schemas in memory. IDs are given from 1, and
+// the same schema has the same ID in every subject. It is safe for
+// concurrent use.
+type MemoryAvroRegistry struct {
+	m        sync.Mutex
+	schemas  []string // by ID - 1
+	subjects map[string][]int
+}
+
+func NewMemoryAvroRegistry() *MemoryAvroRegistry {
+	return &MemoryAvroRegistry{subjects: make(map[string][]int)}
+}
+
+func (r *MemoryAvroRegistry) Register(subject, schema string) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	id, _ := r.register(subject, schema)
+	return id, nil
+}
+
+// register returns the ID of a schema and whether registering it changed
+// the registry.
+func (r *MemoryAvroRegistry) register(subject, schema string) (int, bool) {
+	id := 0
+	for i, s := range r.schemas {
+		if s == schema {
+			id = i + 1
+			break
+		}
+	}
+	changed := false
+	if id == 0 {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+		changed = true
+	}
+
+	for _, version := range r.subjects[subject] {
+		if version == id {
+			return id, changed
+		}
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id, true
+}
+
+func (r *MemoryAvroRegistry) Latest(subject string) (string, int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return "", 0, nil
+	}
+	id := versions[len(versions)-1]
+	return r.schemas[id-1], id, nil
+}
+
+func (r *MemoryAvroRegistry) Schema(id int) (string, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if id < 1 || id > len(r.schemas) {
+		return "", fmt.Errorf("no schema with ID %d", id)
+	}
+	return r.schemas[id-1], nil
+}
+
+// A FileAvroRegistry is a MemoryAvroRegistry saved to a JSON file whenever a
+// schema is registered, so that IDs outlive the process.
+type FileAvroRegistry struct {
+	MemoryAvroRegistry
+	path  string
+	dirty bool // the last save failed
+}
+
+// avroRegistryFile is the content of a FileAvroRegistry's file.
+type avroRegistryFile struct {
+	Schemas  []string         `json:"schemas"`
+	Subjects map[string][]int `json:"subjects"`
+}
+
+// NewFileAvroRegistry opens the registry saved at path, or a new one if there
+// is no file there yet.
+func NewFileAvroRegistry(path string) (*FileAvroRegistry, error) {
+	r := &FileAvroRegistry{MemoryAvroRegistry: MemoryAvroRegistry{subjects: make(map[string][]int)}, path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f avroRegistryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for subject, versions := range f.Subjects {
+		for _, id := range versions {
+			if id < 1 || id > len(f.Schemas) {
+				return nil, fmt.Errorf("%s: subject %s has unknown schema ID %d", path, subject, id)
+			}
+		}
+		r.subjects[subject] = versions
+	}
+	r.schemas = f.Schemas
+	return r, nil
+}
+
+// Register registers a schema as MemoryAvroRegistry does, and saves the
+// registry if that changed it.
+func (r *FileAvroRegistry) Register(subject, schema string) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	id, changed := r.register(subject, schema)
+	if !changed && !r.dirty {
+		return id, nil
+	}
+	if err := r.save(); err != nil {
+		r.dirty = true
+		return 0, err
+	}
+	r.dirty = false
+	return id, nil
+}
+
+func (r *FileAvroRegistry) save() error {
+	data, err := json.MarshalIndent(avroRegistryFile{Schemas: r.schemas, Subjects: r.subjects}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Replace the file, rather than rewrite it, so that it is never seen half
+	// written
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
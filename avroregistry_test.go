@@ -0,0 +1,100 @@
+package binlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAvroRegistry(t *testing.T, r AvroRegistry) {
+	schema, id, err := r.Latest("uploads-value")
+	require.NoError(t, err)
+	assert.Equal(t, "", schema)
+	assert.Equal(t, 0, id)
+
+	id, err = r.Register("uploads-value", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	id, err = r.Register("uploads-value", `"long"`)
+	require.NoError(t, err)
+	assert.Equal(t, 2, id)
+
+	// Schemas keep their IDs across subjects, and registering them again
+	// doesn't make new versions
+	id, err = r.Register("uploads-key", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	id, err = r.Register("uploads-value", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	schema, id, err = r.Latest("uploads-value")
+	require.NoError(t, err)
+	assert.Equal(t, `"long"`, schema)
+	assert.Equal(t, 2, id)
+
+	schema, err = r.Schema(2)
+	require.NoError(t, err)
+	assert.Equal(t, `"long"`, schema)
+	_, err = r.Schema(3)
+	assert.Error(t, err)
+}
+
+func TestMemoryAvroRegistry(t *testing.T) {
+	testAvroRegistry(t, NewMemoryAvroRegistry())
+}
+
+func TestFileAvroRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avroregistry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schemas.json")
+
+	r, err := NewFileAvroRegistry(path)
+	require.NoError(t, err)
+	testAvroRegistry(t, r)
+
+	r, err = NewFileAvroRegistry(path)
+	require.NoError(t, err)
+	schema, id, err := r.Latest("uploads-value")
+	require.NoError(t, err)
+	assert.Equal(t, `"long"`, schema)
+	assert.Equal(t, 2, id)
+	id, err = r.Register("uploads-key", `"string"`)
+	require.NoError(t, err)
+	assert.Equal(t, 3, id)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"schemas":["\"int\""],"subjects":{"a":[2]}}`), 0644))
+	_, err = NewFileAvroRegistry(path)
+	assert.Error(t, err)
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{`), 0644))
+	_, err = NewFileAvroRegistry(path)
+	assert.Error(t, err)
+}
+
+func TestFileAvroRegistrySavesAfterFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avroregistry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "missing", "schemas.json")
+
+	r, err := NewFileAvroRegistry(path)
+	require.NoError(t, err)
+	_, err = r.Register("uploads-value", `"int"`)
+	assert.Error(t, err)
+
+	require.NoError(t, os.Mkdir(filepath.Dir(path), 0755))
+	id, err := r.Register("uploads-value", `"int"`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	r, err = NewFileAvroRegistry(path)
+	require.NoError(t, err)
+	schema, _, err := r.Latest("uploads-value")
+	require.NoError(t, err)
+	assert.Equal(t, `"int"`, schema)
+}
@@ -0,0 +1,1156 @@
+// Row change events, as binlog.ChangeEvent reads them from a binlog stream.
+// binlog.ChangeEvent.Proto converts them, and binlog.ProtoEncoder writes them
+// as length-delimited messages, as binlog.ChangeEncoder writes JSON.
+//
+// Regenerate changeevent.pb.go with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative binlogpb/changeevent.proto
+//
+// from the root of the repository.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: binlogpb/changeevent.proto
+
+package binlogpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Op int32
+
+const (
+	Op_OP_UNSPECIFIED Op = 0
+	Op_OP_CREATE      Op = 1 // an insert
+	Op_OP_UPDATE      Op = 2
+	Op_OP_DELETE      Op = 3
+	Op_OP_READ        Op = 4 // a row read by a snapshot
+)
+
+// Enum value maps for Op.
+var (
+	Op_name = map[int32]string{
+		0: "OP_UNSPECIFIED",
+		1: "OP_CREATE",
+		2: "OP_UPDATE",
+		3: "OP_DELETE",
+		4: "OP_READ",
+	}
+	Op_value = map[string]int32{
+		"OP_UNSPECIFIED": 0,
+		"OP_CREATE":      1,
+		"OP_UPDATE":      2,
+		"OP_DELETE":      3,
+		"OP_READ":        4,
+	}
+)
+
+func (x Op) Enum() *Op {
+	p := new(Op)
+	*p = x
+	return p
+}
+
+func (x Op) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Op) Descriptor() protoreflect.EnumDescriptor {
+	return file_binlogpb_changeevent_proto_enumTypes[0].Descriptor()
+}
+
+func (Op) Type() protoreflect.EnumType {
+	return &file_binlogpb_changeevent_proto_enumTypes[0]
+}
+
+func (x Op) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Op.Descriptor instead.
+func (Op) EnumDescriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{0}
+}
+
+type JsonDiff_Operation int32
+
+const (
+	JsonDiff_REPLACE JsonDiff_Operation = 0
+	JsonDiff_INSERT  JsonDiff_Operation = 1
+	JsonDiff_REMOVE  JsonDiff_Operation = 2
+)
+
+// Enum value maps for JsonDiff_Operation.
+var (
+	JsonDiff_Operation_name = map[int32]string{
+		0: "REPLACE",
+		1: "INSERT",
+		2: "REMOVE",
+	}
+	JsonDiff_Operation_value = map[string]int32{
+		"REPLACE": 0,
+		"INSERT":  1,
+		"REMOVE":  2,
+	}
+)
+
+func (x JsonDiff_Operation) Enum() *JsonDiff_Operation {
+	p := new(JsonDiff_Operation)
+	*p = x
+	return p
+}
+
+func (x JsonDiff_Operation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JsonDiff_Operation) Descriptor() protoreflect.EnumDescriptor {
+	return file_binlogpb_changeevent_proto_enumTypes[1].Descriptor()
+}
+
+func (JsonDiff_Operation) Type() protoreflect.EnumType {
+	return &file_binlogpb_changeevent_proto_enumTypes[1]
+}
+
+func (x JsonDiff_Operation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JsonDiff_Operation.Descriptor instead.
+func (JsonDiff_Operation) EnumDescriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{8, 0}
+}
+
+// A change to one row, with where it was logged and the transaction it was
+// part of.
+type ChangeEvent struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Source *Source                `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Table  *Table                 `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`
+	Op     Op                     `protobuf:"varint,3,opt,name=op,proto3,enum=autobahn.binlog.Op" json:"op,omitempty"`
+	// before is the row before an update or delete, and after the row after an
+	// insert, update or snapshot read; the other is unset.
+	Before *Row `protobuf:"bytes,4,opt,name=before,proto3" json:"before,omitempty"`
+	After  *Row `protobuf:"bytes,5,opt,name=after,proto3" json:"after,omitempty"`
+	// key holds the primary key columns of after, or for deletes of before. It
+	// is unset if the primary key isn't known.
+	Key *Row `protobuf:"bytes,6,opt,name=key,proto3" json:"key,omitempty"`
+	// transaction is unset for changes outside transactions, such as snapshot
+	// reads.
+	Transaction   *Transaction `protobuf:"bytes,7,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeEvent) Reset() {
+	*x = ChangeEvent{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeEvent) ProtoMessage() {}
+
+func (x *ChangeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeEvent.ProtoReflect.Descriptor instead.
+func (*ChangeEvent) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChangeEvent) GetSource() *Source {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetTable() *Table {
+	if x != nil {
+		return x.Table
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetOp() Op {
+	if x != nil {
+		return x.Op
+	}
+	return Op_OP_UNSPECIFIED
+}
+
+func (x *ChangeEvent) GetBefore() *Row {
+	if x != nil {
+		return x.Before
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetAfter() *Row {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetKey() *Row {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetTransaction() *Transaction {
+	if x != nil {
+		return x.Transaction
+	}
+	return nil
+}
+
+// Where a change was logged.
+type Source struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServerId      uint32                 `protobuf:"varint,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	File          string                 `protobuf:"bytes,2,opt,name=file,proto3" json:"file,omitempty"`           // binlog file, or empty for snapshot reads
+	Pos           uint32                 `protobuf:"varint,3,opt,name=pos,proto3" json:"pos,omitempty"`            // position after the rows event, or 0 for snapshot reads
+	Row           uint32                 `protobuf:"varint,4,opt,name=row,proto3" json:"row,omitempty"`            // index of the row in the rows event
+	Gtid          string                 `protobuf:"bytes,5,opt,name=gtid,proto3" json:"gtid,omitempty"`           // of the transaction, or empty if the server logs none
+	Thread        uint32                 `protobuf:"varint,6,opt,name=thread,proto3" json:"thread,omitempty"`      // ID of the session that made the change, or 0 if unknown
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // when the rows event was logged, to the second
+	Snapshot      bool                   `protobuf:"varint,8,opt,name=snapshot,proto3" json:"snapshot,omitempty"`  // the change is a snapshot read
+	Query         []byte                 `protobuf:"bytes,9,opt,name=query,proto3" json:"query,omitempty"`         // the statement that made the change, if logged
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Source) Reset() {
+	*x = Source{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Source) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Source) ProtoMessage() {}
+
+func (x *Source) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Source.ProtoReflect.Descriptor instead.
+func (*Source) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Source) GetServerId() uint32 {
+	if x != nil {
+		return x.ServerId
+	}
+	return 0
+}
+
+func (x *Source) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *Source) GetPos() uint32 {
+	if x != nil {
+		return x.Pos
+	}
+	return 0
+}
+
+func (x *Source) GetRow() uint32 {
+	if x != nil {
+		return x.Row
+	}
+	return 0
+}
+
+func (x *Source) GetGtid() string {
+	if x != nil {
+		return x.Gtid
+	}
+	return ""
+}
+
+func (x *Source) GetThread() uint32 {
+	if x != nil {
+		return x.Thread
+	}
+	return 0
+}
+
+func (x *Source) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Source) GetSnapshot() bool {
+	if x != nil {
+		return x.Snapshot
+	}
+	return false
+}
+
+func (x *Source) GetQuery() []byte {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+type Table struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Database      string                 `protobuf:"bytes,1,opt,name=database,proto3" json:"database,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	TableId       uint64                 `protobuf:"varint,3,opt,name=table_id,json=tableId,proto3" json:"table_id,omitempty"` // of the table map the rows were logged with
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Table) Reset() {
+	*x = Table{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Table) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Table) ProtoMessage() {}
+
+func (x *Table) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Table.ProtoReflect.Descriptor instead.
+func (*Table) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Table) GetDatabase() string {
+	if x != nil {
+		return x.Database
+	}
+	return ""
+}
+
+func (x *Table) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Table) GetTableId() uint64 {
+	if x != nil {
+		return x.TableId
+	}
+	return 0
+}
+
+type Transaction struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`              // its GTID, or file:pos of its BEGIN if it has none
+	Sequence      uint64                 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"` // of the change in the transaction, from 1
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Transaction) Reset() {
+	*x = Transaction{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Transaction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transaction) ProtoMessage() {}
+
+func (x *Transaction) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transaction.ProtoReflect.Descriptor instead.
+func (*Transaction) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Transaction) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Transaction) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+// An image of a row. Columns the server left out of the image are left out.
+type Row struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Columns       []*Column              `protobuf:"bytes,1,rep,name=columns,proto3" json:"columns,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Row) Reset() {
+	*x = Row{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Row) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Row) ProtoMessage() {}
+
+func (x *Row) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Row.ProtoReflect.Descriptor instead.
+func (*Row) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Row) GetColumns() []*Column {
+	if x != nil {
+		return x.Columns
+	}
+	return nil
+}
+
+type Column struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         uint32                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"` // of the column in the table, from 0
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`    // or @1, @2 and so on if unknown
+	Type          uint32                 `protobuf:"varint,3,opt,name=type,proto3" json:"type,omitempty"`   // binlog column type (MYSQL_TYPE_*), with the real type of MYSQL_TYPE_STRING columns
+	Value         *Value                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Column) Reset() {
+	*x = Column{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Column) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Column) ProtoMessage() {}
+
+func (x *Column) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Column.ProtoReflect.Descriptor instead.
+func (*Column) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Column) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Column) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Column) GetType() uint32 {
+	if x != nil {
+		return x.Type
+	}
+	return 0
+}
+
+func (x *Column) GetValue() *Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+// A column value, by its binlog.ValueKind.
+type Value struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Kind:
+	//
+	//	*Value_NullValue
+	//	*Value_IntValue
+	//	*Value_UintValue
+	//	*Value_FloatValue
+	//	*Value_DecimalValue
+	//	*Value_TimeValue
+	//	*Value_ZeroDateValue
+	//	*Value_DurationValue
+	//	*Value_StringValue
+	//	*Value_BytesValue
+	//	*Value_JsonValue
+	//	*Value_JsonDiffsValue
+	//	*Value_SetValue
+	Kind          isValue_Kind `protobuf_oneof:"kind"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Value) Reset() {
+	*x = Value{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Value) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Value) ProtoMessage() {}
+
+func (x *Value) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Value.ProtoReflect.Descriptor instead.
+func (*Value) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Value) GetKind() isValue_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return nil
+}
+
+func (x *Value) GetNullValue() structpb.NullValue {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_NullValue); ok {
+			return x.NullValue
+		}
+	}
+	return structpb.NullValue(0)
+}
+
+func (x *Value) GetIntValue() int64 {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_IntValue); ok {
+			return x.IntValue
+		}
+	}
+	return 0
+}
+
+func (x *Value) GetUintValue() uint64 {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_UintValue); ok {
+			return x.UintValue
+		}
+	}
+	return 0
+}
+
+func (x *Value) GetFloatValue() float64 {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_FloatValue); ok {
+			return x.FloatValue
+		}
+	}
+	return 0
+}
+
+func (x *Value) GetDecimalValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_DecimalValue); ok {
+			return x.DecimalValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetTimeValue() *timestamppb.Timestamp {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_TimeValue); ok {
+			return x.TimeValue
+		}
+	}
+	return nil
+}
+
+func (x *Value) GetZeroDateValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_ZeroDateValue); ok {
+			return x.ZeroDateValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetDurationValue() *durationpb.Duration {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_DurationValue); ok {
+			return x.DurationValue
+		}
+	}
+	return nil
+}
+
+func (x *Value) GetStringValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_StringValue); ok {
+			return x.StringValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetBytesValue() []byte {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_BytesValue); ok {
+			return x.BytesValue
+		}
+	}
+	return nil
+}
+
+func (x *Value) GetJsonValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_JsonValue); ok {
+			return x.JsonValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetJsonDiffsValue() *JsonDiffs {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_JsonDiffsValue); ok {
+			return x.JsonDiffsValue
+		}
+	}
+	return nil
+}
+
+func (x *Value) GetSetValue() *Labels {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_SetValue); ok {
+			return x.SetValue
+		}
+	}
+	return nil
+}
+
+type isValue_Kind interface {
+	isValue_Kind()
+}
+
+type Value_NullValue struct {
+	NullValue structpb.NullValue `protobuf:"varint,1,opt,name=null_value,json=nullValue,proto3,enum=google.protobuf.NullValue,oneof"`
+}
+
+type Value_IntValue struct {
+	IntValue int64 `protobuf:"zigzag64,2,opt,name=int_value,json=intValue,proto3,oneof"` // signed integers and YEAR
+}
+
+type Value_UintValue struct {
+	UintValue uint64 `protobuf:"varint,3,opt,name=uint_value,json=uintValue,proto3,oneof"` // unsigned integers, BIT, and ENUM and SET indexes
+}
+
+type Value_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,4,opt,name=float_value,json=floatValue,proto3,oneof"` // FLOAT and DOUBLE
+}
+
+type Value_DecimalValue struct {
+	DecimalValue string `protobuf:"bytes,5,opt,name=decimal_value,json=decimalValue,proto3,oneof"` // DECIMAL, as exact as it was parsed
+}
+
+type Value_TimeValue struct {
+	TimeValue *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=time_value,json=timeValue,proto3,oneof"` // DATE, DATETIME as UTC wall clock times, and TIMESTAMP
+}
+
+type Value_ZeroDateValue struct {
+	ZeroDateValue string `protobuf:"bytes,7,opt,name=zero_date_value,json=zeroDateValue,proto3,oneof"` // DATE, DATETIME and TIMESTAMP values that aren't times, as MySQL prints them
+}
+
+type Value_DurationValue struct {
+	DurationValue *durationpb.Duration `protobuf:"bytes,8,opt,name=duration_value,json=durationValue,proto3,oneof"` // TIME
+}
+
+type Value_StringValue struct {
+	StringValue string `protobuf:"bytes,9,opt,name=string_value,json=stringValue,proto3,oneof"` // text, and ENUM labels
+}
+
+type Value_BytesValue struct {
+	BytesValue []byte `protobuf:"bytes,10,opt,name=bytes_value,json=bytesValue,proto3,oneof"` // binary strings and GEOMETRY
+}
+
+type Value_JsonValue struct {
+	JsonValue string `protobuf:"bytes,11,opt,name=json_value,json=jsonValue,proto3,oneof"` // JSON documents
+}
+
+type Value_JsonDiffsValue struct {
+	JsonDiffsValue *JsonDiffs `protobuf:"bytes,12,opt,name=json_diffs_value,json=jsonDiffsValue,proto3,oneof"` // partial JSON updates
+}
+
+type Value_SetValue struct {
+	SetValue *Labels `protobuf:"bytes,13,opt,name=set_value,json=setValue,proto3,oneof"` // SET labels
+}
+
+func (*Value_NullValue) isValue_Kind() {}
+
+func (*Value_IntValue) isValue_Kind() {}
+
+func (*Value_UintValue) isValue_Kind() {}
+
+func (*Value_FloatValue) isValue_Kind() {}
+
+func (*Value_DecimalValue) isValue_Kind() {}
+
+func (*Value_TimeValue) isValue_Kind() {}
+
+func (*Value_ZeroDateValue) isValue_Kind() {}
+
+func (*Value_DurationValue) isValue_Kind() {}
+
+func (*Value_StringValue) isValue_Kind() {}
+
+func (*Value_BytesValue) isValue_Kind() {}
+
+func (*Value_JsonValue) isValue_Kind() {}
+
+func (*Value_JsonDiffsValue) isValue_Kind() {}
+
+func (*Value_SetValue) isValue_Kind() {}
+
+type JsonDiffs struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Diffs         []*JsonDiff            `protobuf:"bytes,1,rep,name=diffs,proto3" json:"diffs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JsonDiffs) Reset() {
+	*x = JsonDiffs{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JsonDiffs) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JsonDiffs) ProtoMessage() {}
+
+func (x *JsonDiffs) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JsonDiffs.ProtoReflect.Descriptor instead.
+func (*JsonDiffs) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *JsonDiffs) GetDiffs() []*JsonDiff {
+	if x != nil {
+		return x.Diffs
+	}
+	return nil
+}
+
+type JsonDiff struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     JsonDiff_Operation     `protobuf:"varint,1,opt,name=operation,proto3,enum=autobahn.binlog.JsonDiff_Operation" json:"operation,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"` // JSON text; empty for REMOVE
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JsonDiff) Reset() {
+	*x = JsonDiff{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JsonDiff) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JsonDiff) ProtoMessage() {}
+
+func (x *JsonDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JsonDiff.ProtoReflect.Descriptor instead.
+func (*JsonDiff) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *JsonDiff) GetOperation() JsonDiff_Operation {
+	if x != nil {
+		return x.Operation
+	}
+	return JsonDiff_REPLACE
+}
+
+func (x *JsonDiff) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *JsonDiff) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type Labels struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Labels        []string               `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Labels) Reset() {
+	*x = Labels{}
+	mi := &file_binlogpb_changeevent_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Labels) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Labels) ProtoMessage() {}
+
+func (x *Labels) ProtoReflect() protoreflect.Message {
+	mi := &file_binlogpb_changeevent_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Labels.ProtoReflect.Descriptor instead.
+func (*Labels) Descriptor() ([]byte, []int) {
+	return file_binlogpb_changeevent_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Labels) GetLabels() []string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+var File_binlogpb_changeevent_proto protoreflect.FileDescriptor
+
+const file_binlogpb_changeevent_proto_rawDesc = "" +
+	"\n" +
+	"\x1abinlogpb/changeevent.proto\x12\x0fautobahn.binlog\x1a\x1egoogle/protobuf/duration.proto\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd3\x02\n" +
+	"\vChangeEvent\x12/\n" +
+	"\x06source\x18\x01 \x01(\v2\x17.autobahn.binlog.SourceR\x06source\x12,\n" +
+	"\x05table\x18\x02 \x01(\v2\x16.autobahn.binlog.TableR\x05table\x12#\n" +
+	"\x02op\x18\x03 \x01(\x0e2\x13.autobahn.binlog.OpR\x02op\x12,\n" +
+	"\x06before\x18\x04 \x01(\v2\x14.autobahn.binlog.RowR\x06before\x12*\n" +
+	"\x05after\x18\x05 \x01(\v2\x14.autobahn.binlog.RowR\x05after\x12&\n" +
+	"\x03key\x18\x06 \x01(\v2\x14.autobahn.binlog.RowR\x03key\x12>\n" +
+	"\vtransaction\x18\a \x01(\v2\x1c.autobahn.binlog.TransactionR\vtransaction\"\xf5\x01\n" +
+	"\x06Source\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\rR\bserverId\x12\x12\n" +
+	"\x04file\x18\x02 \x01(\tR\x04file\x12\x10\n" +
+	"\x03pos\x18\x03 \x01(\rR\x03pos\x12\x10\n" +
+	"\x03row\x18\x04 \x01(\rR\x03row\x12\x12\n" +
+	"\x04gtid\x18\x05 \x01(\tR\x04gtid\x12\x16\n" +
+	"\x06thread\x18\x06 \x01(\rR\x06thread\x128\n" +
+	"\ttimestamp\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1a\n" +
+	"\bsnapshot\x18\b \x01(\bR\bsnapshot\x12\x14\n" +
+	"\x05query\x18\t \x01(\fR\x05query\"R\n" +
+	"\x05Table\x12\x1a\n" +
+	"\bdatabase\x18\x01 \x01(\tR\bdatabase\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x19\n" +
+	"\btable_id\x18\x03 \x01(\x04R\atableId\"9\n" +
+	"\vTransaction\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x04R\bsequence\"8\n" +
+	"\x03Row\x121\n" +
+	"\acolumns\x18\x01 \x03(\v2\x17.autobahn.binlog.ColumnR\acolumns\"t\n" +
+	"\x06Column\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\rR\x04type\x12,\n" +
+	"\x05value\x18\x04 \x01(\v2\x16.autobahn.binlog.ValueR\x05value\"\xea\x04\n" +
+	"\x05Value\x12;\n" +
+	"\n" +
+	"null_value\x18\x01 \x01(\x0e2\x1a.google.protobuf.NullValueH\x00R\tnullValue\x12\x1d\n" +
+	"\tint_value\x18\x02 \x01(\x12H\x00R\bintValue\x12\x1f\n" +
+	"\n" +
+	"uint_value\x18\x03 \x01(\x04H\x00R\tuintValue\x12!\n" +
+	"\vfloat_value\x18\x04 \x01(\x01H\x00R\n" +
+	"floatValue\x12%\n" +
+	"\rdecimal_value\x18\x05 \x01(\tH\x00R\fdecimalValue\x12;\n" +
+	"\n" +
+	"time_value\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampH\x00R\ttimeValue\x12(\n" +
+	"\x0fzero_date_value\x18\a \x01(\tH\x00R\rzeroDateValue\x12B\n" +
+	"\x0eduration_value\x18\b \x01(\v2\x19.google.protobuf.DurationH\x00R\rdurationValue\x12#\n" +
+	"\fstring_value\x18\t \x01(\tH\x00R\vstringValue\x12!\n" +
+	"\vbytes_value\x18\n" +
+	" \x01(\fH\x00R\n" +
+	"bytesValue\x12\x1f\n" +
+	"\n" +
+	"json_value\x18\v \x01(\tH\x00R\tjsonValue\x12F\n" +
+	"\x10json_diffs_value\x18\f \x01(\v2\x1a.autobahn.binlog.JsonDiffsH\x00R\x0ejsonDiffsValue\x126\n" +
+	"\tset_value\x18\r \x01(\v2\x17.autobahn.binlog.LabelsH\x00R\bsetValueB\x06\n" +
+	"\x04kind\"<\n" +
+	"\tJsonDiffs\x12/\n" +
+	"\x05diffs\x18\x01 \x03(\v2\x19.autobahn.binlog.JsonDiffR\x05diffs\"\xa9\x01\n" +
+	"\bJsonDiff\x12A\n" +
+	"\toperation\x18\x01 \x01(\x0e2#.autobahn.binlog.JsonDiff.OperationR\toperation\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\"0\n" +
+	"\tOperation\x12\v\n" +
+	"\aREPLACE\x10\x00\x12\n" +
+	"\n" +
+	"\x06INSERT\x10\x01\x12\n" +
+	"\n" +
+	"\x06REMOVE\x10\x02\" \n" +
+	"\x06Labels\x12\x16\n" +
+	"\x06labels\x18\x01 \x03(\tR\x06labels*R\n" +
+	"\x02Op\x12\x12\n" +
+	"\x0eOP_UNSPECIFIED\x10\x00\x12\r\n" +
+	"\tOP_CREATE\x10\x01\x12\r\n" +
+	"\tOP_UPDATE\x10\x02\x12\r\n" +
+	"\tOP_DELETE\x10\x03\x12\v\n" +
+	"\aOP_READ\x10\x04B*Z(github.com/vsco/autobahn-binlog/binlogpbb\x06proto3"
+
+var (
+	file_binlogpb_changeevent_proto_rawDescOnce sync.Once
+	file_binlogpb_changeevent_proto_rawDescData []byte
+)
+
+func file_binlogpb_changeevent_proto_rawDescGZIP() []byte {
+	file_binlogpb_changeevent_proto_rawDescOnce.Do(func() {
+		file_binlogpb_changeevent_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_binlogpb_changeevent_proto_rawDesc), len(file_binlogpb_changeevent_proto_rawDesc)))
+	})
+	return file_binlogpb_changeevent_proto_rawDescData
+}
+
+var file_binlogpb_changeevent_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_binlogpb_changeevent_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_binlogpb_changeevent_proto_goTypes = []any{
+	(Op)(0),                       // 0: autobahn.binlog.Op
+	(JsonDiff_Operation)(0),       // 1: autobahn.binlog.JsonDiff.Operation
+	(*ChangeEvent)(nil),           // 2: autobahn.binlog.ChangeEvent
+	(*Source)(nil),                // 3: autobahn.binlog.Source
+	(*Table)(nil),                 // 4: autobahn.binlog.Table
+	(*Transaction)(nil),           // 5: autobahn.binlog.Transaction
+	(*Row)(nil),                   // 6: autobahn.binlog.Row
+	(*Column)(nil),                // 7: autobahn.binlog.Column
+	(*Value)(nil),                 // 8: autobahn.binlog.Value
+	(*JsonDiffs)(nil),             // 9: autobahn.binlog.JsonDiffs
+	(*JsonDiff)(nil),              // 10: autobahn.binlog.JsonDiff
+	(*Labels)(nil),                // 11: autobahn.binlog.Labels
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+	(structpb.NullValue)(0),       // 13: google.protobuf.NullValue
+	(*durationpb.Duration)(nil),   // 14: google.protobuf.Duration
+}
+var file_binlogpb_changeevent_proto_depIdxs = []int32{
+	3,  // 0: autobahn.binlog.ChangeEvent.source:type_name -> autobahn.binlog.Source
+	4,  // 1: autobahn.binlog.ChangeEvent.table:type_name -> autobahn.binlog.Table
+	0,  // 2: autobahn.binlog.ChangeEvent.op:type_name -> autobahn.binlog.Op
+	6,  // 3: autobahn.binlog.ChangeEvent.before:type_name -> autobahn.binlog.Row
+	6,  // 4: autobahn.binlog.ChangeEvent.after:type_name -> autobahn.binlog.Row
+	6,  // 5: autobahn.binlog.ChangeEvent.key:type_name -> autobahn.binlog.Row
+	5,  // 6: autobahn.binlog.ChangeEvent.transaction:type_name -> autobahn.binlog.Transaction
+	12, // 7: autobahn.binlog.Source.timestamp:type_name -> google.protobuf.Timestamp
+	7,  // 8: autobahn.binlog.Row.columns:type_name -> autobahn.binlog.Column
+	8,  // 9: autobahn.binlog.Column.value:type_name -> autobahn.binlog.Value
+	13, // 10: autobahn.binlog.Value.null_value:type_name -> google.protobuf.NullValue
+	12, // 11: autobahn.binlog.Value.time_value:type_name -> google.protobuf.Timestamp
+	14, // 12: autobahn.binlog.Value.duration_value:type_name -> google.protobuf.Duration
+	9,  // 13: autobahn.binlog.Value.json_diffs_value:type_name -> autobahn.binlog.JsonDiffs
+	11, // 14: autobahn.binlog.Value.set_value:type_name -> autobahn.binlog.Labels
+	10, // 15: autobahn.binlog.JsonDiffs.diffs:type_name -> autobahn.binlog.JsonDiff
+	1,  // 16: autobahn.binlog.JsonDiff.operation:type_name -> autobahn.binlog.JsonDiff.Operation
+	17, // [17:17] is the sub-list for method output_type
+	17, // [17:17] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
+}
+
+func init() { file_binlogpb_changeevent_proto_init() }
+func file_binlogpb_changeevent_proto_init() {
+	if File_binlogpb_changeevent_proto != nil {
+		return
+	}
+	file_binlogpb_changeevent_proto_msgTypes[6].OneofWrappers = []any{
+		(*Value_NullValue)(nil),
+		(*Value_IntValue)(nil),
+		(*Value_UintValue)(nil),
+		(*Value_FloatValue)(nil),
+		(*Value_DecimalValue)(nil),
+		(*Value_TimeValue)(nil),
+		(*Value_ZeroDateValue)(nil),
+		(*Value_DurationValue)(nil),
+		(*Value_StringValue)(nil),
+		(*Value_BytesValue)(nil),
+		(*Value_JsonValue)(nil),
+		(*Value_JsonDiffsValue)(nil),
+		(*Value_SetValue)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_binlogpb_changeevent_proto_rawDesc), len(file_binlogpb_changeevent_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_binlogpb_changeevent_proto_goTypes,
+		DependencyIndexes: file_binlogpb_changeevent_proto_depIdxs,
+		EnumInfos:         file_binlogpb_changeevent_proto_enumTypes,
+		MessageInfos:      file_binlogpb_changeevent_proto_msgTypes,
+	}.Build()
+	File_binlogpb_changeevent_proto = out.File
+	file_binlogpb_changeevent_proto_goTypes = nil
+	file_binlogpb_changeevent_proto_depIdxs = nil
+}
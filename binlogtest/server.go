@@ -0,0 +1,1153 @@
+// Package binlogtest provides an in-process fake MySQL leader for testing code
+// that replicates with package binlog, without a live MySQL server.
+//
+// A Server speaks the handshake and text protocol, answers the queries a
+// Follower sends, accepts COM_REGISTER_SLAVE and COM_BINLOG_DUMP, and streams
+// scripted or file-backed binlog events. Faults such as dropped connections,
+// ERR packets, fragmented writes and semi-sync headers can be injected into
+// the stream.
+package binlogtest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultServerVersion is the version a Server reports in its handshake.
+const DefaultServerVersion = "5.5.34-binlogtest"
+
+// MariaDBServerVersion is a version to report to act as a MariaDB leader.
+const MariaDBServerVersion = "5.5.5-10.4.12-MariaDB-binlogtest"
+
+// Protocol constants, mirroring those in package binlog.
+const (
+	comQuit          byte = 0x01
+	comQuery         byte = 0x03
+	comPing          byte = 0x0e
+	comBinlogDump    byte = 0x12
+	comRegisterSlave byte = 0x15
+
+	okHeader  byte = 0x00
+	eofHeader byte = 0xfe
+	errHeader byte = 0xff
+
+	semiSyncIndicator byte = 0xef
+
+	clientLongPassword     uint32 = 0x00000001
+	clientLongFlag         uint32 = 0x00000004
+	clientConnectWithDB    uint32 = 0x00000008
+	clientProtocol41       uint32 = 0x00000200
+	clientTransactions     uint32 = 0x00002000
+	clientSecureConnection uint32 = 0x00008000
+	clientPluginAuth       uint32 = 0x00080000
+
+	serverCapabilities = clientLongPassword | clientLongFlag | clientConnectWithDB | clientProtocol41 |
+		clientTransactions | clientSecureConnection | clientPluginAuth
+
+	maxPayloadLength = 1<<24 - 1
+	eventHeaderSize  = 19
+	binlogMagic      = "\xfebin"
+
+	rotateEventType            byte   = 0x04
+	formatDescriptionEventType byte   = 0x0f
+	xidEventType               byte   = 0x10
+	annotateRowsEventType      byte   = 0xa0
+	mariadbGtidEventType       byte   = 0xa2
+	artificialEventFlag        uint16 = 0x0020
+	sendAnnotateRowsEventFlag  uint16 = 0x0002
+)
+
+// Server error codes used by the fake leader.
+const (
+	ErrAccessDenied            uint16 = 1045
+	ErrUnknownCommand          uint16 = 1047
+	ErrUnknownQuery            uint16 = 1105
+	ErrFatalErrorReadingBinlog uint16 = 1236
+)
+
+// A Result is a text-protocol result set returned for a query. Values are
+// sent using fmt.Sprint; nil values are sent as NULL.
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// An Error is sent as an ERR packet.
+type Error struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ERROR %d (%s): %s", e.Code, e.State, e.Message)
+}
+
+// A Registration records a COM_REGISTER_SLAVE command.
+type Registration struct {
+	ServerID uint32
+	Hostname string
+	User     string
+	Password string
+	Port     uint16
+	MasterID uint32
+}
+
+// A Dump records a COM_BINLOG_DUMP command.
+type Dump struct {
+	File     string
+	Pos      uint32
+	Flags    uint16
+	ServerID uint32
+
+	// UserVariables are the user variables the replica had set, without the
+	// leading @.
+	UserVariables map[string]string
+}
+
+// An Ack records a semi-sync acknowledgement sent by a replica.
+type Ack struct {
+	File string
+	Pos  uint64
+}
+
+// FaultAction says what a Fault does to the binlog stream.
+type FaultAction int
+
+const (
+	// Disconnect closes the connection instead of sending the event.
+	Disconnect FaultAction = iota
+	// SendError sends an ERR packet instead of the event and ends the stream.
+	SendError
+	// SkipEvent silently leaves the event out of the stream.
+	SkipEvent
+	// SendTruncated sends the event with its last byte missing.
+	SendTruncated
+	// SendSplit pads the event with zeros, fixing up its size, until its
+	// packet fills two maximum-size protocol packets. It's sent as those and
+	// the empty packet that ends a packet of such a size, so the replica has to
+	// put it back together.
+	SendSplit
+)
+
+// A Fault disrupts a binlog stream once AfterEvents events have been sent on
+// it, not counting the artificial rotate event every stream starts with. Each
+// fault fires once, on the first stream that reaches it.
+type Fault struct {
+	AfterEvents int
+	Action      FaultAction
+	Err         *Error // sent by SendError
+}
+
+// A binlogFile is a named sequence of events, each at a file offset.
+type binlogFile struct {
+	name    string
+	events  [][]byte
+	offsets []uint32
+	size    uint32
+}
+
+func (f *binlogFile) add(event []byte) {
+	f.events = append(f.events, event)
+	f.offsets = append(f.offsets, f.size)
+	f.size = f.size + uint32(len(event))
+}
+
+// Server is a fake MySQL leader listening on a local TCP port.
+type Server struct {
+	// User and Password, when set, are required to log in.
+	User     string
+	Password string
+	// Variables answer SHOW VARIABLES queries. Names are lower case.
+	Variables map[string]string
+	// SemiSync makes the stream carry semi-sync headers for replicas that
+	// set @rpl_semi_sync_slave = 1, asking for an ack after every XID event.
+	SemiSync bool
+	// WriteChunkSize, when positive, splits every network write into chunks of
+	// that many bytes, exercising the client's handling of partial reads.
+	WriteChunkSize int
+
+	version string // reported in the handshake
+
+	l      net.Listener
+	m      sync.Mutex
+	wg     sync.WaitGroup
+	closed chan struct{}
+	conns  map[net.Conn]bool
+
+	queries  map[string]interface{} // *Result or *Error
+	files    []*binlogFile
+	changed  chan struct{}
+	faults   []Fault
+	nextConn uint32
+
+	registrations []Registration
+	dumps         []Dump
+	acks          []Ack
+	queryLog      []string
+}
+
+// NewServer starts a Server on a random local port. It holds one empty binlog
+// file, mysql-bin.000001.
+func NewServer() (*Server, error) {
+	return NewServerWithVersion(DefaultServerVersion)
+}
+
+// NewServerWithVersion starts a Server as NewServer does, reporting version in
+// its handshake; MariaDBServerVersion makes it act as a MariaDB leader.
+func NewServerWithVersion(version string) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		version: version,
+		Variables: map[string]string{
+			"server_id":       "1",
+			"log_bin":         "ON",
+			"binlog_format":   "ROW",
+			"binlog_checksum": "CRC32",
+		},
+		l:       l,
+		closed:  make(chan struct{}),
+		conns:   make(map[net.Conn]bool),
+		queries: make(map[string]interface{}),
+		changed: make(chan struct{}),
+		files:   []*binlogFile{newBinlogFile("mysql-bin.000001")},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+func newBinlogFile(name string) *binlogFile {
+	return &binlogFile{name: name, size: uint32(len(binlogMagic))}
+}
+
+// Host returns the host the Server listens on.
+func (s *Server) Host() string {
+	return s.l.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the Server listens on.
+func (s *Server) Port() uint16 {
+	return uint16(s.l.Addr().(*net.TCPAddr).Port)
+}
+
+// Close stops the Server and closes all of its connections.
+func (s *Server) Close() error {
+	s.m.Lock()
+	select {
+	case <-s.closed:
+		s.m.Unlock()
+		return nil
+	default:
+	}
+	close(s.closed)
+	err := s.l.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.m.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// HandleQuery makes the Server answer query with r. Queries are matched
+// case-insensitively, ignoring surrounding whitespace, and take precedence over
+// the queries the Server answers on its own.
+func (s *Server) HandleQuery(query string, r *Result) {
+	s.m.Lock()
+	s.queries[normalizeQuery(query)] = r
+	s.m.Unlock()
+}
+
+// HandleQueryError makes the Server answer query with an ERR packet.
+func (s *Server) HandleQueryError(query string, e *Error) {
+	s.m.Lock()
+	s.queries[normalizeQuery(query)] = e
+	s.m.Unlock()
+}
+
+// AddEvents appends raw events (header included) to the current binlog file.
+// Replicas that are streaming receive them right away.
+func (s *Server) AddEvents(events ...[]byte) {
+	s.m.Lock()
+	f := s.files[len(s.files)-1]
+	for _, e := range events {
+		f.add(e)
+	}
+	s.notifyLocked()
+	s.m.Unlock()
+}
+
+// Rotate ends the current binlog file with a rotate event and starts a new
+// file with the given name.
+func (s *Server) Rotate(name string) {
+	s.m.Lock()
+	f := s.files[len(s.files)-1]
+	f.add(RotateEvent(name, 4, f.size))
+	s.files = append(s.files, newBinlogFile(name))
+	s.notifyLocked()
+	s.m.Unlock()
+}
+
+// LoadBinlogFile reads a binary log written by MySQL and appends it, under
+// its base name, to the files the Server serves. It becomes the current file.
+func (s *Server) LoadBinlogFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := parseBinlogFile(filepath.Base(path), data)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	if cur := s.files[len(s.files)-1]; len(cur.events) == 0 {
+		s.files[len(s.files)-1] = f
+	} else {
+		s.files = append(s.files, f)
+	}
+	s.notifyLocked()
+	s.m.Unlock()
+
+	return nil
+}
+
+func parseBinlogFile(name string, data []byte) (*binlogFile, error) {
+	if !bytes.HasPrefix(data, []byte(binlogMagic)) {
+		return nil, fmt.Errorf("%s is not a binary log", name)
+	}
+
+	f := newBinlogFile(name)
+	for i := len(binlogMagic); i < len(data); {
+		if len(data)-i < eventHeaderSize {
+			return nil, fmt.Errorf("%s: truncated event header at offset %d", name, i)
+		}
+
+		size := int(binary.LittleEndian.Uint32(data[i+9:]))
+		if size < eventHeaderSize || len(data)-i < size {
+			return nil, fmt.Errorf("%s: invalid event size %d at offset %d", name, size, i)
+		}
+
+		f.add(data[i : i+size])
+		i = i + size
+	}
+
+	return f, nil
+}
+
+// PurgeBinaryLogs removes all binlog files before the named one, like PURGE
+// BINARY LOGS TO.
+func (s *Server) PurgeBinaryLogs(to string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for i, f := range s.files {
+		if f.name == to {
+			s.files = s.files[i:]
+			return
+		}
+	}
+}
+
+// InjectFault schedules a fault on the next binlog stream that reaches it.
+func (s *Server) InjectFault(f Fault) {
+	s.m.Lock()
+	s.faults = append(s.faults, f)
+	s.m.Unlock()
+}
+
+// Registrations returns the COM_REGISTER_SLAVE commands received so far.
+func (s *Server) Registrations() []Registration {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]Registration(nil), s.registrations...)
+}
+
+// Dumps returns the COM_BINLOG_DUMP commands received so far.
+func (s *Server) Dumps() []Dump {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]Dump(nil), s.dumps...)
+}
+
+// Acks returns the semi-sync acknowledgements received so far.
+func (s *Server) Acks() []Ack {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]Ack(nil), s.acks...)
+}
+
+// Queries returns the queries received so far, in order.
+func (s *Server) Queries() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]string(nil), s.queryLog...)
+}
+
+// notifyLocked wakes up streams waiting for new events.
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.m.Lock()
+		s.conns[c] = true
+		s.nextConn++
+		id := s.nextConn
+		s.m.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			sc := &serverConn{s: s, c: c, id: id, vars: make(map[string]string)}
+			sc.run()
+
+			c.Close()
+			s.m.Lock()
+			delete(s.conns, c)
+			s.m.Unlock()
+		}()
+	}
+}
+
+// A serverConn is one client connection to the Server.
+type serverConn struct {
+	s    *Server
+	c    net.Conn
+	id   uint32
+	seq  uint8
+	salt []byte
+	vars map[string]string // user variables set by the client
+}
+
+func (c *serverConn) run() {
+	if err := c.handshake(); err != nil {
+		return
+	}
+
+	for {
+		c.seq = 0
+		b, err := c.readPacket()
+		if err != nil {
+			return
+		}
+
+		switch b[0] {
+		case comQuit:
+			return
+		case comPing:
+			err = c.writeOK()
+		case comQuery:
+			err = c.handleQuery(string(b[1:]))
+		case comRegisterSlave:
+			err = c.handleRegister(b[1:])
+		case comBinlogDump:
+			c.handleDump(b[1:])
+			return
+		default:
+			err = c.writeError(&Error{ErrUnknownCommand, "08S01", "Unknown command"})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *serverConn) handshake() error {
+	c.salt = []byte("0123456789abcdefghij")
+
+	var b bytes.Buffer
+	b.WriteByte(10) // protocol version
+	b.WriteString(c.s.version)
+	b.WriteByte(0)
+	binary.Write(&b, binary.LittleEndian, c.id)
+	b.Write(c.salt[:8])
+	b.WriteByte(0)
+	binary.Write(&b, binary.LittleEndian, uint16(serverCapabilities&0xffff))
+	b.WriteByte(33)                                  // utf8_general_ci
+	binary.Write(&b, binary.LittleEndian, uint16(2)) // SERVER_STATUS_AUTOCOMMIT
+	binary.Write(&b, binary.LittleEndian, uint16(serverCapabilities>>16))
+	b.WriteByte(byte(len(c.salt) + 1))
+	b.Write(make([]byte, 10))
+	b.Write(c.salt[8:])
+	b.WriteByte(0)
+	b.WriteString("mysql_native_password")
+	b.WriteByte(0)
+
+	if err := c.writePacket(b.Bytes()); err != nil {
+		return err
+	}
+
+	resp, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	user, auth, err := parseHandshakeResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	if (c.s.User != "" && user != c.s.User) || !bytes.Equal(auth, scramble(c.salt, c.s.Password)) {
+		msg := fmt.Sprintf("Access denied for user '%s'@'localhost'", user)
+		c.writeError(&Error{ErrAccessDenied, "28000", msg})
+		return errors.New(msg)
+	}
+
+	return c.writeOK()
+}
+
+func parseHandshakeResponse(b []byte) (user string, auth []byte, err error) {
+	// capability (4), max packet size (4), charset (1), filler (23)
+	i := 4 + 4 + 1 + 23
+	if len(b) < i {
+		return "", nil, errors.New("short handshake response")
+	}
+
+	end := bytes.IndexByte(b[i:], 0)
+	if end < 0 {
+		return "", nil, errors.New("malformed handshake response")
+	}
+	user = string(b[i : i+end])
+	i = i + end + 1
+
+	if i >= len(b) {
+		return user, nil, nil
+	}
+	n := int(b[i])
+	i = i + 1
+	if len(b) < i+n {
+		return "", nil, errors.New("malformed handshake response")
+	}
+
+	return user, b[i : i+n], nil
+}
+
+// scramble computes the mysql_native_password response for password.
+func scramble(salt []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(stage2[:])
+	result := h.Sum(nil)
+
+	for i := range result {
+		result[i] ^= stage1[i]
+	}
+	return result
+}
+
+func (c *serverConn) handleQuery(query string) error {
+	s := c.s
+
+	s.m.Lock()
+	s.queryLog = append(s.queryLog, query)
+	answer, ok := s.queries[normalizeQuery(query)]
+	s.m.Unlock()
+
+	if ok {
+		switch a := answer.(type) {
+		case *Result:
+			return c.writeResult(a)
+		case *Error:
+			return c.writeError(a)
+		}
+	}
+
+	q := normalizeQuery(query)
+	switch {
+	case strings.HasPrefix(q, "set "):
+		c.setVariable(query[strings.Index(strings.ToLower(query), "set ")+4:])
+		return c.writeOK()
+	case strings.HasPrefix(q, "show global variables") || strings.HasPrefix(q, "show variables"):
+		return c.writeResult(s.showVariables(query))
+	case q == "show master status":
+		return c.writeResult(s.showMasterStatus())
+	case q == "show binary logs" || q == "show master logs":
+		return c.writeResult(s.showBinaryLogs())
+	default:
+		return c.writeError(&Error{ErrUnknownQuery, "HY000", fmt.Sprintf("binlogtest: no answer for query %q", query)})
+	}
+}
+
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.TrimSpace(query))
+}
+
+// setVariable records a user variable set with SET @name = value.
+func (c *serverConn) setVariable(assignment string) {
+	i := strings.IndexByte(assignment, '=')
+	if i < 0 {
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(assignment[:i]))
+	value := strings.Trim(strings.TrimSpace(assignment[i+1:]), `'"`)
+	c.vars[strings.TrimPrefix(name, "@")] = value
+}
+
+// showVariables answers SHOW VARIABLES LIKE 'name' and SHOW VARIABLES WHERE
+// Variable_name IN ('a', 'b'). LIKE patterns are matched literally.
+func (s *Server) showVariables(query string) *Result {
+	var names []string
+	parts := strings.Split(query, "'")
+	for i := 1; i < len(parts); i += 2 {
+		names = append(names, strings.ToLower(parts[i]))
+	}
+
+	r := &Result{Columns: []string{"Variable_name", "Value"}}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, name := range names {
+		if v, ok := s.Variables[name]; ok {
+			r.Rows = append(r.Rows, []interface{}{name, v})
+		}
+	}
+
+	return r
+}
+
+func (s *Server) showMasterStatus() *Result {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f := s.files[len(s.files)-1]
+	return &Result{
+		Columns: []string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"},
+		Rows:    [][]interface{}{{f.name, f.size, "", "", s.Variables["gtid_executed"]}},
+	}
+}
+
+func (s *Server) showBinaryLogs() *Result {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := &Result{Columns: []string{"Log_name", "File_size"}}
+	for _, f := range s.files {
+		r.Rows = append(r.Rows, []interface{}{f.name, f.size})
+	}
+	return r
+}
+
+func (c *serverConn) handleRegister(b []byte) error {
+	var r Registration
+	i := 0
+
+	read := func(n int) []byte {
+		if i+n > len(b) {
+			return nil
+		}
+		v := b[i : i+n]
+		i = i + n
+		return v
+	}
+	readString := func() string {
+		n := read(1)
+		if n == nil {
+			return ""
+		}
+		return string(read(int(n[0])))
+	}
+
+	if v := read(4); v != nil {
+		r.ServerID = binary.LittleEndian.Uint32(v)
+	}
+	r.Hostname = readString()
+	r.User = readString()
+	r.Password = readString()
+	if v := read(2); v != nil {
+		r.Port = binary.LittleEndian.Uint16(v)
+	}
+	read(4) // replication rank
+	if v := read(4); v != nil {
+		r.MasterID = binary.LittleEndian.Uint32(v)
+	}
+
+	c.s.m.Lock()
+	c.s.registrations = append(c.s.registrations, r)
+	c.s.m.Unlock()
+
+	return c.writeOK()
+}
+
+func (c *serverConn) handleDump(b []byte) {
+	if len(b) < 10 {
+		c.writeError(&Error{ErrFatalErrorReadingBinlog, "HY000", "malformed COM_BINLOG_DUMP"})
+		return
+	}
+
+	d := Dump{
+		Pos:           binary.LittleEndian.Uint32(b[0:4]),
+		Flags:         binary.LittleEndian.Uint16(b[4:6]),
+		ServerID:      binary.LittleEndian.Uint32(b[6:10]),
+		File:          string(b[10:]),
+		UserVariables: make(map[string]string),
+	}
+	for k, v := range c.vars {
+		d.UserVariables[k] = v
+	}
+
+	s := c.s
+	s.m.Lock()
+	s.dumps = append(s.dumps, d)
+	fileIndex := -1
+	for i, f := range s.files {
+		if f.name == d.File {
+			fileIndex = i
+		}
+	}
+	// Like MariaDB, a replica that sets a GTID connect state is streamed the
+	// whole binlog, less the transactions it has already seen.
+	if _, ok := c.vars["slave_connect_state"]; ok && d.File == "" {
+		fileIndex = 0
+		d.File = s.files[0].name
+	}
+	s.m.Unlock()
+
+	if fileIndex < 0 {
+		c.writeError(&Error{ErrFatalErrorReadingBinlog, "HY000",
+			"Could not find first log file name in binary log index file"})
+		return
+	}
+
+	c.stream(fileIndex, d)
+}
+
+// stream sends events from the given file and position onwards, then waits for
+// more until the connection or the Server is closed.
+func (c *serverConn) stream(fileIndex int, d Dump) {
+	s := c.s
+	semiSync := s.SemiSync && c.vars["rpl_semi_sync_slave"] == "1"
+	sent := 0
+
+	connectState := parseConnectState(c.vars["slave_connect_state"])
+	skipping := false
+
+	// Like MySQL, start with an artificial rotate event naming the file.
+	if err := c.sendEvent(RotateEvent(d.File, uint64(d.Pos), 0), false, false); err != nil {
+		return
+	}
+
+	eventIndex := 0
+	for {
+		s.m.Lock()
+		if fileIndex >= len(s.files) {
+			// The file was purged while we were streaming it.
+			s.m.Unlock()
+			return
+		}
+		f := s.files[fileIndex]
+		var event []byte
+		var offset uint32
+		if eventIndex < len(f.events) {
+			event = f.events[eventIndex]
+			offset = f.offsets[eventIndex]
+		}
+		hasNextFile := fileIndex+1 < len(s.files)
+		changed := s.changed
+		s.m.Unlock()
+
+		switch {
+		case event == nil && hasNextFile:
+			fileIndex++
+			eventIndex = 0
+			continue
+		case event == nil:
+			select {
+			case <-changed:
+				continue
+			case <-s.closed:
+				return
+			}
+		}
+
+		eventIndex++
+
+		// Skip events before the requested position, except the format
+		// description event, which the replica needs to parse the rest.
+		if offset < d.Pos && !(len(event) > 4 && event[4] == formatDescriptionEventType) {
+			continue
+		}
+
+		// Skip transactions up to the GTID connect state.
+		if len(connectState) > 0 && len(event) >= eventHeaderSize+12 && event[4] == mariadbGtidEventType {
+			seq := binary.LittleEndian.Uint64(event[eventHeaderSize:])
+			domain := binary.LittleEndian.Uint32(event[eventHeaderSize+8:])
+			last, ok := connectState[domain]
+			skipping = ok && seq <= last
+		}
+		if skipping && event[4] != formatDescriptionEventType {
+			continue
+		}
+
+		// Like MariaDB, only send ANNOTATE_ROWS events to replicas that ask.
+		if event[4] == annotateRowsEventType && d.Flags&sendAnnotateRowsEventFlag == 0 {
+			continue
+		}
+
+		if fault := s.takeFault(sent); fault != nil {
+			switch fault.Action {
+			case Disconnect:
+				return
+			case SendError:
+				c.writeError(fault.Err)
+				return
+			case SkipEvent:
+				sent++
+				continue
+			case SendTruncated:
+				event = event[:len(event)-1]
+			case SendSplit:
+				size := 2*maxPayloadLength - 1 // less the OK byte
+				if semiSync {
+					size -= 2
+				}
+				event = padEvent(event, size)
+			}
+		}
+
+		needAck := semiSync && len(event) > 4 && event[4] == xidEventType
+		if err := c.sendEvent(event, semiSync, needAck); err != nil {
+			return
+		}
+		sent++
+
+		if needAck {
+			c.readAck()
+		}
+	}
+}
+
+// takeFault removes and returns the first fault due once sent events have
+// been sent, or nil if none is.
+func (s *Server) takeFault(sent int) *Fault {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for i, f := range s.faults {
+		if f.AfterEvents <= sent {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			return &f
+		}
+	}
+	return nil
+}
+
+// padEvent returns a copy of an event with zeros added to its end, and its size
+// fixed up, to make it size bytes long.
+func padEvent(event []byte, size int) []byte {
+	padded := make([]byte, size)
+	copy(padded, event)
+	binary.LittleEndian.PutUint32(padded[9:], uint32(size))
+	return padded
+}
+
+// parseConnectState parses a MariaDB GTID list such as 0-1-100,1-2-7 into the
+// last sequence number of each domain.
+func parseConnectState(state string) map[uint32]uint64 {
+	m := make(map[uint32]uint64)
+	for _, gtid := range strings.Split(state, ",") {
+		parts := strings.Split(strings.TrimSpace(gtid), "-")
+		if len(parts) != 3 {
+			continue
+		}
+		domain, err1 := strconv.ParseUint(parts[0], 10, 32)
+		seq, err2 := strconv.ParseUint(parts[2], 10, 64)
+		if err1 == nil && err2 == nil {
+			m[uint32(domain)] = seq
+		}
+	}
+	return m
+}
+
+func (c *serverConn) sendEvent(event []byte, semiSync bool, needAck bool) error {
+	b := make([]byte, 0, len(event)+3)
+	b = append(b, okHeader)
+	if semiSync {
+		flag := byte(0)
+		if needAck {
+			flag = 1
+		}
+		b = append(b, semiSyncIndicator, flag)
+	}
+	b = append(b, event...)
+
+	return c.writePacket(b)
+}
+
+func (c *serverConn) readAck() {
+	c.c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c.c.SetReadDeadline(time.Time{})
+
+	seq := c.seq
+	b, err := c.readPacket()
+	c.seq = seq
+	if err != nil || len(b) < 9 || b[0] != semiSyncIndicator {
+		return
+	}
+
+	c.s.m.Lock()
+	c.s.acks = append(c.s.acks, Ack{Pos: binary.LittleEndian.Uint64(b[1:9]), File: string(b[9:])})
+	c.s.m.Unlock()
+}
+
+func (c *serverConn) writeOK() error {
+	// header, affected rows, last insert id, status flags, warnings
+	return c.writePacket([]byte{okHeader, 0, 0, 2, 0, 0, 0})
+}
+
+func (c *serverConn) writeEOF() error {
+	// header, warnings, status flags
+	return c.writePacket([]byte{eofHeader, 0, 0, 2, 0})
+}
+
+func (c *serverConn) writeError(e *Error) error {
+	state := e.State
+	if len(state) != 5 {
+		state = "HY000"
+	}
+
+	b := []byte{errHeader, byte(e.Code), byte(e.Code >> 8), '#'}
+	b = append(b, state...)
+	b = append(b, e.Message...)
+
+	return c.writePacket(b)
+}
+
+func (c *serverConn) writeResult(r *Result) error {
+	if err := c.writePacket(putLengthEncodedInt(uint64(len(r.Columns)))); err != nil {
+		return err
+	}
+
+	for _, name := range r.Columns {
+		var b []byte
+		for _, s := range []string{"def", "", "", "", name, name} {
+			b = appendLengthEncodedString(b, s)
+		}
+		b = append(b, 0x0c)       // length of the fixed-length fields
+		b = append(b, 33, 0)      // character set
+		b = append(b, 0, 1, 0, 0) // column length
+		b = append(b, 0xfd)       // MYSQL_TYPE_VAR_STRING
+		b = append(b, 0, 0)       // flags
+		b = append(b, 0)          // decimals
+		b = append(b, 0, 0)       // filler
+
+		if err := c.writePacket(b); err != nil {
+			return err
+		}
+	}
+
+	if err := c.writeEOF(); err != nil {
+		return err
+	}
+
+	for _, row := range r.Rows {
+		var b []byte
+		for _, v := range row {
+			if v == nil {
+				b = append(b, 0xfb)
+			} else {
+				b = appendLengthEncodedString(b, fmt.Sprint(v))
+			}
+		}
+
+		if err := c.writePacket(b); err != nil {
+			return err
+		}
+	}
+
+	return c.writeEOF()
+}
+
+func (c *serverConn) readPacket() ([]byte, error) {
+	var payload []byte
+	header := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(c.c, header); err != nil {
+			return nil, err
+		}
+
+		n := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c.c, b); err != nil {
+			return nil, err
+		}
+		payload = append(payload, b...)
+
+		if n < maxPayloadLength {
+			break
+		}
+	}
+
+	if len(payload) == 0 {
+		return nil, errors.New("empty packet")
+	}
+	return payload, nil
+}
+
+// writePacket sends a payload, splitting it into several packets if it is
+// longer than the protocol allows.
+func (c *serverConn) writePacket(payload []byte) error {
+	for {
+		n := len(payload)
+		if n > maxPayloadLength {
+			n = maxPayloadLength
+		}
+
+		b := make([]byte, 4+n)
+		b[0] = byte(n)
+		b[1] = byte(n >> 8)
+		b[2] = byte(n >> 16)
+		b[3] = c.seq
+		copy(b[4:], payload[:n])
+		c.seq++
+
+		if err := c.write(b); err != nil {
+			return err
+		}
+
+		payload = payload[n:]
+		if n < maxPayloadLength {
+			return nil
+		}
+	}
+}
+
+func (c *serverConn) write(b []byte) error {
+	chunk := c.s.WriteChunkSize
+	if chunk <= 0 {
+		_, err := c.c.Write(b)
+		return err
+	}
+
+	for len(b) > 0 {
+		n := chunk
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := c.c.Write(b[:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+func putLengthEncodedInt(n uint64) []byte {
+	switch {
+	case n <= 250:
+		return []byte{byte(n)}
+	case n <= 0xffff:
+		return []byte{0xfc, byte(n), byte(n >> 8)}
+	case n <= 0xffffff:
+		return []byte{0xfd, byte(n), byte(n >> 8), byte(n >> 16)}
+	default:
+		b := make([]byte, 9)
+		b[0] = 0xfe
+		binary.LittleEndian.PutUint64(b[1:], n)
+		return b
+	}
+}
+
+func appendLengthEncodedString(b []byte, s string) []byte {
+	b = append(b, putLengthEncodedInt(uint64(len(s)))...)
+	return append(b, s...)
+}
+
+// Event builds a binlog event from a header and a body. The event size is
+// filled in; logPos is the position of the next event.
+func Event(eventType byte, timestamp uint32, serverID uint32, logPos uint32, flags uint16, body []byte) []byte {
+	b := make([]byte, eventHeaderSize+len(body))
+	binary.LittleEndian.PutUint32(b[0:], timestamp)
+	b[4] = eventType
+	binary.LittleEndian.PutUint32(b[5:], serverID)
+	binary.LittleEndian.PutUint32(b[9:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[13:], logPos)
+	binary.LittleEndian.PutUint16(b[17:], flags)
+	copy(b[eventHeaderSize:], body)
+	return b
+}
+
+// RotateEvent builds a rotate event pointing at the given file and position.
+// offset is where the event starts in its own file; zero makes it an artificial
+// rotate event like the one that starts every binlog stream.
+func RotateEvent(nextFile string, nextPos uint64, offset uint32) []byte {
+	body := make([]byte, 8+len(nextFile))
+	binary.LittleEndian.PutUint64(body, nextPos)
+	copy(body[8:], nextFile)
+
+	if offset == 0 {
+		return Event(rotateEventType, 0, 1, 0, artificialEventFlag, body)
+	}
+	return Event(rotateEventType, 0, 1, offset+uint32(eventHeaderSize+len(body)), 0, body)
+}
+
+// FormatDescriptionEvent builds the format description event MySQL 5.5 writes
+// at the start of every binlog file.
+func FormatDescriptionEvent(serverVersion string) []byte {
+	body := make([]byte, 2+50+4+1)
+	binary.LittleEndian.PutUint16(body, 4)
+	copy(body[2:52], serverVersion)
+	body[56] = eventHeaderSize
+	body = append(body, 56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 84, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0)
+
+	return Event(formatDescriptionEventType, 0, 1, 4+uint32(eventHeaderSize+len(body)), 0, body)
+}
+
+// XidEvent builds a transaction commit event.
+func XidEvent(xid uint64, logPos uint32) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, xid)
+	return Event(xidEventType, uint32(time.Now().Unix()), 1, logPos, 0, body)
+}
+
+// MariadbGtidEvent builds the event that starts a MariaDB transaction with the
+// GTID domainID-serverID-seq.
+func MariadbGtidEvent(domainID uint32, serverID uint32, seq uint64, logPos uint32) []byte {
+	body := make([]byte, 19)
+	binary.LittleEndian.PutUint64(body, seq)
+	binary.LittleEndian.PutUint32(body[8:], domainID)
+	return Event(mariadbGtidEventType, uint32(time.Now().Unix()), serverID, logPos, 0, body)
+}
@@ -0,0 +1,400 @@
+package binlog
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// A ChangeOp is what a ChangeEvent did to its row.
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "c" // an insert
+	ChangeUpdate ChangeOp = "u"
+	ChangeDelete ChangeOp = "d"
+	ChangeRead   ChangeOp = "r" // a row read by a snapshot
+)
+
+// A ChangeEvent is one change to one row, with where it was logged and the
+// transaction it was part of.
+type ChangeEvent struct {
+	Source   ChangeSource
+	Database string
+	Table    string
+	Op       ChangeOp
+
+	// Before is the row before an update or delete, and After the row after
+	// an insert, update or snapshot read; the other is the zero Row. Columns
+	// the server left out of the row image are absent.
+	Before Row
+	After  Row
+
+	// Key holds the primary key columns of After, or for deletes of Before.
+	// It is the zero Row if the primary key isn't known.
+	Key Row
+
+	// Transaction is nil for changes outside transactions, such as snapshot
+	// reads.
+	Transaction *ChangeTransaction
+
+	table *changeSchema // of the rows event the change was read from
+}
+
+// A ChangeSource tells where a change was logged.
+type ChangeSource struct {
+	ServerID  uint32
+	File      string    // binlog file, or "" for snapshot reads
+	Pos       uint32    // position after the rows event, or 0 for snapshot reads
+	Row       int       // index of the row in the rows event
+	GTID      string    // of the transaction, or "" if the server logs none
+	Thread    uint32    // ID of the session that made the change, or 0 if unknown
+	Timestamp time.Time // when the rows event was logged, to the second
+	Snapshot  bool      // the change is a snapshot read
+	Query     []byte    // the statement that made the change, if logged
+}
+
+// A ChangeTransaction identifies the transaction of a change, and the change
+// within it.
+type ChangeTransaction struct {
+	ID       string // its GTID, or file:pos of its BEGIN if it has none
+	Sequence int    // of the change in the transaction, from 1
+}
+
+// A ChangeStream reads the row changes of the events of a Streamer.
+//
+// Without ParserOptions.ExactDecimals, DECIMAL values are only as exact as a
+// float64; parse events with it for exact decimals.
+type ChangeStream struct {
+	s       *Streamer
+	tracker changeTracker
+	pending []*ChangeEvent
+}
+
+// NewChangeStream reads the changes of the events of s. Columns are named
+// from the table maps of MySQL 8.0 with binlog_row_metadata=FULL, or failing
+// that by schemas, if it isn't nil and knows the table; otherwise they're
+// named @1, @2 and so on, as mysqlbinlog does.
+func NewChangeStream(s *Streamer, schemas func(database, table string) *TableSchema) *ChangeStream {
+	return &ChangeStream{s: s, tracker: changeTracker{schemas: schemas}}
+}
+
+// Next returns the next change, reading events until one holds a change. It
+// fails if the Streamer does, or with rows it can't decode.
+func (c *ChangeStream) Next() (*ChangeEvent, error) {
+	for len(c.pending) == 0 {
+		e, err := c.s.GetEvent()
+		if err != nil {
+			return nil, err
+		}
+		if c.pending, err = c.tracker.changes(e); err != nil {
+			return nil, err
+		}
+	}
+
+	change := c.pending[0]
+	c.pending = c.pending[1:]
+	return change, nil
+}
+
+// changeTracker follows the binlog file and transaction of a stream of
+// events, and turns the rows of its rows events into ChangeEvents.
+type changeTracker struct {
+	schemas func(database, table string) *TableSchema
+	file    string
+	gtid    string             // of the current or next transaction
+	thread  uint32             // of the session of the current transaction
+	tx      *ChangeTransaction // nil outside transactions
+	tables  map[uint64]*changeSchema
+}
+
+// changes returns the changes an event holds.
+func (t *changeTracker) changes(c *EventContainer) ([]*ChangeEvent, error) {
+	if c.Filtered {
+		return nil, nil
+	}
+	return t.handle(c.Header, c.Event, c.Header.LogPos)
+}
+
+// handle tracks an event logged before pos, and returns the changes it holds.
+func (t *changeTracker) handle(h *EventHeader, e Event, pos uint32) ([]*ChangeEvent, error) {
+	switch e := e.(type) {
+	case *RotateEvent:
+		t.file = string(e.NextFile)
+	case *GtidEvent:
+		t.gtid = ""
+		if h.EventType == GTID_LOG_EVENT {
+			t.gtid = e.GTID()
+		}
+	case *MariadbGtidEvent:
+		// Takes the place of BEGIN, but for DDL
+		t.end()
+		t.gtid = e.GTID.String()
+		if e.Flags&MARIADB_FL_STANDALONE == 0 {
+			t.begin(h)
+		}
+	case *QueryEvent:
+		switch {
+		case t.isDDL(e):
+			t.gtid = "" // DDL takes a transaction of its own
+		case isQuery(e, "BEGIN"):
+			t.begin(h)
+			t.thread = e.SlaveProxyID
+		case isQuery(e, "COMMIT"), isQuery(e, "ROLLBACK"):
+			t.end()
+		}
+	case *XidEvent:
+		t.end()
+	case *TransactionPayloadEvent:
+		var changes []*ChangeEvent
+		for _, c := range e.Events {
+			inner, err := t.handle(c.Header, c.Event, pos)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, inner...)
+		}
+		return changes, nil
+	case *RowsEvent:
+		return t.rowChanges(h, e, pos)
+	}
+	return nil, nil
+}
+
+func (t *changeTracker) begin(h *EventHeader) {
+	id := t.gtid
+	if id == "" {
+		start := uint32(0)
+		if h.LogPos >= h.EventSize {
+			start = h.LogPos - h.EventSize
+		}
+		id = fmt.Sprintf("%s:%d", t.file, start)
+	}
+	t.tx = &ChangeTransaction{ID: id}
+}
+
+func (t *changeTracker) end() {
+	t.tx = nil
+	t.gtid = ""
+	t.thread = 0
+}
+
+// isDDL reports whether a query is a statement of its own outside
+// transactions, as DDL is.
+func (t *changeTracker) isDDL(q *QueryEvent) bool {
+	return t.tx == nil && !isQuery(q, "BEGIN") && !isQuery(q, "COMMIT") && !isQuery(q, "ROLLBACK")
+}
+
+func isQuery(q *QueryEvent, statement string) bool {
+	return strings.EqualFold(strings.TrimSpace(string(q.Query)), statement)
+}
+
+// changeOp returns the operation of rows events of type tp, or "" for other
+// events.
+func changeOp(tp EventType) ChangeOp {
+	switch tp {
+	case PRE_GA_WRITE_ROWS_EVENT, WRITE_ROWS_EVENT_V1, WRITE_ROWS_EVENT_V2,
+		WRITE_ROWS_COMPRESSED_EVENT_V1, WRITE_ROWS_COMPRESSED_EVENT:
+		return ChangeCreate
+	case PRE_GA_UPDATE_ROWS_EVENT, UPDATE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT_V2, PARTIAL_UPDATE_ROWS_EVENT,
+		UPDATE_ROWS_COMPRESSED_EVENT_V1, UPDATE_ROWS_COMPRESSED_EVENT:
+		return ChangeUpdate
+	case PRE_GA_DELETE_ROWS_EVENT, DELETE_ROWS_EVENT_V1, DELETE_ROWS_EVENT_V2,
+		DELETE_ROWS_COMPRESSED_EVENT_V1, DELETE_ROWS_COMPRESSED_EVENT:
+		return ChangeDelete
+	}
+	return ""
+}
+
+// rowChanges returns the changes of a rows event logged before pos.
+func (t *changeTracker) rowChanges(h *EventHeader, e *RowsEvent, pos uint32) ([]*ChangeEvent, error) {
+	op := changeOp(h.EventType)
+	if e.Skipped || e.Table == nil || op == "" {
+		return nil, nil
+	}
+	database, name := string(e.Table.DatabaseName), string(e.Table.TableName)
+	if e.UndecodedRows != nil {
+		return nil, fmt.Errorf("%s.%s: rows with values of unknown types", database, name)
+	}
+
+	images := e.Images()
+	if c := e.Cursor(); c != nil {
+		images = images[:0]
+		for c.Next() {
+			image, err := c.Image()
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", database, name, err)
+			}
+			images = append(images, image)
+		}
+		if err := c.Err(); err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", database, name, err)
+		}
+	}
+
+	source := ChangeSource{
+		ServerID:  h.ServerId,
+		Timestamp: time.Unix(int64(h.Timestamp), 0).UTC(),
+		Query:     e.Query,
+	}
+	tx := t.tx
+	if h.Flags&LOG_EVENT_ARTIFICIAL_F != 0 {
+		op = ChangeRead
+		source.Snapshot = true
+		tx = nil
+	} else {
+		source.File, source.Pos, source.GTID, source.Thread = t.file, pos, t.gtid, t.thread
+	}
+
+	table := t.table(e.Table)
+	step := 1
+	if op == ChangeUpdate {
+		step = 2
+	}
+
+	changes := make([]*ChangeEvent, 0, len(images)/step)
+	for i := 0; i+step <= len(images); i = i + step {
+		c := &ChangeEvent{Source: source, Database: database, Table: name, Op: op, table: table}
+		c.Source.Row = i / step
+
+		switch op {
+		case ChangeUpdate:
+			c.Before, c.After = table.row(images[i]), table.row(images[i+1])
+			c.Key = table.key(c.After)
+		case ChangeDelete:
+			c.Before = table.row(images[i])
+			c.Key = table.key(c.Before)
+		default:
+			c.After = table.row(images[i])
+			c.Key = table.key(c.After)
+		}
+
+		if tx != nil {
+			tx.Sequence++
+			c.Transaction = &ChangeTransaction{ID: tx.ID, Sequence: tx.Sequence}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// table returns what naming and typing the rows of a table map takes,
+// building it again only when the table map changes.
+func (t *changeTracker) table(tme *TableMapEvent) *changeSchema {
+	if c, ok := t.tables[tme.TableID]; ok && c.table == tme {
+		return c
+	}
+
+	var schema *TableSchema
+	if len(tme.ColumnNames) != len(tme.ColumnTypes) && t.schemas != nil {
+		schema = t.schemas(string(tme.DatabaseName), string(tme.TableName))
+	}
+	c := newChangeSchema(tme, schema)
+
+	if t.tables == nil {
+		t.tables = make(map[uint64]*changeSchema)
+	}
+	t.tables[tme.TableID] = c
+	return c
+}
+
+// A changeSchema names and types the values of the rows of a table.
+type changeSchema struct {
+	table   *TableMapEvent
+	columns []*Column // names, signedness and character sets
+	names   []string
+	binary  []bool // character columns known to hold binary strings
+	keys    []int  // the primary key columns
+}
+
+// newChangeSchema describes the columns of a table from its table map, or
+// from its schema if that isn't nil and has as many columns.
+func newChangeSchema(tme *TableMapEvent, schema *TableSchema) *changeSchema {
+	n := len(tme.ColumnTypes)
+	c := &changeSchema{table: tme, columns: make([]*Column, n), names: make([]string, n), binary: make([]bool, n)}
+
+	if schema != nil && len(schema.Columns) == n {
+		c.keys = schema.PrimaryKey
+		for j, column := range schema.Columns {
+			c.columns[j] = column
+			c.names[j] = column.Name
+			c.binary[j] = isCharacterColumn(tme.ColumnTypes[j], tme.ColumnMetadata[j]) &&
+				(column.Charset == "" || column.Charset == "binary")
+		}
+		return c
+	}
+
+	c.keys = tme.PrimaryKey
+	for j := range c.columns {
+		column := &Column{Name: fmt.Sprintf("@%d", j+1)}
+		if len(tme.ColumnNames) == n {
+			column.Name = tme.ColumnNames[j]
+		}
+		if j < len(tme.ColumnUnsigned) {
+			column.Unsigned = tme.ColumnUnsigned[j]
+		}
+		if j < len(tme.ColumnCollations) && isCharacterColumn(tme.ColumnTypes[j], tme.ColumnMetadata[j]) {
+			column.Charset = CollationCharset(tme.ColumnCollations[j])
+			if column.Charset == "binary" {
+				column.Charset = ""
+				c.binary[j] = true
+			}
+		}
+		c.columns[j] = column
+		c.names[j] = column.Name
+	}
+	return c
+}
+
+// sameDefinition reports whether two tables have the same columns, with the
+// same names, types, metadata, nullability, signedness and character sets,
+// and the same primary key. MySQL logs a new table map for each transaction.
+func (c *changeSchema) sameDefinition(o *changeSchema) bool {
+	a, b := c.table, o.table
+	if !bytes.Equal(a.ColumnTypes, b.ColumnTypes) || !bytes.Equal(a.NullBitVector, b.NullBitVector) ||
+		!reflect.DeepEqual(a.ColumnMetadata, b.ColumnMetadata) || !reflect.DeepEqual(c.names, o.names) ||
+		!reflect.DeepEqual(c.binary, o.binary) || !reflect.DeepEqual(c.keys, o.keys) {
+		return false
+	}
+	for j, column := range c.columns {
+		if column.Unsigned != o.columns[j].Unsigned || column.Charset != o.columns[j].Charset {
+			return false
+		}
+	}
+	return true
+}
+
+// row makes a Row of an image of a row of the table.
+func (c *changeSchema) row(image RowImage) Row {
+	r := Row{Values: make([]Value, len(image.Values)), Names: c.names}
+	for j, v := range image.Values {
+		if !image.IsPresent(j) || j >= len(c.columns) {
+			continue
+		}
+		if s, ok := v.(string); ok && c.binary[j] {
+			v = []byte(s)
+		}
+		r.Values[j] = NewValue(v, c.table.ColumnTypes[j], c.table.ColumnMetadata[j], c.columns[j])
+		r.Values[j].loc = image.location
+	}
+	return r
+}
+
+// key returns the primary key columns of a row, or the zero Row if the
+// primary key isn't known.
+func (c *changeSchema) key(r Row) Row {
+	if len(c.keys) == 0 {
+		return Row{}
+	}
+
+	key := Row{Values: make([]Value, len(c.keys)), Names: make([]string, len(c.keys))}
+	for i, j := range c.keys {
+		key.Values[i] = r.Index(j)
+		if j < len(c.names) {
+			key.Names[i] = c.names[j]
+		}
+	}
+	return key
+}
@@ -0,0 +1,254 @@
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errEndOfChanges = errors.New("end of changes")
+
+func changeTable() *TableMapEvent {
+	return &TableMapEvent{
+		TableID:          12,
+		DatabaseName:     []byte("shard767"),
+		TableName:        []byte("uploads"),
+		ColumnCount:      4,
+		ColumnTypes:      []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_BLOB},
+		ColumnMetadata:   []uint16{0, 255, metaFromPrecAndDec(10, 2), 2},
+		NullBitVector:    []byte{0x0e},
+		ColumnCollations: []uint16{0, 255, 0, 63},
+		ColumnUnsigned:   []bool{true, false, false, false},
+		ColumnNames:      []string{"id", "name", "size", "data"},
+		PrimaryKey:       []int{0},
+	}
+}
+
+type changeTestEvent struct {
+	t     EventType
+	flags uint16
+	e     Event
+}
+
+// changeTransactions are a transaction with a GTID that inserts two rows and
+// updates one, then one without that deletes a row.
+func changeTransactions(table *TableMapEvent) []changeTestEvent {
+	return []changeTestEvent{
+		{ROTATE_EVENT, LOG_EVENT_ARTIFICIAL_F, &RotateEvent{NextPosition: 4, NextFile: []byte("mysql-bin.000003")}},
+		{FORMAT_DESCRIPTION_EVENT, 0, testFormatDescription()},
+		{GTID_LOG_EVENT, 0, &GtidEvent{SID: []byte("0123456789abcdef"), GNO: 23}},
+		{QUERY_EVENT, 0, &QueryEvent{DatabaseName: []byte("shard767"), Query: []byte("BEGIN")}},
+		{TABLE_MAP_EVENT, 0, table},
+		{WRITE_ROWS_EVENT_V2, 0, &RowsEvent{TableID: 12, ColumnCount: 4, ColumnBitmap1: []byte{0x0f},
+			Rows: [][]interface{}{
+				{int64(-1), "first", "1.50", []byte{0xff, 0x00}},
+				{int64(2), nil, "-0.25", nil},
+			}}},
+		{UPDATE_ROWS_EVENT_V2, 0, &RowsEvent{TableID: 12, ColumnCount: 4, ColumnBitmap1: []byte{0x0f}, ColumnBitmap2: []byte{0x05},
+			Rows: [][]interface{}{
+				{int64(2), nil, "-0.25", nil},
+				{int64(2), nil, "12345678.90", nil},
+			}}},
+		{XID_EVENT, 0, &XidEvent{Xid: 9}},
+		{ANONYMOUS_GTID_LOG_EVENT, 0, &GtidEvent{SID: make([]byte, 16)}},
+		{QUERY_EVENT, 0, &QueryEvent{DatabaseName: []byte("shard767"), Query: []byte("BEGIN")}},
+		{TABLE_MAP_EVENT, 0, table},
+		{DELETE_ROWS_EVENT_V2, 0, &RowsEvent{TableID: 12, ColumnCount: 4, ColumnBitmap1: []byte{0x01},
+			Rows: [][]interface{}{{int64(-1)}}}},
+		{QUERY_EVENT, 0, &QueryEvent{DatabaseName: []byte("shard767"), Query: []byte("COMMIT")}},
+	}
+}
+
+// parseChangeEvents encodes events and parses them with the options.
+func parseChangeEvents(t *testing.T, o ParserOptions, events []changeTestEvent) []*EventContainer {
+	enc := NewBinlogEncoder()
+	p := NewBinlogParserWithOptions(o)
+
+	var parsed []*EventContainer
+	for _, e := range events {
+		b, err := enc.Encode(&EventHeader{Timestamp: 1600000000, EventType: e.t, ServerId: 1, Flags: e.flags}, e.e)
+		require.NoError(t, err)
+		c, err := p.Parse(b)
+		require.NoError(t, err)
+		parsed = append(parsed, c)
+	}
+	return parsed
+}
+
+// streamChanges encodes events, parses them with the options and reads the
+// changes a ChangeStream makes of them. It returns the parsed events too.
+func streamChanges(t *testing.T, o ParserOptions, schemas func(database, table string) *TableSchema,
+	events []changeTestEvent) ([]*ChangeEvent, []*EventContainer) {
+	parsed := parseChangeEvents(t, o, events)
+	s := newStreamer()
+	for _, c := range parsed {
+		s.ch <- c
+	}
+	s.closeWithError(errEndOfChanges)
+
+	return readChanges(t, NewChangeStream(s, schemas)), parsed
+}
+
+func readChanges(t *testing.T, cs *ChangeStream) []*ChangeEvent {
+	var changes []*ChangeEvent
+	for {
+		c, err := cs.Next()
+		if err != nil {
+			require.Equal(t, errEndOfChanges, err)
+			return changes
+		}
+		changes = append(changes, c)
+	}
+}
+
+func rowText(r Row) map[string]string {
+	if r.Values == nil {
+		return nil
+	}
+	m := make(map[string]string)
+	for j, v := range r.Values {
+		if v.IsPresent() {
+			m[r.Names[j]] = v.String()
+		}
+	}
+	return m
+}
+
+func TestChangeStreamReadsRowChanges(t *testing.T) {
+	changes, parsed := streamChanges(t, ParserOptions{ExactDecimals: true}, nil, changeTransactions(changeTable()))
+	require.Len(t, changes, 4)
+
+	gtid := "30313233-3435-3637-3839-616263646566:23"
+	source := ChangeSource{
+		ServerID:  1,
+		File:      "mysql-bin.000003",
+		Pos:       parsed[5].Header.LogPos,
+		GTID:      gtid,
+		Timestamp: time.Unix(1600000000, 0).UTC(),
+	}
+
+	c := changes[0]
+	assert.Equal(t, source, c.Source)
+	assert.Equal(t, "shard767", c.Database)
+	assert.Equal(t, "uploads", c.Table)
+	assert.Equal(t, ChangeCreate, c.Op)
+	assert.Nil(t, c.Before.Values)
+	assert.Equal(t, map[string]string{"id": "18446744073709551615", "name": "first", "size": "1.50", "data": "\xff\x00"},
+		rowText(c.After))
+	assert.Equal(t, BytesKind, c.After.Index(3).Kind())
+	assert.Equal(t, map[string]string{"id": "18446744073709551615"}, rowText(c.Key))
+	assert.Equal(t, &ChangeTransaction{ID: gtid, Sequence: 1}, c.Transaction)
+
+	c = changes[1]
+	source.Row = 1
+	assert.Equal(t, source, c.Source)
+	assert.Equal(t, map[string]string{"id": "2", "name": "NULL", "size": "-0.25", "data": "NULL"}, rowText(c.After))
+	assert.Equal(t, &ChangeTransaction{ID: gtid, Sequence: 2}, c.Transaction)
+
+	c = changes[2]
+	assert.Equal(t, ChangeUpdate, c.Op)
+	assert.Equal(t, parsed[6].Header.LogPos, c.Source.Pos)
+	assert.Equal(t, 0, c.Source.Row)
+	assert.Equal(t, map[string]string{"id": "2", "name": "NULL", "size": "-0.25", "data": "NULL"}, rowText(c.Before))
+	assert.Equal(t, map[string]string{"id": "2", "size": "12345678.90"}, rowText(c.After))
+	assert.Equal(t, map[string]string{"id": "2"}, rowText(c.Key))
+	assert.Equal(t, &ChangeTransaction{ID: gtid, Sequence: 3}, c.Transaction)
+
+	// Transactions without a GTID are identified by the position of BEGIN
+	c = changes[3]
+	assert.Equal(t, ChangeDelete, c.Op)
+	assert.Equal(t, "", c.Source.GTID)
+	assert.Nil(t, c.After.Values)
+	assert.Equal(t, map[string]string{"id": "18446744073709551615"}, rowText(c.Before))
+	assert.Equal(t, map[string]string{"id": "18446744073709551615"}, rowText(c.Key))
+	begin := parsed[9].Header
+	assert.Equal(t, &ChangeTransaction{ID: fmt.Sprintf("mysql-bin.000003:%d", begin.LogPos-begin.EventSize), Sequence: 1},
+		c.Transaction)
+}
+
+func TestChangeStreamNamesColumnsFromSchemas(t *testing.T) {
+	table := changeTable()
+	table.ColumnNames, table.ColumnUnsigned, table.ColumnCollations, table.PrimaryKey = nil, nil, nil, nil
+
+	changes, _ := streamChanges(t, ParserOptions{ExactDecimals: true}, nil, changeTransactions(table))
+	assert.Equal(t, map[string]string{"@1": "-1", "@2": "first", "@3": "1.50", "@4": "\xff\x00"},
+		rowText(changes[0].After))
+	assert.Equal(t, StringKind, changes[0].After.Index(1).Kind())
+	assert.Nil(t, changes[0].Key.Values)
+
+	var looked []string
+	schemas := func(database, name string) *TableSchema {
+		looked = append(looked, database+"."+name)
+		return &TableSchema{
+			Schema: database,
+			Name:   name,
+			Columns: []*Column{
+				{Name: "id", Unsigned: true},
+				{Name: "name"}, // VARBINARY
+				{Name: "size"},
+				{Name: "data"},
+			},
+			PrimaryKey: []int{0, 1},
+		}
+	}
+	changes, _ = streamChanges(t, ParserOptions{ExactDecimals: true}, schemas, changeTransactions(table))
+	assert.Equal(t, []string{"shard767.uploads", "shard767.uploads"}, looked)
+	assert.Equal(t, map[string]string{"id": "18446744073709551615", "name": "first", "size": "1.50", "data": "\xff\x00"},
+		rowText(changes[0].After))
+	assert.Equal(t, BytesKind, changes[0].After.Index(1).Kind())
+	assert.Equal(t, map[string]string{"id": "18446744073709551615", "name": "first"}, rowText(changes[0].Key))
+
+	// Table maps that name their columns are taken over schemas
+	looked = nil
+	streamChanges(t, ParserOptions{}, schemas, changeTransactions(changeTable()))
+	assert.Empty(t, looked)
+}
+
+func TestChangeStreamReadsLazyRows(t *testing.T) {
+	eager, _ := streamChanges(t, ParserOptions{ExactDecimals: true}, nil, changeTransactions(changeTable()))
+	lazy, _ := streamChanges(t, ParserOptions{ExactDecimals: true, LazyRows: true}, nil, changeTransactions(changeTable()))
+	assert.Equal(t, eager, lazy)
+}
+
+func TestChangeStreamIgnoresSkippedTables(t *testing.T) {
+	o := ParserOptions{Filter: &ReplicationFilter{IgnoreTables: []string{"shard767.uploads"}}}
+	changes, _ := streamChanges(t, o, nil, changeTransactions(changeTable()))
+	assert.Empty(t, changes)
+
+	o = ParserOptions{Projection: func(database, table string) []int { return []int{} }}
+	changes, _ = streamChanges(t, o, nil, changeTransactions(changeTable()))
+	assert.Empty(t, changes)
+}
+
+func TestChangeStreamReadsSnapshotRows(t *testing.T) {
+	s := newStreamer()
+	table := changeTable()
+	s.ch <- snapshotEvent(TABLE_MAP_EVENT, table)
+	s.ch <- snapshotEvent(WRITE_ROWS_EVENT_V2, &RowsEvent{Table: table, TableID: 12, ColumnCount: 4,
+		ColumnBitmap1: []byte{0x0f}, Rows: [][]interface{}{{int64(3), "snap", "0.10", nil}}})
+	s.closeWithError(errEndOfChanges)
+
+	changes := readChanges(t, NewChangeStream(s, nil))
+	require.Len(t, changes, 1)
+	c := changes[0]
+	assert.Equal(t, ChangeRead, c.Op)
+	assert.True(t, c.Source.Snapshot)
+	assert.Equal(t, "", c.Source.File)
+	assert.Nil(t, c.Transaction)
+	assert.Equal(t, map[string]string{"id": "3", "name": "snap", "size": "0.10", "data": "NULL"}, rowText(c.After))
+}
+
+func TestChangeStreamFailsOnUndecodableRows(t *testing.T) {
+	s := newStreamer()
+	s.ch <- &EventContainer{
+		Header: &EventHeader{EventType: WRITE_ROWS_EVENT_V2},
+		Event:  &RowsEvent{Table: changeTable(), UndecodedRows: []byte{1}},
+	}
+
+	_, err := NewChangeStream(s, nil).Next()
+	assert.Error(t, err)
+}
@@ -0,0 +1,314 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalJSON encodes a change as a JSON object, with its fields always in
+// this order:
+//
+//	{
+//	  "source": {
+//	    "server_id": 1,
+//	    "file": "mysql-bin.000003",  // "" for snapshot reads
+//	    "pos": 4711,                 // 0 for snapshot reads
+//	    "row": 0,
+//	    "gtid": "3e11fa47-71ca-11e1-9e33-c80aa9429562:23",  // or null
+//	    "ts": "2021-03-04T05:06:07Z",
+//	    "snapshot": false,
+//	    "query": "UPDATE uploads SET size = 10 WHERE id = 7"  // or null
+//	  },
+//	  "database": "shard767",
+//	  "table": "uploads",
+//	  "op": "u",                     // c, u, d or r
+//	  "before": {"id": 7, "size": 9},  // or null
+//	  "after": {"id": 7, "size": 10},  // or null
+//	  "key": {"id": 7},              // or null
+//	  "transaction": {"id": "3e11fa47-71ca-11e1-9e33-c80aa9429562:23", "sequence": 1}  // or null
+//	}
+//
+// Rows hold their columns in table order, leaving out those the row image
+// doesn't; values are
+//   - numbers for integers, YEAR, BIT and ENUM indexes, FLOAT and DOUBLE
+//   - strings of exact decimal text for DECIMAL
+//   - strings for DATE ("2021-03-04"), DATETIME ("2021-03-04T05:06:07.000000")
+//     and TIMESTAMP, in UTC ("2021-03-04T05:06:07.000000Z"), with microseconds
+//     but for columns with fractional seconds decoded without
+//     ParserOptions.ParseTime, which have none; zero dates are as MySQL prints
+//     them
+//   - strings for TIME ("-838:59:59.000000")
+//   - strings for text, and base64 strings for binary strings and WKB
+//     GEOMETRY
+//   - the document itself for JSON, and for partial JSON updates an array of
+//     {"op": "replace", "path": "$.a", "value": 1} diffs, with null values for
+//     removes
+//   - arrays of labels for SETs decoded with ParserOptions.DecodeEnums
+func (e *ChangeEvent) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	s := &e.Source
+
+	fmt.Fprintf(&b, `{"source":{"server_id":%d,"file":`, s.ServerID)
+	writeJSONString(&b, s.File)
+	fmt.Fprintf(&b, `,"pos":%d,"row":%d,"gtid":`, s.Pos, s.Row)
+	if s.GTID != "" {
+		writeJSONString(&b, s.GTID)
+	} else {
+		b.WriteString("null")
+	}
+	fmt.Fprintf(&b, `,"ts":"%s","snapshot":%t,"query":`, s.Timestamp.UTC().Format(time.RFC3339), s.Snapshot)
+	if s.Query != nil {
+		writeJSONString(&b, string(s.Query))
+	} else {
+		b.WriteString("null")
+	}
+
+	b.WriteString(`},"database":`)
+	writeJSONString(&b, e.Database)
+	b.WriteString(`,"table":`)
+	writeJSONString(&b, e.Table)
+	fmt.Fprintf(&b, `,"op":"%s"`, e.Op)
+
+	for _, row := range []struct {
+		name string
+		r    Row
+	}{{"before", e.Before}, {"after", e.After}, {"key", e.Key}} {
+		fmt.Fprintf(&b, `,"%s":`, row.name)
+		if err := writeJSONRow(&b, row.r); err != nil {
+			return nil, fmt.Errorf("%s.%s: %s %v", e.Database, e.Table, row.name, err)
+		}
+	}
+
+	b.WriteString(`,"transaction":`)
+	if t := e.Transaction; t != nil {
+		b.WriteString(`{"id":`)
+		writeJSONString(&b, t.ID)
+		fmt.Fprintf(&b, `,"sequence":%d}`, t.Sequence)
+	} else {
+		b.WriteString("null")
+	}
+	b.WriteString("}")
+
+	return b.Bytes(), nil
+}
+
+// writeJSONRow writes the present columns of a row as a JSON object, or null
+// for the zero Row.
+func writeJSONRow(b *bytes.Buffer, r Row) error {
+	if r.Values == nil {
+		b.WriteString("null")
+		return nil
+	}
+
+	b.WriteString("{")
+	first := true
+	for j, v := range r.Values {
+		if !v.IsPresent() {
+			continue
+		}
+		if !first {
+			b.WriteString(",")
+		}
+		first = false
+
+		name := fmt.Sprintf("@%d", j+1)
+		if j < len(r.Names) {
+			name = r.Names[j]
+		}
+		writeJSONString(b, name)
+		b.WriteString(":")
+		if err := writeJSONValue(b, v); err != nil {
+			return fmt.Errorf("column %s: %v", name, err)
+		}
+	}
+	b.WriteString("}")
+	return nil
+}
+
+// writeJSONValue writes a value as MarshalJSON describes.
+func writeJSONValue(b *bytes.Buffer, v Value) error {
+	switch v.Kind() {
+	case NullKind:
+		b.WriteString("null")
+	case IntKind:
+		i, err := v.Int64()
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatInt(i, 10))
+	case UintKind:
+		u, err := v.Uint64()
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatUint(u, 10))
+	case FloatKind:
+		switch f := v.Interface().(type) {
+		case float32:
+			b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+		case float64:
+			b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		default:
+			return fmt.Errorf("can't read %T as a float", f)
+		}
+	case DecimalKind:
+		d, err := v.Decimal()
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, d)
+	case TimeKind:
+		s, err := changeTimeText(v)
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, s)
+	case DurationKind:
+		d, err := v.Duration()
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, changeDurationText(d))
+	case StringKind:
+		writeJSONString(b, v.String())
+	case BytesKind:
+		data, err := v.Bytes()
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, base64.StdEncoding.EncodeToString(data))
+	case JSONKind:
+		doc, err := v.JSON()
+		if err != nil {
+			return err
+		}
+		writeJSONDocument(b, doc)
+	case JSONDiffKind:
+		diffs, err := v.JSONDiffs()
+		if err != nil {
+			return err
+		}
+		b.WriteString("[")
+		for i, d := range diffs {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(b, `{"op":"%s","path":`, strings.ToLower(d.Operation.String()))
+			writeJSONString(b, string(d.Path))
+			b.WriteString(`,"value":`)
+			if d.Value == nil {
+				b.WriteString("null")
+			} else {
+				writeJSONDocument(b, d.Value)
+			}
+			b.WriteString("}")
+		}
+		b.WriteString("]")
+	case SetKind:
+		labels, err := v.Labels()
+		if err != nil {
+			return err
+		}
+		b.WriteString("[")
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			writeJSONString(b, label)
+		}
+		b.WriteString("]")
+	default:
+		return fmt.Errorf("can't encode %s value", v.Kind())
+	}
+	return nil
+}
+
+// writeJSONDocument writes JSON text as it is, or as a string if it isn't
+// valid JSON.
+func writeJSONDocument(b *bytes.Buffer, doc []byte) {
+	if json.Valid(doc) {
+		b.Write(bytes.TrimSpace(doc))
+		return
+	}
+	writeJSONString(b, string(doc))
+}
+
+// changeTimeText formats DATE, DATETIME and TIMESTAMP values as MarshalJSON
+// describes. Values that aren't times, such as zero dates, are left as they
+// were decoded.
+func changeTimeText(v Value) (string, error) {
+	t, err := v.Time()
+	s, isString := v.Interface().(string)
+	if err != nil {
+		if isString {
+			return s, nil
+		}
+		return "", err
+	}
+
+	// Strings decoded without ParseTime leave out the fractions of columns
+	// that have them, so there are no microseconds to show
+	layout := "2006-01-02T15:04:05.000000"
+	fractional := (v.tp == MYSQL_TYPE_DATETIME2 || v.tp == MYSQL_TYPE_TIMESTAMP2) && v.meta > 0
+	if isString && fractional && !strings.Contains(s, ".") {
+		layout = "2006-01-02T15:04:05"
+	}
+
+	switch v.tp {
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
+		return t.Format("2006-01-02"), nil
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2:
+		return t.UTC().Format(layout + "Z"), nil
+	}
+	return t.Format(layout), nil
+}
+
+// changeDurationText formats TIME values as MarshalJSON describes.
+func changeDurationText(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, d/time.Hour, d%time.Hour/time.Minute,
+		d%time.Minute/time.Second, d%time.Second/time.Microsecond)
+}
+
+// A ChangeEncoder writes changes as newline-delimited JSON.
+type ChangeEncoder struct {
+	w io.Writer
+}
+
+func NewChangeEncoder(w io.Writer) *ChangeEncoder {
+	return &ChangeEncoder{w: w}
+}
+
+// Encode writes a change as a line of JSON; see ChangeEvent.MarshalJSON.
+func (enc *ChangeEncoder) Encode(e *ChangeEvent) error {
+	b, err := e.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(append(b, '\n'))
+	return err
+}
+
+// EncodeStream writes the changes of a stream until it fails, and returns its
+// error, or the first error writing them.
+func (enc *ChangeEncoder) EncodeStream(s *ChangeStream) error {
+	for {
+		e, err := s.Next()
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+}
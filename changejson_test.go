@@ -0,0 +1,145 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeValuesAreWrittenAsJSON(t *testing.T) {
+	unsigned := &Column{Unsigned: true}
+	text := &Column{Charset: "utf8mb4"}
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.FixedZone("", 3600))
+
+	for _, tc := range []struct {
+		v    Value
+		want string
+	}{
+		{NewValue(nil, MYSQL_TYPE_LONG, 0, nil), `null`},
+		{NewValue(int8(-1), MYSQL_TYPE_TINY, 0, nil), `-1`},
+		{NewValue(int8(-1), MYSQL_TYPE_TINY, 0, unsigned), `255`},
+		{NewValue(int64(-1), MYSQL_TYPE_LONGLONG, 0, unsigned), `18446744073709551615`},
+		{NewValue("2021", MYSQL_TYPE_YEAR, 0, nil), `2021`},
+		{NewValue(int64(5), MYSQL_TYPE_BIT, 3, nil), `5`},
+		{NewValue(float32(0.1), MYSQL_TYPE_FLOAT, 4, nil), `0.1`},
+		{NewValue(float64(-2.5e30), MYSQL_TYPE_DOUBLE, 8, nil), `-2.5e+30`},
+		{NewValue("12345678901234567890.123456789", MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(65, 9), nil),
+			`"12345678901234567890.123456789"`},
+		{NewValue(float64(1.5), MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 2), nil), `"1.50"`},
+		{NewValue("2021-03-04", MYSQL_TYPE_DATE, 0, nil), `"2021-03-04"`},
+		{NewValue("2021-03-04 05:06:07.5", MYSQL_TYPE_DATETIME2, 1, nil), `"2021-03-04T05:06:07.500000"`},
+		{NewValue(ts, MYSQL_TYPE_DATETIME2, 2, nil), `"2021-03-04T05:06:07.890000"`},
+		{NewValue("2021-03-04 05:06:07", MYSQL_TYPE_DATETIME2, 3, nil), `"2021-03-04T05:06:07"`},
+		{NewValue("2021-03-04 05:06:07", MYSQL_TYPE_DATETIME2, 0, nil), `"2021-03-04T05:06:07.000000"`},
+		{Value{kind: TimeKind, v: "2021-03-04 05:06:07", tp: MYSQL_TYPE_TIMESTAMP2, loc: time.FixedZone("", 3600)},
+			`"2021-03-04T04:06:07.000000Z"`},
+		{NewValue(ts, MYSQL_TYPE_TIMESTAMP2, 2, nil), `"2021-03-04T04:06:07.890000Z"`},
+		{NewValue("0000-00-00 00:00:00", MYSQL_TYPE_DATETIME2, 0, nil), `"0000-00-00 00:00:00"`},
+		{NewValue("-838:59:59", MYSQL_TYPE_TIME2, 0, nil), `"-838:59:59.000000"`},
+		{NewValue(1500*time.Millisecond, MYSQL_TYPE_TIME2, 3, nil), `"00:00:01.500000"`},
+		{NewValue("<a & \"b\">\n", MYSQL_TYPE_VARCHAR, 255, nil), `"<a & \"b\">\n"`},
+		{NewValue([]byte("text"), MYSQL_TYPE_BLOB, 2, text), `"text"`},
+		{NewValue([]byte{0xff, 0x00, 0x01}, MYSQL_TYPE_BLOB, 2, nil), `"/wAB"`},
+		{NewValue([]byte(`{"a": [1, 2]}`), MYSQL_TYPE_JSON, 4, nil), `{"a": [1, 2]}`},
+		{NewValue([]byte(`not json`), MYSQL_TYPE_JSON, 4, nil), `"not json"`},
+		{NewValue([]JSONDiff{
+			{Operation: JSON_DIFF_REPLACE, Path: []byte("$.a"), Value: []byte("1")},
+			{Operation: JSON_DIFF_REMOVE, Path: []byte("$.b[0]")},
+		}, MYSQL_TYPE_JSON, 4, nil), `[{"op":"replace","path":"$.a","value":1},{"op":"remove","path":"$.b[0]","value":null}]`},
+		{NewValue([]string{"a", "c"}, MYSQL_TYPE_SET, 1, nil), `["a","c"]`},
+		{NewValue("small", MYSQL_TYPE_ENUM, 1, nil), `"small"`},
+		{NewValue(int64(2), MYSQL_TYPE_ENUM, 1, nil), `2`},
+	} {
+		var b bytes.Buffer
+		if assert.NoError(t, writeJSONValue(&b, tc.v), tc.want) {
+			assert.Equal(t, tc.want, b.String())
+			assert.True(t, json.Valid(b.Bytes()), tc.want)
+		}
+	}
+
+	var b bytes.Buffer
+	assert.Error(t, writeJSONValue(&b, Value{kind: UintKind, v: "not a number", tp: MYSQL_TYPE_LONG}))
+}
+
+func TestChangeEventIsMarshaledAsJSON(t *testing.T) {
+	names := []string{"id", "size", "note"}
+	e := &ChangeEvent{
+		Source: ChangeSource{
+			ServerID:  1,
+			File:      "mysql-bin.000003",
+			Pos:       4711,
+			Row:       1,
+			GTID:      "3e11fa47-71ca-11e1-9e33-c80aa9429562:23",
+			Timestamp: time.Unix(1600000000, 0),
+			Query:     []byte("UPDATE uploads SET size = 10"),
+		},
+		Database: "shard767",
+		Table:    "uploads",
+		Op:       ChangeUpdate,
+		Before: Row{Names: names, Values: []Value{
+			NewValue(int64(7), MYSQL_TYPE_LONGLONG, 0, nil),
+			NewValue("9.00", MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(4, 2), nil),
+			NewValue(nil, MYSQL_TYPE_VARCHAR, 255, nil),
+		}},
+		After: Row{Names: names, Values: []Value{
+			NewValue(int64(7), MYSQL_TYPE_LONGLONG, 0, nil),
+			NewValue("10.00", MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(4, 2), nil),
+			{},
+		}},
+		Key:         Row{Names: names[:1], Values: []Value{NewValue(int64(7), MYSQL_TYPE_LONGLONG, 0, nil)}},
+		Transaction: &ChangeTransaction{ID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:23", Sequence: 2},
+	}
+
+	b, err := json.Marshal(e)
+	require.NoError(t, err)
+	assert.Equal(t, `{"source":{"server_id":1,"file":"mysql-bin.000003","pos":4711,"row":1,`+
+		`"gtid":"3e11fa47-71ca-11e1-9e33-c80aa9429562:23","ts":"2020-09-13T12:26:40Z","snapshot":false,`+
+		`"query":"UPDATE uploads SET size = 10"},"database":"shard767","table":"uploads","op":"u",`+
+		`"before":{"id":7,"size":"9.00","note":null},"after":{"id":7,"size":"10.00"},"key":{"id":7},`+
+		`"transaction":{"id":"3e11fa47-71ca-11e1-9e33-c80aa9429562:23","sequence":2}}`, string(b))
+
+	e = &ChangeEvent{
+		Source:   ChangeSource{Timestamp: time.Unix(1600000000, 0), Snapshot: true},
+		Database: "shard767",
+		Table:    "uploads",
+		Op:       ChangeRead,
+		After:    Row{Values: []Value{NewValue(int64(7), MYSQL_TYPE_LONGLONG, 0, nil)}},
+	}
+	b, err = json.Marshal(e)
+	require.NoError(t, err)
+	assert.Equal(t, `{"source":{"server_id":0,"file":"","pos":0,"row":0,"gtid":null,"ts":"2020-09-13T12:26:40Z",`+
+		`"snapshot":true,"query":null},"database":"shard767","table":"uploads","op":"r",`+
+		`"before":null,"after":{"@1":7},"key":null,"transaction":null}`, string(b))
+}
+
+func TestChangeEncoderWritesStreamAsLines(t *testing.T) {
+	var b bytes.Buffer
+	enc := NewChangeEncoder(&b)
+
+	s := newStreamer()
+	for _, c := range parseChangeEvents(t, ParserOptions{ExactDecimals: true}, changeTransactions(changeTable())) {
+		s.ch <- c
+	}
+	s.closeWithError(errEndOfChanges)
+
+	assert.Equal(t, errEndOfChanges, enc.EncodeStream(NewChangeStream(s, nil)))
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	var ops []string
+	for _, line := range lines {
+		var change struct {
+			Op    string
+			After map[string]interface{}
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &change))
+		ops = append(ops, change.Op)
+	}
+	assert.Equal(t, []string{"c", "c", "u", "d"}, ops)
+	assert.Contains(t, lines[0], `"after":{"id":18446744073709551615,"name":"first","size":"1.50","data":"/wA="}`)
+}
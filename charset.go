@@ -0,0 +1,167 @@
+package binlog
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// BINARY_COLLATION_ID is the collation of binary strings: BINARY, VARBINARY
+// and BLOB columns.
+const BINARY_COLLATION_ID uint16 = 63
+
+// collationCharsets maps the IDs of the collations before 100 to their
+// character sets. Later IDs come in ranges; see CollationCharset.
+var collationCharsets = map[uint16]string{
+	1: "big5", 2: "latin2", 3: "dec8", 4: "cp850", 5: "latin1", 6: "hp8", 7: "koi8r", 8: "latin1",
+	9: "latin2", 10: "swe7", 11: "ascii", 12: "ujis", 13: "sjis", 14: "cp1251", 15: "latin1", 16: "hebrew",
+	18: "tis620", 19: "euckr", 20: "latin7", 21: "latin2", 22: "koi8u", 23: "cp1251", 24: "gb2312",
+	25: "greek", 26: "cp1250", 27: "latin2", 28: "gbk", 29: "cp1257", 30: "latin5", 31: "latin1",
+	32: "armscii8", 33: "utf8mb3", 34: "cp1250", 35: "ucs2", 36: "cp866", 37: "keybcs2", 38: "macce",
+	39: "macroman", 40: "cp852", 41: "latin7", 42: "latin7", 43: "macce", 44: "cp1250", 45: "utf8mb4",
+	46: "utf8mb4", 47: "latin1", 48: "latin1", 49: "latin1", 50: "cp1251", 51: "cp1251", 52: "cp1251",
+	53: "macroman", 54: "utf16", 55: "utf16", 56: "utf16le", 57: "cp1256", 58: "cp1257", 59: "cp1257",
+	60: "utf32", 61: "utf32", 62: "utf16le", 63: "binary", 64: "armscii8", 65: "ascii", 66: "cp1250",
+	67: "cp1256", 68: "cp866", 69: "dec8", 70: "greek", 71: "hebrew", 72: "hp8", 73: "keybcs2",
+	74: "koi8r", 75: "koi8u", 76: "utf8mb3", 77: "latin2", 78: "latin5", 79: "latin7", 80: "cp850",
+	81: "cp852", 82: "swe7", 83: "utf8mb3", 84: "big5", 85: "euckr", 86: "gb2312", 87: "gbk", 88: "sjis",
+	89: "tis620", 90: "ucs2", 91: "ujis", 92: "geostd8", 93: "geostd8", 94: "latin1", 95: "cp932",
+	96: "cp932", 97: "eucjpms", 98: "eucjpms", 99: "cp1250",
+}
+
+// CollationCharset returns the character set of a MySQL or MariaDB collation
+// ID, or "" if it is unknown.
+func CollationCharset(id uint16) string {
+	switch {
+	case id < 100:
+		return collationCharsets[id]
+	case id >= 101 && id <= 124:
+		return "utf16"
+	case id >= 128 && id <= 151, id == 159:
+		return "ucs2"
+	case id >= 160 && id <= 183:
+		return "utf32"
+	case id >= 192 && id <= 215, id == 223:
+		return "utf8mb3"
+	case id >= 224 && id <= 247, id >= 255 && id <= 323:
+		return "utf8mb4"
+	case id >= 248 && id <= 250:
+		return "gb18030"
+	case id >= 1024 && id < 2048:
+		// MariaDB's NO PAD collations
+		return CollationCharset(id - 1024)
+	case id >= 2048 && id < 3328:
+		// MariaDB's UCA 14.0.0 collations
+		return []string{"utf8mb3", "utf8mb4", "ucs2", "utf16", "utf32"}[(id-2048)>>8]
+	}
+	return ""
+}
+
+// charsetEncodings holds the encodings of the character sets that aren't
+// UTF-8 or a subset of it. Those missing from both convert as they are.
+var charsetEncodings = map[string]encoding.Encoding{
+	"latin1":   charmap.Windows1252, // MySQL's latin1 is cp1252
+	"latin2":   charmap.ISO8859_2,
+	"latin5":   charmap.ISO8859_9,
+	"latin7":   charmap.ISO8859_13,
+	"greek":    charmap.ISO8859_7,
+	"hebrew":   charmap.ISO8859_8,
+	"cp1250":   charmap.Windows1250,
+	"cp1251":   charmap.Windows1251,
+	"cp1256":   charmap.Windows1256,
+	"cp1257":   charmap.Windows1257,
+	"cp850":    charmap.CodePage850,
+	"cp852":    charmap.CodePage852,
+	"cp866":    charmap.CodePage866,
+	"koi8r":    charmap.KOI8R,
+	"koi8u":    charmap.KOI8U,
+	"macroman": charmap.Macintosh,
+	"tis620":   charmap.Windows874,
+	"sjis":     japanese.ShiftJIS,
+	"cp932":    japanese.ShiftJIS,
+	"ujis":     japanese.EUCJP,
+	"eucjpms":  japanese.EUCJP,
+	"euckr":    korean.EUCKR,
+	"gb2312":   simplifiedchinese.GBK,
+	"gbk":      simplifiedchinese.GBK,
+	"gb18030":  simplifiedchinese.GB18030,
+	"big5":     traditionalchinese.Big5,
+	"ucs2":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf16":    unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf16le":  unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf32":    utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM),
+}
+
+// decodeCharset converts text in a character set to UTF-8. Text in unknown
+// character sets, and in ones that are already UTF-8, is copied as it is.
+func decodeCharset(b []byte, charset string) (string, error) {
+	e, ok := charsetEncodings[charset]
+	if !ok {
+		return string(b), nil
+	}
+
+	s, err := e.NewDecoder().Bytes(b)
+	if err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+// encodeCharset converts UTF-8 text to a character set, as decodeCharset
+// converts it back.
+func encodeCharset(s string, charset string) ([]byte, error) {
+	e, ok := charsetEncodings[charset]
+	if !ok {
+		return []byte(s), nil
+	}
+	return e.NewEncoder().Bytes([]byte(s))
+}
+
+// isCharacterColumn reports whether a column of type tp with metadata meta
+// has a character set: CHAR, VARCHAR, TEXT and their binary counterparts.
+func isCharacterColumn(tp byte, meta uint16) bool {
+	if tp == MYSQL_TYPE_STRING {
+		tp, _ = stringRealType(meta)
+	}
+	switch tp {
+	case MYSQL_TYPE_STRING, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING,
+		MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB:
+		return true
+	}
+	return false
+}
+
+// decodeCharacterValue converts the value of a character column in charset
+// to what DecodeCharsets makes of it: a []byte for binary strings and a UTF-8
+// string for text.
+func decodeCharacterValue(v interface{}, charset string) (interface{}, error) {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return v, nil
+	}
+
+	if charset == "binary" {
+		return b, nil
+	}
+	return decodeCharset(b, charset)
+}
+
+// encodeCharacterValue converts the value of a character column that
+// decodeCharacterValue made of it back to charset.
+func encodeCharacterValue(v interface{}, charset string) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || charset == "binary" {
+		return v, nil
+	}
+	return encodeCharset(s, charset)
+}
@@ -0,0 +1,137 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollationCharset(t *testing.T) {
+	for id, want := range map[uint16]string{
+		8:    "latin1",
+		33:   "utf8mb3",
+		45:   "utf8mb4",
+		51:   "cp1251",
+		63:   "binary",
+		101:  "utf16",
+		192:  "utf8mb3",
+		248:  "gb18030",
+		255:  "utf8mb4",
+		309:  "utf8mb4",
+		1032: "latin1",
+		2304: "utf8mb4",
+		17:   "",
+		400:  "",
+	} {
+		assert.Equal(t, want, CollationCharset(id), "%d", id)
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		input   string
+		want    string
+	}{
+		{"latin1", "caf\xe9 \x80", "café €"},
+		{"cp1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"utf16", "\x00h\x00\xe9", "hé"},
+		{"utf16le", "h\x00\xe9\x00", "hé"},
+		{"sjis", "\x93\xfa\x96\x7b", "日本"},
+		{"utf8mb4", "日本", "日本"},
+		{"armscii8", "raw", "raw"},
+	}
+
+	for _, tt := range tests {
+		s, err := decodeCharset([]byte(tt.input), tt.charset)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, s, tt.charset)
+	}
+}
+
+func charsetRowsEvent(t *testing.T, o ParserOptions, collations []uint16) *RowsEvent {
+	tme := &TableMapEvent{
+		TableID:      12,
+		DatabaseName: []byte("shard767"),
+		TableName:    []byte("names"),
+		ColumnCount:  6,
+		ColumnTypes: []byte{MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_STRING,
+			MYSQL_TYPE_VARCHAR, MYSQL_TYPE_BLOB, MYSQL_TYPE_BLOB},
+		ColumnMetadata:   []uint16{255, 255, uint16(MYSQL_TYPE_STRING)<<8 | 40, 255, 2, 2},
+		NullBitVector:    []byte{0x3f},
+		ColumnCollations: collations,
+	}
+	write := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   6,
+		ColumnBitmap1: []byte{0x3f},
+		Rows: [][]interface{}{
+			{"caf\xe9", "\xcf\xf0\xe8\xe2\xe5\xf2", "\x00h\x00i", "\x00\x01", []byte("text"), []byte{0xff}},
+		},
+	}
+
+	return parseEncodedRowsEvent(t, o, tme, write)
+}
+
+func TestRowsEventsDecodeCharsetsFromTableMaps(t *testing.T) {
+	collations := []uint16{8, 51, 54, 63, 255, 63}
+
+	e := charsetRowsEvent(t, ParserOptions{DecodeCharsets: true}, collations)
+	assert.Equal(t, []interface{}{"café", "Привет", "hi", []byte{0, 1}, "text", []byte{0xff}}, e.Rows[0])
+
+	// Without the option, values are decoded as they are.
+	e = charsetRowsEvent(t, ParserOptions{}, collations)
+	assert.Equal(t, []interface{}{"caf\xe9", "\xcf\xf0\xe8\xe2\xe5\xf2", "\x00h\x00i", "\x00\x01", []byte("text"), []byte{0xff}}, e.Rows[0])
+}
+
+func TestRowsEventsDecodeCharsetsFromSchemas(t *testing.T) {
+	schema := &TableSchema{
+		Schema: "shard767",
+		Name:   "names",
+		Columns: []*Column{
+			{Name: "a", Charset: "latin1"},
+			{Name: "b", Charset: "cp1251"},
+			{Name: "c", Charset: "utf16"},
+			{Name: "d"},
+			{Name: "e", Charset: "utf8"},
+			{Name: "f"},
+		},
+	}
+	o := ParserOptions{
+		DecodeCharsets: true,
+		Schemas: func(database, table string) *TableSchema {
+			if database == schema.Schema && table == schema.Name {
+				return schema
+			}
+			return nil
+		},
+	}
+
+	e := charsetRowsEvent(t, o, nil)
+	assert.Equal(t, []interface{}{"café", "Привет", "hi", []byte{0, 1}, "text", []byte{0xff}}, e.Rows[0])
+
+	row := e.Row(0, nil)
+	assert.Equal(t, BytesKind, row.Index(3).Kind())
+	assert.Equal(t, StringKind, row.Index(4).Kind())
+}
+
+func TestValueFromTextDecodesCharsets(t *testing.T) {
+	o := &ParserOptions{DecodeCharsets: true}
+
+	tests := []struct {
+		column Column
+		want   interface{}
+	}{
+		{Column{Type: MYSQL_TYPE_VARCHAR, Metadata: 255, Charset: "latin1"}, "café"},
+		{Column{Type: MYSQL_TYPE_VARCHAR, Metadata: 255}, []byte("café")},
+		{Column{Type: MYSQL_TYPE_BLOB, Metadata: 2, Charset: "utf8mb4"}, "café"},
+		{Column{Type: MYSQL_TYPE_BLOB, Metadata: 2}, []byte("café")},
+	}
+
+	for _, tt := range tests {
+		v, err := o.valueFromText(&tt.column, []byte("café"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, v)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -31,11 +32,12 @@ type Conn struct {
 	db       string
 
 	// Handshake initialization packet from server
-	capability   uint32
-	status       uint16
-	charset      string
-	salt         []byte
-	connectionID uint32
+	serverVersion string
+	capability    uint32
+	status        uint16
+	charset       string
+	salt          []byte
+	connectionID  uint32
 }
 
 // NewConn opens a new connection to a MySQL server and returns it.
@@ -47,7 +49,7 @@ func NewConn(host string, port uint16, user string, password string, dbName stri
 	c.charset = DEFAULT_CHARSET
 
 	var err error
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(int(port)))
 	c.conn, err = net.DialTimeout("tcp", address, timeout)
 	if err != nil {
 		return nil, err
@@ -102,8 +104,13 @@ func (c *Conn) readInitialHandshake() error {
 	// Skip protocol version (1 byte)
 	i = i + 1
 
-	// Skip (null-terminated) MySQL version
-	i = i + bytes.IndexByte(b[1:], 0x00) + 1
+	// MySQL version (null-terminated string)
+	n := bytes.IndexByte(b[1:], 0x00)
+	if n < 0 {
+		return errors.New("malformed initial handshake")
+	}
+	c.serverVersion = string(b[1 : 1+n])
+	i = i + n + 1
 
 	// Connection ID (4 bytes)
 	c.connectionID = uint32(binary.LittleEndian.Uint32(b[i : i+4]))
@@ -155,8 +162,43 @@ func (c *Conn) execute(query string) (*Result, error) {
 	return c.readResult(false)
 }
 
-func (c *Conn) handleErrorPacket(data []byte) error {
-	return errors.New("error packet")
+// A MySQLError is an error reported by the server in an ERR packet.
+type MySQLError struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *MySQLError) Error() string {
+	if e.State != "" {
+		return fmt.Sprintf("ERROR %d (%s): %s", e.Code, e.State, e.Message)
+	}
+	return fmt.Sprintf("ERROR %d: %s", e.Code, e.Message)
+}
+
+// handleErrorPacket turns an ERR packet into a *MySQLError.
+func (c *Conn) handleErrorPacket(b []byte) error {
+	if len(b) < 3 {
+		return errors.New("malformed error packet")
+	}
+
+	e := new(MySQLError)
+	i := 1
+
+	// Error code (2 bytes)
+	e.Code = binary.LittleEndian.Uint16(b[i : i+2])
+	i = i + 2
+
+	// SQL state marker and SQL state (string[6]), protocol 4.1 only
+	if c.capability&CLIENT_PROTOCOL_41 > 0 && len(b) >= i+6 && b[i] == '#' {
+		e.State = string(b[i+1 : i+6])
+		i = i + 6
+	}
+
+	// Error message (string[EOF])
+	e.Message = string(b[i:])
+
+	return e
 }
 
 func (c *Conn) readOKPacket() (*Result, error) {
@@ -439,6 +481,13 @@ func (c *Conn) readPacket() ([]byte, error) {
 // readPacketTo reads the next available network packet into the writer provided
 // and increments the packet sequence number.
 func (c *Conn) readPacketTo(w io.Writer) error {
+	return c.readContinuedPacketTo(w, false)
+}
+
+// readContinuedPacketTo reads a packet as readPacketTo does. Packets that
+// continue one of the maximum size may be empty, when it was a multiple of that
+// size.
+func (c *Conn) readContinuedPacketTo(w io.Writer, continued bool) error {
 	header := []byte{0, 0, 0, 0}
 
 	if _, err := io.ReadFull(c.br, header); err != nil {
@@ -446,7 +495,7 @@ func (c *Conn) readPacketTo(w io.Writer) error {
 	}
 
 	payloadLength := int(getBinaryUint24(header[0:3]))
-	if payloadLength < 1 {
+	if payloadLength < 1 && !continued {
 		return fmt.Errorf("invalid payload length %d", payloadLength)
 	}
 
@@ -467,7 +516,7 @@ func (c *Conn) readPacketTo(w io.Writer) error {
 		if payloadLength < maxPayloadLength {
 			return nil
 		}
-		if err := c.readPacketTo(w); err != nil {
+		if err := c.readContinuedPacketTo(w, true); err != nil {
 			return err
 		}
 	}
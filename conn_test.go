@@ -31,3 +31,22 @@ func TestNonEofPacketIsNotRecognizedAsEof(t *testing.T) {
 	assert.False(t, isEof1)
 	assert.False(t, isEof2)
 }
+
+func TestErrorPacketIsParsedAsMySQLError(t *testing.T) {
+	c := &Conn{capability: CLIENT_PROTOCOL_41}
+	input := append([]byte{ERR_HEADER, 0xd4, 0x04, '#', 'H', 'Y', '0', '0', '0'}, "binlog purged"...)
+
+	err := c.handleErrorPacket(input)
+
+	assert.Equal(t, &MySQLError{Code: 1236, State: "HY000", Message: "binlog purged"}, err)
+	assert.Equal(t, "ERROR 1236 (HY000): binlog purged", err.Error())
+}
+
+func TestShortErrorPacketIsMalformed(t *testing.T) {
+	c := new(Conn)
+	err := c.handleErrorPacket([]byte{ERR_HEADER, 0xd4})
+
+	assert.Error(t, err)
+	_, ok := err.(*MySQLError)
+	assert.False(t, ok)
+}
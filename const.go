@@ -17,6 +17,11 @@ const (
 	ERR_HEADER         byte = 0xff
 )
 
+// Server error codes
+const (
+	ER_MASTER_FATAL_ERROR_READING_BINLOG uint16 = 1236
+)
+
 // Types
 const (
 	MYSQL_TYPE_DECIMAL byte = iota
@@ -42,7 +47,8 @@ const (
 )
 
 const (
-	MYSQL_TYPE_NEWDECIMAL byte = iota + 0xf6
+	MYSQL_TYPE_JSON byte = iota + 0xf5 // 5.7+
+	MYSQL_TYPE_NEWDECIMAL
 	MYSQL_TYPE_ENUM
 	MYSQL_TYPE_SET
 	MYSQL_TYPE_TINY_BLOB
@@ -96,6 +102,9 @@ const (
 	BINLOG_DUMP_NON_BLOCK   uint16 = 0x1
 	BINLOG_THROUGH_POSITION uint16 = 0x2
 	BINLOG_THROUGH_GTID     uint16 = 0x4
+
+	// MariaDB only sends ANNOTATE_ROWS events to replicas that ask for them.
+	BINLOG_SEND_ANNOTATE_ROWS_EVENT uint16 = 0x2
 )
 
 // Binlog events
@@ -138,6 +147,28 @@ const (
 	GTID_LOG_EVENT
 	ANONYMOUS_GTID_LOG_EVENT
 	PREVIOUS_GTIDS_LOG_EVENT // 0x23
+	TRANSACTION_CONTEXT_EVENT
+	VIEW_CHANGE_EVENT
+	XA_PREPARE_LOG_EVENT
+	PARTIAL_UPDATE_ROWS_EVENT // 8.0+
+	TRANSACTION_PAYLOAD_EVENT // 8.0.20+
+	HEARTBEAT_LOG_EVENT_V2    // 0x29
+)
+
+// MariaDB binlog events
+const (
+	ANNOTATE_ROWS_EVENT EventType = iota + 160
+	BINLOG_CHECKPOINT_EVENT
+	MARIADB_GTID_EVENT
+	MARIADB_GTID_LIST_EVENT
+	START_ENCRYPTION_EVENT
+	QUERY_COMPRESSED_EVENT
+	WRITE_ROWS_COMPRESSED_EVENT_V1
+	UPDATE_ROWS_COMPRESSED_EVENT_V1
+	DELETE_ROWS_COMPRESSED_EVENT_V1
+	WRITE_ROWS_COMPRESSED_EVENT // compressed V2
+	UPDATE_ROWS_COMPRESSED_EVENT
+	DELETE_ROWS_COMPRESSED_EVENT // 0xab
 )
 
 func (e EventType) String() string {
@@ -214,6 +245,42 @@ func (e EventType) String() string {
 		return "AnonymousGTIDLogEvent"
 	case PREVIOUS_GTIDS_LOG_EVENT:
 		return "PreviousGTIDsLogEvent"
+	case TRANSACTION_CONTEXT_EVENT:
+		return "TransactionContextEvent"
+	case VIEW_CHANGE_EVENT:
+		return "ViewChangeEvent"
+	case XA_PREPARE_LOG_EVENT:
+		return "XAPrepareLogEvent"
+	case PARTIAL_UPDATE_ROWS_EVENT:
+		return "PartialUpdateRowsEvent"
+	case TRANSACTION_PAYLOAD_EVENT:
+		return "TransactionPayloadEvent"
+	case HEARTBEAT_LOG_EVENT_V2:
+		return "HeartbeatLogEventV2"
+	case ANNOTATE_ROWS_EVENT:
+		return "AnnotateRowsEvent"
+	case BINLOG_CHECKPOINT_EVENT:
+		return "BinlogCheckpointEvent"
+	case MARIADB_GTID_EVENT:
+		return "MariadbGTIDEvent"
+	case MARIADB_GTID_LIST_EVENT:
+		return "MariadbGTIDListEvent"
+	case START_ENCRYPTION_EVENT:
+		return "StartEncryptionEvent"
+	case QUERY_COMPRESSED_EVENT:
+		return "QueryCompressedEvent"
+	case WRITE_ROWS_COMPRESSED_EVENT_V1:
+		return "WriteRowsCompressedEventV1"
+	case UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		return "UpdateRowsCompressedEventV1"
+	case DELETE_ROWS_COMPRESSED_EVENT_V1:
+		return "DeleteRowsCompressedEventV1"
+	case WRITE_ROWS_COMPRESSED_EVENT:
+		return "WriteRowsCompressedEvent"
+	case UPDATE_ROWS_COMPRESSED_EVENT:
+		return "UpdateRowsCompressedEvent"
+	case DELETE_ROWS_COMPRESSED_EVENT:
+		return "DeleteRowsCompressedEvent"
 	default:
 		return "UnknownEvent"
 	}
@@ -53,6 +53,24 @@ func TestEventsAreMappedCorrectly(t *testing.T) {
 		{GTID_LOG_EVENT, "GTIDLogEvent"},
 		{ANONYMOUS_GTID_LOG_EVENT, "AnonymousGTIDLogEvent"},
 		{PREVIOUS_GTIDS_LOG_EVENT, "PreviousGTIDsLogEvent"},
+		{TRANSACTION_CONTEXT_EVENT, "TransactionContextEvent"},
+		{VIEW_CHANGE_EVENT, "ViewChangeEvent"},
+		{XA_PREPARE_LOG_EVENT, "XAPrepareLogEvent"},
+		{PARTIAL_UPDATE_ROWS_EVENT, "PartialUpdateRowsEvent"},
+		{TRANSACTION_PAYLOAD_EVENT, "TransactionPayloadEvent"},
+		{HEARTBEAT_LOG_EVENT_V2, "HeartbeatLogEventV2"},
+		{ANNOTATE_ROWS_EVENT, "AnnotateRowsEvent"},
+		{BINLOG_CHECKPOINT_EVENT, "BinlogCheckpointEvent"},
+		{MARIADB_GTID_EVENT, "MariadbGTIDEvent"},
+		{MARIADB_GTID_LIST_EVENT, "MariadbGTIDListEvent"},
+		{START_ENCRYPTION_EVENT, "StartEncryptionEvent"},
+		{QUERY_COMPRESSED_EVENT, "QueryCompressedEvent"},
+		{WRITE_ROWS_COMPRESSED_EVENT_V1, "WriteRowsCompressedEventV1"},
+		{UPDATE_ROWS_COMPRESSED_EVENT_V1, "UpdateRowsCompressedEventV1"},
+		{DELETE_ROWS_COMPRESSED_EVENT_V1, "DeleteRowsCompressedEventV1"},
+		{WRITE_ROWS_COMPRESSED_EVENT, "WriteRowsCompressedEvent"},
+		{UPDATE_ROWS_COMPRESSED_EVENT, "UpdateRowsCompressedEvent"},
+		{DELETE_ROWS_COMPRESSED_EVENT, "DeleteRowsCompressedEvent"},
 		{0xff, "UnknownEvent"},
 	}
 
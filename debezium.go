@@ -0,0 +1,448 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A DebeziumDecimalMode is how a DebeziumEncoder writes DECIMAL values, as
+// Debezium's decimal.handling.mode.
+type DebeziumDecimalMode int
+
+const (
+	DebeziumDecimalPrecise DebeziumDecimalMode = iota // base64 of the unscaled value, big-endian two's complement
+	DebeziumDecimalDouble                             // numbers
+	DebeziumDecimalString                             // decimal text
+)
+
+// DebeziumOptions configure a DebeziumEncoder.
+type DebeziumOptions struct {
+	// ServerName is Debezium's topic.prefix: the name of the server in source
+	// blocks, and the prefix of topic names.
+	ServerName string
+
+	// Version is the connector version given in source blocks.
+	Version string
+
+	// Decimals is how DECIMAL values are written. Parse events with
+	// ParserOptions.ExactDecimals for exact precise and string decimals.
+	Decimals DebeziumDecimalMode
+
+	// NoTombstones leaves out the tombstones that follow deletes, as
+	// tombstones.on.delete=false does.
+	NoTombstones bool
+
+	// Now returns the time records are made, for their ts_ms; nil means
+	// time.Now.
+	Now func() time.Time
+
+	// Schemas names the columns of tables whose table maps don't; see
+	// NewChangeStream.
+	Schemas func(database, table string) *TableSchema
+}
+
+// A DebeziumRecord is a Kafka record as Debezium's MySQL connector writes
+// it with the JSON converter and schemas.enable=false.
+type DebeziumRecord struct {
+	Topic string
+	Key   []byte // JSON, or nil for tables without a primary key
+	Value []byte // JSON, or nil for tombstones
+}
+
+// A DebeziumEncoder turns row changes, snapshot rows and DDL into the
+// records of Debezium's MySQL connector:
+//   - a change record for each row, to ServerName.database.table, keyed by
+//     its primary key
+//   - a tombstone after each delete of a row with a primary key, for log
+//     compaction
+//   - a schema change record for each DDL statement, to ServerName, keyed by
+//     its database; tableChanges is always empty, as the statements aren't
+//     parsed
+//
+// Values are written as Debezium does by default, with
+// time.precision.mode=adaptive_time_microseconds and binary.handling.mode=bytes:
+//   - DATE as days since the epoch, DATETIME as milliseconds since the epoch,
+//     or microseconds if it has more than 3 fractional digits, and TIME as
+//     microseconds
+//   - TIMESTAMP as UTC text, e.g. "2021-03-04T05:06:07.5Z"
+//   - zero dates as null
+//   - BIT(1) as booleans, and wider BITs as base64 little-endian bytes
+//   - ENUM and SET as their labels, parsed with ParserOptions.DecodeEnums
+//   - binary strings as base64, JSON as text and GEOMETRY as {"wkb", "srid"}
+//
+// Partial JSON updates can't be written; parse them with
+// ParserOptions.ApplyJSONDiffs.
+type DebeziumEncoder struct {
+	o       DebeziumOptions
+	tracker changeTracker
+	tx      string         // ID of the transaction of the last change
+	orders  map[string]int // changes to each table in that transaction
+}
+
+func NewDebeziumEncoder(o DebeziumOptions) *DebeziumEncoder {
+	return &DebeziumEncoder{o: o, tracker: changeTracker{schemas: o.Schemas}}
+}
+
+// Encode returns the records of an event. Events must be passed in the order
+// they were streamed, for the encoder to follow binlog positions and
+// transactions.
+func (enc *DebeziumEncoder) Encode(e *EventContainer) ([]DebeziumRecord, error) {
+	var records []DebeziumRecord
+	if q, ok := e.Event.(*QueryEvent); ok && !e.Filtered && enc.tracker.isDDL(q) {
+		records = append(records, enc.schemaChange(e.Header, q))
+	}
+
+	changes, err := enc.tracker.changes(e)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		change, err := enc.EncodeChange(c)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, change...)
+	}
+	return records, nil
+}
+
+// EncodeStream encodes the events of a stream, passing their records to emit,
+// until the stream or emit fail, and returns their error.
+func (enc *DebeziumEncoder) EncodeStream(s *Streamer, emit func(DebeziumRecord) error) error {
+	for {
+		e, err := s.GetEvent()
+		if err != nil {
+			return err
+		}
+		records, err := enc.Encode(e)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := emit(r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// EncodeChange returns the change record of a change, followed by a tombstone
+// for deletes.
+func (enc *DebeziumEncoder) EncodeChange(c *ChangeEvent) ([]DebeziumRecord, error) {
+	record := DebeziumRecord{Topic: enc.o.ServerName + "." + c.Database + "." + c.Table}
+
+	if c.Key.Values != nil {
+		var b bytes.Buffer
+		if err := enc.writeRow(&b, c.Key); err != nil {
+			return nil, fmt.Errorf("%s.%s: key %v", c.Database, c.Table, err)
+		}
+		record.Key = b.Bytes()
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"before":`)
+	if err := enc.writeRow(&b, c.Before); err != nil {
+		return nil, fmt.Errorf("%s.%s: before %v", c.Database, c.Table, err)
+	}
+	b.WriteString(`,"after":`)
+	if err := enc.writeRow(&b, c.After); err != nil {
+		return nil, fmt.Errorf("%s.%s: after %v", c.Database, c.Table, err)
+	}
+
+	b.WriteString(`,"source":`)
+	enc.writeSource(&b, &c.Source, c.Database, c.Table)
+	fmt.Fprintf(&b, `,"op":"%s","ts_ms":%d,"transaction":`, c.Op, enc.now())
+	if t := c.Transaction; t != nil {
+		if t.ID != enc.tx {
+			enc.tx = t.ID
+			enc.orders = make(map[string]int)
+		}
+		name := c.Database + "." + c.Table
+		enc.orders[name]++
+
+		b.WriteString(`{"id":`)
+		writeJSONString(&b, t.ID)
+		fmt.Fprintf(&b, `,"total_order":%d,"data_collection_order":%d}`, t.Sequence, enc.orders[name])
+	} else {
+		b.WriteString("null")
+	}
+	b.WriteString("}")
+	record.Value = b.Bytes()
+
+	records := []DebeziumRecord{record}
+	if c.Op == ChangeDelete && record.Key != nil && !enc.o.NoTombstones {
+		records = append(records, DebeziumRecord{Topic: record.Topic, Key: record.Key})
+	}
+	return records, nil
+}
+
+// schemaChange returns the schema change record of a DDL statement.
+func (enc *DebeziumEncoder) schemaChange(h *EventHeader, q *QueryEvent) DebeziumRecord {
+	t := &enc.tracker
+	source := &ChangeSource{
+		ServerID:  h.ServerId,
+		File:      t.file,
+		Pos:       h.LogPos,
+		GTID:      t.gtid,
+		Thread:    q.SlaveProxyID,
+		Timestamp: time.Unix(int64(h.Timestamp), 0).UTC(),
+		Snapshot:  h.Flags&LOG_EVENT_ARTIFICIAL_F != 0,
+		Query:     q.Query,
+	}
+	database := string(q.DatabaseName)
+
+	var key bytes.Buffer
+	key.WriteString(`{"databaseName":`)
+	writeJSONString(&key, database)
+	key.WriteString("}")
+
+	var b bytes.Buffer
+	b.WriteString(`{"source":`)
+	enc.writeSource(&b, source, database, "")
+	fmt.Fprintf(&b, `,"ts_ms":%d,"databaseName":`, enc.now())
+	writeJSONString(&b, database)
+	b.WriteString(`,"schemaName":null,"ddl":`)
+	writeJSONString(&b, string(q.Query))
+	b.WriteString(`,"tableChanges":[]}`)
+
+	return DebeziumRecord{Topic: enc.o.ServerName, Key: key.Bytes(), Value: b.Bytes()}
+}
+
+func (enc *DebeziumEncoder) now() int64 {
+	now := time.Now
+	if enc.o.Now != nil {
+		now = enc.o.Now
+	}
+	return now().UnixNano() / int64(time.Millisecond)
+}
+
+// writeSource writes the source block of a record; table is "" for schema
+// changes.
+func (enc *DebeziumEncoder) writeSource(b *bytes.Buffer, s *ChangeSource, database, table string) {
+	b.WriteString(`{"version":`)
+	writeJSONString(b, enc.o.Version)
+	b.WriteString(`,"connector":"mysql","name":`)
+	writeJSONString(b, enc.o.ServerName)
+	fmt.Fprintf(b, `,"ts_ms":%d,"snapshot":"%t","db":`, s.Timestamp.UnixNano()/int64(time.Millisecond), s.Snapshot)
+	writeJSONString(b, database)
+	b.WriteString(`,"sequence":null,"table":`)
+	if table != "" {
+		writeJSONString(b, table)
+	} else {
+		b.WriteString("null")
+	}
+	fmt.Fprintf(b, `,"server_id":%d,"gtid":`, s.ServerID)
+	if s.GTID != "" {
+		writeJSONString(b, s.GTID)
+	} else {
+		b.WriteString("null")
+	}
+	b.WriteString(`,"file":`)
+	writeJSONString(b, s.File)
+	fmt.Fprintf(b, `,"pos":%d,"row":%d,"thread":`, s.Pos, s.Row)
+	if s.Thread != 0 {
+		b.WriteString(strconv.FormatUint(uint64(s.Thread), 10))
+	} else {
+		b.WriteString("null")
+	}
+	b.WriteString(`,"query":`)
+	if s.Query != nil {
+		writeJSONString(b, string(s.Query))
+	} else {
+		b.WriteString("null")
+	}
+	b.WriteString("}")
+}
+
+// writeRow writes every column of a row, as null if the row image doesn't
+// hold it, or null for the zero Row.
+func (enc *DebeziumEncoder) writeRow(b *bytes.Buffer, r Row) error {
+	if r.Values == nil {
+		b.WriteString("null")
+		return nil
+	}
+
+	b.WriteString("{")
+	for j, v := range r.Values {
+		if j > 0 {
+			b.WriteString(",")
+		}
+		name := fmt.Sprintf("@%d", j+1)
+		if j < len(r.Names) {
+			name = r.Names[j]
+		}
+		writeJSONString(b, name)
+		b.WriteString(":")
+		if err := enc.writeValue(b, v); err != nil {
+			return fmt.Errorf("column %s: %v", name, err)
+		}
+	}
+	b.WriteString("}")
+	return nil
+}
+
+// writeValue writes a value as DebeziumEncoder describes.
+func (enc *DebeziumEncoder) writeValue(b *bytes.Buffer, v Value) error {
+	switch v.Kind() {
+	case AbsentKind, NullKind:
+		b.WriteString("null")
+		return nil
+	case DecimalKind:
+		return enc.writeDecimal(b, v)
+	case TimeKind:
+		return writeDebeziumTime(b, v)
+	case DurationKind:
+		d, err := v.Duration()
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatInt(int64(d/time.Microsecond), 10))
+		return nil
+	case JSONKind:
+		doc, err := v.JSON()
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, string(doc))
+		return nil
+	case JSONDiffKind:
+		return fmt.Errorf("partial JSON updates need ParserOptions.ApplyJSONDiffs")
+	case SetKind:
+		labels, err := v.Labels()
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, strings.Join(labels, ","))
+		return nil
+	}
+
+	switch v.tp {
+	case MYSQL_TYPE_BIT:
+		return writeDebeziumBits(b, v)
+	case MYSQL_TYPE_GEOMETRY:
+		if data, ok := v.Interface().([]byte); ok && len(data) >= 4 {
+			b.WriteString(`{"wkb":`)
+			writeJSONString(b, base64.StdEncoding.EncodeToString(data[4:]))
+			fmt.Fprintf(b, `,"srid":%d}`, binary.LittleEndian.Uint32(data))
+			return nil
+		}
+	}
+	return writeJSONValue(b, v)
+}
+
+// writeDecimal writes a DECIMAL value in the encoder's DebeziumDecimalMode.
+func (enc *DebeziumEncoder) writeDecimal(b *bytes.Buffer, v Value) error {
+	switch enc.o.Decimals {
+	case DebeziumDecimalDouble:
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		return nil
+	case DebeziumDecimalString:
+		d, err := v.Decimal()
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, d)
+		return nil
+	}
+
+	d, err := v.Decimal()
+	if err != nil {
+		return err
+	}
+	unscaled, ok := new(big.Int).SetString(strings.Replace(d, ".", "", 1), 10)
+	if !ok {
+		return fmt.Errorf("invalid decimal %q", d)
+	}
+	writeJSONString(b, base64.StdEncoding.EncodeToString(twosComplement(unscaled)))
+	return nil
+}
+
+// twosComplement returns the shortest big-endian two's complement of n, as
+// Java's BigInteger.toByteArray does.
+func twosComplement(n *big.Int) []byte {
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+
+	size := 1
+	for new(big.Int).Lsh(big.NewInt(-1), uint(8*size-1)).Cmp(n) > 0 {
+		size++
+	}
+	m := new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+	return m.Add(m, n).Bytes()
+}
+
+// writeDebeziumTime writes DATE values as days since the epoch, DATETIME
+// values as milliseconds or microseconds since the epoch, and TIMESTAMP
+// values as UTC text. Zero dates are null.
+func writeDebeziumTime(b *bytes.Buffer, v Value) error {
+	t, err := v.Time()
+	if err != nil {
+		if _, ok := v.Interface().(string); ok {
+			b.WriteString("null")
+			return nil
+		}
+		return err
+	}
+
+	switch v.tp {
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2:
+		writeJSONString(b, t.UTC().Format("2006-01-02T15:04:05.999999Z"))
+		return nil
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
+		days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+		b.WriteString(strconv.FormatInt(days, 10))
+		return nil
+	}
+
+	// DATETIME values are wall clock times, taken to be in UTC
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	if v.tp == MYSQL_TYPE_DATETIME2 && v.meta > 3 {
+		b.WriteString(strconv.FormatInt(wall.Unix()*1000000+int64(wall.Nanosecond()/1000), 10))
+	} else {
+		b.WriteString(strconv.FormatInt(wall.Unix()*1000+int64(wall.Nanosecond()/1000000), 10))
+	}
+	return nil
+}
+
+// writeDebeziumBits writes BIT(1) values as booleans, and wider ones as
+// base64 little-endian bytes.
+func writeDebeziumBits(b *bytes.Buffer, v Value) error {
+	numBits := int(v.meta>>8)*8 + int(v.meta&0xff)
+
+	var bits uint64
+	switch x := v.Interface().(type) {
+	case int64:
+		bits = uint64(x)
+	case string: // ParserOptions.BitStrings
+		var err error
+		if bits, err = strconv.ParseUint(x, 2, 64); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("can't read %T as bits", x)
+	}
+
+	if numBits == 1 {
+		b.WriteString(strconv.FormatBool(bits != 0))
+		return nil
+	}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, bits)
+	writeJSONString(b, base64.StdEncoding.EncodeToString(data[:(numBits+7)/8]))
+	return nil
+}
@@ -0,0 +1,229 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func debeziumOptions() DebeziumOptions {
+	return DebeziumOptions{
+		ServerName: "dbserver1",
+		Version:    "1.9.7.Final",
+		Now:        func() time.Time { return time.Unix(1700000000, 0) },
+	}
+}
+
+func encodeDebezium(t *testing.T, enc *DebeziumEncoder, events []*EventContainer) []DebeziumRecord {
+	var records []DebeziumRecord
+	for _, e := range events {
+		r, err := enc.Encode(e)
+		require.NoError(t, err)
+		records = append(records, r...)
+	}
+	return records
+}
+
+func TestDebeziumEncoderWritesChangeRecords(t *testing.T) {
+	events := changeTransactions(changeTable())
+	events = append(events[:2:2], append([]changeTestEvent{
+		{GTID_LOG_EVENT, 0, &GtidEvent{SID: []byte("0123456789abcdef"), GNO: 22}},
+		{QUERY_EVENT, 0, &QueryEvent{SlaveProxyID: 8, DatabaseName: []byte("shard767"),
+			Query: []byte("ALTER TABLE uploads ADD data BLOB")}},
+	}, events[2:]...)...)
+	parsed := parseChangeEvents(t, ParserOptions{ExactDecimals: true}, events)
+
+	records := encodeDebezium(t, NewDebeziumEncoder(debeziumOptions()), parsed)
+	require.Len(t, records, 6)
+
+	r := records[0]
+	assert.Equal(t, "dbserver1", r.Topic)
+	assert.Equal(t, `{"databaseName":"shard767"}`, string(r.Key))
+	assert.Equal(t, fmt.Sprintf(`{"source":{"version":"1.9.7.Final","connector":"mysql","name":"dbserver1",`+
+		`"ts_ms":1600000000000,"snapshot":"false","db":"shard767","sequence":null,"table":null,"server_id":1,`+
+		`"gtid":"30313233-3435-3637-3839-616263646566:22","file":"mysql-bin.000003","pos":%d,"row":0,"thread":8,`+
+		`"query":"ALTER TABLE uploads ADD data BLOB"},"ts_ms":1700000000000,"databaseName":"shard767",`+
+		`"schemaName":null,"ddl":"ALTER TABLE uploads ADD data BLOB","tableChanges":[]}`, parsed[3].Header.LogPos),
+		string(r.Value))
+
+	gtid := "30313233-3435-3637-3839-616263646566:23"
+	r = records[1]
+	assert.Equal(t, "dbserver1.shard767.uploads", r.Topic)
+	assert.Equal(t, `{"id":18446744073709551615}`, string(r.Key))
+	assert.Equal(t, fmt.Sprintf(`{"before":null,`+
+		`"after":{"id":18446744073709551615,"name":"first","size":"AJY=","data":"/wA="},`+
+		`"source":{"version":"1.9.7.Final","connector":"mysql","name":"dbserver1","ts_ms":1600000000000,`+
+		`"snapshot":"false","db":"shard767","sequence":null,"table":"uploads","server_id":1,"gtid":"%s",`+
+		`"file":"mysql-bin.000003","pos":%d,"row":0,"thread":null,"query":null},"op":"c","ts_ms":1700000000000,`+
+		`"transaction":{"id":"%s","total_order":1,"data_collection_order":1}}`, gtid, parsed[7].Header.LogPos, gtid),
+		string(r.Value))
+
+	type value struct {
+		Before, After map[string]interface{}
+		Op            string
+		Source        struct{ Row int }
+		Transaction   *struct {
+			TotalOrder          int `json:"total_order"`
+			DataCollectionOrder int `json:"data_collection_order"`
+		}
+	}
+	var values []value
+	for _, r := range records[1:5] {
+		require.True(t, json.Valid(r.Key), string(r.Key))
+		var v value
+		require.NoError(t, json.Unmarshal(r.Value, &v))
+		values = append(values, v)
+	}
+
+	assert.Equal(t, "c", values[1].Op)
+	assert.Equal(t, 1, values[1].Source.Row)
+	assert.Equal(t, 2, values[1].Transaction.TotalOrder)
+	assert.Equal(t, 2, values[1].Transaction.DataCollectionOrder)
+
+	// Columns the row image leaves out are null
+	assert.Equal(t, "u", values[2].Op)
+	assert.Equal(t, map[string]interface{}{"id": 2.0, "name": nil, "size": "5w==", "data": nil}, values[2].Before)
+	assert.Equal(t, map[string]interface{}{"id": 2.0, "name": nil, "size": "SZYC0g==", "data": nil}, values[2].After)
+	assert.Equal(t, 3, values[2].Transaction.TotalOrder)
+
+	// Transaction orders start over with each transaction
+	assert.Equal(t, "d", values[3].Op)
+	assert.Nil(t, values[3].After)
+	assert.Equal(t, 1, values[3].Transaction.TotalOrder)
+	assert.Equal(t, 1, values[3].Transaction.DataCollectionOrder)
+
+	// Deletes are followed by tombstones
+	assert.Equal(t, DebeziumRecord{Topic: "dbserver1.shard767.uploads", Key: []byte(`{"id":18446744073709551615}`)},
+		records[5])
+}
+
+func TestDebeziumEncoderOptions(t *testing.T) {
+	parsed := parseChangeEvents(t, ParserOptions{ExactDecimals: true}, changeTransactions(changeTable()))
+
+	o := debeziumOptions()
+	o.NoTombstones = true
+	o.Decimals = DebeziumDecimalString
+	records := encodeDebezium(t, NewDebeziumEncoder(o), parsed)
+	require.Len(t, records, 4)
+	assert.Contains(t, string(records[0].Value), `"size":"1.50"`)
+	assert.NotNil(t, records[3].Value)
+
+	// Tables without a primary key have unkeyed records and no tombstones
+	table := changeTable()
+	table.PrimaryKey = nil
+	parsed = parseChangeEvents(t, ParserOptions{ExactDecimals: true}, changeTransactions(table))
+	records = encodeDebezium(t, NewDebeziumEncoder(debeziumOptions()), parsed)
+	require.Len(t, records, 4)
+	for _, r := range records {
+		assert.Nil(t, r.Key)
+		assert.NotNil(t, r.Value)
+	}
+}
+
+func TestDebeziumEncoderWritesSnapshotRows(t *testing.T) {
+	table := changeTable()
+	records := encodeDebezium(t, NewDebeziumEncoder(debeziumOptions()), []*EventContainer{
+		snapshotEvent(TABLE_MAP_EVENT, table),
+		snapshotEvent(WRITE_ROWS_EVENT_V2, &RowsEvent{Table: table, TableID: 12, ColumnCount: 4,
+			ColumnBitmap1: []byte{0x0f}, Rows: [][]interface{}{{int64(3), "snap", 0.1, nil}}}),
+	})
+	require.Len(t, records, 1)
+
+	var value struct {
+		Op          string
+		Source      map[string]interface{}
+		Transaction interface{}
+	}
+	require.NoError(t, json.Unmarshal(records[0].Value, &value))
+	assert.Equal(t, "r", value.Op)
+	assert.Equal(t, "true", value.Source["snapshot"])
+	assert.Equal(t, "", value.Source["file"])
+	assert.Nil(t, value.Source["gtid"])
+	assert.Nil(t, value.Transaction)
+}
+
+func TestDebeziumEncoderEncodesStreams(t *testing.T) {
+	s := newStreamer()
+	for _, c := range parseChangeEvents(t, ParserOptions{ExactDecimals: true}, changeTransactions(changeTable())) {
+		s.ch <- c
+	}
+	s.closeWithError(errEndOfChanges)
+
+	var records []DebeziumRecord
+	err := NewDebeziumEncoder(debeziumOptions()).EncodeStream(s, func(r DebeziumRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	assert.Equal(t, errEndOfChanges, err)
+	assert.Len(t, records, 5)
+}
+
+func TestDebeziumValues(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.FixedZone("", 3600))
+	decimal := metaFromPrecAndDec(10, 2)
+
+	for _, tc := range []struct {
+		v        Value
+		decimals DebeziumDecimalMode
+		want     string
+	}{
+		{Value{}, 0, `null`},
+		{NewValue(nil, MYSQL_TYPE_LONG, 0, nil), 0, `null`},
+		{NewValue(int32(-7), MYSQL_TYPE_LONG, 0, nil), 0, `-7`},
+		{NewValue("1.50", MYSQL_TYPE_NEWDECIMAL, decimal, nil), DebeziumDecimalPrecise, `"AJY="`},
+		{NewValue("-1.50", MYSQL_TYPE_NEWDECIMAL, decimal, nil), DebeziumDecimalPrecise, `"/2o="`},
+		{NewValue("0.00", MYSQL_TYPE_NEWDECIMAL, decimal, nil), DebeziumDecimalPrecise, `"AA=="`},
+		{NewValue("-1.50", MYSQL_TYPE_NEWDECIMAL, decimal, nil), DebeziumDecimalDouble, `-1.5`},
+		{NewValue("-1.50", MYSQL_TYPE_NEWDECIMAL, decimal, nil), DebeziumDecimalString, `"-1.50"`},
+		{NewValue("2021-03-04", MYSQL_TYPE_DATE, 0, nil), 0, `18690`},
+		{NewValue("1969-12-31", MYSQL_TYPE_DATE, 0, nil), 0, `-1`},
+		{NewValue("0000-00-00", MYSQL_TYPE_DATE, 0, nil), 0, `null`},
+		{NewValue("2021-03-04 05:06:07", MYSQL_TYPE_DATETIME2, 0, nil), 0, `1614834367000`},
+		{NewValue("2021-03-04 05:06:07.5", MYSQL_TYPE_DATETIME2, 3, nil), 0, `1614834367500`},
+		{NewValue("2021-03-04 05:06:07.5", MYSQL_TYPE_DATETIME2, 6, nil), 0, `1614834367500000`},
+		{NewValue(ts, MYSQL_TYPE_TIMESTAMP2, 2, nil), 0, `"2021-03-04T04:06:07.89Z"`},
+		{NewValue("-838:59:59", MYSQL_TYPE_TIME2, 0, nil), 0, `-3020399000000`},
+		{NewValue(int64(1), MYSQL_TYPE_BIT, 1, nil), 0, `true`},
+		{NewValue(int64(0x201), MYSQL_TYPE_BIT, 1<<8|2, nil), 0, `"AQI="`},
+		{NewValue([]string{"a", "c"}, MYSQL_TYPE_SET, 1, nil), 0, `"a,c"`},
+		{NewValue("small", MYSQL_TYPE_ENUM, 1, nil), 0, `"small"`},
+		{NewValue([]byte(`{"a": 1}`), MYSQL_TYPE_JSON, 4, nil), 0, `"{\"a\": 1}"`},
+		{NewValue([]byte{0xe6, 0x10, 0, 0, 1, 2}, MYSQL_TYPE_GEOMETRY, 4, nil), 0, `{"wkb":"AQI=","srid":4326}`},
+	} {
+		o := debeziumOptions()
+		o.Decimals = tc.decimals
+		enc := NewDebeziumEncoder(o)
+
+		var b bytes.Buffer
+		if assert.NoError(t, enc.writeValue(&b, tc.v), tc.want) {
+			assert.Equal(t, tc.want, b.String())
+		}
+	}
+
+	var b bytes.Buffer
+	diffs := NewValue([]JSONDiff{{Operation: JSON_DIFF_REMOVE, Path: []byte("$.a")}}, MYSQL_TYPE_JSON, 4, nil)
+	assert.Error(t, NewDebeziumEncoder(debeziumOptions()).writeValue(&b, diffs))
+}
+
+func TestTwosComplement(t *testing.T) {
+	for _, tc := range []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x00, 0x80}},
+		{-1, []byte{0xff}},
+		{-128, []byte{0x80}},
+		{-129, []byte{0xff, 0x7f}},
+		{-32768, []byte{0x80, 0x00}},
+	} {
+		assert.Equal(t, tc.want, twosComplement(big.NewInt(tc.n)), "%d", tc.n)
+	}
+}
@@ -0,0 +1,205 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A BinlogEncoder serializes events back into binlog bytes. It is the mirror
+// image of BinlogParser: it keeps track of the format description and table
+// maps it has encoded, which rows events need, and of the position in the
+// binlog file the events are written to, so that every header gets the right
+// size and LogPos.
+type BinlogEncoder struct {
+	format  *FormatDescriptionEvent
+	tables  map[uint64]*TableMapEvent
+	options ParserOptions
+
+	// Position is the offset in the binlog file at which the next event will
+	// be written. It starts after the 4-byte magic number.
+	Position uint32
+}
+
+func NewBinlogEncoder() *BinlogEncoder {
+	return NewBinlogEncoderWithOptions(ParserOptions{})
+}
+
+// NewBinlogEncoderWithOptions returns a BinlogEncoder for rows events whose
+// values were decoded with the options: text is converted back to the
+// character sets DecodeCharsets decoded it from, ENUM and SET labels back to
+// their values, and TIMESTAMP strings are read in Location. Values that
+// options turn into NULLs, such as zero dates with ZeroDateNull, are encoded
+// as NULLs, and GEOMETRY values must be WKB.
+func NewBinlogEncoderWithOptions(o ParserOptions) *BinlogEncoder {
+	enc := new(BinlogEncoder)
+
+	enc.tables = make(map[uint64]*TableMapEvent)
+	enc.options = o
+	enc.Position = 4
+
+	return enc
+}
+
+// Encode serializes an event with the header fields of h. The event size and
+// LogPos are computed; the other header fields are copied. Artificial events
+// (LOG_EVENT_ARTIFICIAL_F) are not part of any file and get a LogPos of 0.
+// A rotate event moves Position to the start of the next file.
+func (enc *BinlogEncoder) Encode(h *EventHeader, e Event) ([]byte, error) {
+	return enc.encodeEvent(h, e, h.Flags&LOG_EVENT_ARTIFICIAL_F == 0)
+}
+
+// encodeEvent encodes an event, giving it a LogPos and moving Position past
+// it only if inFile is set.
+func (enc *BinlogEncoder) encodeEvent(h *EventHeader, e Event, inFile bool) ([]byte, error) {
+	w := new(eventWriter)
+	w.b = make([]byte, EventHeaderSize, 256)
+
+	if err := enc.encodeBody(w, h.EventType, e); err != nil {
+		return nil, err
+	}
+
+	size := uint32(len(w.b))
+	logPos := uint32(0)
+	if inFile {
+		logPos = enc.Position + size
+		enc.Position = logPos
+	}
+
+	b := w.b
+	binary.LittleEndian.PutUint32(b[0:], h.Timestamp)
+	b[4] = byte(h.EventType)
+	binary.LittleEndian.PutUint32(b[5:], h.ServerId)
+	binary.LittleEndian.PutUint32(b[9:], size)
+	binary.LittleEndian.PutUint32(b[13:], logPos)
+	binary.LittleEndian.PutUint16(b[17:], h.Flags)
+
+	switch e := e.(type) {
+	case *FormatDescriptionEvent:
+		enc.format = e
+	case *TableMapEvent:
+		enc.tables[e.TableID] = e
+	case *RotateEvent:
+		enc.tables = make(map[uint64]*TableMapEvent)
+		if inFile {
+			enc.Position = uint32(e.NextPosition)
+		}
+	}
+
+	return b, nil
+}
+
+func (enc *BinlogEncoder) encodeBody(w *eventWriter, t EventType, e Event) error {
+	switch e := e.(type) {
+	case *FormatDescriptionEvent:
+		e.encode(w)
+	case *RotateEvent:
+		e.encode(w)
+	case *TableMapEvent:
+		e.encode(w, enc.format)
+	case *RowsEvent:
+		table := e.Table
+		if table == nil {
+			table = enc.tables[e.TableID]
+		}
+		if table == nil {
+			return fmt.Errorf("no table map for table id %d", e.TableID)
+		}
+		if ut, ok := compressedRowsEventTypes[t]; ok {
+			return e.encodeCompressed(w, ut, table, &enc.options)
+		}
+		return e.encode(w, enc.format, t, table, &enc.options)
+	case *QueryEvent:
+		if t == QUERY_COMPRESSED_EVENT {
+			c := *e
+			c.Query = mariadbCompress(e.Query)
+			e = &c
+		}
+		e.encode(w)
+	case *XidEvent:
+		e.encode(w)
+	case *BeginLoadQueryEvent:
+		e.encode(w)
+	case *GtidEvent:
+		e.encode(w)
+	case *PreviousGTIDsEvent:
+		e.encode(w)
+	case *IntVarEvent:
+		e.encode(w)
+	case *RandEvent:
+		e.encode(w)
+	case *UserVarEvent:
+		e.encode(w)
+	case *RowsQueryEvent:
+		e.encode(w, t)
+	case *MariadbGtidEvent:
+		e.encode(w)
+	case *MariadbGtidListEvent:
+		e.encode(w)
+	case *BinlogCheckpointEvent:
+		e.encode(w)
+	case *TransactionPayloadEvent:
+		return e.encode(w, enc)
+	case *GenericEvent:
+		w.bytes(e.Data)
+	default:
+		return fmt.Errorf("can't encode %T", e)
+	}
+
+	return nil
+}
+
+// An eventWriter appends the fields of an event body; it is the counterpart
+// of eventReader.
+type eventWriter struct {
+	b []byte
+}
+
+func (w *eventWriter) bytes(b []byte) {
+	w.b = append(w.b, b...)
+}
+
+func (w *eventWriter) uint8(v uint8) {
+	w.b = append(w.b, v)
+}
+
+func (w *eventWriter) uint16(v uint16) {
+	w.b = append(w.b, putBinaryUint16(v)...)
+}
+
+func (w *eventWriter) uint32(v uint32) {
+	w.b = append(w.b, putBinaryUint32(v)...)
+}
+
+func (w *eventWriter) uint64(v uint64) {
+	w.b = append(w.b, putBinaryUint64(v)...)
+}
+
+// uintN writes the low n bytes of v, little-endian.
+func (w *eventWriter) uintN(v uint64, n int) {
+	for i := 0; i < n; i++ {
+		w.b = append(w.b, byte(v>>(uint(i)*8)))
+	}
+}
+
+// uintNBigEndian writes the low n bytes of v, big-endian.
+func (w *eventWriter) uintNBigEndian(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.b = append(w.b, byte(v>>(uint(i)*8)))
+	}
+}
+
+func (w *eventWriter) lengthEncodedInt(v uint64) {
+	w.b = append(w.b, putLengthEncodedInt(v)...)
+}
+
+func (w *eventWriter) lengthEncodedBytes(b []byte) {
+	w.lengthEncodedInt(uint64(len(b)))
+	w.bytes(b)
+}
+
+// padBytes returns b cut or zero-padded to n bytes.
+func padBytes(b []byte, n int) []byte {
+	p := make([]byte, n)
+	copy(p, b)
+	return p
+}
@@ -0,0 +1,323 @@
+package binlog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeValueMatchesParseFixtures(t *testing.T) {
+	fixtures := []struct {
+		tp    byte
+		tests []parseTest
+	}{
+		{MYSQL_TYPE_NEWDECIMAL, decimalTests},
+		{MYSQL_TYPE_BIT, bitTests},
+		{MYSQL_TYPE_YEAR, yearTests},
+		{MYSQL_TYPE_VARCHAR, varcharTests},
+		{MYSQL_TYPE_STRING, stringTests},
+	}
+
+	for _, f := range fixtures {
+		for _, pt := range f.tests {
+			w := new(eventWriter)
+			err := encodeValue(w, f.tp, pt.inMeta, pt.wantVal)
+
+			if assert.NoError(t, err, "type %d, value %v", f.tp, pt.wantVal) {
+				assert.Equal(t, pt.inData[:pt.wantLen], w.b, "type %d, value %v", f.tp, pt.wantVal)
+			}
+		}
+	}
+}
+
+func TestEncodeValueRoundTrips(t *testing.T) {
+	ts := time.Unix(1500000000, 0)
+
+	tests := []struct {
+		tp    byte
+		meta  uint16
+		value interface{}
+	}{
+		{MYSQL_TYPE_TINY, 0, int8(-5)},
+		{MYSQL_TYPE_SHORT, 0, int16(-300)},
+		{MYSQL_TYPE_INT24, 0, int32(-70000)},
+		{MYSQL_TYPE_LONG, 0, int32(2000000000)},
+		{MYSQL_TYPE_LONGLONG, 0, int64(-9000000000)},
+		{MYSQL_TYPE_FLOAT, 0, float32(1.5)},
+		{MYSQL_TYPE_DOUBLE, 0, float64(-2.25)},
+		{MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(8, 2), float64(123456.78)},
+		{MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(20, 0), float64(-12345678901234)},
+		{MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(12, 11), float64(0.12345678901)},
+		{MYSQL_TYPE_BIT, 1<<8 | 3, int64(1500)},
+		{MYSQL_TYPE_SET, 2, int64(3)},
+		{MYSQL_TYPE_SET, 8, int64(-1)},
+		{MYSQL_TYPE_ENUM, 1, int64(2)},
+		{MYSQL_TYPE_ENUM, 2, int64(300)},
+		{MYSQL_TYPE_TIMESTAMP, 0, ts},
+		{MYSQL_TYPE_DATETIME, 0, time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)},
+		{MYSQL_TYPE_TIMESTAMP2, 0, ts.Format(TimeFormat)},
+		{MYSQL_TYPE_TIMESTAMP2, 3, ts.Format(TimeFormat)},
+		{MYSQL_TYPE_TIMESTAMP2, 0, "0000-00-00 00:00:00"},
+		{MYSQL_TYPE_DATETIME2, 0, "2017-07-14 02:40:00"},
+		{MYSQL_TYPE_DATETIME2, 6, "1999-12-31 23:59:59"},
+		{MYSQL_TYPE_TIME, 0, "12:34:56"},
+		{MYSQL_TYPE_TIME2, 0, "12:34:56"},
+		{MYSQL_TYPE_TIME2, 2, "-01:02:03"},
+		{MYSQL_TYPE_TIME2, 4, "01:02:03"},
+		{MYSQL_TYPE_TIME2, 6, "838:59:59"},
+		{MYSQL_TYPE_DATE, 0, "2017-07-14"},
+		{MYSQL_TYPE_YEAR, 0, "2017"},
+		{MYSQL_TYPE_YEAR, 0, "0000"},
+		{MYSQL_TYPE_BLOB, 2, []byte("blob")},
+		{MYSQL_TYPE_GEOMETRY, 4, []byte("\x00\x00\x00\x00\x01\x01\x00\x00\x00")},
+		{MYSQL_TYPE_VARCHAR, 300, "two-byte length prefix"},
+		{MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_STRING)<<8 | 10, "char"},
+		{MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_ENUM)<<8 | 1, int64(3)},
+		{MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_SET)<<8 | 2, int64(5)},
+	}
+
+	for _, tt := range tests {
+		w := new(eventWriter)
+		require.NoError(t, encodeValue(w, tt.tp, tt.meta, tt.value), "type %d, value %v", tt.tp, tt.value)
+
+		v, n, err := parseValue(w.b, tt.tp, tt.meta)
+		if assert.NoError(t, err, "type %d, value %v", tt.tp, tt.value) {
+			assert.Equal(t, tt.value, v, "type %d", tt.tp)
+			assert.Equal(t, len(w.b), n, "type %d, value %v", tt.tp, tt.value)
+		}
+	}
+}
+
+func TestEncodeValueRoundTripsParsedTimes(t *testing.T) {
+	o := &ParserOptions{ParseTime: true, BitStrings: true, Location: time.UTC}
+
+	tests := []struct {
+		tp    byte
+		meta  uint16
+		value interface{}
+	}{
+		{MYSQL_TYPE_TIMESTAMP2, 6, time.Date(2017, 7, 14, 2, 40, 0, 123456000, time.UTC)},
+		{MYSQL_TYPE_TIMESTAMP2, 3, time.Date(2017, 7, 14, 2, 40, 0, 5000000, time.UTC)},
+		{MYSQL_TYPE_DATETIME2, 6, time.Date(1999, 12, 31, 23, 59, 59, 999999000, time.UTC)},
+		{MYSQL_TYPE_DATETIME2, 1, time.Date(2017, 7, 14, 2, 40, 0, 500000000, time.UTC)},
+		{MYSQL_TYPE_DATE, 0, time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC)},
+		{MYSQL_TYPE_TIME2, 0, 12*time.Hour + 34*time.Minute + 56*time.Second},
+		{MYSQL_TYPE_TIME2, 2, -(time.Hour + 2*time.Minute + 3*time.Second + 450*time.Millisecond)},
+		{MYSQL_TYPE_TIME2, 4, -(3*time.Second + 1200*time.Microsecond)},
+		{MYSQL_TYPE_TIME2, 4, 3*time.Second + 1200*time.Microsecond},
+		{MYSQL_TYPE_TIME2, 6, -(838*time.Hour + 59*time.Minute + 59*time.Second)},
+		{MYSQL_TYPE_TIME2, 6, 5*time.Second + 7*time.Microsecond},
+		{MYSQL_TYPE_YEAR, 0, int64(2017)},
+		{MYSQL_TYPE_BIT, 5, "00101"},
+		{MYSQL_TYPE_BIT, 1<<8 | 3, "00000000101"},
+	}
+
+	for _, tt := range tests {
+		w := new(eventWriter)
+		require.NoError(t, encodeValue(w, tt.tp, tt.meta, tt.value), "type %d, value %v", tt.tp, tt.value)
+
+		v, n, err := o.parseValue(w.b, tt.tp, tt.meta)
+		if assert.NoError(t, err, "type %d, value %v", tt.tp, tt.value) {
+			assert.Equal(t, tt.value, v, "type %d", tt.tp)
+			assert.Equal(t, len(w.b), n, "type %d, value %v", tt.tp, tt.value)
+		}
+	}
+}
+
+func TestEncodeValueRejectsWrongTypes(t *testing.T) {
+	w := new(eventWriter)
+
+	assert.Error(t, encodeValue(w, MYSQL_TYPE_LONG, 0, "1"))
+	assert.Error(t, encodeValue(w, MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(4, 2), float64(100)))
+	assert.Error(t, encodeValue(w, MYSQL_TYPE_SET, 16, int64(3)))
+	assert.Error(t, encodeValue(w, MYSQL_TYPE_BIT, 5, "00102"))
+	assert.Error(t, encodeValue(w, MYSQL_TYPE_TIME2, 0, "noon"))
+}
+
+func TestEncoderRoundTripsFixtures(t *testing.T) {
+	p := NewBinlogParser()
+	enc := NewBinlogEncoder()
+
+	for _, input := range [][]byte{
+		bytes.Join([][]byte{formatEventHeader, formatDescriptionEvent}, []byte{}),
+		bytes.Join([][]byte{tableMapEventHeader, tableMapEvent}, []byte{}),
+		eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent),
+		eventWithHeader(QUERY_EVENT, queryEvent),
+		eventWithHeader(XID_EVENT, xidEvent),
+		bytes.Join([][]byte{rotateEventHeader, rotateEvent}, []byte{}),
+	} {
+		e, err := p.Parse(input)
+		require.NoError(t, err)
+
+		output, err := enc.Encode(e.Header, e.Event)
+		require.NoError(t, err)
+
+		// Everything but the log position survives the round trip.
+		want := append([]byte(nil), input...)
+		copy(want[13:17], output[13:17])
+		assert.Equal(t, want, output, "%s", e.Header.EventType)
+	}
+}
+
+func TestEncoderTracksLogPosition(t *testing.T) {
+	enc := NewBinlogEncoder()
+
+	fde, err := enc.Encode(&EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, testFormatDescription())
+	require.NoError(t, err)
+	h, _ := NewEventHeader(fde)
+	assert.Equal(t, uint32(len(fde)), h.EventSize)
+	assert.Equal(t, uint32(4+len(fde)), h.LogPos)
+
+	xid, err := enc.Encode(&EventHeader{EventType: XID_EVENT}, &XidEvent{Xid: 1})
+	require.NoError(t, err)
+	h, _ = NewEventHeader(xid)
+	assert.Equal(t, uint32(4+len(fde)+len(xid)), h.LogPos)
+	assert.Equal(t, h.LogPos, enc.Position)
+
+	// Artificial events aren't part of the file.
+	fake, err := enc.Encode(&EventHeader{EventType: ROTATE_EVENT, Flags: LOG_EVENT_ARTIFICIAL_F},
+		&RotateEvent{NextPosition: 4, NextFile: []byte("mysql-bin.000001")})
+	require.NoError(t, err)
+	h, _ = NewEventHeader(fake)
+	assert.Equal(t, uint32(0), h.LogPos)
+	assert.Equal(t, uint32(4+len(fde)+len(xid)), enc.Position)
+
+	// A real rotate event ends the file.
+	_, err = enc.Encode(&EventHeader{EventType: ROTATE_EVENT},
+		&RotateEvent{NextPosition: 4, NextFile: []byte("mysql-bin.000002")})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4), enc.Position)
+}
+
+func testFormatDescription() *FormatDescriptionEvent {
+	e, _ := NewFormatDescriptionEvent(formatDescriptionEvent)
+	return e.(*FormatDescriptionEvent)
+}
+
+func TestEncodedRowsEventsParse(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:      12,
+		DatabaseName: []byte("shard767"),
+		TableName:    []byte("uploads"),
+		ColumnCount:  6,
+		ColumnTypes: []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_BLOB,
+			MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_DATETIME2, MYSQL_TYPE_DOUBLE},
+		ColumnMetadata: []uint16{0, 255, 2, metaFromPrecAndDec(10, 2), 0, 8},
+		NullBitVector:  []byte{0x3e},
+	}
+
+	write := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   6,
+		ColumnBitmap1: []byte{0x3f},
+		Rows: [][]interface{}{
+			{int64(1), "first", []byte("data"), float64(12.5), "2017-07-14 02:40:00", float64(0.25)},
+			{int64(2), nil, nil, nil, nil, nil},
+		},
+	}
+	update := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   6,
+		ColumnBitmap1: []byte{0x3f},
+		ColumnBitmap2: []byte{0x03},
+		Rows: [][]interface{}{
+			{int64(1), "first", []byte("data"), float64(12.5), "2017-07-14 02:40:00", float64(0.25)},
+			{int64(1), "renamed", nil, nil, nil, nil},
+		},
+	}
+
+	enc := NewBinlogEncoder()
+	p := NewBinlogParser()
+
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{WRITE_ROWS_EVENT_V1, write},
+		{UPDATE_ROWS_EVENT_V1, update},
+		{DELETE_ROWS_EVENT_V1, write},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+
+		parsed, err := p.Parse(b)
+		require.NoError(t, err, "%s", e.t)
+
+		if re, ok := parsed.Event.(*RowsEvent); ok {
+			assert.Equal(t, tme, re.Table)
+			assert.Equal(t, e.e.(*RowsEvent).Rows, re.Rows)
+		} else {
+			assert.Equal(t, e.e, parsed.Event)
+		}
+	}
+}
+
+func TestEncodedRowsEventsParseWithOptions(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:          12,
+		DatabaseName:     []byte("shard767"),
+		TableName:        []byte("uploads"),
+		ColumnCount:      5,
+		ColumnTypes:      []byte{MYSQL_TYPE_VARCHAR, MYSQL_TYPE_STRING, MYSQL_TYPE_STRING, MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_BIT},
+		ColumnMetadata:   []uint16{255, uint16(MYSQL_TYPE_ENUM)<<8 | 1, uint16(MYSQL_TYPE_SET)<<8 | 1, 3, 5},
+		NullBitVector:    []byte{0x1f},
+		ColumnCollations: []uint16{8, 0, 0, 0, 0},
+		ColumnValues:     [][]string{nil, {"small", "large"}, {"a", "b", "c"}, nil, nil},
+	}
+	write := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   5,
+		ColumnBitmap1: []byte{0x1f},
+		Rows: [][]interface{}{
+			{"caf\u00e9", "large", []string{"a", "c"}, time.Date(2017, 7, 14, 2, 40, 0, 250000000, time.UTC), "00101"},
+			{"", "", []string{}, nil, nil},
+		},
+	}
+
+	o := ParserOptions{ParseTime: true, DecodeCharsets: true, DecodeEnums: true, BitStrings: true, Location: time.UTC}
+	enc := NewBinlogEncoderWithOptions(o)
+	p := NewBinlogParserWithOptions(o)
+
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{WRITE_ROWS_EVENT_V1, write},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+
+		parsed, err := p.Parse(b)
+		require.NoError(t, err, "%s", e.t)
+
+		if re, ok := parsed.Event.(*RowsEvent); ok {
+			assert.Equal(t, write.Rows, re.Rows)
+		}
+	}
+
+	// Labels the column doesn't have can't be encoded.
+	_, err := enc.Encode(&EventHeader{EventType: WRITE_ROWS_EVENT_V1}, &RowsEvent{
+		TableID:       12,
+		ColumnCount:   5,
+		ColumnBitmap1: []byte{0x1f},
+		Rows:          [][]interface{}{{"", "medium", nil, nil, nil}},
+	})
+	assert.Error(t, err)
+}
+
+func TestEncodingRowsWithoutTableMapFails(t *testing.T) {
+	_, err := NewBinlogEncoder().Encode(&EventHeader{EventType: WRITE_ROWS_EVENT_V1}, &RowsEvent{TableID: 99})
+	assert.Error(t, err)
+}
+
+func TestEncodingExecuteLoadQueryEventFails(t *testing.T) {
+	_, err := NewBinlogEncoder().Encode(&EventHeader{EventType: EXECUTE_LOAD_QUERY_EVENT}, &ExecuteLoadQueryEvent{})
+	assert.Error(t, err)
+}
@@ -1,23 +1,54 @@
 package binlog
 
+import (
+	"fmt"
+)
+
 // An EventContainer represents a single event from a raw MySQL binlog stream.
 // A Streamer receives these events through a Follower and processes them.
 type EventContainer struct {
 	Header *EventHeader // parsed event header
 	Event  Event        // parsed event body
 	Bytes  []byte       // event body as raw bytes
+
+	// Filtered is set on events the parser's ReplicationFilter leaves out.
+	Filtered bool
 }
 
 // Event represents the real data in an EventContainer, in a possibly-parsed form.
 type Event interface {
 }
 
+// An EventError describes an event that could not be parsed.
 type EventError struct {
-	Header *EventHeader
-	Err    string
-	Data   []byte
+	Header    *EventHeader
+	Err       string
+	Data      []byte
+	EventType EventType
+	Offset    int // offset of the malformed field from the start of the event, header included; -1 if unknown
+	Column    int // index of the column whose value is malformed; -1 if none
 }
 
 func (e *EventError) Error() string {
 	return e.Err
 }
+
+// newEventError wraps an error from an event decoder, keeping the offset and
+// column of decodeErrors.
+func newEventError(h *EventHeader, data []byte, err error) *EventError {
+	e := &EventError{Header: h, Data: data, EventType: h.EventType, Offset: -1, Column: -1}
+
+	msg := err.Error()
+	if de, ok := err.(*decodeError); ok {
+		e.Offset = EventHeaderSize + de.offset
+		e.Column = de.column
+
+		msg = fmt.Sprintf("%s at offset %d", de.msg, e.Offset)
+		if e.Column >= 0 {
+			msg = fmt.Sprintf("column %d: %s", e.Column, msg)
+		}
+	}
+	e.Err = fmt.Sprintf("%s: %s", h.EventType, msg)
+
+	return e
+}
@@ -13,7 +13,7 @@ var (
 func TestEventErrorContainsError(t *testing.T) {
 	h, _ := NewEventHeader(someEventHeader)
 	s := "test error"
-	e := &EventError{h, s, []byte{}}
+	e := &EventError{Header: h, Err: s, Data: []byte{}}
 
 	assert.Equal(t, e.Error(), s)
 }
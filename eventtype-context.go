@@ -0,0 +1,237 @@
+package binlog
+
+import (
+	"math"
+)
+
+// In this file: events that carry the context a statement-based QUERY_EVENT
+// needs to be replayed. They precede the query they belong to.
+
+// IntVarEvent types
+const (
+	INVALID_INT_EVENT    uint8 = 0
+	LAST_INSERT_ID_EVENT uint8 = 1
+	INSERT_ID_EVENT      uint8 = 2
+)
+
+// "Written every time a statement uses an AUTO_INCREMENT column or the
+// LAST_INSERT_ID() function."
+type IntVarEvent struct {
+	Type  uint8 // LAST_INSERT_ID_EVENT or INSERT_ID_EVENT
+	Value uint64
+}
+
+// Payload is structured as follows:
+//
+//	1 byte (uint8) for the variable type
+//	8 bytes (uint64) for the value
+func NewIntVarEvent(b []byte) (Event, error) {
+	e := new(IntVarEvent)
+	r := newEventReader(b)
+
+	e.Type = r.uint8()
+	e.Value = r.uint64()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+func (e *IntVarEvent) encode(w *eventWriter) {
+	w.uint8(e.Type)
+	w.uint64(e.Value)
+}
+
+// "Written every time a statement uses the RAND() function." The seeds are
+// the state of the random number generator before the statement ran.
+type RandEvent struct {
+	Seed1 uint64
+	Seed2 uint64
+}
+
+func NewRandEvent(b []byte) (Event, error) {
+	e := new(RandEvent)
+	r := newEventReader(b)
+
+	e.Seed1 = r.uint64()
+	e.Seed2 = r.uint64()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+func (e *RandEvent) encode(w *eventWriter) {
+	w.uint64(e.Seed1)
+	w.uint64(e.Seed2)
+}
+
+// UserVarEvent value types (Item_result in the server)
+const (
+	STRING_RESULT  uint8 = 0
+	REAL_RESULT    uint8 = 1
+	INT_RESULT     uint8 = 2
+	ROW_RESULT     uint8 = 3
+	DECIMAL_RESULT uint8 = 4
+)
+
+// UserVarEvent flags
+const (
+	USER_VAR_UNSIGNED_F uint8 = 0x01
+)
+
+// "Written every time a statement uses a user variable."
+type UserVarEvent struct {
+	Name    []byte
+	IsNull  bool
+	Type    uint8  // STRING_RESULT, REAL_RESULT, INT_RESULT or DECIMAL_RESULT
+	Charset uint32 // collation ID of a string value
+	Flags   uint8  // USER_VAR_UNSIGNED_F
+	Data    []byte // value as logged
+
+	// Value is Data decoded: nil, string converted to UTF-8 from Charset
+	// ([]byte for the binary charset), float64, int64 (uint64 if unsigned)
+	// or float64 for decimals.
+	Value interface{}
+}
+
+// Payload is structured as follows:
+//
+//	4 bytes (uint32) for the name length, then the name
+//	1 byte for whether the value is NULL; if it isn't:
+//	  1 byte for the value type
+//	  4 bytes (uint32) for the charset
+//	  4 bytes (uint32) for the value length, then the value
+//	  (5.6+) 1 byte for the flags
+//
+// Decimals are logged as 1 byte precision, 1 byte scale, then the binary
+// DECIMAL format used in rows events.
+func NewUserVarEvent(b []byte) (Event, error) {
+	e := new(UserVarEvent)
+	r := newEventReader(b)
+
+	nameLength := r.uint32()
+	e.Name = r.bytes(int(nameLength))
+	e.IsNull = r.uint8() != 0
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if e.IsNull {
+		return e, nil
+	}
+
+	e.Type = r.uint8()
+	e.Charset = r.uint32()
+	valueLength := r.uint32()
+	start := r.i
+	e.Data = r.bytes(int(valueLength))
+
+	if r.len() > 0 {
+		e.Flags = r.uint8()
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	switch e.Type {
+	case STRING_RESULT:
+		if e.Charset == uint32(BINARY_COLLATION_ID) {
+			e.Value = e.Data
+			break
+		}
+		v, err := decodeCharset(e.Data, CollationCharset(uint16(e.Charset)))
+		if err != nil {
+			r.i = start
+			r.fail("%v", err)
+			break
+		}
+		e.Value = v
+	case REAL_RESULT:
+		if len(e.Data) != 8 {
+			r.i = start
+			r.fail("REAL value needs 8 bytes, have %d", len(e.Data))
+			break
+		}
+		e.Value = math.Float64frombits(getBinaryUint64(e.Data))
+	case INT_RESULT:
+		if len(e.Data) != 8 {
+			r.i = start
+			r.fail("INT value needs 8 bytes, have %d", len(e.Data))
+			break
+		}
+		if e.Flags&USER_VAR_UNSIGNED_F != 0 {
+			e.Value = getBinaryUint64(e.Data)
+		} else {
+			e.Value = getBinaryInt64(e.Data)
+		}
+	case DECIMAL_RESULT:
+		if len(e.Data) < 2 {
+			r.i = start
+			r.fail("DECIMAL value needs 2 bytes, have %d", len(e.Data))
+			break
+		}
+		meta := uint16(e.Data[0])<<8 | uint16(e.Data[1])
+		v, _, err := parseDecimalType(e.Data[2:], meta)
+		if err != nil {
+			r.i = start + 2
+			r.fail("%v", err)
+			break
+		}
+		e.Value = v
+	default:
+		r.i = start
+		r.fail("unknown user variable type %d", e.Type)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+func (e *UserVarEvent) encode(w *eventWriter) {
+	w.uint32(uint32(len(e.Name)))
+	w.bytes(e.Name)
+	if e.IsNull {
+		w.uint8(1)
+		return
+	}
+	w.uint8(0)
+	w.uint8(e.Type)
+	w.uint32(e.Charset)
+	w.uint32(uint32(len(e.Data)))
+	w.bytes(e.Data)
+	w.uint8(e.Flags)
+}
+
+// A StatementContext holds the INTVAR, RAND and USER_VAR events that preceded
+// a QueryEvent, which are needed to reproduce LAST_INSERT_ID(), RAND() and
+// @var values when the statement is replayed.
+type StatementContext struct {
+	IntVars  []*IntVarEvent
+	Rand     *RandEvent
+	UserVars []*UserVarEvent
+}
+
+// add records a context event. It returns false if e isn't one.
+func (c *StatementContext) add(e Event) bool {
+	switch e := e.(type) {
+	case *IntVarEvent:
+		c.IntVars = append(c.IntVars, e)
+	case *RandEvent:
+		c.Rand = e
+	case *UserVarEvent:
+		c.UserVars = append(c.UserVars, e)
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *StatementContext) empty() bool {
+	return len(c.IntVars) == 0 && c.Rand == nil && len(c.UserVars) == 0
+}
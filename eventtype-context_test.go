@@ -0,0 +1,118 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	intVarEvent = []byte{
+		// Type
+		2,
+		// Value
+		42, 0, 0, 0, 0, 0, 0, 0,
+	}
+	randEvent = []byte{
+		// Seed 1
+		0x19, 0xb1, 0x5c, 0x2f, 0, 0, 0, 0,
+		// Seed 2
+		0x9d, 0x4e, 0x63, 0x07, 0, 0, 0, 0,
+	}
+)
+
+// userVarEvent builds a USER_VAR_EVENT body for a non-NULL @v.
+func userVarEvent(tp uint8, charset uint32, value []byte, flags uint8) []byte {
+	w := new(eventWriter)
+	(&UserVarEvent{Name: []byte("v"), Type: tp, Charset: charset, Data: value, Flags: flags}).encode(w)
+	return w.b
+}
+
+func TestEventCanBeParsedAsIntVarEvent(t *testing.T) {
+	e, err := NewIntVarEvent(intVarEvent)
+
+	require.NoError(t, err)
+	assert.Equal(t, &IntVarEvent{Type: INSERT_ID_EVENT, Value: 42}, e)
+}
+
+func TestEventCanBeParsedAsRandEvent(t *testing.T) {
+	e, err := NewRandEvent(randEvent)
+
+	require.NoError(t, err)
+	assert.Equal(t, &RandEvent{Seed1: 0x2f5cb119, Seed2: 0x07634e9d}, e)
+}
+
+func TestUserVarEventValues(t *testing.T) {
+	tests := []struct {
+		input []byte
+		want  interface{}
+	}{
+		{userVarEvent(STRING_RESULT, 33, []byte("utf8 text"), 0), "utf8 text"},
+		{userVarEvent(STRING_RESULT, uint32(BINARY_COLLATION_ID), []byte{0, 1, 2}, 0), []byte{0, 1, 2}},
+		{userVarEvent(STRING_RESULT, 8, []byte("caf\xe9"), 0), "caf\u00e9"},
+		{userVarEvent(STRING_RESULT, 54, []byte{0, 'h', 0, 'i'}, 0), "hi"},
+		{userVarEvent(REAL_RESULT, 33, []byte{0, 0, 0, 0, 0, 0, 0x04, 0x40}, 0), float64(2.5)},
+		{userVarEvent(INT_RESULT, 33, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 0), int64(-2)},
+		{userVarEvent(INT_RESULT, 33, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, USER_VAR_UNSIGNED_F), uint64(18446744073709551614)},
+		{userVarEvent(DECIMAL_RESULT, 33, append([]byte{4, 2}, decimalTests[0].inData[:2]...), 0), float64(-99.99)},
+	}
+
+	for _, tt := range tests {
+		e, err := NewUserVarEvent(tt.input)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte("v"), e.(*UserVarEvent).Name)
+			assert.Equal(t, tt.want, e.(*UserVarEvent).Value)
+		}
+	}
+}
+
+func TestNullUserVarEvent(t *testing.T) {
+	input := []byte{1, 0, 0, 0, 'v', 1}
+
+	e, err := NewUserVarEvent(input)
+
+	require.NoError(t, err)
+	assert.Equal(t, &UserVarEvent{Name: []byte("v"), IsNull: true}, e)
+}
+
+func TestUserVarEventFromOlderServersHasNoFlags(t *testing.T) {
+	input := userVarEvent(INT_RESULT, 33, []byte{7, 0, 0, 0, 0, 0, 0, 0}, 0)
+
+	e, err := NewUserVarEvent(input[:len(input)-1])
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), e.(*UserVarEvent).Value)
+}
+
+func TestMalformedUserVarEventsFail(t *testing.T) {
+	for _, input := range [][]byte{
+		userVarEvent(INT_RESULT, 33, []byte{1, 2, 3}, 0),
+		userVarEvent(REAL_RESULT, 33, nil, 0),
+		userVarEvent(DECIMAL_RESULT, 33, []byte{4}, 0),
+		userVarEvent(DECIMAL_RESULT, 33, []byte{99, 2, 0}, 0),
+		userVarEvent(ROW_RESULT, 33, nil, 0),
+		{200, 0, 0, 0, 'v'},
+	} {
+		_, err := NewUserVarEvent(input)
+		assert.Error(t, err, "%v", input)
+	}
+}
+
+func TestContextEventsRoundTripThroughEncoder(t *testing.T) {
+	p := NewBinlogParser()
+
+	for _, input := range [][]byte{
+		eventWithHeader(INTVAR_EVENT, intVarEvent),
+		eventWithHeader(RAND_EVENT, randEvent),
+		eventWithHeader(USER_VAR_EVENT, userVarEvent(STRING_RESULT, 33, []byte("x"), 0)),
+		eventWithHeader(USER_VAR_EVENT, []byte{1, 0, 0, 0, 'v', 1}),
+	} {
+		e, err := p.Parse(input)
+		require.NoError(t, err)
+
+		output, err := NewBinlogEncoder().Encode(e.Header, e.Event)
+		require.NoError(t, err)
+		assert.Equal(t, input[EventHeaderSize:], output[EventHeaderSize:])
+	}
+}
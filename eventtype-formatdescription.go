@@ -1,7 +1,6 @@
 package binlog
 
 import (
-	"encoding/binary"
 	"errors"
 )
 
@@ -16,43 +15,60 @@ type FormatDescriptionEvent struct {
 }
 
 // Payload is structured as follows for MySQL v5.5:
-//   2 bytes (uint16) for binlog version
-//   50 bytes for server version string (padded with '\0's)
-//   4 bytes (uint32) for created timestamp. Note that this value may be
-//     unpopulated
-//   1 byte (uint8) for total header size, where total header size = common header
-//     size + extra headers size
-//   1 byte per event type for event's fixed length data size. Note that unknown
-//     events doesn't have an entry
-//   27 bytes for events' fixed size length (one uint8 entry per event type except
-//     unknown events)
+//
+//	2 bytes (uint16) for binlog version
+//	50 bytes for server version string (padded with '\0's)
+//	4 bytes (uint32) for created timestamp. Note that this value may be
+//	  unpopulated
+//	1 byte (uint8) for total header size, where total header size = common header
+//	  size + extra headers size
+//	1 byte per event type for event's fixed length data size. Note that unknown
+//	  events doesn't have an entry
+//	27 bytes for events' fixed size length (one uint8 entry per event type except
+//	  unknown events)
 func NewFormatDescriptionEvent(b []byte) (Event, error) {
 	e := new(FormatDescriptionEvent)
-	i := 0
+	r := newEventReader(b)
 
 	// Version of this binlog format (2 bytes); should always be 4
-	e.BinlogVersion = binary.LittleEndian.Uint16(b[i : i+2])
-	i = i + 2
+	e.BinlogVersion = r.uint16()
 
 	// Version of the MySQL server that created the binlog (string[50])
 	e.ServerVersion = make([]byte, 50)
-	copy(e.ServerVersion, b[i:i+50])
-	i = i + 50
+	copy(e.ServerVersion, r.bytes(50))
 
 	// Seconds since Unix epoch when the binlog was created (4 bytes)
-	e.CreationTimestamp = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.CreationTimestamp = r.uint32()
 
 	// Length of the binlog event header of following events; should always match
 	// const EventHeaderSize (1 byte)
-	e.EventHeaderLength = b[i]
-	i = i + 1
-	if e.EventHeaderLength != byte(EventHeaderSize) {
+	e.EventHeaderLength = r.uint8()
+	if r.err == nil && e.EventHeaderLength != byte(EventHeaderSize) {
 		return nil, errors.New("invalid event header length")
 	}
 
 	// An array indexed by binlogeventtype - 1 to extract the length of the event-specific header (string[p])
-	e.EventTypeHeaderLengths = b[i:]
+	e.EventTypeHeaderLengths = r.rest()
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
+
+// postHeaderLength returns the post-header length of events of type t, or -1
+// if the format description doesn't list that type.
+func (e *FormatDescriptionEvent) postHeaderLength(t EventType) int {
+	if e == nil || t == 0 || int(t) > len(e.EventTypeHeaderLengths) {
+		return -1
+	}
+	return int(e.EventTypeHeaderLengths[t-1])
+}
+
+func (e *FormatDescriptionEvent) encode(w *eventWriter) {
+	w.uint16(e.BinlogVersion)
+	w.bytes(padBytes(e.ServerVersion, 50))
+	w.uint32(e.CreationTimestamp)
+	w.uint8(e.EventHeaderLength)
+	w.bytes(e.EventTypeHeaderLengths)
+}
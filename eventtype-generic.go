@@ -1,9 +1,5 @@
 package binlog
 
-import (
-	"encoding/binary"
-)
-
 // In this file: events that are irrelevant to us.
 
 // "Transaction ID for 2PC, written whenever a COMMIT is expected."
@@ -13,64 +9,90 @@ type XidEvent struct {
 
 func NewXidEvent(b []byte) (Event, error) {
 	e := new(XidEvent)
+	r := newEventReader(b)
 
 	// XID (8 bytes)
-	e.Xid = binary.LittleEndian.Uint64(b)
+	e.Xid = r.uint64()
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
 
+func (e *XidEvent) encode(w *eventWriter) {
+	w.uint64(e.Xid)
+}
+
 // The query event is used to send text queries the correct binlog.
 type QueryEvent struct {
 	SlaveProxyID  uint32
 	ExecutionTime uint32
 	ErrorCode     uint16
-	StatusVars    []byte
+	StatusVars    []byte       // status variables as logged
+	Status        *QueryStatus // status variables decoded
 	DatabaseName  []byte
 	Query         []byte
+
+	// Context holds the INTVAR, RAND and USER_VAR events logged before the
+	// query. It is set by the Streamer, and nil if there were none.
+	Context *StatementContext
 }
 
 func NewQueryEvent(b []byte) (Event, error) {
 	e := new(QueryEvent)
-	i := 0
+	r := newEventReader(b)
 
 	// Slave proxy ID (4 bytes)
-	e.SlaveProxyID = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.SlaveProxyID = r.uint32()
 
 	// Execution time (4 bytes)
-	e.ExecutionTime = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.ExecutionTime = r.uint32()
 
 	// Database name length (1 byte)
-	dbNameLength := uint8(b[i])
-	i = i + 1
+	dbNameLength := r.uint8()
 
 	// Error code (2 bytes)
-	e.ErrorCode = binary.LittleEndian.Uint16(b[i : i+2])
-	i = i + 2
+	e.ErrorCode = r.uint16()
 
 	// Status-vars length (2 bytes)
-	statusVarsLength := binary.LittleEndian.Uint16(b[i : i+2])
-	i = i + 2
+	statusVarsLength := r.uint16()
 
 	// Status-vars (string[$len])
-	e.StatusVars = b[i : i+int(statusVarsLength)]
-	i = i + int(statusVarsLength)
+	sr := r.sub(int(statusVarsLength))
+	e.StatusVars = sr.b[sr.i:]
+	e.Status = parseQueryStatus(sr)
+	if sr.err != nil {
+		return nil, sr.err
+	}
 
 	// DatabaseName (string[$len])
-	e.DatabaseName = b[i : i+int(dbNameLength)]
-	i = i + int(dbNameLength)
+	e.DatabaseName = r.bytes(int(dbNameLength))
 
 	// Skip [00] byte
-	i = i + 1
+	r.skip(1)
 
 	// Query (string[EOF])
-	e.Query = b[i:]
+	e.Query = r.rest()
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
 
+func (e *QueryEvent) encode(w *eventWriter) {
+	w.uint32(e.SlaveProxyID)
+	w.uint32(e.ExecutionTime)
+	w.uint8(uint8(len(e.DatabaseName)))
+	w.uint16(e.ErrorCode)
+	w.uint16(uint16(len(e.StatusVars)))
+	w.bytes(e.StatusVars)
+	w.bytes(e.DatabaseName)
+	w.uint8(0)
+	w.bytes(e.Query)
+}
+
 // "truncate a file and set block-data"
 type BeginLoadQueryEvent struct {
 	FileID    uint32
@@ -79,19 +101,27 @@ type BeginLoadQueryEvent struct {
 
 func NewBeginLoadQueryEvent(b []byte) (Event, error) {
 	e := new(BeginLoadQueryEvent)
-
-	i := 0
+	r := newEventReader(b)
 
 	// File ID (4)
-	e.FileID = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.FileID = r.uint32()
 
 	// Block data (string[EOF])
-	e.BlockData = b[i:]
+	e.BlockData = r.rest()
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
 
+func (e *BeginLoadQueryEvent) encode(w *eventWriter) {
+	w.uint32(e.FileID)
+	w.bytes(e.BlockData)
+}
+
+// ExecuteLoadQueryEvent keeps only the fixed part of the event, so unlike the
+// other typed events it can't be encoded again.
 type ExecuteLoadQueryEvent struct {
 	SlaveProxyID     uint32
 	ExecutionTime    uint32
@@ -106,43 +136,38 @@ type ExecuteLoadQueryEvent struct {
 
 func NewExecuteLoadQueryEvent(b []byte) (Event, error) {
 	e := new(ExecuteLoadQueryEvent)
-	i := 0
+	r := newEventReader(b)
 
 	// Slave proxy ID (4 bytes)
-	e.SlaveProxyID = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.SlaveProxyID = r.uint32()
 
 	// Execution time (4 bytes)
-	e.ExecutionTime = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.ExecutionTime = r.uint32()
 
 	// Schema length (1 byte)
-	e.SchemaLength = uint8(b[i])
-	i = i + 1
+	e.SchemaLength = r.uint8()
 
 	// Error code (2 bytes)
-	e.ErrorCode = binary.LittleEndian.Uint16(b[i : i+2])
-	i = i + 2
+	e.ErrorCode = r.uint16()
 
 	// Status-vars length (2 byte)
-	e.StatusVars = binary.LittleEndian.Uint16(b[i : i+2])
-	i = i + 2
+	e.StatusVars = r.uint16()
 
 	// File ID (4 bytes)
-	e.FileID = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.FileID = r.uint32()
 
 	// Start position (4 nytes)
-	e.StartPos = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.StartPos = r.uint32()
 
 	// End position (4 bytes)
-	e.EndPos = binary.LittleEndian.Uint32(b[i : i+4])
-	i = i + 4
+	e.EndPos = r.uint32()
 
 	// Dup handling flags (1 byte)
-	e.DupHandlingFlags = uint8(b[i])
+	e.DupHandlingFlags = r.uint8()
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
 
@@ -156,3 +181,45 @@ func NewGenericEvent(b []byte) (Event, error) {
 	e.Data = b
 	return e, nil
 }
+
+// "The SQL text of the statement that caused the rows events that follow",
+// logged with binlog_rows_query_log_events. MariaDB's ANNOTATE_ROWS_EVENT
+// carries the same text and is decoded into this type too.
+type RowsQueryEvent struct {
+	Query []byte
+}
+
+// Payload is structured as follows:
+//
+//	1 byte (uint8) for the query length, which is truncated and unused
+//	Query (string[EOF])
+func NewRowsQueryEvent(b []byte) (Event, error) {
+	e := new(RowsQueryEvent)
+	r := newEventReader(b)
+
+	r.skip(1)
+	e.Query = r.rest()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+// An ANNOTATE_ROWS_EVENT body is the query text alone.
+func NewAnnotateRowsEvent(b []byte) (Event, error) {
+	e := new(RowsQueryEvent)
+	e.Query = b
+	return e, nil
+}
+
+func (e *RowsQueryEvent) encode(w *eventWriter, t EventType) {
+	if t == ROWS_QUERY_EVENT {
+		n := len(e.Query)
+		if n > 0xff {
+			n = 0xff
+		}
+		w.uint8(uint8(n))
+	}
+	w.bytes(e.Query)
+}
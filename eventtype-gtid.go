@@ -0,0 +1,216 @@
+package binlog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// A GtidEvent starts a transaction and carries its global transaction ID.
+// ANONYMOUS_GTID_LOG_EVENTs have the same layout, with a zero SID and GNO.
+type GtidEvent struct {
+	CommitFlag uint8
+	SID        []byte // 16-byte UUID of the server the transaction originated on
+	GNO        int64  // transaction number on that server
+
+	// Logical clock for parallel replication (5.7+); zero if not logged
+	LastCommitted  int64
+	SequenceNumber int64
+
+	// Commit timestamps in microseconds since the Unix epoch, the transaction
+	// size and the versions of the servers involved (8.0+); zero if not logged
+	ImmediateCommitTimestamp uint64
+	OriginalCommitTimestamp  uint64
+	TransactionLength        uint64
+	ImmediateServerVersion   uint32
+	OriginalServerVersion    uint32
+}
+
+const (
+	logicalTimestampTypeCode = 2
+	commitTimestampLength    = 7
+	originalFlag             = uint64(1) << 55 // set on a commit timestamp that is followed by another
+	serverVersionFlag        = uint32(1) << 31
+)
+
+// Payload is structured as follows:
+//
+//	1 byte (uint8) for the commit flag
+//	16 bytes for the SID
+//	8 bytes (int64) for the GNO
+//	(5.7+) 1 byte logical timestamp type code, then 8 bytes each for
+//	  last_committed and sequence_number
+//	(8.0+) 7 bytes for the immediate commit timestamp; if its top bit is set,
+//	  7 more bytes for the original commit timestamp
+//	(8.0+) 1 to 9 bytes (net_store_length) for the transaction length
+//	(8.0+) 4 bytes for the immediate server version; if its top bit is set, 4
+//	  more bytes for the original server version
+func NewGtidEvent(b []byte) (Event, error) {
+	e := new(GtidEvent)
+	r := newEventReader(b)
+
+	e.CommitFlag = r.uint8()
+	e.SID = r.bytes(16)
+	e.GNO = int64(r.uint64())
+
+	if r.len() > 0 && r.b[r.i] == logicalTimestampTypeCode {
+		r.skip(1)
+		e.LastCommitted = int64(r.uint64())
+		e.SequenceNumber = int64(r.uint64())
+	}
+
+	if r.len() >= commitTimestampLength {
+		e.ImmediateCommitTimestamp = r.uintN(commitTimestampLength)
+		e.OriginalCommitTimestamp = e.ImmediateCommitTimestamp
+		if e.ImmediateCommitTimestamp&originalFlag != 0 {
+			e.ImmediateCommitTimestamp &^= originalFlag
+			e.OriginalCommitTimestamp = r.uintN(commitTimestampLength)
+		}
+
+		if r.len() > 0 {
+			e.TransactionLength = r.lengthEncodedInt()
+		}
+
+		if r.len() >= 4 {
+			e.ImmediateServerVersion = r.uint32()
+			e.OriginalServerVersion = e.ImmediateServerVersion
+			if e.ImmediateServerVersion&serverVersionFlag != 0 {
+				e.ImmediateServerVersion &^= serverVersionFlag
+				e.OriginalServerVersion = r.uint32()
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+// GTID returns the transaction's global ID in the usual UUID:GNO form.
+func (e *GtidEvent) GTID() string {
+	return fmt.Sprintf("%s:%d", formatUUID(e.SID), e.GNO)
+}
+
+func (e *GtidEvent) encode(w *eventWriter) {
+	w.uint8(e.CommitFlag)
+	w.bytes(padBytes(e.SID, 16))
+	w.uint64(uint64(e.GNO))
+
+	hasTimestamps := e.ImmediateCommitTimestamp != 0 || e.OriginalCommitTimestamp != 0
+	if e.LastCommitted == 0 && e.SequenceNumber == 0 && !hasTimestamps {
+		return
+	}
+
+	w.uint8(logicalTimestampTypeCode)
+	w.uint64(uint64(e.LastCommitted))
+	w.uint64(uint64(e.SequenceNumber))
+
+	if !hasTimestamps {
+		return
+	}
+
+	if e.OriginalCommitTimestamp != e.ImmediateCommitTimestamp {
+		w.uintN(e.ImmediateCommitTimestamp|originalFlag, commitTimestampLength)
+		w.uintN(e.OriginalCommitTimestamp, commitTimestampLength)
+	} else {
+		w.uintN(e.ImmediateCommitTimestamp, commitTimestampLength)
+	}
+
+	w.lengthEncodedInt(e.TransactionLength)
+
+	if e.ImmediateServerVersion == 0 && e.OriginalServerVersion == 0 {
+		return
+	}
+	if e.OriginalServerVersion != e.ImmediateServerVersion {
+		w.uint32(e.ImmediateServerVersion | serverVersionFlag)
+		w.uint32(e.OriginalServerVersion)
+	} else {
+		w.uint32(e.ImmediateServerVersion)
+	}
+}
+
+// A GTIDInterval is a range of transaction numbers, from Start up to but not
+// including Stop.
+type GTIDInterval struct {
+	Start int64
+	Stop  int64
+}
+
+// SIDIntervals are the transactions executed for one server UUID.
+type SIDIntervals struct {
+	SID       []byte
+	Intervals []GTIDInterval
+}
+
+// A PreviousGTIDsEvent starts every binlog file with GTIDs on and lists the
+// transactions executed before it.
+type PreviousGTIDsEvent struct {
+	Sets []SIDIntervals
+}
+
+// Payload is structured as follows:
+//
+//	8 bytes (uint64) for the number of SIDs
+//	for each SID: 16 bytes for the SID, 8 bytes (uint64) for the number of
+//	  intervals, then 8 bytes each for the start and stop of every interval
+func NewPreviousGTIDsEvent(b []byte) (Event, error) {
+	e := new(PreviousGTIDsEvent)
+	r := newEventReader(b)
+
+	n := r.uint64()
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		s := SIDIntervals{SID: r.bytes(16)}
+
+		count := r.uint64()
+		if r.err == nil && count > uint64(r.len()/16) {
+			r.fail("%d intervals don't fit in the event", count)
+		}
+		for j := uint64(0); j < count && r.err == nil; j++ {
+			s.Intervals = append(s.Intervals, GTIDInterval{Start: int64(r.uint64()), Stop: int64(r.uint64())})
+		}
+
+		e.Sets = append(e.Sets, s)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+// String returns the GTID set in the form MySQL prints it, e.g.
+// 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7.
+func (e *PreviousGTIDsEvent) String() string {
+	sets := make([]string, len(e.Sets))
+	for i, s := range e.Sets {
+		parts := []string{formatUUID(s.SID)}
+		for _, in := range s.Intervals {
+			if in.Stop-in.Start == 1 {
+				parts = append(parts, fmt.Sprintf("%d", in.Start))
+			} else {
+				parts = append(parts, fmt.Sprintf("%d-%d", in.Start, in.Stop-1))
+			}
+		}
+		sets[i] = strings.Join(parts, ":")
+	}
+	return strings.Join(sets, ",")
+}
+
+func (e *PreviousGTIDsEvent) encode(w *eventWriter) {
+	w.uint64(uint64(len(e.Sets)))
+	for _, s := range e.Sets {
+		w.bytes(padBytes(s.SID, 16))
+		w.uint64(uint64(len(s.Intervals)))
+		for _, in := range s.Intervals {
+			w.uint64(uint64(in.Start))
+			w.uint64(uint64(in.Stop))
+		}
+	}
+}
+
+// formatUUID formats a 16-byte SID as a UUID.
+func formatUUID(b []byte) string {
+	h := hex.EncodeToString(padBytes(b, 16))
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
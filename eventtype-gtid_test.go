@@ -0,0 +1,100 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSID = []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+	gtidEvent = append(append([]byte{
+		// Commit flag
+		1},
+		// SID
+		testSID...),
+		// GNO
+		42, 0, 0, 0, 0, 0, 0, 0,
+	)
+
+	previousGTIDsEvent = append(append([]byte{
+		// Number of SIDs
+		1, 0, 0, 0, 0, 0, 0, 0},
+		// SID
+		testSID...),
+		// Number of intervals
+		2, 0, 0, 0, 0, 0, 0, 0,
+		// 1-5
+		1, 0, 0, 0, 0, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0,
+		// 7
+		7, 0, 0, 0, 0, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0,
+	)
+)
+
+func TestEventCanBeParsedAsGtidEvent(t *testing.T) {
+	e, err := NewGtidEvent(gtidEvent)
+	require.NoError(t, err)
+
+	assert.Equal(t, &GtidEvent{CommitFlag: 1, SID: testSID, GNO: 42}, e)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:42", e.(*GtidEvent).GTID())
+}
+
+func TestGtidEventWithLogicalClockAndTimestampsRoundTrips(t *testing.T) {
+	events := []*GtidEvent{
+		{CommitFlag: 1, SID: testSID, GNO: 42, LastCommitted: 7, SequenceNumber: 8},
+		{CommitFlag: 1, SID: testSID, GNO: 42, LastCommitted: 7, SequenceNumber: 8,
+			ImmediateCommitTimestamp: 1500000000000000, OriginalCommitTimestamp: 1500000000000000,
+			TransactionLength: 300, ImmediateServerVersion: 80019, OriginalServerVersion: 80019},
+		{CommitFlag: 1, SID: testSID, GNO: 42, LastCommitted: 7, SequenceNumber: 8,
+			ImmediateCommitTimestamp: 1500000000000001, OriginalCommitTimestamp: 1500000000000000,
+			TransactionLength: 300, ImmediateServerVersion: 80019, OriginalServerVersion: 50730},
+	}
+
+	for _, want := range events {
+		w := new(eventWriter)
+		want.encode(w)
+
+		e, err := NewGtidEvent(w.b)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, e)
+		}
+	}
+}
+
+func TestEventCanBeParsedAsPreviousGTIDsEvent(t *testing.T) {
+	e, err := NewPreviousGTIDsEvent(previousGTIDsEvent)
+	require.NoError(t, err)
+
+	assert.Equal(t, &PreviousGTIDsEvent{Sets: []SIDIntervals{{
+		SID:       testSID,
+		Intervals: []GTIDInterval{{1, 6}, {7, 8}},
+	}}}, e)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7", e.(*PreviousGTIDsEvent).String())
+}
+
+func TestPreviousGTIDsEventWithTooManyIntervalsFails(t *testing.T) {
+	input := append([]byte(nil), previousGTIDsEvent...)
+	input[24] = 0xff
+
+	_, err := NewPreviousGTIDsEvent(input)
+	assert.Error(t, err)
+}
+
+func TestGtidEventsRoundTripThroughEncoder(t *testing.T) {
+	p := NewBinlogParser()
+
+	for _, input := range [][]byte{
+		eventWithHeader(GTID_LOG_EVENT, gtidEvent),
+		eventWithHeader(ANONYMOUS_GTID_LOG_EVENT, gtidEvent),
+		eventWithHeader(PREVIOUS_GTIDS_LOG_EVENT, previousGTIDsEvent),
+	} {
+		e, err := p.Parse(input)
+		require.NoError(t, err)
+
+		output, err := NewBinlogEncoder().Encode(e.Header, e.Event)
+		require.NoError(t, err)
+		assert.Equal(t, input[EventHeaderSize:], output[EventHeaderSize:])
+	}
+}
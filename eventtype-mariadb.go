@@ -0,0 +1,276 @@
+package binlog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// In this file: events only MariaDB writes.
+
+// MariadbGtidEvent flags
+const (
+	MARIADB_FL_STANDALONE      uint8 = 0x01 // no BEGIN; the transaction is a single statement
+	MARIADB_FL_GROUP_COMMIT_ID uint8 = 0x02 // a commit ID follows
+	MARIADB_FL_TRANSACTIONAL   uint8 = 0x04
+	MARIADB_FL_ALLOW_PARALLEL  uint8 = 0x08
+	MARIADB_FL_WAITED          uint8 = 0x10
+	MARIADB_FL_DDL             uint8 = 0x20
+)
+
+const mariadbGtidEventLength = 19
+
+// A MariadbGtidEvent starts a MariaDB transaction, taking the place of BEGIN.
+type MariadbGtidEvent struct {
+	GTID     MariadbGTID
+	Flags    uint8
+	CommitID uint64 // transactions that group-committed together share it
+}
+
+// Payload is structured as follows:
+//
+//	8 bytes (uint64) for the sequence number
+//	4 bytes (uint32) for the domain ID
+//	1 byte (uint8) for the flags
+//	if MARIADB_FL_GROUP_COMMIT_ID is set, 8 bytes (uint64) for the commit ID
+//	the rest is padding, or XA information we don't decode
+//
+// The server ID of the GTID is the one in the event header.
+func NewMariadbGtidEvent(serverID uint32, b []byte) (Event, error) {
+	e := new(MariadbGtidEvent)
+	r := newEventReader(b)
+
+	e.GTID.ServerID = serverID
+	e.GTID.SequenceNumber = r.uint64()
+	e.GTID.DomainID = r.uint32()
+	e.Flags = r.uint8()
+
+	if e.Flags&MARIADB_FL_GROUP_COMMIT_ID != 0 {
+		e.CommitID = r.uint64()
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+func (e *MariadbGtidEvent) encode(w *eventWriter) {
+	start := len(w.b)
+
+	w.uint64(e.GTID.SequenceNumber)
+	w.uint32(e.GTID.DomainID)
+	w.uint8(e.Flags)
+	if e.Flags&MARIADB_FL_GROUP_COMMIT_ID != 0 {
+		w.uint64(e.CommitID)
+	}
+
+	if n := len(w.b) - start; n < mariadbGtidEventLength {
+		w.bytes(make([]byte, mariadbGtidEventLength-n))
+	}
+}
+
+// A MariadbGtidListEvent starts every MariaDB binlog file with the last GTID
+// of each domain written before it.
+type MariadbGtidListEvent struct {
+	Flags uint8
+	GTIDs MariadbGTIDList
+}
+
+// Payload is structured as follows:
+//
+//	4 bytes (uint32): the GTID count in the low 28 bits, flags in the top 4
+//	for each GTID: 4 bytes domain ID, 4 bytes server ID, 8 bytes sequence
+//	  number
+func NewMariadbGtidListEvent(b []byte) (Event, error) {
+	e := new(MariadbGtidListEvent)
+	r := newEventReader(b)
+
+	v := r.uint32()
+	count := v & 0x0fffffff
+	e.Flags = uint8(v >> 28)
+
+	if r.err == nil && uint64(count)*16 > uint64(r.len()) {
+		r.fail("%d GTIDs don't fit in the event", count)
+	}
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		var g MariadbGTID
+		g.DomainID = r.uint32()
+		g.ServerID = r.uint32()
+		g.SequenceNumber = r.uint64()
+		e.GTIDs = append(e.GTIDs, g)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+func (e *MariadbGtidListEvent) encode(w *eventWriter) {
+	w.uint32(uint32(len(e.GTIDs)) | uint32(e.Flags)<<28)
+	for _, g := range e.GTIDs {
+		w.uint32(g.DomainID)
+		w.uint32(g.ServerID)
+		w.uint64(g.SequenceNumber)
+	}
+}
+
+// A BinlogCheckpointEvent names the oldest binlog file MariaDB still needs for
+// crash recovery.
+type BinlogCheckpointEvent struct {
+	File []byte
+}
+
+func NewBinlogCheckpointEvent(b []byte) (Event, error) {
+	e := new(BinlogCheckpointEvent)
+	r := newEventReader(b)
+
+	n := r.uint32()
+	e.File = r.bytes(int(n))
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return e, nil
+}
+
+func (e *BinlogCheckpointEvent) encode(w *eventWriter) {
+	w.uint32(uint32(len(e.File)))
+	w.bytes(e.File)
+}
+
+// NewCompressedQueryEvent decodes a QUERY_COMPRESSED_EVENT, written with
+// log_bin_compress. It has the layout of a QUERY_EVENT whose query text is
+// compressed; the event is returned with the text uncompressed.
+func NewCompressedQueryEvent(b []byte) (Event, error) {
+	e, err := NewQueryEvent(b)
+	if err != nil {
+		return nil, err
+	}
+
+	q := e.(*QueryEvent)
+	offset := len(b) - len(q.Query)
+	if q.Query, err = mariadbUncompress(q.Query); err != nil {
+		return nil, &decodeError{offset: offset, column: -1, msg: err.Error()}
+	}
+	return q, nil
+}
+
+// compressedRowsEventTypes maps MariaDB's compressed rows events to the
+// uncompressed event types they wrap.
+var compressedRowsEventTypes = map[EventType]EventType{
+	WRITE_ROWS_COMPRESSED_EVENT_V1:  WRITE_ROWS_EVENT_V1,
+	UPDATE_ROWS_COMPRESSED_EVENT_V1: UPDATE_ROWS_EVENT_V1,
+	DELETE_ROWS_COMPRESSED_EVENT_V1: DELETE_ROWS_EVENT_V1,
+	WRITE_ROWS_COMPRESSED_EVENT:     WRITE_ROWS_EVENT_V2,
+	UPDATE_ROWS_COMPRESSED_EVENT:    UPDATE_ROWS_EVENT_V2,
+	DELETE_ROWS_COMPRESSED_EVENT:    DELETE_ROWS_EVENT_V2,
+}
+
+// NewCompressedRowsEvent decodes a compressed rows event. Everything after
+// the table ID and flags (and the v2 extra data length) is compressed.
+// Errors in the compressed part are reported at its start, as offsets into
+// the uncompressed data have no meaning in the event.
+func NewCompressedRowsEvent(tables map[uint64]*TableMapEvent, eventType EventType, b []byte) (Event, error) {
+	return newCompressedRowsEvent(tables, eventType, b, nil)
+}
+
+func newCompressedRowsEvent(tables map[uint64]*TableMapEvent, eventType EventType, b []byte, o *ParserOptions) (Event, error) {
+	t, ok := compressedRowsEventTypes[eventType]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a compressed rows event", eventType)
+	}
+
+	postHeaderLength := 8
+	if isRowsEventV2(t) {
+		postHeaderLength = 10
+	}
+	if len(b) < postHeaderLength {
+		return nil, &decodeError{offset: len(b), column: -1,
+			msg: fmt.Sprintf("need %d bytes, have %d", postHeaderLength, len(b))}
+	}
+
+	body, err := mariadbUncompress(b[postHeaderLength:])
+	if err != nil {
+		return nil, &decodeError{offset: postHeaderLength, column: -1, msg: err.Error()}
+	}
+
+	e, err := newRowsEvent(nil, tables, t, append(append([]byte(nil), b[:postHeaderLength]...), body...), o)
+	if de, ok := err.(*decodeError); ok {
+		return nil, &decodeError{offset: postHeaderLength, column: de.column,
+			msg: fmt.Sprintf("%s at uncompressed offset %d", de.msg, de.offset)}
+	}
+	return e, err
+}
+
+// encodeCompressed writes the event as a compressed rows event wrapping
+// eventType.
+func (e *RowsEvent) encodeCompressed(w *eventWriter, eventType EventType, table *TableMapEvent, o *ParserOptions) error {
+	u := new(eventWriter)
+	if err := e.encode(u, nil, eventType, table, o); err != nil {
+		return err
+	}
+
+	postHeaderLength := 8
+	if isRowsEventV2(eventType) {
+		postHeaderLength = 10
+	}
+	w.bytes(u.b[:postHeaderLength])
+	w.bytes(mariadbCompress(u.b[postHeaderLength:]))
+	return nil
+}
+
+// mariadbUncompress uncompresses data written by MariaDB's binlog compression.
+// The first byte has its top bit set, the algorithm in bits 4 to 6 (0 is zlib)
+// and the size of the uncompressed length in the low 3 bits; the big-endian
+// uncompressed length and the compressed data follow.
+func mariadbUncompress(b []byte) ([]byte, error) {
+	if len(b) < 1 || b[0]&0x80 == 0 {
+		return nil, fmt.Errorf("missing compression header")
+	}
+	if alg := (b[0] & 0x70) >> 4; alg != 0 {
+		return nil, fmt.Errorf("unknown compression algorithm %d", alg)
+	}
+
+	lengthSize := int(b[0] & 0x07)
+	if lengthSize < 1 || lengthSize > 4 || len(b) < 1+lengthSize {
+		return nil, fmt.Errorf("invalid compressed length size %d", lengthSize)
+	}
+	length := getBigEndianFixedLengthInt(b[1 : 1+lengthSize])
+
+	zr, err := zlib.NewReader(bytes.NewReader(b[1+lengthSize:]))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(io.LimitReader(zr, int64(length)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != length {
+		return nil, fmt.Errorf("uncompressed %d bytes, want %d", len(data), length)
+	}
+	return data, nil
+}
+
+// mariadbCompress is the inverse of mariadbUncompress.
+func mariadbCompress(data []byte) []byte {
+	lengthSize := 1
+	for ; lengthSize < 4 && len(data) >= 1<<(uint(lengthSize)*8); lengthSize++ {
+	}
+
+	w := new(eventWriter)
+	w.uint8(0x80 | uint8(lengthSize))
+	w.uintNBigEndian(uint64(len(data)), lengthSize)
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	w.bytes(buf.Bytes())
+
+	return w.b
+}
@@ -0,0 +1,189 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mariadbGtidEvent = []byte{
+	// Sequence number
+	100, 0, 0, 0, 0, 0, 0, 0,
+	// Domain ID
+	2, 0, 0, 0,
+	// Flags
+	MARIADB_FL_STANDALONE | MARIADB_FL_GROUP_COMMIT_ID,
+	// Commit ID
+	9, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var mariadbGtidListEvent = []byte{
+	// Count and flags
+	2, 0, 0, 0,
+	// 0-1-100
+	0, 0, 0, 0, 1, 0, 0, 0, 100, 0, 0, 0, 0, 0, 0, 0,
+	// 1-2-7
+	1, 0, 0, 0, 2, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0,
+}
+
+func TestEventCanBeParsedAsMariadbGtidEvent(t *testing.T) {
+	e, err := NewMariadbGtidEvent(1, mariadbGtidEvent)
+
+	require.NoError(t, err)
+	assert.Equal(t, &MariadbGtidEvent{
+		GTID:     MariadbGTID{DomainID: 2, ServerID: 1, SequenceNumber: 100},
+		Flags:    MARIADB_FL_STANDALONE | MARIADB_FL_GROUP_COMMIT_ID,
+		CommitID: 9,
+	}, e)
+}
+
+func TestEventCanBeParsedAsMariadbGtidListEvent(t *testing.T) {
+	e, err := NewMariadbGtidListEvent(mariadbGtidListEvent)
+
+	require.NoError(t, err)
+	assert.Equal(t, &MariadbGtidListEvent{GTIDs: MariadbGTIDList{{0, 1, 100}, {1, 2, 7}}}, e)
+
+	input := append([]byte(nil), mariadbGtidListEvent...)
+	input[0] = 3
+	_, err = NewMariadbGtidListEvent(input)
+	assert.Error(t, err)
+}
+
+func TestEventCanBeParsedAsBinlogCheckpointEvent(t *testing.T) {
+	e, err := NewBinlogCheckpointEvent([]byte{16, 0, 0, 0, 'm', 'y', 's', 'q', 'l', '-', 'b', 'i', 'n', '.', '0', '0', '0', '0', '0', '1'})
+
+	require.NoError(t, err)
+	assert.Equal(t, &BinlogCheckpointEvent{File: []byte("mysql-bin.000001")}, e)
+}
+
+func TestMariadbEventsRoundTripThroughEncoder(t *testing.T) {
+	for _, input := range [][]byte{
+		eventWithHeader(MARIADB_GTID_EVENT, mariadbGtidEvent),
+		eventWithHeader(MARIADB_GTID_EVENT, append(mariadbGtidEvent[:12:12], 0, 0, 0, 0, 0, 0, 0)),
+		eventWithHeader(MARIADB_GTID_LIST_EVENT, mariadbGtidListEvent),
+		eventWithHeader(BINLOG_CHECKPOINT_EVENT, []byte{1, 0, 0, 0, 'x'}),
+	} {
+		e, err := NewBinlogParser().Parse(input)
+		require.NoError(t, err)
+
+		output, err := NewBinlogEncoder().Encode(e.Header, e.Event)
+		require.NoError(t, err)
+		assert.Equal(t, input[EventHeaderSize:], output[EventHeaderSize:])
+	}
+}
+
+func TestMariadbCompressionRoundTrips(t *testing.T) {
+	for _, n := range []int{0, 1, 255, 256, 70000} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i % 7)
+		}
+
+		out, err := mariadbUncompress(mariadbCompress(data))
+		require.NoError(t, err)
+		assert.Equal(t, data, out)
+	}
+}
+
+func TestMariadbUncompressRejectsBadInput(t *testing.T) {
+	good := mariadbCompress([]byte("some query text"))
+
+	for _, input := range [][]byte{
+		nil,
+		{0x01, 0x00},
+		{0x91, 0x00},
+		{0x85, 0x00},
+		good[:len(good)-3],
+		append([]byte{0x81, 20}, good[2:]...),
+	} {
+		_, err := mariadbUncompress(input)
+		assert.Error(t, err, "%v", input)
+	}
+}
+
+func TestCompressedQueryEventIsUncompressed(t *testing.T) {
+	e, err := NewBinlogParser().Parse(eventWithHeader(QUERY_EVENT, queryEvent))
+	require.NoError(t, err)
+
+	b, err := NewBinlogEncoder().Encode(&EventHeader{EventType: QUERY_COMPRESSED_EVENT}, e.Event)
+	require.NoError(t, err)
+
+	c, err := NewBinlogParser().Parse(b)
+	require.NoError(t, err)
+	assert.Equal(t, e.Event, c.Event)
+	assert.NotEqual(t, e.Bytes[EventHeaderSize:], c.Bytes[EventHeaderSize:])
+}
+
+func TestCompressedAndV2RowsEventsAreParsed(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    2,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR},
+		ColumnMetadata: []uint16{0, 255},
+		NullBitVector:  []byte{0x02},
+	}
+
+	enc := NewBinlogEncoder()
+	p := NewBinlogParser()
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t}, e.e)
+		require.NoError(t, err)
+		_, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+
+	for _, tt := range []struct {
+		t         EventType
+		extraData []byte
+	}{
+		{UPDATE_ROWS_EVENT_V2, nil},
+		{UPDATE_ROWS_EVENT_V2, []byte{0, 1, 2}},
+		{WRITE_ROWS_COMPRESSED_EVENT_V1, nil},
+		{UPDATE_ROWS_COMPRESSED_EVENT_V1, nil},
+		{UPDATE_ROWS_COMPRESSED_EVENT, []byte{0, 1, 2}},
+		{DELETE_ROWS_COMPRESSED_EVENT, nil},
+	} {
+		rows := &RowsEvent{
+			TableID:       12,
+			ExtraData:     tt.extraData,
+			ColumnCount:   2,
+			ColumnBitmap1: []byte{0x03},
+			Rows:          [][]interface{}{{int64(1), "first"}, {int64(1), "renamed"}},
+		}
+		if isUpdateRowsEvent(tt.t) {
+			rows.ColumnBitmap2 = []byte{0x03}
+		}
+
+		b, err := enc.Encode(&EventHeader{EventType: tt.t}, rows)
+		require.NoError(t, err, "%s", tt.t)
+
+		parsed, err := p.Parse(b)
+		require.NoError(t, err, "%s", tt.t)
+
+		re := parsed.Event.(*RowsEvent)
+		assert.Equal(t, tme, re.Table, "%s", tt.t)
+		assert.Equal(t, tt.extraData, re.ExtraData, "%s", tt.t)
+		assert.Equal(t, rows.Rows, re.Rows, "%s", tt.t)
+	}
+}
+
+func TestCorruptCompressedRowsEventReportsOffsetInEvent(t *testing.T) {
+	p := parserWithTableMap(t)
+
+	body := append(append([]byte(nil), writeRowsEvent[:8]...), mariadbCompress(writeRowsEvent[8:len(writeRowsEvent)-1])...)
+	_, err := p.Parse(eventWithHeader(WRITE_ROWS_COMPRESSED_EVENT_V1, body))
+
+	require.Error(t, err)
+	ee := err.(*EventError)
+	assert.Equal(t, EventHeaderSize+8, ee.Offset)
+	assert.Equal(t, 1, ee.Column)
+}
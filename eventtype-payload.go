@@ -0,0 +1,188 @@
+package binlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TransactionPayloadEvent compression types
+const (
+	TRANSACTION_PAYLOAD_COMPRESSION_ZSTD uint64 = 0
+	TRANSACTION_PAYLOAD_COMPRESSION_NONE uint64 = 255
+)
+
+// TransactionPayloadEvent header field types
+const (
+	OTW_PAYLOAD_HEADER_END_MARK         uint64 = 0
+	OTW_PAYLOAD_SIZE_FIELD              uint64 = 1
+	OTW_PAYLOAD_COMPRESSION_TYPE_FIELD  uint64 = 2
+	OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD uint64 = 3
+)
+
+// A TransactionPayloadEvent holds a whole transaction written with
+// binlog_transaction_compression (MySQL 8.0.20+). The embedded events are
+// parsed by the same BinlogParser as the outer event, and a Follower streams
+// them in its place. They carry no position of their own in the binlog file,
+// so their headers get the LogPos of the outer event.
+type TransactionPayloadEvent struct {
+	CompressionType  uint64
+	UncompressedSize uint64
+	Events           []*EventContainer
+}
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// Payload is structured as follows:
+//
+//	header fields, each of them:
+//	  packed integer for the field type
+//	  packed integer for the length of the value
+//	  the value, a packed integer
+//	packed integer OTW_PAYLOAD_HEADER_END_MARK
+//	the payload: the embedded events, compressed as in the compression type
+//
+// Fields of unknown types are skipped.
+func (p *BinlogParser) parseTransactionPayloadEvent(h *EventHeader, b []byte) (Event, error) {
+	e := new(TransactionPayloadEvent)
+	r := newEventReader(b)
+
+	payloadSize := uint64(0)
+	hasPayloadSize := false
+	for r.err == nil {
+		t := r.lengthEncodedInt()
+		if t == OTW_PAYLOAD_HEADER_END_MARK {
+			break
+		}
+
+		n := r.lengthEncodedInt()
+		if n > uint64(r.len()) {
+			r.fail("need %d bytes, have %d", n, r.len())
+			break
+		}
+		f := r.sub(int(n))
+
+		switch t {
+		case OTW_PAYLOAD_SIZE_FIELD:
+			payloadSize = f.lengthEncodedInt()
+			hasPayloadSize = true
+		case OTW_PAYLOAD_COMPRESSION_TYPE_FIELD:
+			e.CompressionType = f.lengthEncodedInt()
+		case OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD:
+			e.UncompressedSize = f.lengthEncodedInt()
+		}
+		if f.err != nil {
+			r.err = f.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	payloadOffset := r.i
+	if hasPayloadSize && payloadSize != uint64(r.len()) {
+		r.fail("payload size is %d, have %d bytes", payloadSize, r.len())
+		return nil, r.err
+	}
+
+	var payload []byte
+	switch e.CompressionType {
+	case TRANSACTION_PAYLOAD_COMPRESSION_ZSTD:
+		var err error
+		if payload, err = zstdUncompress(r.rest(), e.UncompressedSize); err != nil {
+			return nil, &decodeError{offset: payloadOffset, column: -1, msg: err.Error()}
+		}
+	case TRANSACTION_PAYLOAD_COMPRESSION_NONE:
+		payload = r.rest()
+	default:
+		return nil, &decodeError{offset: payloadOffset, column: -1,
+			msg: fmt.Sprintf("unknown compression type %d", e.CompressionType)}
+	}
+	if uint64(len(payload)) != e.UncompressedSize {
+		return nil, &decodeError{offset: payloadOffset, column: -1,
+			msg: fmt.Sprintf("uncompressed %d bytes, want %d", len(payload), e.UncompressedSize)}
+	}
+
+	// Errors in embedded events are reported at the start of the payload, as
+	// offsets into the uncompressed data have no meaning in the event.
+	for i := 0; i < len(payload); {
+		n := len(payload) - i
+		if n >= EventHeaderSize {
+			n = int(getLittleEndianFixedLengthInt(payload[i+9 : i+13]))
+		}
+		if n < EventHeaderSize || n > len(payload)-i {
+			return nil, &decodeError{offset: payloadOffset, column: -1,
+				msg: fmt.Sprintf("truncated embedded event at uncompressed offset %d", i)}
+		}
+
+		inner, err := p.Parse(payload[i : i+n])
+		if err != nil {
+			msg, column := err.Error(), -1
+			if ee, ok := err.(*EventError); ok {
+				column = ee.Column
+			}
+			return nil, &decodeError{offset: payloadOffset, column: column,
+				msg: fmt.Sprintf("embedded event at uncompressed offset %d: %s", i, msg)}
+		}
+		inner.Header.LogPos = h.LogPos
+		e.Events = append(e.Events, inner)
+
+		i += n
+	}
+
+	return e, nil
+}
+
+// zstdUncompress uncompresses b, reading at most one byte more than the
+// expected size so that a corrupt size can't make it allocate without bound.
+func zstdUncompress(b []byte, size uint64) ([]byte, error) {
+	zr, err := zstd.NewReader(bytes.NewReader(b), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(io.LimitReader(zr, int64(size)+1))
+}
+
+// encode writes the embedded events, encoded by enc without a position, and
+// compresses them.
+func (e *TransactionPayloadEvent) encode(w *eventWriter, enc *BinlogEncoder) error {
+	var payload []byte
+	for _, inner := range e.Events {
+		b, err := enc.encodeEvent(inner.Header, inner.Event, false)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, b...)
+	}
+
+	uncompressedSize := uint64(len(payload))
+	switch e.CompressionType {
+	case TRANSACTION_PAYLOAD_COMPRESSION_ZSTD:
+		payload = zstdEncoder.EncodeAll(payload, nil)
+	case TRANSACTION_PAYLOAD_COMPRESSION_NONE:
+	default:
+		return fmt.Errorf("unknown compression type %d", e.CompressionType)
+	}
+
+	for _, f := range []struct {
+		t uint64
+		v uint64
+	}{
+		{OTW_PAYLOAD_SIZE_FIELD, uint64(len(payload))},
+		{OTW_PAYLOAD_COMPRESSION_TYPE_FIELD, e.CompressionType},
+		{OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD, uncompressedSize},
+	} {
+		v := putLengthEncodedInt(f.v)
+		w.lengthEncodedInt(f.t)
+		w.lengthEncodedInt(uint64(len(v)))
+		w.bytes(v)
+	}
+	w.lengthEncodedInt(OTW_PAYLOAD_HEADER_END_MARK)
+	w.bytes(payload)
+
+	return nil
+}
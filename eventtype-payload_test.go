@@ -0,0 +1,130 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTransactionPayload(compressionType uint64) *TransactionPayloadEvent {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    2,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR},
+		ColumnMetadata: []uint16{0, 255},
+		NullBitVector:  []byte{0x02},
+	}
+
+	return &TransactionPayloadEvent{
+		CompressionType: compressionType,
+		Events: []*EventContainer{
+			{Header: &EventHeader{EventType: QUERY_EVENT, ServerId: 1}, Event: &QueryEvent{
+				DatabaseName: []byte("shard767"), Query: []byte("BEGIN"), Status: new(QueryStatus)}},
+			{Header: &EventHeader{EventType: TABLE_MAP_EVENT, ServerId: 1}, Event: tme},
+			{Header: &EventHeader{EventType: WRITE_ROWS_EVENT_V2, ServerId: 1}, Event: &RowsEvent{
+				TableID:       12,
+				ColumnCount:   2,
+				ColumnBitmap1: []byte{0x03},
+				Rows:          [][]interface{}{{int64(1), "first"}, {int64(2), nil}},
+			}},
+			{Header: &EventHeader{EventType: XID_EVENT, ServerId: 1}, Event: &XidEvent{Xid: 42}},
+		},
+	}
+}
+
+// encodeTransactionPayload encodes a format description event and the
+// transaction payload event tp, and returns the latter.
+func encodeTransactionPayload(t testing.TB, tp *TransactionPayloadEvent) []byte {
+	enc := NewBinlogEncoder()
+	_, err := enc.Encode(&EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, testFormatDescription())
+	require.NoError(t, err)
+
+	b, err := enc.Encode(&EventHeader{EventType: TRANSACTION_PAYLOAD_EVENT, ServerId: 1}, tp)
+	require.NoError(t, err)
+	return b
+}
+
+func TestTransactionPayloadEventIsParsed(t *testing.T) {
+	for _, ct := range []uint64{TRANSACTION_PAYLOAD_COMPRESSION_ZSTD, TRANSACTION_PAYLOAD_COMPRESSION_NONE} {
+		tp := testTransactionPayload(ct)
+		b := encodeTransactionPayload(t, tp)
+
+		p := NewBinlogParser()
+		p.format = testFormatDescription()
+		e, err := p.Parse(b)
+		require.NoError(t, err)
+
+		parsed := e.Event.(*TransactionPayloadEvent)
+		assert.Equal(t, ct, parsed.CompressionType)
+		require.Len(t, parsed.Events, 4)
+
+		for i, inner := range parsed.Events {
+			assert.Equal(t, tp.Events[i].Header.EventType, inner.Header.EventType)
+			assert.Equal(t, e.Header.LogPos, inner.Header.LogPos)
+		}
+		assert.Equal(t, []byte("BEGIN"), parsed.Events[0].Event.(*QueryEvent).Query)
+
+		rows := parsed.Events[2].Event.(*RowsEvent)
+		assert.Equal(t, tp.Events[1].Event, rows.Table)
+		assert.Equal(t, tp.Events[2].Event.(*RowsEvent).Rows, rows.Rows)
+		assert.Equal(t, uint64(42), parsed.Events[3].Event.(*XidEvent).Xid)
+
+		// The table map inside the payload is kept for later events.
+		assert.Contains(t, p.tables, uint64(12))
+	}
+}
+
+func TestTransactionPayloadEventIsSmallerCompressed(t *testing.T) {
+	tp := testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_ZSTD)
+	rows := tp.Events[2].Event.(*RowsEvent)
+	for i := 0; i < 100; i++ {
+		rows.Rows = append(rows.Rows, []interface{}{int64(i), "the same text"})
+	}
+
+	compressed := encodeTransactionPayload(t, tp)
+	tp.CompressionType = TRANSACTION_PAYLOAD_COMPRESSION_NONE
+	uncompressed := encodeTransactionPayload(t, tp)
+
+	assert.True(t, len(compressed) < len(uncompressed)/2, "%d vs %d", len(compressed), len(uncompressed))
+}
+
+func TestCorruptTransactionPayloadEventFails(t *testing.T) {
+	b := encodeTransactionPayload(t, testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_ZSTD))
+
+	for _, corrupt := range []func(b []byte){
+		func(b []byte) { b[len(b)-8] ^= 0xff },      // compressed data
+		func(b []byte) { b[EventHeaderSize+5] = 1 }, // compression type
+		func(b []byte) { b[EventHeaderSize+8]++ },   // uncompressed size
+		func(b []byte) { b[EventHeaderSize+2] = 5 }, // payload size
+	} {
+		input := append([]byte(nil), b...)
+		corrupt(input)
+
+		p := NewBinlogParser()
+		p.format = testFormatDescription()
+		_, err := p.Parse(input)
+		require.Error(t, err)
+
+		ee := err.(*EventError)
+		assert.Equal(t, TRANSACTION_PAYLOAD_EVENT, ee.EventType)
+		assert.True(t, ee.Offset <= len(input), "offset %d", ee.Offset)
+	}
+}
+
+func TestTransactionPayloadEventWithBadEmbeddedEventFails(t *testing.T) {
+	tp := testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_NONE)
+
+	// Make the rows event refer to a table that wasn't mapped.
+	tp.Events = tp.Events[2:]
+	tp.Events[0].Event.(*RowsEvent).Table = testTransactionPayload(0).Events[1].Event.(*TableMapEvent)
+	b := encodeTransactionPayload(t, tp)
+
+	p := NewBinlogParser()
+	p.format = testFormatDescription()
+	_, err := p.Parse(b)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "embedded event at uncompressed offset 0")
+}
@@ -0,0 +1,203 @@
+package binlog
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status variable codes of a QUERY_EVENT
+const (
+	Q_FLAGS2_CODE                     uint8 = 0
+	Q_SQL_MODE_CODE                   uint8 = 1
+	Q_CATALOG_CODE                    uint8 = 2 // 5.0.0 to 5.0.3 only
+	Q_AUTO_INCREMENT                  uint8 = 3
+	Q_CHARSET_CODE                    uint8 = 4
+	Q_TIME_ZONE_CODE                  uint8 = 5
+	Q_CATALOG_NZ_CODE                 uint8 = 6
+	Q_LC_TIME_NAMES_CODE              uint8 = 7
+	Q_CHARSET_DATABASE_CODE           uint8 = 8
+	Q_TABLE_MAP_FOR_UPDATE_CODE       uint8 = 9
+	Q_MASTER_DATA_WRITTEN_CODE        uint8 = 10
+	Q_INVOKER                         uint8 = 11
+	Q_UPDATED_DB_NAMES                uint8 = 12
+	Q_MICROSECONDS                    uint8 = 13
+	Q_COMMIT_TS                       uint8 = 14 // never written
+	Q_COMMIT_TS2                      uint8 = 15 // never written
+	Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP uint8 = 16
+	Q_DDL_LOGGED_WITH_XID             uint8 = 17
+	Q_DEFAULT_COLLATION_FOR_UTF8MB4   uint8 = 18
+	Q_SQL_REQUIRE_PRIMARY_KEY         uint8 = 19
+	Q_DEFAULT_TABLE_ENCRYPTION        uint8 = 20
+)
+
+// sql_mode flags, as logged in Q_SQL_MODE_CODE
+const (
+	MODE_REAL_AS_FLOAT              uint64 = 1 << 0
+	MODE_PIPES_AS_CONCAT            uint64 = 1 << 1
+	MODE_ANSI_QUOTES                uint64 = 1 << 2
+	MODE_IGNORE_SPACE               uint64 = 1 << 3
+	MODE_ONLY_FULL_GROUP_BY         uint64 = 1 << 5
+	MODE_NO_UNSIGNED_SUBTRACTION    uint64 = 1 << 6
+	MODE_NO_DIR_IN_CREATE           uint64 = 1 << 7
+	MODE_ANSI                       uint64 = 1 << 18
+	MODE_NO_AUTO_VALUE_ON_ZERO      uint64 = 1 << 19
+	MODE_NO_BACKSLASH_ESCAPES       uint64 = 1 << 20
+	MODE_STRICT_TRANS_TABLES        uint64 = 1 << 21
+	MODE_STRICT_ALL_TABLES          uint64 = 1 << 22
+	MODE_NO_ZERO_IN_DATE            uint64 = 1 << 23
+	MODE_NO_ZERO_DATE               uint64 = 1 << 24
+	MODE_INVALID_DATES              uint64 = 1 << 25
+	MODE_ERROR_FOR_DIVISION_BY_ZERO uint64 = 1 << 26
+	MODE_TRADITIONAL                uint64 = 1 << 27
+	MODE_NO_AUTO_CREATE_USER        uint64 = 1 << 28 // removed in 8.0
+	MODE_HIGH_NOT_PRECEDENCE        uint64 = 1 << 29
+	MODE_NO_ENGINE_SUBSTITUTION     uint64 = 1 << 30
+	MODE_PAD_CHAR_TO_FULL_LENGTH    uint64 = 1 << 31
+	MODE_TIME_TRUNCATE_FRACTIONAL   uint64 = 1 << 32 // 8.0+
+)
+
+// Q_UPDATED_DB_NAMES count meaning the databases weren't listed
+const overMaxDBsInEventMTS = 254
+
+// QueryStatus holds the decoded status variables of a QueryEvent: the session
+// state the statement ran with. Fields of variables that weren't logged are
+// zero; use Has to tell them apart from logged zeros.
+type QueryStatus struct {
+	Flags2  uint32
+	SQLMode uint64
+	Catalog []byte
+
+	AutoIncrementIncrement uint16
+	AutoIncrementOffset    uint16
+
+	// Collation IDs of character_set_client, collation_connection and
+	// collation_server
+	CharsetClient       uint16
+	CollationConnection uint16
+	CollationServer     uint16
+
+	TimeZone          []byte // e.g. SYSTEM, +00:00 or Europe/Paris
+	LCTimeNames       uint16
+	CharsetDatabase   uint16
+	TableMapForUpdate uint64
+	MasterDataWritten uint32
+
+	// User and host of the definer of a stored routine or view
+	InvokerUser []byte
+	InvokerHost []byte
+
+	// Databases updated by the statement; nil and UpdatedDBNamesOverflow set
+	// if there were too many to log
+	UpdatedDBNames         [][]byte
+	UpdatedDBNamesOverflow bool
+
+	Microseconds                 uint32 // fractional part of the event timestamp
+	ExplicitDefaultsForTimestamp bool
+	DDLXid                       uint64 // set on DDL logged with an XID (8.0+)
+	DefaultCollationForUTF8MB4   uint16
+	SQLRequirePrimaryKey         uint8
+	DefaultTableEncryption       uint8
+
+	present uint64 // bit per status variable code
+}
+
+// Has reports whether the status variable with the given code was logged.
+func (s *QueryStatus) Has(code uint8) bool {
+	return code < 64 && s.present&(1<<code) != 0
+}
+
+// Location returns the session time zone of the statement, for interpreting
+// TIMESTAMP values. It returns nil when the server's system time zone was in
+// effect, which the event doesn't record.
+func (s *QueryStatus) Location() (*time.Location, error) {
+	tz := string(s.TimeZone)
+	if !s.Has(Q_TIME_ZONE_CODE) || strings.EqualFold(tz, "SYSTEM") {
+		return nil, nil
+	}
+
+	if len(tz) == 6 && (tz[0] == '+' || tz[0] == '-') && tz[3] == ':' {
+		h, herr := strconv.Atoi(tz[1:3])
+		m, merr := strconv.Atoi(tz[4:6])
+		if herr == nil && merr == nil {
+			offset := h*3600 + m*60
+			if tz[0] == '-' {
+				offset = -offset
+			}
+			return time.FixedZone(tz, offset), nil
+		}
+	}
+
+	return time.LoadLocation(tz)
+}
+
+// parseQueryStatus decodes a status variable block. Decoding stops at the
+// first unknown code, as its length can't be known; the server does the same.
+func parseQueryStatus(r *eventReader) *QueryStatus {
+	s := new(QueryStatus)
+
+	for r.err == nil && r.len() > 0 {
+		code := r.uint8()
+
+		switch code {
+		case Q_FLAGS2_CODE:
+			s.Flags2 = r.uint32()
+		case Q_SQL_MODE_CODE:
+			s.SQLMode = r.uint64()
+		case Q_CATALOG_CODE:
+			s.Catalog = r.bytes(int(r.uint8()))
+			r.skip(1) // [00]
+		case Q_AUTO_INCREMENT:
+			s.AutoIncrementIncrement = r.uint16()
+			s.AutoIncrementOffset = r.uint16()
+		case Q_CHARSET_CODE:
+			s.CharsetClient = r.uint16()
+			s.CollationConnection = r.uint16()
+			s.CollationServer = r.uint16()
+		case Q_TIME_ZONE_CODE:
+			s.TimeZone = r.bytes(int(r.uint8()))
+		case Q_CATALOG_NZ_CODE:
+			s.Catalog = r.bytes(int(r.uint8()))
+		case Q_LC_TIME_NAMES_CODE:
+			s.LCTimeNames = r.uint16()
+		case Q_CHARSET_DATABASE_CODE:
+			s.CharsetDatabase = r.uint16()
+		case Q_TABLE_MAP_FOR_UPDATE_CODE:
+			s.TableMapForUpdate = r.uint64()
+		case Q_MASTER_DATA_WRITTEN_CODE:
+			s.MasterDataWritten = r.uint32()
+		case Q_INVOKER:
+			s.InvokerUser = r.bytes(int(r.uint8()))
+			s.InvokerHost = r.bytes(int(r.uint8()))
+		case Q_UPDATED_DB_NAMES:
+			n := r.uint8()
+			if n == overMaxDBsInEventMTS {
+				s.UpdatedDBNamesOverflow = true
+				break
+			}
+			for i := uint8(0); i < n && r.err == nil; i++ {
+				s.UpdatedDBNames = append(s.UpdatedDBNames, r.nullTerminatedBytes())
+			}
+		case Q_MICROSECONDS:
+			s.Microseconds = uint32(r.uintN(3))
+		case Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP:
+			s.ExplicitDefaultsForTimestamp = r.uint8() != 0
+		case Q_DDL_LOGGED_WITH_XID:
+			s.DDLXid = r.uint64()
+		case Q_DEFAULT_COLLATION_FOR_UTF8MB4:
+			s.DefaultCollationForUTF8MB4 = r.uint16()
+		case Q_SQL_REQUIRE_PRIMARY_KEY:
+			s.SQLRequirePrimaryKey = r.uint8()
+		case Q_DEFAULT_TABLE_ENCRYPTION:
+			s.DefaultTableEncryption = r.uint8()
+		default:
+			return s
+		}
+
+		if r.err == nil {
+			s.present |= 1 << code
+		}
+	}
+
+	return s
+}
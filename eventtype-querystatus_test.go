@@ -0,0 +1,135 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var queryStatusVars = []byte{
+	// Flags2
+	Q_FLAGS2_CODE, 0, 0, 0, 0,
+	// sql_mode
+	Q_SQL_MODE_CODE, 0, 0, 0x60, 0, 0, 0, 0, 0,
+	// Catalog
+	Q_CATALOG_NZ_CODE, 3, 's', 't', 'd',
+	// auto_increment_increment, auto_increment_offset
+	Q_AUTO_INCREMENT, 2, 0, 1, 0,
+	// Charsets
+	Q_CHARSET_CODE, 33, 0, 33, 0, 192, 0,
+	// Time zone
+	Q_TIME_ZONE_CODE, 6, '+', '0', '5', ':', '3', '0',
+	// lc_time_names
+	Q_LC_TIME_NAMES_CODE, 1, 0,
+	// Invoker
+	Q_INVOKER, 4, 'r', 'o', 'o', 't', 9, 'l', 'o', 'c', 'a', 'l', 'h', 'o', 's', 't',
+	// Updated databases
+	Q_UPDATED_DB_NAMES, 2, 'a', 0, 'b', 'c', 0,
+	// Microseconds
+	Q_MICROSECONDS, 0x40, 0xe2, 0x01,
+	// explicit_defaults_for_timestamp
+	Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP, 1,
+	// DDL xid
+	Q_DDL_LOGGED_WITH_XID, 9, 0, 0, 0, 0, 0, 0, 0,
+	// default_collation_for_utf8mb4
+	Q_DEFAULT_COLLATION_FOR_UTF8MB4, 255, 0,
+}
+
+func queryEventWithStatus(status []byte) []byte {
+	w := new(eventWriter)
+	(&QueryEvent{StatusVars: status, DatabaseName: []byte("db"), Query: []byte("CREATE TABLE t (a int)")}).encode(w)
+	return w.b
+}
+
+func TestQueryEventStatusIsDecoded(t *testing.T) {
+	e, err := NewQueryEvent(queryEvent)
+	require.NoError(t, err)
+
+	s := e.(*QueryEvent).Status
+	assert.True(t, s.Has(Q_FLAGS2_CODE))
+	assert.True(t, s.Has(Q_SQL_MODE_CODE))
+	assert.False(t, s.Has(Q_TIME_ZONE_CODE))
+	assert.Equal(t, []byte("std"), s.Catalog)
+	assert.Equal(t, uint16(33), s.CharsetClient)
+	assert.Equal(t, uint16(33), s.CollationConnection)
+	assert.Equal(t, uint16(192), s.CollationServer)
+}
+
+func TestQueryEventStatusVariables(t *testing.T) {
+	e, err := NewQueryEvent(queryEventWithStatus(queryStatusVars))
+	require.NoError(t, err)
+
+	s := e.(*QueryEvent).Status
+	assert.Equal(t, MODE_STRICT_TRANS_TABLES|MODE_STRICT_ALL_TABLES, s.SQLMode)
+	assert.Equal(t, uint16(2), s.AutoIncrementIncrement)
+	assert.Equal(t, uint16(1), s.AutoIncrementOffset)
+	assert.Equal(t, []byte("+05:30"), s.TimeZone)
+	assert.Equal(t, uint16(1), s.LCTimeNames)
+	assert.Equal(t, []byte("root"), s.InvokerUser)
+	assert.Equal(t, []byte("localhost"), s.InvokerHost)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("bc")}, s.UpdatedDBNames)
+	assert.Equal(t, uint32(123456), s.Microseconds)
+	assert.True(t, s.ExplicitDefaultsForTimestamp)
+	assert.Equal(t, uint64(9), s.DDLXid)
+	assert.Equal(t, uint16(255), s.DefaultCollationForUTF8MB4)
+	assert.Equal(t, []byte("db"), e.(*QueryEvent).DatabaseName)
+}
+
+func TestQueryEventStatusStopsAtUnknownCode(t *testing.T) {
+	status := []byte{Q_LC_TIME_NAMES_CODE, 1, 0, 99, 1, 2, 3}
+
+	e, err := NewQueryEvent(queryEventWithStatus(status))
+	require.NoError(t, err)
+
+	s := e.(*QueryEvent).Status
+	assert.Equal(t, uint16(1), s.LCTimeNames)
+	assert.Equal(t, status, e.(*QueryEvent).StatusVars)
+}
+
+func TestQueryEventStatusOverflowingDBNames(t *testing.T) {
+	e, err := NewQueryEvent(queryEventWithStatus([]byte{Q_UPDATED_DB_NAMES, overMaxDBsInEventMTS}))
+	require.NoError(t, err)
+
+	s := e.(*QueryEvent).Status
+	assert.True(t, s.UpdatedDBNamesOverflow)
+	assert.Nil(t, s.UpdatedDBNames)
+}
+
+func TestTruncatedQueryEventStatusFails(t *testing.T) {
+	for _, status := range [][]byte{
+		{Q_SQL_MODE_CODE, 0, 0, 0},
+		{Q_TIME_ZONE_CODE, 6, '+'},
+		{Q_UPDATED_DB_NAMES, 1, 'a'},
+	} {
+		_, err := NewQueryEvent(queryEventWithStatus(status))
+		assert.Error(t, err, "%v", status)
+	}
+}
+
+func TestQueryStatusLocation(t *testing.T) {
+	loc, err := (&QueryStatus{}).Location()
+	assert.NoError(t, err)
+	assert.Nil(t, loc)
+
+	s := &QueryStatus{TimeZone: []byte("SYSTEM"), present: 1 << Q_TIME_ZONE_CODE}
+	loc, err = s.Location()
+	assert.NoError(t, err)
+	assert.Nil(t, loc)
+
+	s.TimeZone = []byte("-08:00")
+	loc, err = s.Location()
+	require.NoError(t, err)
+	_, offset := time.Date(2017, 1, 1, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, -8*3600, offset)
+
+	s.TimeZone = []byte("UTC")
+	loc, err = s.Location()
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	s.TimeZone = []byte("Not/AZone")
+	_, err = s.Location()
+	assert.Error(t, err)
+}
@@ -1,9 +1,5 @@
 package binlog
 
-import (
-	"encoding/binary"
-)
-
 // A rotate event tells us what binlog to request next.
 type RotateEvent struct {
 	NextPosition uint64 // position inside next binlog file
@@ -11,16 +7,23 @@ type RotateEvent struct {
 }
 
 // Payload is structured as follows for MySQL v5.5:
-//   8 bytes (uint64) for offset position
-//   the remainder for the new log name (not zero terminated)
+//
+//	8 bytes (uint64) for offset position
+//	the remainder for the new log name (not zero terminated)
 func NewRotateEvent(b []byte) (Event, error) {
 	e := new(RotateEvent)
-	i := 0
-
-	e.NextPosition = binary.LittleEndian.Uint64(b[i : i+8])
-	i = i + 8
+	r := newEventReader(b)
 
-	e.NextFile = b[i:]
+	e.NextPosition = r.uint64()
+	e.NextFile = r.rest()
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
+
+func (e *RotateEvent) encode(w *eventWriter) {
+	w.uint64(e.NextPosition)
+	w.bytes(e.NextFile)
+}
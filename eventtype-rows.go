@@ -5,8 +5,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 	"unsafe"
 )
@@ -15,56 +17,96 @@ type RowsEvent struct {
 	Table         *TableMapEvent
 	TableID       uint64
 	Flags         uint16
+	ExtraData     []byte // v2 only
 	ColumnCount   uint64
-	ColumnBitmap1 []byte          //len = (ColumnCount + 7) / 8
-	ColumnBitmap2 []byte          //if UPDATE_ROWS_EVENT_V1 or v2, len = (ColumnCount + 7) / 8
-	Rows          [][]interface{} //rows: invalid: int64, float64, bool, []byte, string
+	ColumnBitmap1 []byte //len = (ColumnCount + 7) / 8
+	ColumnBitmap2 []byte //if UPDATE_ROWS_EVENT_V1 or v2, len = (ColumnCount + 7) / 8
+
+	// Rows holds the row images in order, the before and after images of
+	// updates in pairs. Columns left out of a row image are nil in Rows, like
+	// NULLs; Image and Updates tell them apart.
+	Rows [][]interface{}
+
+	// UndecodedRows holds the rows from the first one with a value of a type
+	// the parser doesn't know, as it can't tell where those values end. They
+	// are left as they are in the event, and Rows holds the rows before them.
+	UndecodedRows []byte
+
+	// Query is the statement that caused the change, from the ROWS_QUERY or
+	// ANNOTATE_ROWS event before it; nil if the server didn't log one.
+	Query []byte
+
+	// Skipped is set on events of tables the parser's Projection selects no
+	// columns of. Their rows aren't decoded, and Rows is nil. Events of tables
+	// its Filter leaves out are Skipped too, and hold only TableID and Flags.
+	Skipped bool
+
+	lazy     *lazyRows      // rows left undecoded, with LazyRows or for Skipped
+	location *time.Location // temporal strings are shown in; see ParserOptions.stringLocation
 }
 
+// RowsEvent flags
+const (
+	STMT_END_F uint16 = 0x0001 // the last rows event of its statement
+)
+
 // Payload is structured as follows for MySQL v5.5:
-//   19 bytes for common v4 event header
-//   6 bytes (uint64) for table id
-//   2 bytes (uint16) for flags
-//   1 to 9 bytes (net_store_length variable encoded uint64), Z, for total
-//     number of columns
-//   ceil(Z / 8) bytes for bitmap indicating which columns are used (for update
-//     events, this bitmap is used for the before image)
-//   (v1/v2 update events specific) ceil(Z / 8) bytes for bitmap indicating which
-//     columns are used in the after image
-//   The remaining body contains the row data (row values are decoded based
-//       on current table context):
-//     v1/v2 write/delete events specific:
-//       List of rows
-//     v1/v2 update events specific:
-//       List of pairs of (before image row, after image row)
-//     Each row image is composed of:
-//       bit field indicating whether each field in the row is NULL.
-//       list of non-NULL encoded values.
+//
+//	19 bytes for common v4 event header
+//	6 bytes (uint64) for table id, or 4 if the format description gives rows
+//	  events a post-header 2 bytes shorter (MySQL before 5.1.4)
+//	2 bytes (uint16) for flags
+//	(v2 specific) 2 bytes (uint16) for the length of the extra data, counting
+//	  these 2 bytes, then the extra data
+//	1 to 9 bytes (net_store_length variable encoded uint64), Z, for total
+//	  number of columns
+//	ceil(Z / 8) bytes for bitmap indicating which columns are used (for update
+//	  events, this bitmap is used for the before image)
+//	(v1/v2 update events specific) ceil(Z / 8) bytes for bitmap indicating which
+//	  columns are used in the after image
+//	The remaining body contains the row data (row values are decoded based
+//	    on current table context):
+//	  v1/v2 write/delete events specific:
+//	    List of rows
+//	  v1/v2 update events specific:
+//	    List of pairs of (before image row, after image row)
+//	  Each row image is composed of:
+//	    (partial update after images specific) packed integer for the
+//	      binlog_row_value_options; if PARTIAL_JSON_UPDATES is set, a bitmap
+//	      with a bit per JSON column of the table, set for the columns logged
+//	      as JSON diffs
+//	    bit field indicating whether each field in the row is NULL.
+//	    list of non-NULL encoded values.
 func NewRowsEvent(tables map[uint64]*TableMapEvent, eventType EventType, b []byte) (Event, error) {
+	return newRowsEvent(nil, tables, eventType, b, nil)
+}
+
+// newRowsEvent parses a rows event in the format, decoding its values as o
+// says; nil options decode them as NewRowsEvent does.
+func newRowsEvent(format *FormatDescriptionEvent, tables map[uint64]*TableMapEvent, eventType EventType, b []byte, o *ParserOptions) (Event, error) {
 	e := new(RowsEvent)
-	i := 0
+	r := newEventReader(b)
 
-	// Table ID (6 bytes): either 0x00ffffff (a dummy event) or a table defined by a
-	// TableMapEvent
-	const tableIDSize = 6
-	e.TableID = getLittleEndianFixedLengthInt(b[i:tableIDSize])
-	i = i + tableIDSize
+	// Table ID (6 bytes, previously 4): either 0x00ffffff (a dummy event) or a
+	// table defined by a TableMapEvent
+	e.TableID = r.uintN(rowsTableIDSize(format, eventType))
 
 	// Flags (2 bytes)
-	e.Flags = binary.LittleEndian.Uint16(b[i : i+2])
-	i = i + 2
+	e.Flags = r.uint16()
 
-	var n int
-	e.ColumnCount, _, n = getLengthEncodedInt(b[i:])
-	i = i + n
-
-	bitCount := bitmapByteSize(int(e.ColumnCount))
-	e.ColumnBitmap1 = b[i : i+bitCount]
-	i = i + bitCount
+	if isRowsEventV2(eventType) {
+		extraLength := r.uint16()
+		if r.err == nil && extraLength < 2 {
+			r.fail("extra data length %d is less than 2", extraLength)
+		}
+		if extraLength > 2 {
+			e.ExtraData = r.bytes(int(extraLength) - 2)
+		}
+	}
 
-	if eventType == UPDATE_ROWS_EVENT_V1 {
-		e.ColumnBitmap2 = b[i : i+bitCount]
-		i = i + bitCount
+	e.ColumnCount = r.lengthEncodedInt()
+	if r.err != nil {
+		return nil, r.err
 	}
 
 	var ok bool
@@ -72,37 +114,158 @@ func NewRowsEvent(tables map[uint64]*TableMapEvent, eventType EventType, b []byt
 	if !ok {
 		return nil, errors.New("invalid table id")
 	}
+	if e.ColumnCount > e.Table.ColumnCount {
+		r.fail("column count %d exceeds the %d columns of table %s.%s", e.ColumnCount, e.Table.ColumnCount, e.Table.DatabaseName, e.Table.TableName)
+		return nil, r.err
+	}
+
+	bitmapSize := bitmapByteSize(int(e.ColumnCount))
+	e.ColumnBitmap1 = r.bytes(bitmapSize)
+
+	if isUpdateRowsEvent(eventType) {
+		e.ColumnBitmap2 = r.bytes(bitmapSize)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	d := newRowDecoder(e.Table, o)
+	e.Skipped = d.skips()
+	e.location = o.stringLocation()
+
+	if e.Skipped || o != nil && o.LazyRows {
+		if o != nil {
+			options := *o // the parser's may change before the rows are read
+			d.o = &options
+		}
+		e.lazy = &lazyRows{
+			b:       r.b,
+			start:   r.i,
+			bitmaps: [2][]byte{e.ColumnBitmap1, e.ColumnBitmap2},
+			count:   int(e.ColumnCount),
+			update:  isUpdateRowsEvent(eventType),
+			partial: eventType == PARTIAL_UPDATE_ROWS_EVENT,
+			decoder: d,
+		}
+		e.ColumnBitmap1, e.ColumnBitmap2 = d.project(e.ColumnBitmap1), d.project(e.ColumnBitmap2)
+		return e, nil
+	}
 
 	// Repeatedly parse rows until end of event
-	var err error
-	for i < len(b) {
-		if n, err = e.parseRows(b[i:], e.Table, e.ColumnBitmap1); err != nil {
-			return nil, err
+	for r.err == nil && r.len() > 0 {
+		start := r.i
+		rows := len(e.Rows)
+		ok := e.parseRows(r, e.ColumnBitmap1, false, d)
+
+		if ok && isUpdateRowsEvent(eventType) {
+			ok = e.parseRows(r, e.ColumnBitmap2, eventType == PARTIAL_UPDATE_ROWS_EVENT, d)
 		}
-		i = i + n
 
-		if eventType == UPDATE_ROWS_EVENT_V1 {
-			if n, err = e.parseRows(b[i:], e.Table, e.ColumnBitmap2); err != nil {
-				return nil, err
-			}
-			i = i + n
+		if !ok {
+			e.Rows = e.Rows[:rows]
+			r.i = start
+			e.UndecodedRows = r.rest()
+			break
+		}
+
+		if r.err == nil && r.i == start {
+			r.fail("%d trailing bytes after empty row image", r.len())
 		}
 	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// Columns left out by the projection are missing from the images
+	e.ColumnBitmap1, e.ColumnBitmap2 = d.project(e.ColumnBitmap1), d.project(e.ColumnBitmap2)
+	return e, nil
+}
+
+// newFilteredRowsEvent parses the table ID and flags of a rows event of a table
+// the parser's filter leaves out, and skips the rest.
+func newFilteredRowsEvent(format *FormatDescriptionEvent, eventType EventType, b []byte) (Event, error) {
+	e := &RowsEvent{Skipped: true}
+	r := newEventReader(b)
+
+	e.TableID = r.uintN(rowsTableIDSize(format, eventType))
+	e.Flags = r.uint16()
+
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
 
-func (e *RowsEvent) parseRows(b []byte, table *TableMapEvent, bitmap []byte) (int, error) {
+// rowsEventTableID returns the table ID of a rows event, or 0 if it's too
+// short to have one.
+func rowsEventTableID(format *FormatDescriptionEvent, eventType EventType, b []byte) uint64 {
+	return newEventReader(b).uintN(rowsTableIDSize(format, eventType))
+}
+
+// rowsTableIDSize returns the size of the table IDs of rows events of type t
+// in the format: 6 bytes, or 4 before MySQL 5.1.4, when their post-header was
+// 2 bytes shorter. Without a format description they are 6 bytes.
+func rowsTableIDSize(format *FormatDescriptionEvent, t EventType) int {
+	n := format.postHeaderLength(t) - 2 // less the flags
+	if isRowsEventV2(t) {
+		n = n - 2 // less the extra data length
+	}
+	if n == 4 {
+		return 4
+	}
+	return 6
+}
+
+// isUpdateRowsEvent reports whether rows events of type t hold pairs of
+// before and after images.
+func isUpdateRowsEvent(t EventType) bool {
+	switch t {
+	case UPDATE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT_V2, UPDATE_ROWS_COMPRESSED_EVENT_V1, UPDATE_ROWS_COMPRESSED_EVENT,
+		PARTIAL_UPDATE_ROWS_EVENT, PRE_GA_UPDATE_ROWS_EVENT:
+		return true
+	}
+	return false
+}
+
+// isRowsEventV2 reports whether rows events of type t carry extra data.
+func isRowsEventV2(t EventType) bool {
+	switch t {
+	case WRITE_ROWS_EVENT_V2, UPDATE_ROWS_EVENT_V2, DELETE_ROWS_EVENT_V2,
+		WRITE_ROWS_COMPRESSED_EVENT, UPDATE_ROWS_COMPRESSED_EVENT, DELETE_ROWS_COMPRESSED_EVENT,
+		PARTIAL_UPDATE_ROWS_EVENT:
+		return true
+	}
+	return false
+}
+
+// parseRows reads one row image, which is the after image of a partial update
+// if partial is set, decoding the values of the columns d decodes. Errors are
+// recorded in r. It reports whether it knew the types of the image's values;
+// if not, the image is left unread.
+func (e *RowsEvent) parseRows(r *eventReader, bitmap []byte, partial bool, d *rowDecoder) bool {
+	table := d.table
+
+	var partialBits []byte
+	if partial && r.lengthEncodedInt()&PARTIAL_JSON_UPDATES != 0 {
+		partialBits = r.bytes(bitmapByteSize(jsonColumnCount(table)))
+	}
+
 	row := make([]interface{}, e.ColumnCount)
-	i := 0
 	count := byteCountFromBitCount(bitCount(bitmap))
 
-	nullBitmap := b[i : i+count]
-	i = i + count
+	nullBitmap := r.bytes(count)
 	nullBitIndex := 0
+	jsonIndex := 0
+
+	for j := 0; j < int(e.ColumnCount) && r.err == nil; j++ {
+		isDiff := false
+		if partialBits != nil && table.ColumnTypes[j] == MYSQL_TYPE_JSON {
+			isDiff = getBit(partialBits, jsonIndex) != 0
+			jsonIndex++
+		}
 
-	var n int
-	var err error
-	for j := 0; j < int(e.ColumnCount); j++ {
 		if getBit(bitmap, j) == 0 {
 			continue
 		}
@@ -115,40 +278,108 @@ func (e *RowsEvent) parseRows(b []byte, table *TableMapEvent, bitmap []byte) (in
 			continue
 		}
 
-		row[j], n, err = parseValue(b[i:], table.ColumnTypes[j], table.ColumnMetadata[j])
-
+		var v interface{}
+		var n int
+		var err error
+		if d.decodes(j) {
+			v, n, err = d.decode(r.b[r.i:], j, isDiff)
+		} else {
+			n, err = valueSize(r.b[r.i:], table.ColumnTypes[j], table.ColumnMetadata[j])
+		}
+		if _, ok := err.(unknownTypeError); ok {
+			return false
+		}
 		if err != nil {
-			return 0, nil
+			r.failColumn(j, "%v", err)
+			return true
 		}
-		i = i + n
+		row[j] = v
+		r.skip(n)
 		nullBitIndex = nullBitIndex + 1
 	}
 
-	e.Rows = append(e.Rows, row)
-	return i, nil
+	if r.err == nil {
+		e.Rows = append(e.Rows, row)
+	}
+	return true
+}
+
+// jsonColumnCount returns the number of JSON columns of a table.
+func jsonColumnCount(table *TableMapEvent) int {
+	n := 0
+	for _, t := range table.ColumnTypes {
+		if t == MYSQL_TYPE_JSON {
+			n++
+		}
+	}
+	return n
+}
+
+// ApplyJSONDiffs replaces the JSON diffs in the after images of a partial
+// update with the documents they make of the before images. Diffs of columns
+// missing from the before image, as with binlog_row_image=MINIMAL, are left
+// in place.
+func (e *RowsEvent) ApplyJSONDiffs() error {
+	for i := 1; i < len(e.Rows); i = i + 2 {
+		for j, v := range e.Rows[i] {
+			diffs, ok := v.([]JSONDiff)
+			if !ok || getBit(e.ColumnBitmap1, j) == 0 {
+				continue
+			}
+
+			before, ok := e.Rows[i-1][j].([]byte)
+			if !ok {
+				return fmt.Errorf("column %d: JSON diffs to a NULL document", j)
+			}
+			after, err := ApplyJSONDiffs(before, diffs)
+			if err != nil {
+				return fmt.Errorf("column %d: %v", j, err)
+			}
+			e.Rows[i][j] = after
+		}
+	}
+	return nil
+}
+
+// fixedValueSizes holds the size of values whose type alone decides it.
+var fixedValueSizes = map[byte]int{
+	MYSQL_TYPE_TINY:      1,
+	MYSQL_TYPE_SHORT:     2,
+	MYSQL_TYPE_INT24:     3,
+	MYSQL_TYPE_LONG:      4,
+	MYSQL_TYPE_LONGLONG:  8,
+	MYSQL_TYPE_FLOAT:     4,
+	MYSQL_TYPE_DOUBLE:    8,
+	MYSQL_TYPE_TIMESTAMP: 4,
+	MYSQL_TYPE_DATETIME:  8,
+	MYSQL_TYPE_TIME:      3,
+	MYSQL_TYPE_DATE:      3,
+	MYSQL_TYPE_NEWDATE:   3,
+	MYSQL_TYPE_YEAR:      1,
+}
+
+// checkValueLength returns an error if data is shorter than n bytes.
+func checkValueLength(data []byte, n int) error {
+	if len(data) < n {
+		return fmt.Errorf("need %d bytes, have %d", n, len(data))
+	}
+	return nil
 }
 
 // Ref: MySQL sql/log_event.cc > log_event_print_value
 func parseValue(data []byte, tp byte, meta uint16) (v interface{}, n int, err error) {
 	var length int = 0
 
-	if tp == MYSQL_TYPE_STRING {
-		if meta >= 256 {
-			b0 := uint8(meta >> 8)
-			b1 := uint8(meta & 0xFF)
-
-			if b0&0x30 != 0x30 {
-				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
-				tp = byte(b0 | 0x30)
-			} else {
-				length = int(meta & 0xFF)
-				tp = b0
-			}
-		} else {
-			length = int(meta)
+	if size, ok := fixedValueSizes[tp]; ok {
+		if err = checkValueLength(data, size); err != nil {
+			return nil, 0, err
 		}
 	}
 
+	if tp == MYSQL_TYPE_STRING {
+		tp, length = stringRealType(meta)
+	}
+
 	// The MySQL binary replication protocol doesn't tell us whether a field is a
 	// signed or unsigned int; we have to process the value differently on the
 	// receiving side, where we know more about the table schema.
@@ -197,7 +428,7 @@ func parseValue(data []byte, tp byte, meta uint16) (v interface{}, n int, err er
 		return v, n, nil
 	case MYSQL_TYPE_TIME2:
 		return parseTime2Type(data, meta)
-	case MYSQL_TYPE_DATE:
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
 		n = 3
 		i32 := uint32(getLittleEndianFixedLengthInt(data[0:3]))
 		if i32 == 0 {
@@ -210,246 +441,781 @@ func parseValue(data []byte, tp byte, meta uint16) (v interface{}, n int, err er
 		return parseYear(data)
 	case MYSQL_TYPE_ENUM:
 		l := meta & 0xFF
+		if err = checkValueLength(data, int(l)); err != nil {
+			return nil, 0, err
+		}
 		switch l {
 		case 1:
 			v = int64(data[0])
 			n = 1
 		case 2:
-			v = int64(binary.BigEndian.Uint16(data))
+			v = int64(binary.LittleEndian.Uint16(data))
 			n = 2
 		default:
 			err = fmt.Errorf("Unknown ENUM packlen=%d", l)
 		}
 		return v, n, err
 	case MYSQL_TYPE_SET:
-		nbits := meta & 0xFF
-		n = int(nbits+7) / 8
-		v, err = parseBit(data, int(nbits), n)
-		return v, n, err
-	case MYSQL_TYPE_BLOB:
-		switch meta {
-		case 1:
-			length = int(data[0])
-			v = data[1 : 1+length]
-			n = length + 1
-		case 2:
-			length = int(binary.LittleEndian.Uint16(data))
-			v = data[2 : 2+length]
-			n = length + 2
-		case 3:
-			length = int(getLittleEndianFixedLengthInt(data[0:3]))
-			v = data[3 : 3+length]
-			n = length + 3
-		case 4:
-			length = int(binary.LittleEndian.Uint32(data))
-			v = data[4 : 4+length]
-			n = length + 4
-		default:
-			err = fmt.Errorf("invalid blob packlen = %d", meta)
+		// A little-endian bitmask of 1 to 4, or 8, bytes
+		n = int(meta & 0xFF)
+		if n < 1 || n > 8 {
+			return nil, 0, fmt.Errorf("invalid SET packlen = %d", n)
+		}
+		if err = checkValueLength(data, n); err != nil {
+			return nil, 0, err
 		}
+		return int64(getLittleEndianFixedLengthInt(data[:n])), n, nil
+	case MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB, MYSQL_TYPE_GEOMETRY:
+		if meta < 1 || meta > 4 {
+			return nil, 0, fmt.Errorf("invalid blob packlen = %d", meta)
+		}
+		if err = checkValueLength(data, int(meta)); err != nil {
+			return nil, 0, err
+		}
+		length = int(getLittleEndianFixedLengthInt(data[0:meta]))
+		n = int(meta) + length
+		if err = checkValueLength(data, n); err != nil {
+			return nil, 0, err
+		}
+		return data[meta:n], n, nil
+	case MYSQL_TYPE_JSON:
+		if meta < 1 || meta > 4 {
+			return nil, 0, fmt.Errorf("invalid JSON packlen = %d", meta)
+		}
+		if err = checkValueLength(data, int(meta)); err != nil {
+			return nil, 0, err
+		}
+		length = int(getLittleEndianFixedLengthInt(data[0:meta]))
+		n = int(meta) + length
+		if err = checkValueLength(data, n); err != nil {
+			return nil, 0, err
+		}
+		v, err = parseJSONBinary(data[meta:n])
 		return v, n, err
 	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING:
 		return parseString(data, int(meta))
 	case MYSQL_TYPE_STRING:
 		return parseString(data, length)
 	default:
-		return v, n, fmt.Errorf("unsupported type %d in binlog", tp)
+		return v, n, unknownTypeError(tp)
 	}
 }
 
-func parseYear(b []byte) (string, int, error) {
-	v := b[0]
-	var str string
-
-	if v == 0 {
-		str = "0000"
-	} else {
-		str = strconv.Itoa(int(b[0]) + 1900)
-	}
+// An unknownTypeError is the error of decoding a value of a type parseValue
+// doesn't know, and so can't tell the size of.
+type unknownTypeError byte
 
-	return str, 1, nil
+func (e unknownTypeError) Error() string {
+	return fmt.Sprintf("unsupported type %d in binlog", byte(e))
 }
 
-func parseBitType(b []byte, meta uint16) (int64, int, error) {
-	numBits := int(((meta >> 8) * 8) + (meta & 0xFF))
-	numBytes := byteCountFromBitCount(numBits)
-	v, err := parseBit(b, numBits, numBytes)
-	return v, numBytes, err
-}
+// valueSize returns the size of the value at the start of data like parseValue,
+// but without decoding it.
+func valueSize(data []byte, tp byte, meta uint16) (n int, err error) {
+	if tp == MYSQL_TYPE_STRING {
+		var length int
+		if tp, length = stringRealType(meta); tp == MYSQL_TYPE_STRING {
+			meta = uint16(length)
+		}
+	}
 
-func parseBit(b []byte, numBits int, length int) (int64, error) {
-	var (
-		value int64
-		err   error
-	)
-	if numBits > 1 {
-		switch length {
-		case 1:
-			value = int64(b[0])
-		case 2:
-			value = int64(binary.BigEndian.Uint16(b))
-		case 4:
-			value = int64(binary.BigEndian.Uint32(b))
-		case 3, 5, 6, 7:
-			value = int64(getBigEndianFixedLengthInt(b[0:length]))
-		case 8:
-			value = int64(binary.BigEndian.Uint64(b))
-		default:
-			err = fmt.Errorf("invalid bit length %d", length)
+	if size, ok := fixedValueSizes[tp]; ok {
+		return size, checkValueLength(data, size)
+	}
+
+	switch tp {
+	case MYSQL_TYPE_NULL:
+		return 0, nil
+	case MYSQL_TYPE_NEWDECIMAL:
+		if n, err = decimalSize(meta); err != nil {
+			return 0, err
 		}
-	} else {
-		if length != 1 {
-			err = fmt.Errorf("invalid bit length %d", length)
-		} else {
-			value = int64(b[0])
+	case MYSQL_TYPE_BIT:
+		n = byteCountFromBitCount(int(((meta >> 8) * 8) + (meta & 0xFF)))
+	case MYSQL_TYPE_TIMESTAMP2:
+		n = 4 + int(meta+1)/2
+	case MYSQL_TYPE_DATETIME2:
+		n = 5 + int(meta+1)/2
+	case MYSQL_TYPE_TIME2:
+		n = 3 + int(meta+1)/2
+	case MYSQL_TYPE_ENUM:
+		if n = int(meta & 0xFF); n != 1 && n != 2 {
+			return 0, fmt.Errorf("Unknown ENUM packlen=%d", n)
+		}
+	case MYSQL_TYPE_SET:
+		if n = int(meta & 0xFF); n < 1 || n > 8 {
+			return 0, fmt.Errorf("invalid SET packlen = %d", n)
+		}
+	case MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB, MYSQL_TYPE_GEOMETRY,
+		MYSQL_TYPE_JSON:
+		if meta < 1 || meta > 4 {
+			return 0, fmt.Errorf("invalid blob packlen = %d", meta)
+		}
+		if err = checkValueLength(data, int(meta)); err != nil {
+			return 0, err
+		}
+		n = int(meta) + int(getLittleEndianFixedLengthInt(data[:meta]))
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_STRING:
+		prefix := 1
+		if meta >= 256 {
+			prefix = 2
+		}
+		if err = checkValueLength(data, prefix); err != nil {
+			return 0, err
 		}
+		n = prefix + int(getLittleEndianFixedLengthInt(data[:prefix]))
+	default:
+		return 0, unknownTypeError(tp)
 	}
-	return value, err
+	return n, checkValueLength(data, n)
 }
 
-// Ref: https://github.com/jeremycole/mysql_binlog, vitess
-func parseDecimalType(data []byte, meta uint16) (float64, int, error) {
-	precision := int(meta >> 8)
-	decimals := int(meta & 0xFF)
-	integral := (precision - decimals)
-	uncompIntegral := int(integral / digitsPerInteger)
-	uncompFractional := int(decimals / digitsPerInteger)
-	compIntegral := integral - (uncompIntegral * digitsPerInteger)
-	compFractional := decimals - (uncompFractional * digitsPerInteger)
+// parseValue decodes a value as the options say; nil options decode it as
+// parseValue does.
+func (o *ParserOptions) parseValue(data []byte, tp byte, meta uint16) (v interface{}, n int, err error) {
+	if o == nil {
+		return parseValue(data, tp, meta)
+	}
 
-	binSize := uncompIntegral*4 + compressedBytes[compIntegral] +
-		uncompFractional*4 + compressedBytes[compFractional]
+	if tp == MYSQL_TYPE_NEWDATE {
+		tp = MYSQL_TYPE_DATE // the same in rows events
+	}
 
-	buf := make([]byte, binSize)
-	copy(buf, data[:binSize])
+	switch tp {
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_DATETIME, MYSQL_TYPE_DATETIME2,
+		MYSQL_TYPE_DATE, MYSQL_TYPE_TIME, MYSQL_TYPE_TIME2, MYSQL_TYPE_YEAR:
+		return o.parseTemporal(data, tp, meta)
+	}
 
-	// Going to destroy data
-	data = buf
+	if tp == MYSQL_TYPE_NEWDECIMAL && o.ExactDecimals {
+		s, n, err := parseDecimalString(data, meta)
+		if err != nil {
+			return nil, 0, err
+		}
+		return normalizeDecimal(s), n, nil
+	}
 
-	// Support negative decimals:
-	// The sign is encoded in the high bit of the the byte, but this bit may also be used in the value
-	value := uint32(data[0])
-	var res bytes.Buffer
-	var mask uint32 = 0
-	if value&0x80 == 0 {
-		mask = uint32((1 << 32) - 1)
-		res.WriteString("-")
+	v, n, err = parseValue(data, tp, meta)
+	if err != nil {
+		return v, n, err
 	}
 
-	// Clear sign
-	data[0] ^= 0x80
+	switch {
+	case tp == MYSQL_TYPE_BIT && o.BitStrings:
+		v = formatBits(v.(int64), meta)
+	case tp == MYSQL_TYPE_GEOMETRY && o.Geometry != GeometryWKB:
+		v, err = formatGeometry(v.([]byte), o.Geometry)
+	case o.CopyBytes:
+		v = copyValue(v)
+	}
+	return v, n, err
+}
 
-	pos, value := parseDecimalDecompressValue(compIntegral, data, uint8(mask))
-	res.WriteString(fmt.Sprintf("%d", value))
+// A rowDecoder decodes the values of the rows of a table as the options say.
+type rowDecoder struct {
+	table      *TableMapEvent
+	o          *ParserOptions
+	columns    []columnDefinition // nil if the options need none
+	projection []byte             // bitmap of the columns to decode, or nil for all
+}
 
-	for i := 0; i < uncompIntegral; i++ {
-		value = binary.BigEndian.Uint32(data[pos:]) ^ mask
-		pos = pos + 4
-		res.WriteString(fmt.Sprintf("%09d", value))
+func newRowDecoder(table *TableMapEvent, o *ParserOptions) *rowDecoder {
+	d := &rowDecoder{table: table, o: o, projection: o.projection(table)}
+	if !d.skips() {
+		d.columns = o.columnDefinitions(table)
 	}
+	return d
+}
 
-	res.WriteString(".")
+// skips reports whether the decoder decodes none of the table's columns.
+func (d *rowDecoder) skips() bool {
+	return d.projection != nil && bitCount(d.projection) == 0
+}
 
-	for i := 0; i < uncompFractional; i++ {
-		value = binary.BigEndian.Uint32(data[pos:]) ^ mask
-		pos = pos + 4
-		res.WriteString(fmt.Sprintf("%09d", value))
-	}
+// decodes reports whether the values of column j are decoded.
+func (d *rowDecoder) decodes(j int) bool {
+	return d.projection == nil || getBit(d.projection, j) != 0
+}
 
-	if size, value := parseDecimalDecompressValue(compFractional, data[pos:], uint8(mask)); size > 0 {
-		res.WriteString(fmt.Sprintf("%0*d", compFractional, value))
-		pos = pos + size
+// decode decodes the value of column j at the start of data, which is a list
+// of JSON diffs if isDiff is set.
+func (d *rowDecoder) decode(data []byte, j int, isDiff bool) (v interface{}, n int, err error) {
+	tp, meta := d.table.ColumnTypes[j], d.table.ColumnMetadata[j]
+	if isDiff {
+		v, n, err = parseJSONDiffs(data, meta)
+		if err == nil && d.o != nil && d.o.CopyBytes {
+			v = copyValue(v)
+		}
+		return v, n, err
 	}
 
-	f, err := strconv.ParseFloat(getUnsafeString(res.Bytes()), 64)
-	return f, pos, err
+	v, n, err = d.o.parseValue(data, tp, meta)
+	if err == nil && d.columns != nil {
+		v, err = d.columns[j].decode(v, tp, meta)
+	}
+	return v, n, err
 }
 
-func parseDateTime(b []byte) (time.Time, int, error) {
-	val := binary.LittleEndian.Uint64(b)
-	d := val / 1000000
-	t := val % 1000000
-	v := time.Date(
-		int(d/10000),              // year
-		time.Month((d%10000)/100), // month
-		int(d%100),                // day
-		int(t/10000),              // hour
-		int((t%10000)/100),        // minute
-		int(t%100),                // second
-		0,                         // nanosecond
-		time.UTC)
-	return v, 8, nil
-}
+// project returns a copy of a column bitmap without the columns that aren't
+// decoded.
+func (d *rowDecoder) project(bitmap []byte) []byte {
+	if d.projection == nil || bitmap == nil {
+		return bitmap
+	}
 
-func parseString(data []byte, length int) (v string, n int, err error) {
-	if length < 256 {
-		length = int(data[0])
-		n = int(length) + 1
-		v = getUnsafeString(data[1:n])
-	} else {
-		length = int(binary.LittleEndian.Uint16(data[0:]))
-		n = length + 2
-		v = getUnsafeString(data[2:n])
+	projected := make([]byte, len(bitmap))
+	for i := range bitmap {
+		projected[i] = bitmap[i] & d.projection[i]
 	}
-	return v, n, nil
+	return projected
 }
 
-const digitsPerInteger int = 9
-
-var compressedBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+// projection returns the bitmap of the columns of a table that Projection
+// selects, or nil if it selects them all.
+func (o *ParserOptions) projection(table *TableMapEvent) []byte {
+	if o == nil || o.Projection == nil {
+		return nil
+	}
+	columns := o.Projection(string(table.DatabaseName), string(table.TableName))
+	if columns == nil {
+		return nil
+	}
 
-func parseDecimalDecompressValue(compIndx int, data []byte, mask uint8) (size int, value uint32) {
-	size = compressedBytes[compIndx]
-	databuff := make([]byte, size)
-	for i := 0; i < size; i++ {
-		databuff[i] = data[i] ^ mask
+	bitmap := make([]byte, bitmapByteSize(int(table.ColumnCount)))
+	for _, j := range columns {
+		if j >= 0 && j < int(table.ColumnCount) {
+			bitmap[j/8] |= 1 << uint(j%8)
+		}
 	}
-	value = uint32(getBigEndianFixedLengthInt(databuff))
-	return
+	return bitmap
 }
 
-func parseTimestamp2Type(data []byte, meta uint16) (string, int, error) {
-	numBytes := int(4 + (meta+1)/2)
-	sec := int64(binary.BigEndian.Uint32(data[0:4]))
-	usec := int64(0)
+// A columnDefinition is what decoding the values of a column takes beyond its
+// table map entry.
+type columnDefinition struct {
+	charset string   // character set of CHAR, VARCHAR and TEXT values, or ""
+	labels  []string // labels of ENUM and SET values, or nil
+}
 
-	switch meta {
-	case 1, 2:
-		usec = int64(data[4]) * 10000
-	case 3, 4:
-		usec = int64(binary.BigEndian.Uint16(data[4:])) * 100
-	case 5, 6:
-		usec = int64(getBigEndianFixedLengthInt(data[4:7]))
+// columnDefinitions returns the definitions of the columns of a table that
+// the options decode values with: character sets with DecodeCharsets, and
+// labels with DecodeEnums. They come from the optional metadata of the table
+// map or failing that from Schemas. It returns nil if there are none.
+func (o *ParserOptions) columnDefinitions(table *TableMapEvent) []columnDefinition {
+	if o == nil || !o.DecodeCharsets && !o.DecodeEnums {
+		return nil
 	}
 
-	if sec == 0 {
-		return "0000-00-00 00:00:00", numBytes, nil
+	var schema *TableSchema
+	if o.Schemas != nil && (o.DecodeCharsets && table.ColumnCollations == nil || o.DecodeEnums && table.ColumnValues == nil) {
+		schema = o.Schemas(string(table.DatabaseName), string(table.TableName))
+		if schema != nil && len(schema.Columns) != len(table.ColumnTypes) {
+			schema = nil
+		}
 	}
 
-	t := time.Unix(sec, usec*1000)
-	return t.Format(TimeFormat), numBytes, nil
+	columns := make([]columnDefinition, len(table.ColumnTypes))
+	known := false
+	for j, tp := range table.ColumnTypes {
+		meta := table.ColumnMetadata[j]
+		if tp == MYSQL_TYPE_STRING {
+			tp, _ = stringRealType(meta)
+		}
+		c := &columns[j]
+
+		switch {
+		case !o.DecodeCharsets || !isCharacterColumn(tp, meta):
+		case j < len(table.ColumnCollations):
+			c.charset = CollationCharset(table.ColumnCollations[j])
+		case schema != nil:
+			c.charset = schema.Columns[j].Charset
+			if c.charset == "" {
+				c.charset = "binary"
+			}
+		}
+
+		switch {
+		case !o.DecodeEnums || tp != MYSQL_TYPE_ENUM && tp != MYSQL_TYPE_SET:
+		case j < len(table.ColumnValues):
+			c.labels = table.ColumnValues[j]
+		case schema != nil:
+			c.labels = schema.Columns[j].Values
+		}
+
+		known = known || c.charset != "" || c.labels != nil
+	}
+
+	if !known {
+		return nil
+	}
+	return columns
 }
 
-func decodeDatetime2(data []byte, meta uint16) (string, int, error) {
-	n := int(5 + (meta+1)/2)
+// decode converts a value of the column of type tp with metadata meta as its
+// definition says.
+func (c columnDefinition) decode(v interface{}, tp byte, meta uint16) (interface{}, error) {
+	if c.charset != "" {
+		return decodeCharacterValue(v, c.charset)
+	}
+	if c.labels == nil {
+		return v, nil
+	}
 
-	intPart := int64(getBigEndianFixedLengthInt(data[0:5])) - DATETIMEF_INT_OFS
-	var frac int64 = 0
+	if tp == MYSQL_TYPE_STRING {
+		tp, _ = stringRealType(meta)
+	}
+	if tp == MYSQL_TYPE_ENUM {
+		return enumLabel(v, c.labels)
+	}
+	return setLabels(v, c.labels)
+}
+
+// parseTemporal decodes a temporal value as the options say.
+func (o *ParserOptions) parseTemporal(data []byte, tp byte, meta uint16) (v interface{}, n int, err error) {
+	isTimestamp := tp == MYSQL_TYPE_TIMESTAMP || tp == MYSQL_TYPE_TIMESTAMP2
+	if !o.ParseTime && !(isTimestamp && o.Location != nil) {
+		v, n, err = parseValue(data, tp, meta)
+		if s, ok := v.(string); ok && err == nil && strings.HasPrefix(s, "0000-00-00") {
+			v, err = o.zeroDate(s)
+		}
+		return v, n, err
+	}
+
+	var year, month, day, hour, minute, second, usec int64
+	switch tp {
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2:
+		var sec int64
+		if tp == MYSQL_TYPE_TIMESTAMP {
+			if err = checkValueLength(data, 4); err != nil {
+				return nil, 0, err
+			}
+			sec, n = int64(binary.LittleEndian.Uint32(data)), 4
+		} else if sec, usec, n, err = parseTimestamp2(data, meta); err != nil {
+			return nil, 0, err
+		}
+
+		if sec == 0 {
+			v, err = o.zeroDate("0000-00-00 00:00:00")
+			return v, n, err
+		}
+		loc := o.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		t := time.Unix(sec, usec*1000).In(loc)
+		if !o.ParseTime {
+			return t.Format(TimeFormat), n, nil
+		}
+		return t, n, nil
+	case MYSQL_TYPE_DATETIME:
+		if err = checkValueLength(data, 8); err != nil {
+			return nil, 0, err
+		}
+		val := binary.LittleEndian.Uint64(data)
+		d, t := int64(val/1000000), int64(val%1000000)
+		year, month, day = d/10000, d%10000/100, d%100
+		hour, minute, second = t/10000, t%10000/100, t%100
+		n = 8
+	case MYSQL_TYPE_DATETIME2:
+		var packed int64
+		if packed, n, err = parseDatetime2Packed(data, meta); err != nil {
+			return nil, 0, err
+		}
+		usec = packed % (1 << 24)
+		ymdhms := packed >> 24
+		ymd, hms := ymdhms>>17, ymdhms%(1<<17)
+		year, month, day = ymd>>5/13, ymd>>5%13, ymd%(1<<5)
+		hour, minute, second = hms>>12, hms>>6%(1<<6), hms%(1<<6)
+	case MYSQL_TYPE_DATE:
+		if err = checkValueLength(data, 3); err != nil {
+			return nil, 0, err
+		}
+		d := int64(getLittleEndianFixedLengthInt(data[0:3]))
+		year, month, day = d/(16*32), d/32%16, d%32
+		n = 3
+		if month == 0 || day == 0 {
+			v, err = o.zeroDate(fmt.Sprintf("%04d-%02d-%02d", year, month, day))
+			return v, n, err
+		}
+		return time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, o.dateLocation()), n, nil
+	case MYSQL_TYPE_TIME:
+		if err = checkValueLength(data, 3); err != nil {
+			return nil, 0, err
+		}
+		t := int64(getLittleEndianFixedLengthInt(data[0:3]))
+		d := time.Duration(t/10000)*time.Hour + time.Duration(t%10000/100)*time.Minute + time.Duration(t%100)*time.Second
+		return d, 3, nil
+	case MYSQL_TYPE_TIME2:
+		var packed int64
+		if packed, n, err = parseTime2Packed(data, meta); err != nil {
+			return nil, 0, err
+		}
+		neg := packed < 0
+		if neg {
+			packed = -packed
+		}
+		hms := packed >> 24
+		d := time.Duration(hms>>12%(1<<10))*time.Hour + time.Duration(hms>>6%(1<<6))*time.Minute +
+			time.Duration(hms%(1<<6))*time.Second + time.Duration(packed%(1<<24))*time.Microsecond
+		if neg {
+			d = -d
+		}
+		return d, n, nil
+	case MYSQL_TYPE_YEAR:
+		if err = checkValueLength(data, 1); err != nil {
+			return nil, 0, err
+		}
+		if data[0] == 0 {
+			return int64(0), 1, nil
+		}
+		return int64(data[0]) + 1900, 1, nil
+	}
+
+	if month == 0 || day == 0 {
+		v, err = o.zeroDate(fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, minute, second))
+		return v, n, err
+	}
+	return time.Date(int(year), time.Month(month), int(day), int(hour), int(minute), int(second),
+		int(usec)*1000, o.dateLocation()), n, nil
+}
+
+// stringLocation returns the time zone of the temporal values decoded to
+// strings: the one TIMESTAMP values are shown in, and DATE and DATETIME
+// values are taken to be in. It is nil for the defaults, time.Local for
+// TIMESTAMP values and UTC for the others.
+func (o *ParserOptions) stringLocation() *time.Location {
+	if o == nil || o.ParseTime {
+		return nil
+	}
+	return o.Location
+}
+
+// dateLocation returns the time zone of DATE and DATETIME values.
+func (o *ParserOptions) dateLocation() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// zeroDate returns what the zero date s decodes to.
+func (o *ParserOptions) zeroDate(s string) (interface{}, error) {
+	switch o.ZeroDates {
+	case ZeroDateNull:
+		return nil, nil
+	case ZeroDateTime:
+		return time.Time{}, nil
+	case ZeroDateError:
+		return nil, fmt.Errorf("zero date %s", s)
+	}
+	return s, nil
+}
+
+// copyValue copies string and blob values, and the paths and values of JSON
+// diffs, out of the event's bytes.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return string(append([]byte(nil), v...))
+	case []byte:
+		return append([]byte(nil), v...)
+	case []JSONDiff:
+		for i := range v {
+			v[i].Path = append([]byte(nil), v[i].Path...)
+			v[i].Value = append([]byte(nil), v[i].Value...)
+		}
+	}
+	return v
+}
+
+// stringRealType unpacks the metadata of a MYSQL_TYPE_STRING column into the
+// column's real type (CHAR, ENUM or SET) and its maximum length.
+func stringRealType(meta uint16) (tp byte, length int) {
+	if meta < 256 {
+		return MYSQL_TYPE_STRING, int(meta)
+	}
+
+	b0 := uint8(meta >> 8)
+	b1 := uint8(meta & 0xFF)
+
+	if b0&0x30 != 0x30 {
+		return byte(b0 | 0x30), int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+	}
+	return b0, int(meta & 0xFF)
+}
+
+func parseYear(b []byte) (string, int, error) {
+	v := b[0]
+	var str string
+
+	if v == 0 {
+		str = "0000"
+	} else {
+		str = strconv.Itoa(int(b[0]) + 1900)
+	}
+
+	return str, 1, nil
+}
+
+func parseBitType(b []byte, meta uint16) (int64, int, error) {
+	numBits := int(((meta >> 8) * 8) + (meta & 0xFF))
+	numBytes := byteCountFromBitCount(numBits)
+	if err := checkValueLength(b, numBytes); err != nil {
+		return 0, 0, err
+	}
+	v, err := parseBit(b, numBits, numBytes)
+	return v, numBytes, err
+}
+
+// formatBits formats the value of a BIT column with metadata meta as a string
+// of as many binary digits as the column has bits, e.g. "00101".
+func formatBits(v int64, meta uint16) string {
+	numBits := int(((meta >> 8) * 8) + (meta & 0xFF))
+	return fmt.Sprintf("%0*b", numBits, uint64(v))
+}
+
+// enumLabel returns the label of an ENUM value: the value's index, from 1,
+// into the labels. 0 is the empty string, which MySQL stores for invalid
+// values outside of strict mode.
+func enumLabel(v interface{}, labels []string) (interface{}, error) {
+	i, ok := v.(int64)
+	if !ok {
+		return v, nil
+	}
+	if i == 0 {
+		return "", nil
+	}
+	if i < 0 || i > int64(len(labels)) {
+		return nil, fmt.Errorf("ENUM value %d out of %d labels", i, len(labels))
+	}
+	return labels[i-1], nil
+}
+
+// setLabels returns the labels of a SET value, a bitmask of indexes into the
+// labels, in definition order.
+func setLabels(v interface{}, labels []string) (interface{}, error) {
+	bits, ok := v.(int64)
+	if !ok {
+		return v, nil
+	}
+	if len(labels) < 64 && uint64(bits)>>uint(len(labels)) != 0 {
+		return nil, fmt.Errorf("SET value %#x has bits beyond its %d labels", uint64(bits), len(labels))
+	}
+
+	members := []string{}
+	for k, label := range labels {
+		if bits&(1<<uint(k)) != 0 {
+			members = append(members, label)
+		}
+	}
+	return members, nil
+}
+
+func parseBit(b []byte, numBits int, length int) (int64, error) {
+	var (
+		value int64
+		err   error
+	)
+	if numBits > 1 {
+		switch length {
+		case 1:
+			value = int64(b[0])
+		case 2:
+			value = int64(binary.BigEndian.Uint16(b))
+		case 4:
+			value = int64(binary.BigEndian.Uint32(b))
+		case 3, 5, 6, 7:
+			value = int64(getBigEndianFixedLengthInt(b[0:length]))
+		case 8:
+			value = int64(binary.BigEndian.Uint64(b))
+		default:
+			err = fmt.Errorf("invalid bit length %d", length)
+		}
+	} else {
+		if length != 1 {
+			err = fmt.Errorf("invalid bit length %d", length)
+		} else {
+			value = int64(b[0])
+		}
+	}
+	return value, err
+}
+
+func parseDecimalType(data []byte, meta uint16) (float64, int, error) {
+	s, n, err := parseDecimalString(data, meta)
+	if err != nil {
+		return 0, 0, err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, n, err
+}
+
+// decimalSize returns the size of a binary DECIMAL of the precision and scale
+// packed in meta.
+func decimalSize(meta uint16) (int, error) {
+	precision := int(meta >> 8)
+	decimals := int(meta & 0xFF)
+	if precision < 1 || precision > 65 || decimals > 30 || decimals > precision {
+		return 0, fmt.Errorf("invalid decimal precision %d and scale %d", precision, decimals)
+	}
+
+	integral := precision - decimals
+	return integral/digitsPerInteger*4 + compressedBytes[integral%digitsPerInteger] +
+		decimals/digitsPerInteger*4 + compressedBytes[decimals%digitsPerInteger], nil
+}
+
+// parseDecimalString decodes a binary DECIMAL into its exact decimal text.
+// Ref: https://github.com/jeremycole/mysql_binlog, vitess
+func parseDecimalString(data []byte, meta uint16) (string, int, error) {
+	binSize, err := decimalSize(meta)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = checkValueLength(data, binSize); err != nil {
+		return "", 0, err
+	}
+
+	precision := int(meta >> 8)
+	decimals := int(meta & 0xFF)
+	integral := (precision - decimals)
+	uncompIntegral := int(integral / digitsPerInteger)
+	uncompFractional := int(decimals / digitsPerInteger)
+	compIntegral := integral - (uncompIntegral * digitsPerInteger)
+	compFractional := decimals - (uncompFractional * digitsPerInteger)
+
+	buf := make([]byte, binSize)
+	copy(buf, data[:binSize])
+
+	// Going to destroy data
+	data = buf
+
+	// Support negative decimals:
+	// The sign is encoded in the high bit of the the byte, but this bit may also be used in the value
+	value := uint32(data[0])
+	var res bytes.Buffer
+	var mask uint32 = 0
+	if value&0x80 == 0 {
+		mask = uint32((1 << 32) - 1)
+		res.WriteString("-")
+	}
+
+	// Clear sign
+	data[0] ^= 0x80
+
+	pos, value := parseDecimalDecompressValue(compIntegral, data, uint8(mask))
+	res.WriteString(fmt.Sprintf("%d", value))
+
+	for i := 0; i < uncompIntegral; i++ {
+		value = binary.BigEndian.Uint32(data[pos:]) ^ mask
+		pos = pos + 4
+		res.WriteString(fmt.Sprintf("%09d", value))
+	}
+
+	res.WriteString(".")
+
+	for i := 0; i < uncompFractional; i++ {
+		value = binary.BigEndian.Uint32(data[pos:]) ^ mask
+		pos = pos + 4
+		res.WriteString(fmt.Sprintf("%09d", value))
+	}
+
+	if size, value := parseDecimalDecompressValue(compFractional, data[pos:], uint8(mask)); size > 0 {
+		res.WriteString(fmt.Sprintf("%0*d", compFractional, value))
+		pos = pos + size
+	}
+
+	return res.String(), pos, nil
+}
+
+func parseDateTime(b []byte) (time.Time, int, error) {
+	val := binary.LittleEndian.Uint64(b)
+	d := val / 1000000
+	t := val % 1000000
+	v := time.Date(
+		int(d/10000),              // year
+		time.Month((d%10000)/100), // month
+		int(d%100),                // day
+		int(t/10000),              // hour
+		int((t%10000)/100),        // minute
+		int(t%100),                // second
+		0,                         // nanosecond
+		time.UTC)
+	return v, 8, nil
+}
+
+func parseString(data []byte, length int) (v string, n int, err error) {
+	prefix := 1
+	if length >= 256 {
+		prefix = 2
+	}
+	if err = checkValueLength(data, prefix); err != nil {
+		return "", 0, err
+	}
+
+	n = prefix + int(getLittleEndianFixedLengthInt(data[:prefix]))
+	if err = checkValueLength(data, n); err != nil {
+		return "", 0, err
+	}
+	return getUnsafeString(data[prefix:n]), n, nil
+}
+
+const digitsPerInteger int = 9
+
+var compressedBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+func parseDecimalDecompressValue(compIndx int, data []byte, mask uint8) (size int, value uint32) {
+	size = compressedBytes[compIndx]
+	databuff := make([]byte, size)
+	for i := 0; i < size; i++ {
+		databuff[i] = data[i] ^ mask
+	}
+	value = uint32(getBigEndianFixedLengthInt(databuff))
+	return
+}
+
+func parseTimestamp2Type(data []byte, meta uint16) (string, int, error) {
+	sec, usec, numBytes, err := parseTimestamp2(data, meta)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if sec == 0 {
+		return "0000-00-00 00:00:00", numBytes, nil
+	}
+
+	t := time.Unix(sec, usec*1000)
+	return t.Format(TimeFormat), numBytes, nil
+}
+
+// parseTimestamp2 returns the seconds since the epoch and the microseconds of
+// a TIMESTAMP2 value.
+func parseTimestamp2(data []byte, meta uint16) (sec int64, usec int64, n int, err error) {
+	n = int(4 + (meta+1)/2)
+	if err = checkValueLength(data, n); err != nil {
+		return 0, 0, 0, err
+	}
+	sec = int64(binary.BigEndian.Uint32(data[0:4]))
 
 	switch meta {
 	case 1, 2:
-		frac = int64(data[5]) * 10000
+		usec = int64(data[4]) * 10000
 	case 3, 4:
-		frac = int64(binary.BigEndian.Uint16(data[5:7])) * 100
+		usec = int64(binary.BigEndian.Uint16(data[4:])) * 100
 	case 5, 6:
-		frac = int64(getBigEndianFixedLengthInt(data[5:8]))
+		usec = int64(getBigEndianFixedLengthInt(data[4:7]))
 	}
+	return sec, usec, n, nil
+}
 
-	if intPart == 0 {
-		return "0000-00-00 00:00:00", n, nil
+func decodeDatetime2(data []byte, meta uint16) (string, int, error) {
+	tmp, n, err := parseDatetime2Packed(data, meta)
+	if err != nil {
+		return "", 0, err
 	}
 
-	tmp := intPart<<24 + frac
+	if tmp>>24 == 0 {
+		return "0000-00-00 00:00:00", n, nil
+	}
 
 	if tmp < 0 {
 		tmp = -tmp
@@ -470,22 +1236,76 @@ func decodeDatetime2(data []byte, meta uint16) (string, int, error) {
 	minute := int((hms >> 6) % (1 << 6))
 	hour := int((hms >> 12))
 
-	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, minute, second), n, nil
-}
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, minute, second), n, nil
+}
+
+// parseDatetime2Packed returns a DATETIME2 value packed into an integer, as
+// formatPackedTemporal takes it.
+func parseDatetime2Packed(data []byte, meta uint16) (int64, int, error) {
+	n := int(5 + (meta+1)/2)
+	if err := checkValueLength(data, n); err != nil {
+		return 0, 0, err
+	}
+
+	intPart := int64(getBigEndianFixedLengthInt(data[0:5])) - DATETIMEF_INT_OFS
+	var frac int64 = 0
+
+	switch meta {
+	case 1, 2:
+		frac = int64(data[5]) * 10000
+	case 3, 4:
+		frac = int64(binary.BigEndian.Uint16(data[5:7])) * 100
+	case 5, 6:
+		frac = int64(getBigEndianFixedLengthInt(data[5:8]))
+	}
+
+	return intPart<<24 + frac, n, nil
+}
+
+const TIMEF_OFS int64 = 0x800000000000
+const TIMEF_INT_OFS int64 = 0x800000
+
+func parseTime2Type(data []byte, meta uint16) (string, int, error) {
+	tmp, numBytes, err := parseTime2Packed(data, meta)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if tmp == 0 {
+		return "00:00:00", numBytes, nil
+	}
+
+	hms := int64(0)
+	sign := ""
+	if tmp < 0 {
+		tmp = -tmp
+		sign = "-"
+	}
+
+	// Ignore second part (precision)
+	hms = tmp >> 24
+
+	hour := (hms >> 12) % (1 << 10)
+	minute := (hms >> 6) % (1 << 6)
+	second := hms % (1 << 6)
 
-const TIMEF_OFS int64 = 0x800000000000
-const TIMEF_INT_OFS int64 = 0x800000
+	return fmt.Sprintf("%s%02d:%02d:%02d", sign, hour, minute, second), numBytes, nil
+}
 
-func parseTime2Type(data []byte, meta uint16) (string, int, error) {
+// parseTime2Packed returns a TIME2 value packed into an integer, as
+// formatPackedTemporal takes it.
+func parseTime2Packed(data []byte, meta uint16) (int64, int, error) {
 	numBytes := int(3 + (meta+1)/2)
+	if err := checkValueLength(data, numBytes); err != nil {
+		return 0, 0, err
+	}
 
 	tmp := int64(0)
 	intPart := int64(0)
 	frac := int64(0)
 
 	switch meta {
-	case 1:
-	case 2:
+	case 1, 2:
 		intPart = int64(getBigEndianFixedLengthInt(data[0:3])) - TIMEF_INT_OFS
 		frac = int64(data[3])
 		if intPart < 0 && frac > 0 {
@@ -493,8 +1313,7 @@ func parseTime2Type(data []byte, meta uint16) (string, int, error) {
 			frac = frac - 0x100   /* -(0x100 - frac) */
 		}
 		tmp = intPart<<24 + frac*10000
-	case 3:
-	case 4:
+	case 3, 4:
 		intPart = int64(getBigEndianFixedLengthInt(data[0:3])) - TIMEF_INT_OFS
 		frac = int64(binary.BigEndian.Uint16(data[3:5]))
 		if intPart < 0 && frac > 0 {
@@ -503,33 +1322,14 @@ func parseTime2Type(data []byte, meta uint16) (string, int, error) {
 			frac = frac - 0x10000
 		}
 		tmp = intPart<<24 + frac*100
-	case 5:
-	case 6:
+	case 5, 6:
 		tmp = int64(getBigEndianFixedLengthInt(data[0:6])) - TIMEF_OFS
 	default:
 		intPart = int64(getBigEndianFixedLengthInt(data[0:3])) - TIMEF_INT_OFS
 		tmp = intPart << 24
 	}
 
-	if intPart == 0 {
-		return "00:00:00", numBytes, nil
-	}
-
-	hms := int64(0)
-	sign := ""
-	if tmp < 0 {
-		tmp = -tmp
-		sign = "-"
-	}
-
-	// Ignore second part (precision)
-	hms = tmp >> 24
-
-	hour := (hms >> 12) % (1 << 10)
-	minute := (hms >> 6) % (1 << 6)
-	second := hms % (1 << 6)
-
-	return fmt.Sprintf("%s%02d:%02d:%02d", sign, hour, minute, second), numBytes, nil
+	return tmp, numBytes, nil
 }
 
 func getUnsafeString(b []byte) (s string) {
@@ -539,3 +1339,650 @@ func getUnsafeString(b []byte) (s string) {
 	pstring.Len = pbytes.Len
 	return s
 }
+
+func (e *RowsEvent) encode(w *eventWriter, format *FormatDescriptionEvent, eventType EventType, table *TableMapEvent, o *ParserOptions) error {
+	if e.ColumnCount > table.ColumnCount {
+		return fmt.Errorf("column count %d exceeds the %d columns of table %s.%s", e.ColumnCount, table.ColumnCount, table.DatabaseName, table.TableName)
+	}
+
+	w.uintN(e.TableID, rowsTableIDSize(format, eventType))
+	w.uint16(e.Flags)
+	if isRowsEventV2(eventType) {
+		w.uint16(uint16(len(e.ExtraData) + 2))
+		w.bytes(e.ExtraData)
+	}
+	w.lengthEncodedInt(e.ColumnCount)
+
+	bitmap1, bitmap2 := e.ColumnBitmap1, e.ColumnBitmap2
+	if e.lazy != nil {
+		// The undecoded rows have the columns of the images before projection
+		bitmap1, bitmap2 = e.lazy.bitmaps[0], e.lazy.bitmaps[1]
+	}
+
+	bitCount := bitmapByteSize(int(e.ColumnCount))
+	w.bytes(padBytes(bitmap1, bitCount))
+	if isUpdateRowsEvent(eventType) {
+		w.bytes(padBytes(bitmap2, bitCount))
+	}
+
+	enc := newRowEncoder(table, o)
+	for i, row := range e.Rows {
+		bitmap := e.ColumnBitmap1
+		if isUpdateRowsEvent(eventType) && i%2 == 1 {
+			bitmap = e.ColumnBitmap2
+		}
+
+		var partialBits []byte
+		if eventType == PARTIAL_UPDATE_ROWS_EVENT && i%2 == 1 {
+			partialBits = e.encodeValueOptions(w, table, row)
+		}
+
+		if err := e.encodeRow(w, enc, padBytes(bitmap, bitCount), row, partialBits); err != nil {
+			return err
+		}
+	}
+	if e.lazy != nil {
+		w.bytes(e.lazy.b[e.lazy.start:])
+	}
+	w.bytes(e.UndecodedRows)
+
+	return nil
+}
+
+// encodeValueOptions writes the binlog_row_value_options of the after image
+// row of a partial update, and returns the bitmap of its JSON columns that
+// hold diffs. Tables without JSON columns get no options.
+func (e *RowsEvent) encodeValueOptions(w *eventWriter, table *TableMapEvent, row []interface{}) []byte {
+	if jsonColumnCount(table) == 0 {
+		w.lengthEncodedInt(0)
+		return nil
+	}
+
+	partialBits := make([]byte, bitmapByteSize(jsonColumnCount(table)))
+	jsonIndex := 0
+	for j, t := range table.ColumnTypes {
+		if t != MYSQL_TYPE_JSON {
+			continue
+		}
+		if j < len(row) {
+			if _, ok := row[j].([]JSONDiff); ok {
+				partialBits[jsonIndex/8] |= 1 << uint(jsonIndex%8)
+			}
+		}
+		jsonIndex++
+	}
+
+	w.lengthEncodedInt(PARTIAL_JSON_UPDATES)
+	w.bytes(partialBits)
+	return partialBits
+}
+
+// A rowEncoder undoes what options did decoding the values of the rows of a
+// table, for encodeValue; it's the counterpart of rowDecoder.
+type rowEncoder struct {
+	table   *TableMapEvent
+	o       *ParserOptions
+	columns []columnDefinition // nil if the options need none
+}
+
+func newRowEncoder(table *TableMapEvent, o *ParserOptions) *rowEncoder {
+	return &rowEncoder{table: table, o: o, columns: o.columnDefinitions(table)}
+}
+
+// value converts a value of column j back to one encodeValue takes: text to
+// its character set, ENUM and SET labels to their values, and TIMESTAMP
+// strings shown in the options' Location to times. Labels are looked up in
+// the table map if the options have none.
+func (enc *rowEncoder) value(j int, v interface{}) (interface{}, error) {
+	tp, meta := enc.table.ColumnTypes[j], enc.table.ColumnMetadata[j]
+	if tp == MYSQL_TYPE_STRING {
+		tp, _ = stringRealType(meta)
+	}
+
+	var c columnDefinition
+	if enc.columns != nil {
+		c = enc.columns[j]
+	}
+
+	switch tp {
+	case MYSQL_TYPE_ENUM, MYSQL_TYPE_SET:
+		if c.labels == nil && j < len(enc.table.ColumnValues) {
+			c.labels = enc.table.ColumnValues[j]
+		}
+		return c.encodeLabels(v, tp)
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2:
+		s, ok := v.(string)
+		if ok && enc.o != nil && enc.o.Location != nil && !strings.HasPrefix(s, "0000-00-00") {
+			return time.ParseInLocation(TimeFormat, s, enc.o.Location)
+		}
+	}
+	if c.charset != "" {
+		return encodeCharacterValue(v, c.charset)
+	}
+	return v, nil
+}
+
+// encodeLabels converts an ENUM label, or the []string of a SET's labels, to
+// its value. Other values are returned as they are.
+func (c columnDefinition) encodeLabels(v interface{}, tp byte) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if tp != MYSQL_TYPE_ENUM {
+			break
+		}
+		if v == "" {
+			return int64(0), nil
+		}
+		for i, label := range c.labels {
+			if label == v {
+				return int64(i + 1), nil
+			}
+		}
+		return nil, fmt.Errorf("%q isn't one of the %d labels of the ENUM", v, len(c.labels))
+	case []string:
+		if tp != MYSQL_TYPE_SET {
+			break
+		}
+		var bits int64
+	members:
+		for _, member := range v {
+			for k, label := range c.labels {
+				if label == member {
+					bits |= 1 << uint(k)
+					continue members
+				}
+			}
+			return nil, fmt.Errorf("%q isn't one of the %d labels of the SET", member, len(c.labels))
+		}
+		return bits, nil
+	}
+	return v, nil
+}
+
+// encodeRow writes one row image: the NULL bitmap of the present columns
+// followed by their non-NULL values. JSON columns with their bit set in
+// partialBits are written as diffs.
+func (e *RowsEvent) encodeRow(w *eventWriter, enc *rowEncoder, bitmap []byte, row []interface{}, partialBits []byte) error {
+	table := enc.table
+	nullBitmap := make([]byte, byteCountFromBitCount(bitCount(bitmap)))
+	values := new(eventWriter)
+
+	nullBitIndex := 0
+	jsonIndex := 0
+	for j := 0; j < int(e.ColumnCount); j++ {
+		isDiff := false
+		if partialBits != nil && table.ColumnTypes[j] == MYSQL_TYPE_JSON {
+			isDiff = getBit(partialBits, jsonIndex) != 0
+			jsonIndex++
+		}
+
+		if getBit(bitmap, j) == 0 {
+			continue
+		}
+
+		var v interface{}
+		if j < len(row) {
+			v = row[j]
+		}
+
+		var err error
+		switch {
+		case v == nil:
+			nullBitmap[nullBitIndex/8] |= 1 << uint(nullBitIndex%8)
+		case isDiff:
+			err = encodeJSONDiffs(values, table.ColumnMetadata[j], v.([]JSONDiff))
+		default:
+			if v, err = enc.value(j, v); err == nil {
+				err = encodeValue(values, table.ColumnTypes[j], table.ColumnMetadata[j], v)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("column %d: %v", j, err)
+		}
+		nullBitIndex = nullBitIndex + 1
+	}
+
+	w.bytes(nullBitmap)
+	w.bytes(values.b)
+	return nil
+}
+
+// encodeValue is the inverse of parseValue: it writes a value of the Go type
+// parseValue returns for a column type. Integer columns also accept any Go
+// integer type, and columns of the types ParserOptions decode values to
+// without their columns' definitions also accept them: time.Time for DATE,
+// DATETIME and TIMESTAMP, with their fractional seconds, time.Duration for
+// TIME, integers for YEAR, and strings of binary digits for BIT.
+func encodeValue(w *eventWriter, tp byte, meta uint16, v interface{}) error {
+	var length int
+
+	if tp == MYSQL_TYPE_STRING {
+		tp, length = stringRealType(meta)
+	}
+
+	switch tp {
+	case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_INT24, MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG:
+		i, ok := integerValue(v)
+		if !ok {
+			return fmt.Errorf("can't encode %T as an integer", v)
+		}
+		w.uintN(uint64(i), fixedValueSizes[tp])
+	case MYSQL_TYPE_NEWDECIMAL:
+		var b []byte
+		var err error
+		switch d := v.(type) {
+		case float64:
+			b, err = encodeDecimal(d, int(meta>>8), int(meta&0xFF))
+		case string:
+			b, err = encodeDecimalString(d, int(meta>>8), int(meta&0xFF))
+		default:
+			return fmt.Errorf("can't encode %T as a decimal", v)
+		}
+		if err != nil {
+			return err
+		}
+		w.bytes(b)
+	case MYSQL_TYPE_FLOAT:
+		f, ok := v.(float32)
+		if !ok {
+			return fmt.Errorf("can't encode %T as a float", v)
+		}
+		w.uint32(math.Float32bits(f))
+	case MYSQL_TYPE_DOUBLE:
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("can't encode %T as a double", v)
+		}
+		w.uint64(math.Float64bits(f))
+	case MYSQL_TYPE_BIT:
+		numBits := int(((meta >> 8) * 8) + (meta & 0xFF))
+		return encodeBit(w, v, byteCountFromBitCount(numBits))
+	case MYSQL_TYPE_SET:
+		i, ok := integerValue(v)
+		if !ok {
+			return fmt.Errorf("can't encode %T as a set", v)
+		}
+		if n := int(meta & 0xFF); n < 1 || n > 8 {
+			return fmt.Errorf("invalid SET packlen = %d", n)
+		}
+		w.uintN(uint64(i), int(meta&0xFF))
+	case MYSQL_TYPE_ENUM:
+		i, ok := integerValue(v)
+		if !ok {
+			return fmt.Errorf("can't encode %T as an enum", v)
+		}
+		switch meta & 0xFF {
+		case 1:
+			w.uint8(uint8(i))
+		case 2:
+			w.uint16(uint16(i))
+		default:
+			return fmt.Errorf("Unknown ENUM packlen=%d", meta&0xFF)
+		}
+	case MYSQL_TYPE_TIMESTAMP:
+		sec, _, err := timestampValue(v)
+		if err != nil {
+			return err
+		}
+		w.uint32(uint32(sec))
+	case MYSQL_TYPE_DATETIME:
+		f, err := datetimeValue(v)
+		if err != nil {
+			return err
+		}
+		d := uint64(f.year)*10000 + uint64(f.month)*100 + uint64(f.day)
+		w.uint64(d*1000000 + uint64(f.hour)*10000 + uint64(f.minute)*100 + uint64(f.second))
+	case MYSQL_TYPE_TIMESTAMP2:
+		sec, usec, err := timestampValue(v)
+		if err != nil {
+			return err
+		}
+		w.uintNBigEndian(uint64(sec), 4)
+		writeFraction(w, meta, usec)
+	case MYSQL_TYPE_DATETIME2:
+		f, err := datetimeValue(v)
+		if err != nil {
+			return err
+		}
+		ymd := (f.year*13+f.month)<<5 | f.day
+		hms := f.hour<<12 | f.minute<<6 | f.second
+		w.uintNBigEndian(uint64((ymd<<17|hms)+DATETIMEF_INT_OFS), 5)
+		writeFraction(w, meta, f.usec)
+	case MYSQL_TYPE_TIME:
+		neg, h, m, sec, _, err := timeValue(v)
+		if err != nil || neg {
+			return fmt.Errorf("can't encode %v as a time", v)
+		}
+		w.uintN(uint64(h*10000+m*100+sec), 3)
+	case MYSQL_TYPE_TIME2:
+		return encodeTime2(w, v, meta)
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
+		f, err := datetimeValue(v)
+		if err != nil {
+			return fmt.Errorf("can't encode %v as a date", v)
+		}
+		w.uintN(uint64(f.year*16*32+f.month*32+f.day), 3)
+	case MYSQL_TYPE_YEAR:
+		y, ok := integerValue(v)
+		if s, isString := v.(string); isString {
+			n, err := strconv.Atoi(s)
+			y, ok = int64(n), err == nil
+		}
+		if !ok || (y != 0 && (y < 1901 || y > 2155)) {
+			return fmt.Errorf("can't encode %v as a year", v)
+		}
+		if y != 0 {
+			y = y - 1900
+		}
+		w.uint8(uint8(y))
+	case MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB, MYSQL_TYPE_GEOMETRY:
+		b, ok := bytesValue(v)
+		if !ok {
+			return fmt.Errorf("can't encode %T as a blob", v)
+		}
+		if meta < 1 || meta > 4 {
+			return fmt.Errorf("invalid blob packlen = %d", meta)
+		}
+		w.uintN(uint64(len(b)), int(meta))
+		w.bytes(b)
+	case MYSQL_TYPE_JSON:
+		text, ok := bytesValue(v)
+		if !ok {
+			return fmt.Errorf("can't encode %T as JSON", v)
+		}
+		if meta < 1 || meta > 4 {
+			return fmt.Errorf("invalid JSON packlen = %d", meta)
+		}
+		b, err := encodeJSONBinary(text)
+		if err != nil {
+			return err
+		}
+		w.uintN(uint64(len(b)), int(meta))
+		w.bytes(b)
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING:
+		return encodeString(w, v, int(meta))
+	case MYSQL_TYPE_STRING:
+		return encodeString(w, v, length)
+	default:
+		return fmt.Errorf("unsupported type %d in binlog", tp)
+	}
+
+	return nil
+}
+
+func integerValue(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func bytesValue(v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	default:
+		return nil, false
+	}
+}
+
+func encodeBit(w *eventWriter, v interface{}, numBytes int) error {
+	i, ok := integerValue(v)
+	if s, isString := v.(string); isString {
+		// Binary digits, as BitStrings decodes values to
+		u, err := strconv.ParseUint(s, 2, 64)
+		i, ok = int64(u), err == nil
+	}
+	if !ok {
+		return fmt.Errorf("can't encode %v as a bit field", v)
+	}
+	if numBytes < 1 || numBytes > 8 {
+		return fmt.Errorf("invalid bit length %d", numBytes)
+	}
+	w.uintNBigEndian(uint64(i), numBytes)
+	return nil
+}
+
+func encodeString(w *eventWriter, v interface{}, length int) error {
+	b, ok := bytesValue(v)
+	if !ok {
+		return fmt.Errorf("can't encode %T as a string", v)
+	}
+
+	if length < 256 {
+		if len(b) > 0xff {
+			return fmt.Errorf("string of %d bytes is too long", len(b))
+		}
+		w.uint8(uint8(len(b)))
+	} else {
+		if len(b) > 0xffff {
+			return fmt.Errorf("string of %d bytes is too long", len(b))
+		}
+		w.uint16(uint16(len(b)))
+	}
+	w.bytes(b)
+	return nil
+}
+
+// encodeDecimal writes a number in MySQL's binary DECIMAL format: groups of
+// nine digits in four big-endian bytes each, with the leftover leading integer
+// and trailing fraction digits in fewer bytes. Negative numbers have all bits
+// inverted, and the top bit of the first byte is flipped.
+func encodeDecimal(f float64, precision int, decimals int) ([]byte, error) {
+	if precision < 1 || precision > 65 || decimals > 30 || decimals > precision {
+		return nil, fmt.Errorf("invalid decimal precision %d and scale %d", precision, decimals)
+	}
+
+	// Use the shortest representation of f, so that padding it to a wide
+	// scale adds zeros rather than float noise.
+	s := strconv.FormatFloat(math.Abs(f), 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 && len(s)-i-1 > decimals {
+		s = strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	}
+	if f < 0 {
+		s = "-" + s
+	}
+	return encodeDecimalString(s, precision, decimals)
+}
+
+// encodeDecimalString writes decimal text, such as ExactDecimals decodes
+// values to, in MySQL's binary DECIMAL format. It fails for text with more
+// fractional digits than the scale rather than round it.
+func encodeDecimalString(s string, precision int, decimals int) ([]byte, error) {
+	if precision < 1 || precision > 65 || decimals > 30 || decimals > precision {
+		return nil, fmt.Errorf("invalid decimal precision %d and scale %d", precision, decimals)
+	}
+
+	integral := precision - decimals
+	neg := strings.HasPrefix(s, "-")
+	intDigits, fracDigits := strings.TrimPrefix(s, "-"), ""
+	if i := strings.IndexByte(intDigits, '.'); i >= 0 {
+		intDigits, fracDigits = intDigits[:i], intDigits[i+1:]
+	}
+	if strings.Trim(intDigits+fracDigits, "0123456789") != "" || intDigits+fracDigits == "" {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	if len(fracDigits) > decimals {
+		return nil, fmt.Errorf("%s doesn't fit in DECIMAL(%d,%d)", s, precision, decimals)
+	}
+	fracDigits += strings.Repeat("0", decimals-len(fracDigits))
+	intDigits = strings.TrimLeft(intDigits, "0")
+	if len(intDigits) > integral {
+		return nil, fmt.Errorf("%s doesn't fit in DECIMAL(%d,%d)", s, precision, decimals)
+	}
+	intDigits = strings.Repeat("0", integral-len(intDigits)) + intDigits
+
+	w := new(eventWriter)
+	group := func(digits string) {
+		if digits == "" {
+			return
+		}
+		n, _ := strconv.ParseUint(digits, 10, 32)
+		size := 4
+		if len(digits) < digitsPerInteger {
+			size = compressedBytes[len(digits)]
+		}
+		w.uintNBigEndian(n, size)
+	}
+
+	lead := integral % digitsPerInteger
+	group(intDigits[:lead])
+	for i := lead; i < len(intDigits); i = i + digitsPerInteger {
+		group(intDigits[i : i+digitsPerInteger])
+	}
+	for i := 0; i < len(fracDigits); i = i + digitsPerInteger {
+		end := i + digitsPerInteger
+		if end > len(fracDigits) {
+			end = len(fracDigits)
+		}
+		group(fracDigits[i:end])
+	}
+
+	b := w.b
+	if neg {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	}
+	b[0] ^= 0x80
+
+	return b, nil
+}
+
+// scanTime parses a [-]HH:MM:SS string as returned for TIME columns.
+// timeValue splits a TIME value, a string such as parseValue decodes or a
+// time.Duration, into its sign, hours, minutes, seconds and microseconds.
+func timeValue(v interface{}) (neg bool, h, m, s, usec int64, err error) {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "-") {
+			neg = true
+			v = v[1:]
+		}
+		_, err = fmt.Sscanf(v, "%d:%d:%d", &h, &m, &s)
+		return neg, h, m, s, 0, err
+	case time.Duration:
+		if v < 0 {
+			neg, v = true, -v
+		}
+		usec = int64(v / time.Microsecond)
+		return neg, usec / 3600e6, usec / 60e6 % 60, usec / 1e6 % 60, usec % 1e6, nil
+	}
+	return false, 0, 0, 0, 0, fmt.Errorf("can't encode %T as a time", v)
+}
+
+// datetimeFields are the fields of a DATE or DATETIME value.
+type datetimeFields struct {
+	year, month, day, hour, minute, second, usec int64
+}
+
+// datetimeValue splits a DATE or DATETIME value, a string such as parseValue
+// decodes or a time.Time of its wall clock time, into its fields. Zero dates
+// decoded with ZeroDateTime are the zero time.Time.
+func datetimeValue(v interface{}) (f datetimeFields, err error) {
+	switch v := v.(type) {
+	case string:
+		n, _ := fmt.Sscanf(v, "%d-%d-%d %d:%d:%d", &f.year, &f.month, &f.day, &f.hour, &f.minute, &f.second)
+		if n != 3 && n != 6 {
+			return f, fmt.Errorf("can't encode %q as a datetime", v)
+		}
+	case time.Time:
+		if !v.IsZero() {
+			f.year, f.month, f.day = int64(v.Year()), int64(v.Month()), int64(v.Day())
+			f.hour, f.minute, f.second = int64(v.Hour()), int64(v.Minute()), int64(v.Second())
+			f.usec = int64(v.Nanosecond() / 1000)
+		}
+	default:
+		return f, fmt.Errorf("can't encode %T as a datetime", v)
+	}
+	return f, nil
+}
+
+// timestampValue returns the seconds since the epoch and the microseconds of
+// a TIMESTAMP value, a string in time.Local such as parseValue decodes or a
+// time.Time. Zero dates are 0.
+func timestampValue(v interface{}) (sec, usec int64, err error) {
+	switch v := v.(type) {
+	case string:
+		if v == "0000-00-00 00:00:00" {
+			return 0, 0, nil
+		}
+		t, err := time.ParseInLocation(TimeFormat, v, time.Local)
+		if err != nil {
+			return 0, 0, err
+		}
+		return t.Unix(), 0, nil
+	case time.Time:
+		if v.IsZero() {
+			return 0, 0, nil
+		}
+		return v.Unix(), int64(v.Nanosecond() / 1000), nil
+	}
+	return 0, 0, fmt.Errorf("can't encode %T as a timestamp", v)
+}
+
+// writeFraction writes the fractional seconds of a TIMESTAMP2 or DATETIME2
+// value, to the precision of its column.
+func writeFraction(w *eventWriter, meta uint16, usec int64) {
+	switch meta {
+	case 1, 2:
+		w.uint8(uint8(usec / 10000))
+	case 3, 4:
+		w.uintNBigEndian(uint64(usec/100), 2)
+	case 5, 6:
+		w.uintNBigEndian(uint64(usec), 3)
+	}
+}
+
+// encodeTime2 writes a TIME2 value as MySQL packs it: the hours, minutes and
+// seconds and the microseconds as one number, negated for negative times, of
+// which the fraction is written to the precision of the column.
+func encodeTime2(w *eventWriter, v interface{}, meta uint16) error {
+	neg, h, m, s, usec, err := timeValue(v)
+	if err != nil {
+		return fmt.Errorf("can't encode %v as a time", v)
+	}
+
+	packed := (h<<12|m<<6|s)<<24 + usec
+	if neg {
+		packed = -packed
+	}
+
+	// Fractions are written as the remainder of the packed number, so they're
+	// negative along with it.
+	switch meta {
+	case 1, 2:
+		w.uintNBigEndian(uint64(packed>>24+TIMEF_INT_OFS), 3)
+		w.uint8(uint8(int8(packed % (1 << 24) / 10000)))
+	case 3, 4:
+		w.uintNBigEndian(uint64(packed>>24+TIMEF_INT_OFS), 3)
+		w.uintNBigEndian(uint64(uint16(int16(packed%(1<<24)/100))), 2)
+	case 5, 6:
+		w.uintNBigEndian(uint64(packed+TIMEF_OFS), 6)
+	default:
+		w.uintNBigEndian(uint64(packed>>24+TIMEF_INT_OFS), 3)
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package binlog
 
 import (
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMysqlNullIsParsedProperly(t *testing.T) {
@@ -118,6 +121,42 @@ func TestMysqlDecimalIsParsedProperly(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestParserOptionsExactDecimals(t *testing.T) {
+	o := &ParserOptions{ExactDecimals: true}
+	for _, tc := range []struct {
+		s    string
+		meta uint16
+		want string
+	}{
+		{"-10.55", metaFromPrecAndDec(30, 25), "-10.5500000000000000000000000"},
+		{"12345678901234567890.123456789", metaFromPrecAndDec(65, 9), "12345678901234567890.123456789"},
+		{"0.5", metaFromPrecAndDec(4, 2), "0.50"},
+		{"-0.05", metaFromPrecAndDec(4, 2), "-0.05"},
+		{"7", metaFromPrecAndDec(10, 0), "7"},
+		{"0", metaFromPrecAndDec(10, 3), "0.000"},
+	} {
+		b, err := encodeDecimalString(tc.s, int(tc.meta>>8), int(tc.meta&0xff))
+		require.NoError(t, err, tc.s)
+
+		v, n, err := o.parseValue(b, MYSQL_TYPE_NEWDECIMAL, tc.meta)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, v)
+		assert.Equal(t, len(b), n)
+
+		// Floats encode the same where they're exact
+		if f, err := strconv.ParseFloat(tc.s, 64); err == nil && len(tc.s) < 10 {
+			fb, err := encodeDecimal(f, int(tc.meta>>8), int(tc.meta&0xff))
+			require.NoError(t, err)
+			assert.Equal(t, b, fb, tc.s)
+		}
+	}
+
+	for _, s := range []string{"1.234", "123456", "", "-", "1e3", "1.2.3"} {
+		_, err := encodeDecimalString(s, 4, 2)
+		assert.Error(t, err, "%q", s)
+	}
+}
+
 func TestMysqlFloatIsParsedProperly(t *testing.T) {
 	v, n, err := parseValue([]byte{0, 0, 0, 192}, MYSQL_TYPE_FLOAT, 0)
 
@@ -221,3 +260,289 @@ func TestGetUnsafeString(t *testing.T) {
 
 	assert.Equal(t, getUnsafeString(input), "abcdef")
 }
+
+// datetime2 encodes a DATETIME2(6) value.
+func datetime2(year, month, day, hour, minute, second, usec int64) []byte {
+	packed := ((year*13+month)<<5|day)<<17 | hour<<12 | minute<<6 | second
+	intPart := uint64(packed + DATETIMEF_INT_OFS)
+	return []byte{byte(intPart >> 32), byte(intPart >> 24), byte(intPart >> 16), byte(intPart >> 8), byte(intPart),
+		byte(usec >> 16), byte(usec >> 8), byte(usec)}
+}
+
+func TestParserOptionsDecodeTemporalValuesToTime(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	o := &ParserOptions{ParseTime: true, Location: tokyo}
+
+	v, n, err := o.parseValue(datetime2(2017, 7, 14, 2, 40, 0, 123456), MYSQL_TYPE_DATETIME2, 6)
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 123456000, tokyo), v)
+
+	v, _, err = o.parseValue([]byte{0x59, 0x68, 0x2f, 0x00, 0x01, 0xe2, 0x40}, MYSQL_TYPE_TIMESTAMP2, 6)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1500000000, 123456000).In(tokyo), v)
+
+	v, _, err = o.parseValue([]byte{0xee, 0xc2, 0x0f}, MYSQL_TYPE_DATE, 0) // 2017-07-14
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 7, 14, 0, 0, 0, 0, tokyo), v)
+
+	v, _, err = o.parseValue([]byte{0x7f, 0xfd, 0x80, 0x00, 0x00, 0x00}, MYSQL_TYPE_TIME2, 6) // -00:10:00
+	require.NoError(t, err)
+	assert.Equal(t, -10*time.Minute, v)
+
+	v, _, err = o.parseValue([]byte{117}, MYSQL_TYPE_YEAR, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2017), v)
+}
+
+func TestParserOptionsShowTimestampsInLocation(t *testing.T) {
+	o := &ParserOptions{Location: time.UTC}
+
+	v, _, err := o.parseValue([]byte{0x00, 0x2f, 0x68, 0x59}, MYSQL_TYPE_TIMESTAMP, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "2017-07-14 02:40:00", v)
+
+	// DATETIMEs are wall clock times, whatever the location.
+	v, _, err = o.parseValue(datetime2(2017, 7, 14, 2, 40, 0, 0), MYSQL_TYPE_DATETIME2, 6)
+	require.NoError(t, err)
+	assert.Equal(t, "2017-07-14 02:40:00", v)
+}
+
+func TestParserOptionsZeroDatePolicies(t *testing.T) {
+	zero := datetime2(0, 0, 0, 0, 0, 0, 0)
+	partial := datetime2(2017, 0, 0, 0, 0, 0, 0)
+
+	for _, tt := range []struct {
+		o       ParserOptions
+		data    []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{ParserOptions{}, zero, "0000-00-00 00:00:00", false},
+		{ParserOptions{ZeroDates: ZeroDateNull}, zero, nil, false},
+		{ParserOptions{ZeroDates: ZeroDateTime}, zero, time.Time{}, false},
+		{ParserOptions{ZeroDates: ZeroDateError}, zero, nil, true},
+		{ParserOptions{ParseTime: true}, zero, "0000-00-00 00:00:00", false},
+		{ParserOptions{ParseTime: true}, partial, "2017-00-00 00:00:00", false},
+		{ParserOptions{ParseTime: true, ZeroDates: ZeroDateNull}, partial, nil, false},
+	} {
+		v, _, err := tt.o.parseValue(tt.data, MYSQL_TYPE_DATETIME2, 6)
+		if tt.wantErr {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, v, "%+v", tt.o)
+	}
+}
+
+func TestParserOptionsCopyBytes(t *testing.T) {
+	data := []byte{0x02, 'h', 'i'}
+
+	v, _, err := (&ParserOptions{}).parseValue(data, MYSQL_TYPE_VARCHAR, 255)
+	require.NoError(t, err)
+	copied, _, err := (&ParserOptions{CopyBytes: true}).parseValue(data, MYSQL_TYPE_VARCHAR, 255)
+	require.NoError(t, err)
+
+	data[1] = 'H'
+	assert.Equal(t, "Hi", v)
+	assert.Equal(t, "hi", copied)
+}
+
+// parseEncodedRowsEvent encodes a table map and a rows event, and parses them
+// back with the options.
+func parseEncodedRowsEvent(t *testing.T, o ParserOptions, tme *TableMapEvent, rows *RowsEvent) *RowsEvent {
+	enc := NewBinlogEncoder()
+	p := NewBinlogParserWithOptions(o)
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{WRITE_ROWS_EVENT_V2, rows},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+	return parsed.Event.(*RowsEvent)
+}
+
+func labelledRowsEvent(t *testing.T, o ParserOptions, values [][]string) *RowsEvent {
+	point := []byte{0xe6, 0x10, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x40}
+	tme := &TableMapEvent{
+		TableID:      12,
+		DatabaseName: []byte("shard767"),
+		TableName:    []byte("places"),
+		ColumnCount:  5,
+		ColumnTypes:  []byte{MYSQL_TYPE_STRING, MYSQL_TYPE_STRING, MYSQL_TYPE_STRING, MYSQL_TYPE_BIT, MYSQL_TYPE_GEOMETRY},
+		ColumnMetadata: []uint16{uint16(MYSQL_TYPE_ENUM)<<8 | 1, uint16(MYSQL_TYPE_SET)<<8 | 1,
+			uint16(MYSQL_TYPE_ENUM)<<8 | 1, 1<<8 | 2, 4},
+		NullBitVector: []byte{0x1f},
+		ColumnValues:  values,
+	}
+	write := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   5,
+		ColumnBitmap1: []byte{0x1f},
+		Rows: [][]interface{}{
+			{int64(2), int64(5), int64(0), int64(5), point},
+			{int64(1), int64(0), int64(1), int64(0x3ff), point},
+		},
+	}
+	return parseEncodedRowsEvent(t, o, tme, write)
+}
+
+func TestRowsEventsDecodeEnumsSetsBitsAndGeometry(t *testing.T) {
+	values := [][]string{{"small", "large"}, {"a", "b", "c"}, {"x"}, nil, nil}
+	o := ParserOptions{DecodeEnums: true, BitStrings: true, Geometry: GeometryWKT}
+
+	e := labelledRowsEvent(t, o, values)
+	assert.Equal(t, []interface{}{"large", []string{"a", "c"}, "", "0000000101", "POINT(1 2)"}, e.Rows[0])
+	assert.Equal(t, []interface{}{"small", []string{}, "x", "1111111111", "POINT(1 2)"}, e.Rows[1])
+
+	o.Geometry = GeometryGeoJSON
+	e = labelledRowsEvent(t, o, values)
+	assert.Equal(t, `{"type":"Point","coordinates":[1,2],"crs":{"type":"name","properties":{"name":"EPSG:4326"}}}`, e.Rows[0][4])
+
+	// Labels come from the schema when the table map has none.
+	o.Schemas = func(database, table string) *TableSchema {
+		return &TableSchema{Columns: []*Column{{Values: values[0]}, {Values: values[1]}, {Values: values[2]}, {}, {}}}
+	}
+	e = labelledRowsEvent(t, o, nil)
+	assert.Equal(t, "large", e.Rows[0][0])
+	assert.Equal(t, []string{"a", "c"}, e.Rows[0][1])
+
+	// Without the options, values are decoded as they are.
+	e = labelledRowsEvent(t, ParserOptions{}, values)
+	assert.Equal(t, int64(2), e.Rows[0][0])
+	assert.Equal(t, int64(5), e.Rows[0][1])
+	assert.Equal(t, int64(5), e.Rows[0][3])
+	assert.IsType(t, []byte{}, e.Rows[0][4])
+}
+
+func TestEnumAndSetValuesOutsideTheirLabelsFail(t *testing.T) {
+	_, err := enumLabel(int64(3), []string{"a", "b"})
+	assert.Error(t, err)
+
+	_, err = setLabels(int64(4), []string{"a", "b"})
+	assert.Error(t, err)
+
+	v, err := setLabels(int64(-1), make([]string, 64))
+	assert.NoError(t, err)
+	assert.Len(t, v, 64)
+}
+
+func TestRowsEventsWithFourByteTableIDsAreParsed(t *testing.T) {
+	format := *testFormatDescription()
+	format.EventTypeHeaderLengths = append([]byte(nil), format.EventTypeHeaderLengths...)
+	format.EventTypeHeaderLengths[TABLE_MAP_EVENT-1] = 6
+	format.EventTypeHeaderLengths[WRITE_ROWS_EVENT_V1-1] = 6
+	assert.Equal(t, 4, rowsTableIDSize(&format, WRITE_ROWS_EVENT_V1))
+	assert.Equal(t, 6, rowsTableIDSize(testFormatDescription(), WRITE_ROWS_EVENT_V1))
+	assert.Equal(t, 6, rowsTableIDSize(nil, WRITE_ROWS_EVENT_V2))
+
+	tme := &TableMapEvent{
+		TableID:        0x01020304,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    1,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONG},
+		ColumnMetadata: []uint16{0},
+		NullBitVector:  []byte{0x00},
+	}
+	write := &RowsEvent{TableID: tme.TableID, ColumnCount: 1, ColumnBitmap1: []byte{0x01},
+		Rows: [][]interface{}{{int32(7)}}}
+
+	enc := NewBinlogEncoder()
+	p := NewBinlogParser()
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, &format},
+		{TABLE_MAP_EVENT, tme},
+		{WRITE_ROWS_EVENT_V1, write},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []byte{4, 3, 2, 1, 0, 0}, parsed.Bytes[EventHeaderSize:EventHeaderSize+6])
+	re := parsed.Event.(*RowsEvent)
+	assert.Equal(t, tme.TableID, re.TableID)
+	assert.Equal(t, [][]interface{}{{int32(7)}}, re.Rows)
+}
+
+func TestPreGARowsEventsAreParsed(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    2,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONG, MYSQL_TYPE_NEWDATE},
+		ColumnMetadata: []uint16{0, 0},
+		NullBitVector:  []byte{0x02},
+	}
+	update := &RowsEvent{TableID: 12, ColumnCount: 2, ColumnBitmap1: []byte{0x03}, ColumnBitmap2: []byte{0x03},
+		Rows: [][]interface{}{{int32(1), "2007-03-01"}, {int32(1), "2007-03-02"}}}
+
+	enc := NewBinlogEncoder()
+	p := NewBinlogParser()
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{PRE_GA_UPDATE_ROWS_EVENT, update},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+
+	re := parsed.Event.(*RowsEvent)
+	assert.True(t, re.IsUpdate())
+	assert.Equal(t, update.Rows, re.Rows)
+}
+
+func TestValuesOfUnknownTypesAreLeftUndecoded(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("legacy"),
+		ColumnCount:    2,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONG, MYSQL_TYPE_DECIMAL},
+		ColumnMetadata: []uint16{0, 0},
+		NullBitVector:  []byte{0x02},
+	}
+	write := &RowsEvent{TableID: 12, ColumnCount: 2, ColumnBitmap1: []byte{0x03},
+		Rows: [][]interface{}{{int32(1), nil}},
+		// A row with a non-NULL old-style DECIMAL, whose size isn't logged
+		UndecodedRows: []byte{0x00, 2, 0, 0, 0, '1', '.', '5'},
+	}
+
+	e := parseEncodedRowsEvent(t, ParserOptions{}, tme, write)
+
+	assert.Equal(t, write.Rows, e.Rows)
+	assert.Equal(t, write.UndecodedRows, e.UndecodedRows)
+
+	// The before image of an update is left undecoded with its after image.
+	update := &RowsEvent{TableID: 12, ColumnCount: 2, ColumnBitmap1: []byte{0x03}, ColumnBitmap2: []byte{0x03},
+		UndecodedRows: []byte{0x02, 1, 0, 0, 0, 0x00, 2, 0, 0, 0, '1'}}
+	w := new(eventWriter)
+	require.NoError(t, update.encode(w, nil, UPDATE_ROWS_EVENT_V2, tme, nil))
+	ev, err := NewRowsEvent(map[uint64]*TableMapEvent{12: tme}, UPDATE_ROWS_EVENT_V2, w.b)
+	require.NoError(t, err)
+	assert.Empty(t, ev.(*RowsEvent).Rows)
+	assert.Equal(t, update.UndecodedRows, ev.(*RowsEvent).UndecodedRows)
+}
@@ -1,13 +1,6 @@
 package binlog
 
-import (
-	"encoding/binary"
-	"errors"
-	"io"
-)
-
 // A TableMapEvent defines the structure of tables that are about to be changed.
-// We don't support old_row_based_repl_4_byte_map_id_master mode.
 type TableMapEvent struct {
 	TableID        uint64
 	Flags          uint16
@@ -17,141 +10,462 @@ type TableMapEvent struct {
 	ColumnTypes    []byte
 	ColumnMetadata []uint16
 	NullBitVector  []byte
-	// coldescriptors?
+
+	// ColumnCollations holds the collation ID of each CHAR, VARCHAR and TEXT
+	// column, and 0 for the others, when the server logs them: MySQL 8.0 with
+	// binlog_row_metadata. It is nil otherwise.
+	ColumnCollations []uint16
+
+	// ColumnValues holds the labels of each ENUM and SET column, and nil for
+	// the others, when the server logs them: MySQL 8.0 with
+	// binlog_row_metadata=FULL. It is nil otherwise.
+	ColumnValues [][]string
+
+	// ColumnUnsigned tells whether each numeric column is unsigned, when the
+	// server logs it: MySQL 8.0 with binlog_row_metadata. It is nil otherwise.
+	ColumnUnsigned []bool
+
+	// ColumnNames holds the names of the columns, and PrimaryKey the indexes
+	// of the primary key columns in key order, when the server logs them:
+	// MySQL 8.0 with binlog_row_metadata=FULL. They are nil otherwise, and
+	// PrimaryKey is also nil for tables without a primary key.
+	ColumnNames []string
+	PrimaryKey  []int
 }
 
+// Types of the optional metadata fields that MySQL 8.0 appends to table maps.
+const (
+	TABLE_MAP_OPT_META_SIGNEDNESS uint8 = iota + 1
+	TABLE_MAP_OPT_META_DEFAULT_CHARSET
+	TABLE_MAP_OPT_META_COLUMN_CHARSET
+	TABLE_MAP_OPT_META_COLUMN_NAME
+	TABLE_MAP_OPT_META_SET_STR_VALUE
+	TABLE_MAP_OPT_META_ENUM_STR_VALUE
+	TABLE_MAP_OPT_META_GEOMETRY_TYPE
+	TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY
+	TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX
+	TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET
+	TABLE_MAP_OPT_META_ENUM_AND_SET_COLUMN_CHARSET
+	TABLE_MAP_OPT_META_COLUMN_VISIBILITY
+)
+
 // Payload is structured as follows for MySQL v5.5:
-//   19 bytes for common v4 event header
-//   6 bytes (uint64) for table id
-//   2 bytes (uint16) for flags
-//   1 byte (uint8), x, for database name length
-//   x + 1 bytes for db name (zero-terminated)
-//   1 byte (uint8), y, for table name length
-//   y + 1 bytes for table name (zero-terminated)
-//   1 to 9 bytes (net_store_length variable encoded uint64), z, for number of
-//     columns
-//   z bytes for column types (1 byte per column)
-//   1 to 9 bytes (net_store_length variable encoded uint64), w, for field
-//     metadata size
-//   w bytes for field metadata
-//   ceil(z / 8) bytes for nullable columns (1 bit per column)
+//
+//	19 bytes for common v4 event header
+//	6 bytes (uint64) for table id
+//	2 bytes (uint16) for flags
+//	1 byte (uint8), x, for database name length
+//	x + 1 bytes for db name (zero-terminated)
+//	1 byte (uint8), y, for table name length
+//	y + 1 bytes for table name (zero-terminated)
+//	1 to 9 bytes (net_store_length variable encoded uint64), z, for number of
+//	  columns
+//	z bytes for column types (1 byte per column)
+//	1 to 9 bytes (net_store_length variable encoded uint64), w, for field
+//	  metadata size
+//	w bytes for field metadata
+//	ceil(z / 8) bytes for nullable columns (1 bit per column)
+//	optional metadata fields (MySQL 8.0), each of them:
+//	  1 byte (uint8) for the field type (TABLE_MAP_OPT_META_*)
+//	  1 to 9 bytes (net_store_length variable encoded uint64), v, for the
+//	    field length
+//	  v bytes for the field value
 func NewTableMapEvent(format *FormatDescriptionEvent, b []byte) (Event, error) {
 	var tableIDSize int
-	if format.EventTypeHeaderLengths[TABLE_MAP_EVENT-1] == 6 {
+	if format.postHeaderLength(TABLE_MAP_EVENT) == 6 {
 		tableIDSize = 4
 	} else {
 		tableIDSize = 6
 	}
 
 	e := new(TableMapEvent)
-	i := 0
+	r := newEventReader(b)
 
 	// Numeric table ID (now 6 bytes, previously 4)
-	e.TableID = getLittleEndianFixedLengthInt(b[0:tableIDSize])
-	i = i + tableIDSize
+	e.TableID = r.uintN(tableIDSize)
 
 	// Flags (2 bytes)
-	e.Flags = binary.LittleEndian.Uint16(b[i:])
-	i = i + 2
+	e.Flags = r.uint16()
 
 	// Length of the database name (1 byte)
-	dbNameLength := int(b[i])
-	i = i + 1
+	dbNameLength := int(r.uint8())
 
 	// Database name (string[dbNameLength])
-	dbName := b[i : i+dbNameLength+1]
-	i = i + dbNameLength + 1
-	e.DatabaseName = dbName[:dbNameLength] // drop the null-termination char
+	e.DatabaseName = r.bytes(dbNameLength)
+	r.skip(1) // drop the null-termination char
 
 	// Length of the table name
-	tblNameLength := int(b[i])
-	i = i + 1
+	tblNameLength := int(r.uint8())
 
 	// Table name (string[tableLength])
-	tblName := b[i : i+tblNameLength+1]
-	i = i + tblNameLength + 1
-	e.TableName = tblName[:tblNameLength] // drop the null-termination char
+	e.TableName = r.bytes(tblNameLength)
+	r.skip(1) // drop the null-termination char
 
 	// Number of columns in the table map (lenenc-int)
-	var n int
-	e.ColumnCount, _, n = getLengthEncodedInt(b[i:])
-	i = i + n
+	columnCount := r.lengthEncodedInt()
+	if r.err == nil && columnCount > uint64(r.len()) {
+		r.fail("column count %d exceeds event size", columnCount)
+	}
+	e.ColumnCount = columnCount
 
 	// Array of column definitions: one byte per field type
-	e.ColumnTypes = b[i : i+int(e.ColumnCount)]
-	i = i + int(e.ColumnCount)
+	e.ColumnTypes = r.bytes(int(e.ColumnCount))
 
 	// Array of metadata per column (lenenc-str):
 	// length is the overall length of the metadata array in bytes
 	// length of each metadata field is dependent on the column's field type
-	var err error
-	var metadata []byte
-	if metadata, _, n, err = getLengthEncodedString(b[i:]); err != nil {
-		return nil, err
+	metadataLength := r.lengthEncodedInt()
+	if r.err == nil && metadataLength > uint64(r.len()) {
+		r.fail("need %d bytes of column metadata, have %d", metadataLength, r.len())
+	}
+	if r.err != nil {
+		return nil, r.err
 	}
-	if err = e.parseMetadata(metadata); err != nil {
+	if err := e.parseMetadata(r.sub(int(metadataLength))); err != nil {
 		return nil, err
 	}
-	i = i + n
 
 	// A bitmask containing a bit set for each column that can be null.
-	if len(b[i:]) != bitmapByteSize(int(e.ColumnCount)) {
-		return nil, io.EOF
+	e.NullBitVector = r.bytes(bitmapByteSize(int(e.ColumnCount)))
+
+	// Optional metadata fields, of which unknown ones are skipped
+	for r.err == nil && r.len() > 0 {
+		t := r.uint8()
+		length := r.lengthEncodedInt()
+		if r.err == nil && length > uint64(r.len()) {
+			r.fail("need %d bytes of optional metadata, have %d", length, r.len())
+		}
+		if r.err != nil {
+			break
+		}
+		if err := e.parseOptionalMetadata(t, r.sub(int(length))); err != nil {
+			return nil, err
+		}
 	}
-	e.NullBitVector = b[i:]
 
+	if r.err != nil {
+		return nil, r.err
+	}
 	return e, nil
 }
 
-func (e *TableMapEvent) parseMetadata(b []byte) error {
+// parseOptionalMetadata decodes the value of an optional metadata field of
+// type t.
+//
+// DEFAULT_CHARSET is structured as follows:
+//
+//	1 to 9 bytes (net_store_length variable encoded uint64) for the default
+//	  collation of the character columns
+//	for each character column whose collation isn't the default:
+//	  1 to 9 bytes (net_store_length) for the column's index among the
+//	    character columns
+//	  1 to 9 bytes (net_store_length) for its collation
+//
+// COLUMN_CHARSET is structured as follows:
+//
+//	for each character column:
+//	  1 to 9 bytes (net_store_length) for its collation
+//
+// SIGNEDNESS is a bitmap with a bit per numeric column, from the high bit of
+// the first byte, set for unsigned columns.
+//
+// COLUMN_NAME is structured as follows:
+//
+//	for each column:
+//	  1 to 9 bytes (net_store_length), x, for the name length
+//	  x bytes for the name
+//
+// SIMPLE_PRIMARY_KEY is structured as follows:
+//
+//	for each primary key column:
+//	  1 to 9 bytes (net_store_length) for its index
+//
+// PRIMARY_KEY_WITH_PREFIX is structured as follows:
+//
+//	for each primary key column:
+//	  1 to 9 bytes (net_store_length) for its index
+//	  1 to 9 bytes (net_store_length) for the length of its prefix in the
+//	    key, or 0 for all of it
+//
+// SET_STR_VALUE and ENUM_STR_VALUE are structured as follows:
+//
+//	for each SET (or ENUM) column:
+//	  1 to 9 bytes (net_store_length), n, for the number of labels
+//	  n labels, each of them:
+//	    1 to 9 bytes (net_store_length), x, for the label length
+//	    x bytes for the label
+func (e *TableMapEvent) parseOptionalMetadata(t uint8, r *eventReader) error {
+	switch t {
+	case TABLE_MAP_OPT_META_SIGNEDNESS:
+		columns := e.numericColumns()
+		bitmap := r.bytes(bitmapByteSize(len(columns)))
+		if r.err == nil {
+			e.ColumnUnsigned = make([]bool, e.ColumnCount)
+			for i, j := range columns {
+				e.ColumnUnsigned[j] = bitmap[i/8]&(0x80>>uint(i%8)) != 0
+			}
+		}
+	case TABLE_MAP_OPT_META_COLUMN_NAME:
+		e.ColumnNames = make([]string, 0, e.ColumnCount)
+		for j := uint64(0); j < e.ColumnCount && r.err == nil; j++ {
+			e.ColumnNames = append(e.ColumnNames, string(r.lengthEncodedBytes()))
+		}
+	case TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX:
+		e.PrimaryKey = []int{}
+		for r.err == nil && r.len() > 0 {
+			j := r.lengthEncodedInt()
+			if t == TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX {
+				r.lengthEncodedInt()
+			}
+			if r.err == nil && j >= e.ColumnCount {
+				r.fail("primary key column %d out of %d", j, e.ColumnCount)
+			}
+			e.PrimaryKey = append(e.PrimaryKey, int(j))
+		}
+	case TABLE_MAP_OPT_META_DEFAULT_CHARSET:
+		columns := e.characterColumns()
+		defaultCollation := uint16(r.lengthEncodedInt())
+		e.ColumnCollations = make([]uint16, e.ColumnCount)
+		for _, j := range columns {
+			e.ColumnCollations[j] = defaultCollation
+		}
+		for r.err == nil && r.len() > 0 {
+			i := r.lengthEncodedInt()
+			collation := uint16(r.lengthEncodedInt())
+			if r.err == nil && i >= uint64(len(columns)) {
+				r.fail("character column %d out of %d", i, len(columns))
+			}
+			if r.err == nil {
+				e.ColumnCollations[columns[i]] = collation
+			}
+		}
+	case TABLE_MAP_OPT_META_COLUMN_CHARSET:
+		e.ColumnCollations = make([]uint16, e.ColumnCount)
+		for _, j := range e.characterColumns() {
+			e.ColumnCollations[j] = uint16(r.lengthEncodedInt())
+		}
+	case TABLE_MAP_OPT_META_SET_STR_VALUE, TABLE_MAP_OPT_META_ENUM_STR_VALUE:
+		tp := MYSQL_TYPE_SET
+		if t == TABLE_MAP_OPT_META_ENUM_STR_VALUE {
+			tp = MYSQL_TYPE_ENUM
+		}
+		if e.ColumnValues == nil {
+			e.ColumnValues = make([][]string, e.ColumnCount)
+		}
+		for _, j := range e.columnsOfType(tp) {
+			n := r.lengthEncodedInt()
+			if r.err == nil && n > uint64(r.len()) {
+				r.fail("%d labels exceed metadata size", n)
+			}
+			labels := make([]string, 0, int(n))
+			for k := uint64(0); k < n && r.err == nil; k++ {
+				labels = append(labels, string(r.lengthEncodedBytes()))
+			}
+			e.ColumnValues[j] = labels
+		}
+	}
+	return r.err
+}
+
+// columnsOfType returns the indexes of the columns whose real type is tp, as
+// MYSQL_TYPE_STRING columns give it in their metadata.
+func (e *TableMapEvent) columnsOfType(tp byte) []int {
+	var columns []int
+	for j, t := range e.ColumnTypes {
+		if t == MYSQL_TYPE_STRING && j < len(e.ColumnMetadata) {
+			t, _ = stringRealType(e.ColumnMetadata[j])
+		}
+		if t == tp {
+			columns = append(columns, j)
+		}
+	}
+	return columns
+}
+
+// numericColumns returns the indexes of the columns that have a signedness in
+// optional metadata.
+func (e *TableMapEvent) numericColumns() []int {
+	var columns []int
+	for j, tp := range e.ColumnTypes {
+		switch tp {
+		case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_INT24, MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG,
+			MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE, MYSQL_TYPE_NEWDECIMAL:
+			columns = append(columns, j)
+		}
+	}
+	return columns
+}
+
+// characterColumns returns the indexes of the columns that have a collation
+// in optional metadata.
+func (e *TableMapEvent) characterColumns() []int {
+	var columns []int
+	for j, tp := range e.ColumnTypes {
+		if j < len(e.ColumnMetadata) && isCharacterColumn(tp, e.ColumnMetadata[j]) {
+			columns = append(columns, j)
+		}
+	}
+	return columns
+}
+
+// parseMetadata reads the metadata of each column, whose size depends on its
+// type. Types MySQL logs no metadata for, and ones unknown to us, have none.
+func (e *TableMapEvent) parseMetadata(r *eventReader) error {
 	e.ColumnMetadata = make([]uint16, e.ColumnCount)
-	i := 0
 
 	for col, t := range e.ColumnTypes {
 		switch t {
 		// Tightly packed due to MySQL Bug #37426 ref: https://bugs.mysql.com/bug.php?id=37426
-		case MYSQL_TYPE_STRING:
-			x := uint16(b[i]) << 8 // type
-			x = x + uint16(b[i+1]) // length
+		case MYSQL_TYPE_STRING,
+			MYSQL_TYPE_ENUM,
+			MYSQL_TYPE_SET:
+			x := uint16(r.uint8()) << 8 // type
+			x = x + uint16(r.uint8())   // length
 			e.ColumnMetadata[col] = x
-			i = i + 2
 		case MYSQL_TYPE_VAR_STRING,
 			MYSQL_TYPE_VARCHAR,
 			MYSQL_TYPE_BIT:
-			e.ColumnMetadata[col] = binary.LittleEndian.Uint16(b[i:])
-			i = i + 2
+			e.ColumnMetadata[col] = r.uint16()
 		case MYSQL_TYPE_NEWDECIMAL:
-			x := uint16(b[i]) << 8 // precision
-			x = x + uint16(b[i+1]) // decimals
+			x := uint16(r.uint8()) << 8 // precision
+			x = x + uint16(r.uint8())   // decimals
 			e.ColumnMetadata[col] = x
-			i = i + 2
 		case MYSQL_TYPE_BLOB,
+			MYSQL_TYPE_TINY_BLOB,
+			MYSQL_TYPE_MEDIUM_BLOB,
+			MYSQL_TYPE_LONG_BLOB,
 			MYSQL_TYPE_DOUBLE,
 			MYSQL_TYPE_FLOAT,
-			MYSQL_TYPE_GEOMETRY:
-			e.ColumnMetadata[col] = uint16(b[i])
-			i = i + 1
+			MYSQL_TYPE_GEOMETRY,
+			MYSQL_TYPE_JSON:
+			e.ColumnMetadata[col] = uint16(r.uint8())
 		case MYSQL_TYPE_TIME2,
 			MYSQL_TYPE_DATETIME2,
 			MYSQL_TYPE_TIMESTAMP2:
-			e.ColumnMetadata[col] = uint16(b[i])
-			i = i + 1
-		// These shouldn't appear, give up
-		case MYSQL_TYPE_NEWDATE,
-			MYSQL_TYPE_ENUM,
-			MYSQL_TYPE_SET,
-			MYSQL_TYPE_TINY_BLOB,
-			MYSQL_TYPE_MEDIUM_BLOB,
-			MYSQL_TYPE_LONG_BLOB:
-			return errors.New("unsupported type")
+			e.ColumnMetadata[col] = uint16(r.uint8())
 		default:
 			e.ColumnMetadata[col] = 0
 		}
+
+		if r.err != nil {
+			return r.err
+		}
 	}
 
 	return nil
 }
 
+func (e *TableMapEvent) encode(w *eventWriter, format *FormatDescriptionEvent) {
+	if format.postHeaderLength(TABLE_MAP_EVENT) == 6 {
+		w.uintN(e.TableID, 4)
+	} else {
+		w.uintN(e.TableID, 6)
+	}
+	w.uint16(e.Flags)
+
+	w.uint8(uint8(len(e.DatabaseName)))
+	w.bytes(e.DatabaseName)
+	w.uint8(0)
+
+	w.uint8(uint8(len(e.TableName)))
+	w.bytes(e.TableName)
+	w.uint8(0)
+
+	w.lengthEncodedInt(e.ColumnCount)
+	w.bytes(e.ColumnTypes)
+
+	m := new(eventWriter)
+	for col, t := range e.ColumnTypes {
+		meta := e.ColumnMetadata[col]
+		switch t {
+		case MYSQL_TYPE_STRING, MYSQL_TYPE_ENUM, MYSQL_TYPE_SET, MYSQL_TYPE_NEWDECIMAL:
+			m.uint8(uint8(meta >> 8))
+			m.uint8(uint8(meta))
+		case MYSQL_TYPE_VAR_STRING,
+			MYSQL_TYPE_VARCHAR,
+			MYSQL_TYPE_BIT:
+			m.uint16(meta)
+		case MYSQL_TYPE_BLOB,
+			MYSQL_TYPE_TINY_BLOB,
+			MYSQL_TYPE_MEDIUM_BLOB,
+			MYSQL_TYPE_LONG_BLOB,
+			MYSQL_TYPE_DOUBLE,
+			MYSQL_TYPE_FLOAT,
+			MYSQL_TYPE_GEOMETRY,
+			MYSQL_TYPE_JSON,
+			MYSQL_TYPE_TIME2,
+			MYSQL_TYPE_DATETIME2,
+			MYSQL_TYPE_TIMESTAMP2:
+			m.uint8(uint8(meta))
+		}
+	}
+	w.lengthEncodedBytes(m.b)
+
+	w.bytes(padBytes(e.NullBitVector, bitmapByteSize(int(e.ColumnCount))))
+
+	if e.ColumnUnsigned != nil {
+		columns := e.numericColumns()
+		bitmap := make([]byte, bitmapByteSize(len(columns)))
+		for i, j := range columns {
+			if j < len(e.ColumnUnsigned) && e.ColumnUnsigned[j] {
+				bitmap[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+		w.uint8(TABLE_MAP_OPT_META_SIGNEDNESS)
+		w.lengthEncodedBytes(bitmap)
+	}
+
+	if e.ColumnCollations != nil {
+		c := new(eventWriter)
+		for _, j := range e.characterColumns() {
+			c.lengthEncodedInt(uint64(e.ColumnCollations[j]))
+		}
+		w.uint8(TABLE_MAP_OPT_META_COLUMN_CHARSET)
+		w.lengthEncodedBytes(c.b)
+	}
+
+	if e.ColumnNames != nil {
+		n := new(eventWriter)
+		for _, name := range e.ColumnNames {
+			n.lengthEncodedBytes([]byte(name))
+		}
+		w.uint8(TABLE_MAP_OPT_META_COLUMN_NAME)
+		w.lengthEncodedBytes(n.b)
+	}
+
+	if e.ColumnValues != nil {
+		for _, t := range []uint8{TABLE_MAP_OPT_META_SET_STR_VALUE, TABLE_MAP_OPT_META_ENUM_STR_VALUE} {
+			tp := MYSQL_TYPE_SET
+			if t == TABLE_MAP_OPT_META_ENUM_STR_VALUE {
+				tp = MYSQL_TYPE_ENUM
+			}
+			columns := e.columnsOfType(tp)
+			if len(columns) == 0 {
+				continue
+			}
+
+			v := new(eventWriter)
+			for _, j := range columns {
+				v.lengthEncodedInt(uint64(len(e.ColumnValues[j])))
+				for _, label := range e.ColumnValues[j] {
+					v.lengthEncodedBytes([]byte(label))
+				}
+			}
+			w.uint8(t)
+			w.lengthEncodedBytes(v.b)
+		}
+	}
+
+	if e.PrimaryKey != nil {
+		k := new(eventWriter)
+		for _, j := range e.PrimaryKey {
+			k.lengthEncodedInt(uint64(j))
+		}
+		w.uint8(TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY)
+		w.lengthEncodedBytes(k.b)
+	}
+}
+
 // Note: MySQL docs claim this is (n+8)/7, but the below is actually correct
 func bitmapByteSize(columnCount int) int {
 	return int(columnCount+7) / 8
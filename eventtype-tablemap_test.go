@@ -119,3 +119,163 @@ func TestParsesTableMapEventTableNameCorrectly(t *testing.T) {
 
 	assert.EqualValues(t, tme.TableName, want)
 }
+
+func TestTableMapEventOptionalMetadataIsParsed(t *testing.T) {
+	input := []byte{
+		// Table ID
+		76, 0, 0, 0, 0, 0,
+		// Flags
+		1, 0,
+		// Database name
+		1, 'd', 0,
+		// Table name
+		1, 't', 0,
+		// Column types: VARCHAR, LONG, BLOB, CHAR and ENUM
+		5, 15, 3, 252, 254, 254,
+		// Metadata
+		7, 40, 0, 2, 0xfe, 10, 0xf7, 1,
+		// Null bits
+		0x1f,
+		// SIGNEDNESS
+		1, 1, 0x80,
+		// DEFAULT_CHARSET: utf8mb4_0900_ai_ci, but binary for the BLOB and
+		// latin1_swedish_ci for the CHAR
+		2, 7, 0xfc, 255, 0, 1, 63, 2, 8,
+		// An unknown field
+		99, 2, 1, 2,
+	}
+
+	ev, err := NewTableMapEvent(testFormatDescription(), input)
+
+	if assert.NoError(t, err) {
+		e := ev.(*TableMapEvent)
+		assert.Equal(t, []byte{0x1f}, e.NullBitVector)
+		assert.Equal(t, []uint16{255, 0, 63, 8, 0}, e.ColumnCollations)
+		assert.Equal(t, []bool{false, true, false, false, false}, e.ColumnUnsigned)
+	}
+
+	// A pair naming a column past the character columns
+	bad := append(append([]byte{}, input[:32]...), 2, 3, 8, 3, 8)
+	_, err = NewTableMapEvent(testFormatDescription(), bad)
+	assert.Error(t, err)
+}
+
+func TestTableMapEventColumnCollationsRoundTrip(t *testing.T) {
+	e := &TableMapEvent{
+		TableID:          12,
+		DatabaseName:     []byte("shard767"),
+		TableName:        []byte("uploads"),
+		ColumnCount:      3,
+		ColumnTypes:      []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_BLOB},
+		ColumnMetadata:   []uint16{0, 255, 2},
+		NullBitVector:    []byte{0x06},
+		ColumnCollations: []uint16{0, 8, 63},
+	}
+
+	w := new(eventWriter)
+	e.encode(w, testFormatDescription())
+	parsed, err := NewTableMapEvent(testFormatDescription(), w.b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, e, parsed)
+	}
+}
+
+func TestTableMapEventColumnValuesRoundTrip(t *testing.T) {
+	e := &TableMapEvent{
+		TableID:      12,
+		DatabaseName: []byte("shard767"),
+		TableName:    []byte("uploads"),
+		ColumnCount:  4,
+		ColumnTypes:  []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_STRING, MYSQL_TYPE_STRING, MYSQL_TYPE_STRING},
+		ColumnMetadata: []uint16{0, uint16(MYSQL_TYPE_ENUM)<<8 | 1, uint16(MYSQL_TYPE_SET)<<8 | 1,
+			uint16(MYSQL_TYPE_ENUM)<<8 | 1},
+		NullBitVector: []byte{0x00},
+		ColumnValues:  [][]string{nil, {"small", "large"}, {"a", "b", "c"}, {""}},
+	}
+
+	w := new(eventWriter)
+	e.encode(w, testFormatDescription())
+	parsed, err := NewTableMapEvent(testFormatDescription(), w.b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, e, parsed)
+	}
+}
+
+func TestTableMapEventWithEveryMetadataVariantRoundTrips(t *testing.T) {
+	e := &TableMapEvent{
+		TableID:      12,
+		DatabaseName: []byte("shard767"),
+		TableName:    []byte("legacy"),
+		ColumnCount:  8,
+		ColumnTypes: []byte{MYSQL_TYPE_DECIMAL, MYSQL_TYPE_NEWDATE, MYSQL_TYPE_ENUM, MYSQL_TYPE_SET,
+			MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB, 0xf2},
+		ColumnMetadata: []uint16{0, 0, uint16(MYSQL_TYPE_ENUM)<<8 | 2, uint16(MYSQL_TYPE_SET)<<8 | 8, 1, 3, 4, 0},
+		NullBitVector:  []byte{0xff},
+	}
+
+	w := new(eventWriter)
+	e.encode(w, testFormatDescription())
+	parsed, err := NewTableMapEvent(testFormatDescription(), w.b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, e, parsed)
+	}
+}
+
+func TestTableMapEventColumnNamesAndPrimaryKeyRoundTrip(t *testing.T) {
+	e := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    4,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_LONGLONG, MYSQL_TYPE_NEWDECIMAL},
+		ColumnMetadata: []uint16{0, 255, 0, metaFromPrecAndDec(10, 2)},
+		NullBitVector:  []byte{0x0a},
+		ColumnUnsigned: []bool{false, false, true, true},
+		ColumnNames:    []string{"shard_id", "name", "id", "size"},
+		PrimaryKey:     []int{2, 0},
+	}
+
+	w := new(eventWriter)
+	e.encode(w, testFormatDescription())
+	parsed, err := NewTableMapEvent(testFormatDescription(), w.b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, e, parsed)
+	}
+}
+
+func TestTableMapEventPrimaryKeyWithPrefixIsParsed(t *testing.T) {
+	input := []byte{
+		// Table ID
+		76, 0, 0, 0, 0, 0,
+		// Flags
+		1, 0,
+		// Database name
+		1, 'd', 0,
+		// Table name
+		1, 't', 0,
+		// Column types: LONG and VARCHAR
+		2, 3, 15,
+		// Metadata
+		2, 0xff, 0,
+		// Null bits
+		0x00,
+		// PRIMARY_KEY_WITH_PREFIX: the VARCHAR's first 10 characters, then
+		// the LONG
+		9, 4, 1, 10, 0, 0,
+	}
+
+	ev, err := NewTableMapEvent(testFormatDescription(), input)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{1, 0}, ev.(*TableMapEvent).PrimaryKey)
+	}
+
+	// A key column past the last column
+	input[len(input)-2] = 2
+	_, err = NewTableMapEvent(testFormatDescription(), input)
+	assert.Error(t, err)
+}
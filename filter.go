@@ -0,0 +1,158 @@
+package binlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A ReplicationFilter selects the tables and event types a BinlogParser
+// decodes, with rules like the --replicate-* options of a MySQL replica. Tables
+// are given as "database.table", and the wild rules take LIKE patterns, in
+// which % matches any run of characters, _ any one character, and \ escapes
+// either. Names are compared case-sensitively.
+//
+// Tables are checked as a replica checks the tables of row events:
+//   - if DoDBs isn't empty, the database must be in it; otherwise it must not
+//     be in IgnoreDBs
+//   - a table in DoTables passes, and then one in IgnoreTables is filtered out
+//   - a table matching WildDoTables passes, and then one matching
+//     WildIgnoreTables is filtered out
+//   - a table matching neither is filtered out if DoTables or WildDoTables
+//     isn't empty, and otherwise passes
+type ReplicationFilter struct {
+	DoDBs            []string // replicate-do-db
+	IgnoreDBs        []string // replicate-ignore-db
+	DoTables         []string // replicate-do-table
+	IgnoreTables     []string // replicate-ignore-table
+	WildDoTables     []string // replicate-wild-do-table
+	WildIgnoreTables []string // replicate-wild-ignore-table
+
+	// IncludeEvents, if not empty, are the only event types that pass, and
+	// ExcludeEvents are those that don't.
+	IncludeEvents []EventType
+	ExcludeEvents []EventType
+}
+
+// Validate returns an error if a table rule isn't of the form
+// "database.table"; such rules match no table.
+func (f *ReplicationFilter) Validate() error {
+	for _, rules := range [][]string{f.DoTables, f.IgnoreTables, f.WildDoTables, f.WildIgnoreTables} {
+		for _, rule := range rules {
+			if i := strings.IndexByte(rule, '.'); i <= 0 || i == len(rule)-1 {
+				return fmt.Errorf("table rule %q is not of the form database.table", rule)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchTable reports whether the rows of a table pass the filter. A nil
+// filter passes every table.
+func (f *ReplicationFilter) MatchTable(database, table string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.DoDBs) > 0 {
+		if !containsString(f.DoDBs, database) {
+			return false
+		}
+	} else if containsString(f.IgnoreDBs, database) {
+		return false
+	}
+
+	name := database + "." + table
+	if containsString(f.DoTables, name) {
+		return true
+	}
+	if containsString(f.IgnoreTables, name) {
+		return false
+	}
+	if matchTableRules(f.WildDoTables, database, table) {
+		return true
+	}
+	if matchTableRules(f.WildIgnoreTables, database, table) {
+		return false
+	}
+	return len(f.DoTables) == 0 && len(f.WildDoTables) == 0
+}
+
+// MatchEvent reports whether events of type t pass the filter. A nil filter
+// passes every event.
+func (f *ReplicationFilter) MatchEvent(t EventType) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.IncludeEvents) > 0 && !containsEventType(f.IncludeEvents, t) {
+		return false
+	}
+	return !containsEventType(f.ExcludeEvents, t)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsEventType(list []EventType, t EventType) bool {
+	for _, v := range list {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTableRules reports whether a table matches any of the wild rules.
+func matchTableRules(rules []string, database, table string) bool {
+	for _, rule := range rules {
+		i := strings.IndexByte(rule, '.')
+		if i < 0 {
+			continue
+		}
+		if matchLike(rule[:i], database) && matchLike(rule[i+1:], table) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLike reports whether s matches the LIKE pattern.
+func matchLike(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+
+	// On a mismatch, retry from the last %, letting it match one more rune
+	star, next := -1, 0
+	i, j := 0, 0
+	for j < len(t) {
+		switch {
+		case i < len(p) && p[i] == '%':
+			star, next = i, j
+			i++
+			continue
+		case i < len(p) && p[i] == '\\' && i+1 < len(p):
+			if p[i+1] == t[j] {
+				i, j = i+2, j+1
+				continue
+			}
+		case i < len(p) && (p[i] == '_' || p[i] == t[j]):
+			i, j = i+1, j+1
+			continue
+		}
+
+		if star < 0 {
+			return false
+		}
+		next++
+		i, j = star+1, next
+	}
+
+	for i < len(p) && p[i] == '%' {
+		i++
+	}
+	return i == len(p)
+}
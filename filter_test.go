@@ -0,0 +1,205 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchLike(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"uploads", "uploads", true},
+		{"uploads", "upload", false},
+		{"%", "", true},
+		{"%", "anything", true},
+		{"shard%", "shard767", true},
+		{"shard%", "shar", false},
+		{"shard_67", "shard767", true},
+		{"shard_67", "shard67", false},
+		{"%_log%", "user_login", true},
+		{"%log", "logs", false},
+		{"a%b%c", "aXbYbZc", true},
+		{"a%b%c", "aXcYb", false},
+		{`tmp\_%`, "tmp_1", true},
+		{`tmp\_%`, "tmpx1", false},
+		{`100\%`, "100%", true},
+		{`100\%`, "1000", false},
+		{"caf_", "café", true},
+	} {
+		assert.Equal(t, tc.match, matchLike(tc.pattern, tc.s), "%q LIKE %q", tc.s, tc.pattern)
+	}
+}
+
+func TestReplicationFilterMatchTable(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		filter *ReplicationFilter
+		pass   []string
+		fail   []string
+	}{
+		{"nil", nil, []string{"a.b"}, nil},
+		{"empty", &ReplicationFilter{}, []string{"a.b"}, nil},
+		{
+			"do db",
+			&ReplicationFilter{DoDBs: []string{"shard1", "shard2"}, IgnoreDBs: []string{"shard1"}},
+			[]string{"shard1.uploads", "shard2.users"},
+			[]string{"shard3.uploads", "Shard1.uploads"},
+		},
+		{
+			"ignore db",
+			&ReplicationFilter{IgnoreDBs: []string{"mysql"}},
+			[]string{"shard1.uploads"},
+			[]string{"mysql.user"},
+		},
+		{
+			"do table",
+			&ReplicationFilter{DoTables: []string{"shard1.uploads"}, IgnoreTables: []string{"shard1.uploads", "shard1.users"}},
+			[]string{"shard1.uploads"},
+			[]string{"shard1.users", "shard1.likes", "shard2.uploads"},
+		},
+		{
+			"ignore table",
+			&ReplicationFilter{IgnoreTables: []string{"shard1.users"}},
+			[]string{"shard1.uploads", "shard2.users"},
+			[]string{"shard1.users"},
+		},
+		{
+			"wild do table",
+			&ReplicationFilter{WildDoTables: []string{"shard%.upload%"}, WildIgnoreTables: []string{"shard%.%"}},
+			[]string{"shard1.uploads", "shard22.upload_tags"},
+			[]string{"shard1.users", "other.uploads"},
+		},
+		{
+			"wild ignore table",
+			&ReplicationFilter{IgnoreDBs: []string{"mysql"}, WildIgnoreTables: []string{`%.tmp\_%`}},
+			[]string{"shard1.tmpkeep", "shard1.uploads"},
+			[]string{"shard1.tmp_drop", "mysql.user"},
+		},
+		{
+			"dbs before tables",
+			&ReplicationFilter{DoDBs: []string{"shard1"}, DoTables: []string{"shard2.uploads"}},
+			nil,
+			[]string{"shard2.uploads", "shard1.uploads"},
+		},
+	} {
+		for _, name := range tc.pass {
+			db, table := splitTableName(name)
+			assert.True(t, tc.filter.MatchTable(db, table), "%s: %s", tc.name, name)
+		}
+		for _, name := range tc.fail {
+			db, table := splitTableName(name)
+			assert.False(t, tc.filter.MatchTable(db, table), "%s: %s", tc.name, name)
+		}
+	}
+}
+
+func splitTableName(name string) (string, string) {
+	for i := range name {
+		if name[i] == '.' {
+			return name[:i], name[i+1:]
+		}
+	}
+	return name, ""
+}
+
+func TestReplicationFilterMatchEvent(t *testing.T) {
+	var f *ReplicationFilter
+	assert.True(t, f.MatchEvent(QUERY_EVENT))
+
+	f = &ReplicationFilter{ExcludeEvents: []EventType{QUERY_EVENT}}
+	assert.False(t, f.MatchEvent(QUERY_EVENT))
+	assert.True(t, f.MatchEvent(XID_EVENT))
+
+	f = &ReplicationFilter{IncludeEvents: []EventType{WRITE_ROWS_EVENT_V2, QUERY_EVENT}, ExcludeEvents: []EventType{QUERY_EVENT}}
+	assert.True(t, f.MatchEvent(WRITE_ROWS_EVENT_V2))
+	assert.False(t, f.MatchEvent(QUERY_EVENT))
+	assert.False(t, f.MatchEvent(DELETE_ROWS_EVENT_V2))
+}
+
+func TestReplicationFilterValidate(t *testing.T) {
+	assert.NoError(t, (&ReplicationFilter{DoTables: []string{"a.b"}, WildDoTables: []string{"a%.%"}}).Validate())
+
+	for _, rule := range []string{"uploads", ".uploads", "shard1.", ""} {
+		assert.Error(t, (&ReplicationFilter{IgnoreTables: []string{rule}}).Validate(), "%q", rule)
+	}
+}
+
+func TestParserFiltersTablesAndEventTypes(t *testing.T) {
+	enc := NewBinlogEncoder()
+	encode := func(tp EventType, e Event) []byte {
+		b, err := enc.Encode(&EventHeader{EventType: tp, ServerId: 1}, e)
+		require.NoError(t, err)
+		return b
+	}
+
+	table := func(id uint64, database, name string) *TableMapEvent {
+		return &TableMapEvent{
+			TableID:        id,
+			DatabaseName:   []byte(database),
+			TableName:      []byte(name),
+			ColumnCount:    1,
+			ColumnTypes:    []byte{MYSQL_TYPE_LONG},
+			ColumnMetadata: []uint16{0},
+			NullBitVector:  []byte{0x00},
+		}
+	}
+	write := func(id uint64) *RowsEvent {
+		return &RowsEvent{TableID: id, Flags: 1, ColumnCount: 1, ColumnBitmap1: []byte{0x01},
+			Rows: [][]interface{}{{int32(7)}}}
+	}
+
+	events := [][]byte{
+		encode(FORMAT_DESCRIPTION_EVENT, testFormatDescription()),
+		encode(TABLE_MAP_EVENT, table(1, "shard1", "uploads")),
+		encode(TABLE_MAP_EVENT, table(2, "shard1", "users")),
+		encode(WRITE_ROWS_EVENT_V2, write(1)),
+		encode(WRITE_ROWS_EVENT_V2, write(2)),
+		encode(QUERY_EVENT, &QueryEvent{DatabaseName: []byte("shard1"), Query: []byte("BEGIN")}),
+		encode(XID_EVENT, &XidEvent{Xid: 9}),
+	}
+
+	p := NewBinlogParserWithOptions(ParserOptions{Filter: &ReplicationFilter{
+		WildDoTables:  []string{"shard%.upload%"},
+		ExcludeEvents: []EventType{QUERY_EVENT, XID_EVENT, INTVAR_EVENT},
+	}})
+	var parsed []*EventContainer
+	for _, b := range events {
+		e, err := p.Parse(b)
+		require.NoError(t, err)
+		parsed = append(parsed, e)
+	}
+
+	var filtered []bool
+	for _, e := range parsed {
+		filtered = append(filtered, e.Filtered)
+	}
+	assert.Equal(t, []bool{false, false, true, false, true, true, true}, filtered)
+
+	// Table maps of filtered tables aren't kept.
+	assert.Contains(t, p.tables, uint64(1))
+	assert.NotContains(t, p.tables, uint64(2))
+
+	assert.Equal(t, [][]interface{}{{int32(7)}}, parsed[3].Event.(*RowsEvent).Rows)
+	assert.Equal(t, &RowsEvent{TableID: 2, Flags: 1, Skipped: true}, parsed[4].Event)
+
+	// Events the parser depends on are parsed even when filtered; others not.
+	assert.IsType(t, &QueryEvent{}, parsed[5].Event)
+	assert.IsType(t, &XidEvent{}, parsed[6].Event)
+	intvar := encode(INTVAR_EVENT, &IntVarEvent{Type: INSERT_ID_EVENT, Value: 3})
+	e, err := p.Parse(intvar)
+	require.NoError(t, err)
+	assert.True(t, e.Filtered)
+	assert.IsType(t, &GenericEvent{}, e.Event)
+
+	// A table ID reused by a table that passes is decoded again.
+	_, err = p.Parse(encode(TABLE_MAP_EVENT, table(2, "shard2", "uploads")))
+	require.NoError(t, err)
+	e, err = p.Parse(encode(WRITE_ROWS_EVENT_V2, write(2)))
+	require.NoError(t, err)
+	assert.False(t, e.Filtered)
+	assert.Equal(t, [][]interface{}{{int32(7)}}, e.Event.(*RowsEvent).Rows)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,7 +16,7 @@ type Follower struct {
 	wg              sync.WaitGroup
 	m               sync.Mutex
 	c               *Conn
-	followerID         uint32
+	followerID      uint32
 	hostname        string
 	host            string
 	port            uint16
@@ -23,10 +24,16 @@ type Follower struct {
 	password        string
 	masterID        uint32
 	parser          *BinlogParser
+	flavor          Flavor
 	NextPosition    Position
 	running         bool
 	semiSyncEnabled bool
 	stopChan        chan struct{}
+
+	// NextMariadbGTIDs is the GTID position to resume a MariaDB stream from:
+	// the last committed transaction of each domain seen so far.
+	NextMariadbGTIDs MariadbGTIDList
+	pendingGTID      *MariadbGtidEvent // transaction in progress
 }
 
 // NewFollower returns a new Follower. The followerId passed in must be unique
@@ -34,7 +41,7 @@ type Follower struct {
 // IDs collide, the master will stop sending packets to one of the two.
 func NewFollower(followerId uint32) *Follower {
 	f := &Follower{
-		followerID:         followerId,
+		followerID:      followerId,
 		masterID:        0,
 		parser:          NewBinlogParser(),
 		running:         false,
@@ -68,6 +75,33 @@ func (f *Follower) GetLeaderPosition() (filename string, position uint32, err er
 	return filename, uint32(positionValue), nil
 }
 
+// EnableSemiSync asks the leader to send the stream with semi-sync headers and
+// acknowledges every event that requests it, so that a leader running
+// semi-synchronous replication can count the Follower as a replica. It takes
+// effect the next time the Follower registers.
+func (f *Follower) EnableSemiSync() {
+	f.semiSyncEnabled = true
+}
+
+// SetParserOptions changes how the Follower decodes row values. Call it before
+// starting to sync.
+func (f *Follower) SetParserOptions(o ParserOptions) {
+	f.parser.SetOptions(o)
+}
+
+// ApplyJSONDiffs makes the Follower apply the JSON diffs of partial updates
+// (binlog_row_value_options=PARTIAL_JSON) to the before images, so that rows
+// events carry whole documents. It sets ParserOptions.ApplyJSONDiffs.
+func (f *Follower) ApplyJSONDiffs() {
+	f.parser.ApplyJSONDiffs()
+}
+
+// Flavor returns the flavor of the leader, detected from the server version
+// it reported when the Follower registered.
+func (f *Follower) Flavor() Flavor {
+	return f.flavor
+}
+
 // Hostname returns the hostname that the Follower will register to the leader as.
 func (f *Follower) Hostname() string {
 	if f.hostname == "" {
@@ -113,6 +147,8 @@ func (f *Follower) registerFollower() error {
 		return err
 	}
 
+	f.flavor = flavorOfVersion(f.c.serverVersion)
+
 	var r *Result
 	if r, err = f.c.execute("SHOW GLOBAL VARIABLES LIKE 'BINLOG_CHECKSUM'"); err != nil {
 		return err
@@ -125,6 +161,20 @@ func (f *Follower) registerFollower() error {
 		}
 	}
 
+	if f.flavor == MariaDBFlavor {
+		// Without this MariaDB rewrites its GTID and annotate rows events
+		// into events a MySQL 5.5 replica understands.
+		if _, err = f.c.execute(fmt.Sprintf("SET @mariadb_slave_capability = %d", MARIA_SLAVE_CAPABILITY_MINE)); err != nil {
+			return err
+		}
+	}
+
+	if f.semiSyncEnabled {
+		if _, err = f.c.execute("SET @rpl_semi_sync_slave = 1"); err != nil {
+			return err
+		}
+	}
+
 	if err = f.writeRegisterFollowerCommand(); err != nil {
 		return err
 	}
@@ -169,19 +219,144 @@ func (f *Follower) StartSync(binlogFile string, binlogPos uint32) (*Streamer, er
 		return nil, err
 	}
 
+	f.NextPosition = pos
+
 	return f.startStream(), nil
 }
 
+// StartSyncMariadbGTID starts streaming from a MariaDB leader at the GTID
+// position gtids, as the leader's @@gtid_slave_pos would: the stream starts
+// after the last transaction listed for each domain, whichever binlog file it
+// is in. Use NextMariadbGTIDs to resume a stream.
+func (f *Follower) StartSyncMariadbGTID(gtids MariadbGTIDList) (*Streamer, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if err := f.checkExec(); err != nil {
+		return nil, err
+	}
+	if f.flavor != MariaDBFlavor {
+		return nil, errors.New("GTID positions of this form need a MariaDB leader")
+	}
+
+	for _, q := range []string{
+		fmt.Sprintf("SET @slave_connect_state = '%s'", gtids),
+		"SET @slave_gtid_strict_mode = 0",
+		"SET @slave_gtid_ignore_duplicates = 0",
+	} {
+		if _, err := f.c.execute(q); err != nil {
+			return nil, err
+		}
+	}
+
+	// With a connect state, the leader ignores the file name and position.
+	pos := Position{"", 4}
+	if err := f.writeBinlogDumpCommand(pos); err != nil {
+		return nil, err
+	}
+
+	f.NextPosition = pos
+	f.NextMariadbGTIDs = append(MariadbGTIDList(nil), gtids...)
+	f.pendingGTID = nil
+
+	return f.startStream(), nil
+}
+
+// StartSnapshotSync takes a consistent snapshot of the tables in cfg, streams
+// their current rows as synthetic insert events, and then continues with the
+// binlog from the position the snapshot was taken at, so that no change is lost
+// or seen twice. Snapshot events carry the LOG_EVENT_ARTIFICIAL_F header flag.
+//
+// The snapshot is read over a second connection using the credentials passed
+// to RegisterFollower, which need the RELOAD privilege for the brief global read
+// lock that pins the snapshot to a binlog position.
+func (f *Follower) StartSnapshotSync(cfg SnapshotConfig) (*Streamer, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if err := f.checkExec(); err != nil {
+		return nil, err
+	}
+
+	c, err := NewConn(f.host, f.port, f.user, f.password, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := beginSnapshot(c, cfg.ChunkSize)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	o := f.parser.Options()
+	s.options = &o
+
+	// Always start from position >= 4
+	if s.Position.Pos < 4 {
+		s.Position.Pos = 4
+	}
+	f.NextPosition = s.Position
+
+	f.running = true
+	f.stopChan = make(chan struct{}, 1)
+
+	str := newStreamer()
+
+	f.wg.Add(1)
+	go f.snapshotTo(str, s, cfg.Tables)
+
+	return str, nil
+}
+
+// snapshotTo sends the snapshot's rows to the streamer, then requests the
+// binlog stream from the snapshot's position and processes it.
+func (f *Follower) snapshotTo(str *Streamer, s *Snapshot, tables []TableName) {
+	defer f.wg.Done()
+
+	stopped := false
+	emit := func(e *EventContainer) bool {
+		stopped = !f.sendEvent(str, e)
+		return !stopped
+	}
+
+	var err error
+	for _, t := range tables {
+		if err = s.readTable(t, emit); err != nil || stopped {
+			break
+		}
+	}
+
+	if cerr := s.close(); err == nil {
+		err = cerr
+	}
+
+	switch {
+	case stopped:
+		str.closeWithError(errors.New("sync stopping"))
+		return
+	case err != nil:
+		str.closeWithError(err)
+		return
+	}
+
+	if err = f.writeBinlogDumpCommand(s.Position); err != nil {
+		str.closeWithError(err)
+		return
+	}
+
+	f.readEventsTo(str)
+}
+
 // writeBinlogDumpCommand requests that the leader start a binlog network stream.
 func (f *Follower) writeBinlogDumpCommand(p Position) error {
 	f.c.resetSequence()
 
-	data := makeBinlogDumpCommand(p, f.followerID)
+	data := makeBinlogDumpCommand(p, f.followerID, f.flavor)
 
 	return f.c.writePacket(data)
 }
 
-func makeBinlogDumpCommand(p Position, followerID uint32) []byte {
+func makeBinlogDumpCommand(p Position, followerID uint32, flavor Flavor) []byte {
 	b := make([]byte, 4+1+4+2+4+len(p.Name))
 
 	i := 4
@@ -191,7 +366,11 @@ func makeBinlogDumpCommand(p Position, followerID uint32) []byte {
 	binary.LittleEndian.PutUint32(b[i:], p.Pos)
 	i = i + 4
 
-	binary.LittleEndian.PutUint16(b[i:], BINLOG_DUMP_NEVER_STOP)
+	flags := BINLOG_DUMP_NEVER_STOP
+	if flavor == MariaDBFlavor {
+		flags |= BINLOG_SEND_ANNOTATE_ROWS_EVENT
+	}
+	binary.LittleEndian.PutUint16(b[i:], flags)
 	i = i + 2
 
 	binary.LittleEndian.PutUint32(b[i:], followerID)
@@ -250,20 +429,18 @@ func makeRegisterFollowerCommand(hostname string, port uint16, user string, pass
 	return b
 }
 
+// replySemiSyncAck acknowledges an event to the leader. The ack is a packet of
+// its own with sequence number 0; the leader doesn't answer it, and the binlog
+// stream carries on with its own sequence numbers.
 func (f *Follower) replySemiSyncAck(p Position) error {
+	seq := f.c.seq
+	defer func() { f.c.seq = seq }()
+
 	f.c.resetSequence()
 
 	data := makeSemiSyncAck(p)
 
-	err := f.c.writePacket(data)
-	if err != nil {
-		return err
-	}
-
-	_, err = f.c.readOKPacket()
-	if err != nil {
-	}
-	return err
+	return f.c.writePacket(data)
 }
 
 func makeSemiSyncAck(p Position) []byte {
@@ -286,6 +463,10 @@ func makeSemiSyncAck(p Position) []byte {
 func (f *Follower) parseEventsTo(str *Streamer) {
 	defer f.wg.Done()
 
+	f.readEventsTo(str)
+}
+
+func (f *Follower) readEventsTo(str *Streamer) {
 	// For each event, parse if OK; stop and close if unreadable.
 	for {
 		b, err := f.c.readPacket()
@@ -302,7 +483,7 @@ func (f *Follower) parseEventsTo(str *Streamer) {
 			}
 		case ERR_HEADER:
 			err = f.c.handleErrorPacket(b)
-			str.closeWithError(err)
+			str.closeWithError(streamError(err, f.NextPosition))
 			return
 		default:
 			str.closeWithError(fmt.Errorf("invalid stream header %c", b[0]))
@@ -316,7 +497,7 @@ func (f *Follower) parseEvent(str *Streamer, b []byte) error {
 	b = b[1:]
 
 	needACK := false
-	if f.semiSyncEnabled && (b[0] == SemiSyncIndicator) {
+	if f.semiSyncEnabled && len(b) >= 2 && b[0] == SemiSyncIndicator {
 		needACK = (b[1] == 0x01)
 		// Skip semi-sync header
 		b = b[2:]
@@ -333,12 +514,22 @@ func (f *Follower) parseEvent(str *Streamer, b []byte) error {
 		f.NextPosition.Name = string(re.NextFile)
 		f.NextPosition.Pos = uint32(re.NextPosition)
 	}
+	f.trackMariadbGTID(e.Event)
+
+	// Stream the events of a compressed transaction in its place.
+	events := []*EventContainer{e}
+	if tp, ok := e.Event.(*TransactionPayloadEvent); ok {
+		events = tp.Events
+	}
 
 	needStop := false
-	select {
-	case str.ch <- e:
-	case <-f.stopChan:
-		needStop = true
+	for _, e := range events {
+		if e.Filtered {
+			continue
+		}
+		if needStop = !f.sendEvent(str, e); needStop {
+			break
+		}
 	}
 
 	if needACK {
@@ -355,6 +546,43 @@ func (f *Follower) parseEvent(str *Streamer, b []byte) error {
 	return nil
 }
 
+// trackMariadbGTID moves NextMariadbGTIDs past each MariaDB transaction once
+// it has been committed: at its XID event, or at its COMMIT query, or at its
+// only statement for standalone transactions.
+func (f *Follower) trackMariadbGTID(e Event) {
+	switch e := e.(type) {
+	case *MariadbGtidEvent:
+		f.pendingGTID = e
+		return
+	case *XidEvent:
+	case *QueryEvent:
+		if f.pendingGTID == nil {
+			return
+		}
+		if f.pendingGTID.Flags&MARIADB_FL_STANDALONE == 0 && !strings.EqualFold(string(e.Query), "COMMIT") {
+			return
+		}
+	default:
+		return
+	}
+
+	if f.pendingGTID != nil {
+		f.NextMariadbGTIDs = f.NextMariadbGTIDs.Update(f.pendingGTID.GTID)
+		f.pendingGTID = nil
+	}
+}
+
+// sendEvent passes an event to the streamer. It returns false if the Follower
+// was asked to stop instead.
+func (f *Follower) sendEvent(str *Streamer, e *EventContainer) bool {
+	select {
+	case str.ch <- e:
+		return true
+	case <-f.stopChan:
+		return false
+	}
+}
+
 func (f *Follower) Close() {
 	f.m.Lock()
 
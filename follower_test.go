@@ -1,20 +1,30 @@
 package binlog
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/vsco/autobahn-binlog/binlogtest"
 )
 
 func TestMakeBinlogDumpCommand(t *testing.T) {
 	p := Position{Name: "mysql-bin.000001", Pos: 4}
 	followerID := uint32(200)
 	want := []byte{0x0, 0x0, 0x0, 0x0, 0x12, 0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0xc8, 0x0, 0x0, 0x0, 0x6d, 0x79, 0x73, 0x71, 0x6c, 0x2d, 0x62, 0x69, 0x6e, 0x2e, 0x30, 0x30, 0x30, 0x30, 0x30, 0x31}
-	output := makeBinlogDumpCommand(p, followerID)
+	output := makeBinlogDumpCommand(p, followerID, MySQLFlavor)
 
 	assert.Equal(t, output, want)
+
+	// MariaDB leaders are asked for ANNOTATE_ROWS events
+	want[9] = 0x2
+	assert.Equal(t, want, makeBinlogDumpCommand(p, followerID, MariaDBFlavor))
 }
 
 func TestMakeRegisterFollowerCommand(t *testing.T) {
@@ -62,3 +72,557 @@ func (suite *FollowerTestSuite) SetupSuite() {
 func (suite *FollowerTestSuite) TearDownSuite() {
 	suite.follower.Close()
 }
+
+func newTestServer(t *testing.T) *binlogtest.Server {
+	s, err := binlogtest.NewServer()
+	require.NoError(t, err)
+	return s
+}
+
+func startTestFollower(t *testing.T, s *binlogtest.Server, f *Follower, file string, pos uint32) *Streamer {
+	require.NoError(t, f.RegisterFollower(s.Host(), s.Port(), "repl", ""))
+
+	str, err := f.StartSync(file, pos)
+	require.NoError(t, err)
+	return str
+}
+
+// nextEvent reads the next event or error from str, failing the test if
+// nothing arrives in time.
+func nextEvent(t *testing.T, str *Streamer) (*EventContainer, error) {
+	type result struct {
+		e   *EventContainer
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		e, err := str.GetEvent()
+		ch <- result{e, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.e, r.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil, nil
+	}
+}
+
+func testServerEvents() [][]byte {
+	fde := binlogtest.FormatDescriptionEvent("5.5.34-log")
+	xid1 := binlogtest.XidEvent(7, uint32(4+len(fde)+27))
+	xid2 := binlogtest.XidEvent(8, uint32(4+len(fde)+27+27))
+	return [][]byte{fde, xid1, xid2}
+}
+
+func TestFollowerStreamsFromServer(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(testServerEvents()...)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	e, err := nextEvent(t, str)
+	require.NoError(t, err)
+	assert.Equal(t, ROTATE_EVENT, e.Header.EventType)
+
+	e, err = nextEvent(t, str)
+	require.NoError(t, err)
+	assert.Equal(t, FORMAT_DESCRIPTION_EVENT, e.Header.EventType)
+
+	for _, xid := range []uint64{7, 8} {
+		e, err = nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, XID_EVENT, e.Header.EventType)
+		assert.Equal(t, xid, e.Event.(*XidEvent).Xid)
+	}
+	assert.Equal(t, Position{"mysql-bin.000001", e.Header.LogPos}, f.NextPosition)
+
+	// Events added while streaming are sent right away.
+	s.AddEvents(binlogtest.XidEvent(9, e.Header.LogPos+27))
+	e, err = nextEvent(t, str)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), e.Event.(*XidEvent).Xid)
+
+	regs := s.Registrations()
+	require.Len(t, regs, 1)
+	assert.Equal(t, followerID, regs[0].ServerID)
+	assert.Equal(t, []binlogtest.Dump{{
+		File:          "mysql-bin.000001",
+		Pos:           4,
+		Flags:         BINLOG_DUMP_NEVER_STOP,
+		ServerID:      followerID,
+		UserVariables: map[string]string{"master_binlog_checksum": "NONE"},
+	}}, s.Dumps())
+	assert.Contains(t, s.Queries(), "SET @master_binlog_checksum='NONE'")
+}
+
+func TestFollowerStartsFromPosition(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	events := testServerEvents()
+	s.AddEvents(events...)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", uint32(4+len(events[0])+len(events[1])))
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+	assert.Equal(t, uint32(4+len(events[0])+len(events[1])+len(events[2])), f.NextPosition.Pos)
+}
+
+func TestFollowerStreamsFromBinlogFile(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("\xfebin")
+	for _, e := range testServerEvents() {
+		b.Write(e)
+	}
+
+	dir, err := ioutil.TempDir("", "binlogtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mysql-bin.000042")
+	require.NoError(t, ioutil.WriteFile(path, b.Bytes(), 0644))
+
+	s := newTestServer(t)
+	defer s.Close()
+	require.NoError(t, s.LoadBinlogFile(path))
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000042", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT, XID_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+	assert.Equal(t, Position{"mysql-bin.000042", uint32(b.Len())}, f.NextPosition)
+}
+
+func TestFollowerFollowsRotation(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(testServerEvents()...)
+	s.Rotate("mysql-bin.000002")
+	s.AddEvents(binlogtest.FormatDescriptionEvent("5.5.34-log"))
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT, XID_EVENT, ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+	assert.Equal(t, "mysql-bin.000002", f.NextPosition.Name)
+}
+
+func TestFollowerReportsPurgedPosition(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(testServerEvents()...)
+	s.Rotate("mysql-bin.000002")
+	s.PurgeBinaryLogs("mysql-bin.000002")
+
+	f := NewFollower(followerID)
+	require.NoError(t, f.RegisterFollower(s.Host(), s.Port(), "repl", ""))
+	defer f.Close()
+
+	err := f.CheckPosition(Position{"mysql-bin.000001", 4})
+	assert.True(t, IsPositionPurged(err))
+
+	str, err := f.StartSync("mysql-bin.000001", 4)
+	require.NoError(t, err)
+
+	_, err = nextEvent(t, str)
+	require.Error(t, err)
+	assert.True(t, IsPositionPurged(err))
+	assert.Equal(t, Position{"mysql-bin.000001", 4}, err.(*PositionPurgedError).Position)
+}
+
+func TestFollowerStreamFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault binlogtest.Fault
+		check func(t *testing.T, err error)
+	}{
+		{
+			name:  "disconnect",
+			fault: binlogtest.Fault{AfterEvents: 2, Action: binlogtest.Disconnect},
+			check: func(t *testing.T, err error) { assert.Error(t, err) },
+		},
+		{
+			name: "error packet",
+			fault: binlogtest.Fault{AfterEvents: 2, Action: binlogtest.SendError, Err: &binlogtest.Error{
+				Code: 1236, State: "HY000", Message: "binlog truncated in the middle of event",
+			}},
+			check: func(t *testing.T, err error) {
+				assert.Equal(t, &MySQLError{Code: 1236, State: "HY000", Message: "binlog truncated in the middle of event"}, err)
+			},
+		},
+		{
+			name:  "truncated event",
+			fault: binlogtest.Fault{AfterEvents: 2, Action: binlogtest.SendTruncated},
+			check: func(t *testing.T, err error) { assert.EqualError(t, err, "invalid event size") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			defer s.Close()
+			s.AddEvents(testServerEvents()...)
+			s.InjectFault(tt.fault)
+
+			f := NewFollower(followerID)
+			defer f.Close()
+			str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+			for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT} {
+				e, err := nextEvent(t, str)
+				require.NoError(t, err)
+				assert.Equal(t, want, e.Header.EventType)
+			}
+
+			_, err := nextEvent(t, str)
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestFollowerStreamFaultsPastSkippedEvents(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	events := testServerEvents()
+	s.AddEvents(events...)
+	s.InjectFault(binlogtest.Fault{AfterEvents: 1, Action: binlogtest.Disconnect})
+
+	// The fault is due on the first XID event, which is before the position
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", uint32(4+len(events[0])+27))
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+
+	_, err := nextEvent(t, str)
+	assert.Error(t, err)
+}
+
+func TestFollowerSkippedEvent(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(testServerEvents()...)
+	s.InjectFault(binlogtest.Fault{AfterEvents: 1, Action: binlogtest.SkipEvent})
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []uint64{0, 0, 8} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		if want != 0 {
+			assert.Equal(t, want, e.Event.(*XidEvent).Xid)
+		}
+	}
+}
+
+func TestFollowerStreamsCompressedTransactions(t *testing.T) {
+	enc := NewBinlogEncoder()
+	fde, err := enc.Encode(&EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, testFormatDescription())
+	require.NoError(t, err)
+	payload, err := enc.Encode(&EventHeader{EventType: TRANSACTION_PAYLOAD_EVENT},
+		testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_ZSTD))
+	require.NoError(t, err)
+
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(fde, payload)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT,
+		QUERY_EVENT, TABLE_MAP_EVENT, WRITE_ROWS_EVENT_V2, XID_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+	assert.Equal(t, enc.Position, f.NextPosition.Pos)
+}
+
+func TestFollowerDoesNotStreamFilteredEvents(t *testing.T) {
+	enc := NewBinlogEncoder()
+	fde, err := enc.Encode(&EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, testFormatDescription())
+	require.NoError(t, err)
+	payload, err := enc.Encode(&EventHeader{EventType: TRANSACTION_PAYLOAD_EVENT},
+		testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_ZSTD))
+	require.NoError(t, err)
+
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(fde, payload)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	f.SetParserOptions(ParserOptions{Filter: &ReplicationFilter{
+		DoDBs:         []string{"elsewhere"},
+		ExcludeEvents: []EventType{QUERY_EVENT},
+	}})
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+	assert.Equal(t, enc.Position, f.NextPosition.Pos)
+}
+
+func TestFollowerReadsFragmentedPackets(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.WriteChunkSize = 5
+	s.AddEvents(testServerEvents()...)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT, XID_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+}
+
+func TestFollowerReadsSplitPackets(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	// An event longer than the 16MB packet limit is sent over two packets.
+	big := binlogtest.Event(byte(INTVAR_EVENT), 0, 1, 0, 0, make([]byte, 1<<24))
+	s.AddEvents(binlogtest.FormatDescriptionEvent("5.5.34-log"), big)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, INTVAR_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+		if want == INTVAR_EVENT {
+			assert.Len(t, e.Bytes, len(big))
+		}
+	}
+}
+
+func TestFollowerReadsPacketsEndedByEmptyPackets(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.AddEvents(testServerEvents()...)
+	s.InjectFault(binlogtest.Fault{AfterEvents: 1, Action: binlogtest.SendSplit})
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []uint64{0, 0, 7, 8} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		if want == 7 {
+			// The packet was two maximum-size packets and an empty one
+			assert.Len(t, e.Bytes, 2*(1<<24-1)-1)
+		}
+		if want != 0 {
+			assert.Equal(t, want, e.Event.(*XidEvent).Xid)
+		}
+	}
+}
+
+func TestFollowerAcknowledgesSemiSync(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.SemiSync = true
+	events := testServerEvents()
+	s.AddEvents(events...)
+
+	f := NewFollower(followerID)
+	f.EnableSemiSync()
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	var last *EventContainer
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, XID_EVENT, XID_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+		last = e
+	}
+
+	// Events after an ack keep arriving, so the stream's sequence survived it.
+	s.AddEvents(binlogtest.XidEvent(9, last.Header.LogPos+27))
+	_, err := nextEvent(t, str)
+	require.NoError(t, err)
+
+	assert.Contains(t, s.Queries(), "SET @rpl_semi_sync_slave = 1")
+
+	// Every XID event asks for an ack of the position after it.
+	first := uint64(4 + len(events[0]) + 27)
+	want := []binlogtest.Ack{
+		{File: "mysql-bin.000001", Pos: first},
+		{File: "mysql-bin.000001", Pos: first + 27},
+		{File: "mysql-bin.000001", Pos: first + 54},
+	}
+	assert.Eventually(t, func() bool { return len(s.Acks()) == len(want) }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, want, s.Acks())
+}
+
+func TestFollowerRejectedLogin(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.User = "repl"
+	s.Password = "secret"
+
+	f := NewFollower(followerID)
+	err := f.RegisterFollower(s.Host(), s.Port(), "repl", "wrong")
+	assert.Error(t, err)
+
+	require.NoError(t, f.RegisterFollower(s.Host(), s.Port(), "repl", "secret"))
+	f.Close()
+}
+
+func mariadbServerEvents() [][]byte {
+	fde := binlogtest.FormatDescriptionEvent(binlogtest.MariaDBServerVersion)
+	pos := uint32(4 + len(fde))
+	var events [][]byte
+	events = append(events, fde)
+	for seq := uint64(1); seq <= 3; seq++ {
+		pos += 38
+		events = append(events, binlogtest.MariadbGtidEvent(0, 1, seq, pos))
+		pos += 27
+		events = append(events, binlogtest.XidEvent(seq, pos))
+	}
+	return events
+}
+
+func TestFollowerDetectsMariaDBFlavor(t *testing.T) {
+	s, err := binlogtest.NewServerWithVersion(binlogtest.MariaDBServerVersion)
+	require.NoError(t, err)
+	defer s.Close()
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	require.NoError(t, f.RegisterFollower(s.Host(), s.Port(), "repl", ""))
+
+	assert.Equal(t, MariaDBFlavor, f.Flavor())
+	assert.Contains(t, s.Queries(), "SET @mariadb_slave_capability = 4")
+}
+
+func TestFollowerStartsFromMariadbGTID(t *testing.T) {
+	s, err := binlogtest.NewServerWithVersion(binlogtest.MariaDBServerVersion)
+	require.NoError(t, err)
+	defer s.Close()
+	s.AddEvents(mariadbServerEvents()...)
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	require.NoError(t, f.RegisterFollower(s.Host(), s.Port(), "repl", ""))
+
+	str, err := f.StartSyncMariadbGTID(MariadbGTIDList{{DomainID: 0, ServerID: 1, SequenceNumber: 1}})
+	require.NoError(t, err)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Header.EventType)
+	}
+
+	for _, seq := range []uint64{2, 3} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		require.Equal(t, MARIADB_GTID_EVENT, e.Header.EventType)
+		assert.Equal(t, MariadbGTID{0, 1, seq}, e.Event.(*MariadbGtidEvent).GTID)
+
+		e, err = nextEvent(t, str)
+		require.NoError(t, err)
+		require.Equal(t, XID_EVENT, e.Header.EventType)
+	}
+	assert.Equal(t, MariadbGTIDList{{0, 1, 3}}, f.NextMariadbGTIDs)
+
+	assert.Contains(t, s.Queries(), "SET @slave_connect_state = '0-1-1'")
+	dumps := s.Dumps()
+	require.Len(t, dumps, 1)
+	assert.Equal(t, "", dumps[0].File)
+	assert.Equal(t, "0-1-1", dumps[0].UserVariables["slave_connect_state"])
+}
+
+func TestFollowerReceivesMariaDBAnnotateRowsEvents(t *testing.T) {
+	s, err := binlogtest.NewServerWithVersion(binlogtest.MariaDBServerVersion)
+	require.NoError(t, err)
+	defer s.Close()
+
+	fde := binlogtest.FormatDescriptionEvent(binlogtest.MariaDBServerVersion)
+	query := []byte("INSERT INTO t VALUES (1)")
+	pos := uint32(4+len(fde)) + 38
+	gtid := binlogtest.MariadbGtidEvent(0, 1, 1, pos)
+	pos += uint32(19 + len(query))
+	annotate := binlogtest.Event(byte(ANNOTATE_ROWS_EVENT), 0, 1, pos, 0, query)
+	pos += 27
+	s.AddEvents(fde, gtid, annotate, binlogtest.XidEvent(1, pos))
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	str := startTestFollower(t, s, f, "mysql-bin.000001", 4)
+
+	for _, want := range []EventType{ROTATE_EVENT, FORMAT_DESCRIPTION_EVENT, MARIADB_GTID_EVENT, ANNOTATE_ROWS_EVENT} {
+		e, err := nextEvent(t, str)
+		require.NoError(t, err)
+		require.Equal(t, want, e.Header.EventType)
+		if want == ANNOTATE_ROWS_EVENT {
+			assert.Equal(t, query, e.Event.(*RowsQueryEvent).Query)
+		}
+	}
+
+	dumps := s.Dumps()
+	require.Len(t, dumps, 1)
+	assert.Equal(t, BINLOG_SEND_ANNOTATE_ROWS_EVENT, dumps[0].Flags)
+}
+
+func TestFollowerStartSyncMariadbGTIDNeedsMariaDB(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	f := NewFollower(followerID)
+	defer f.Close()
+	require.NoError(t, f.RegisterFollower(s.Host(), s.Port(), "repl", ""))
+
+	assert.Equal(t, MySQLFlavor, f.Flavor())
+	_, err := f.StartSyncMariadbGTID(MariadbGTIDList{{0, 1, 1}})
+	assert.Error(t, err)
+}
+
+func TestFollowerApplyJSONDiffsSetsParserOption(t *testing.T) {
+	f := NewFollower(followerID)
+	defer f.Close()
+
+	f.ApplyJSONDiffs()
+	assert.True(t, f.parser.Options().ApplyJSONDiffs)
+}
@@ -0,0 +1,333 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// A GeometryFormat is what GEOMETRY values decode to.
+type GeometryFormat int
+
+const (
+	GeometryWKB     GeometryFormat = iota // []byte: the SRID and WKB, as MySQL stores them
+	GeometryWKT                           // string: well-known text, without the SRID
+	GeometryGeoJSON                       // string: a GeoJSON geometry, with the SRID as its crs
+)
+
+// WKB geometry types
+const (
+	WKB_POINT              uint32 = 1
+	WKB_LINESTRING         uint32 = 2
+	WKB_POLYGON            uint32 = 3
+	WKB_MULTIPOINT         uint32 = 4
+	WKB_MULTILINESTRING    uint32 = 5
+	WKB_MULTIPOLYGON       uint32 = 6
+	WKB_GEOMETRYCOLLECTION uint32 = 7
+)
+
+// maxGeometryDepth is how deep geometry collections may nest.
+const maxGeometryDepth = 100
+
+// A Geometry is a spatial value: a spatial reference system ID and a shape.
+type Geometry struct {
+	SRID uint32
+	root shape
+}
+
+// A shape is a WKB geometry. Points, line strings and rings hold points;
+// polygons hold their rings, and the other types their members.
+type shape struct {
+	kind   uint32
+	points [][2]float64
+	parts  []shape
+}
+
+// ParseGeometry decodes a GEOMETRY value as MySQL stores it: the SRID (4 bytes,
+// little-endian) followed by the shape in WKB.
+func ParseGeometry(b []byte) (*Geometry, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("geometry of %d bytes is too short", len(b))
+	}
+
+	g := &Geometry{SRID: binary.LittleEndian.Uint32(b)}
+	r := &wkbReader{b: b, i: 4}
+	g.root = r.shape(0)
+	if r.err == nil && r.i != len(b) {
+		r.fail("%d trailing bytes after geometry", len(b)-r.i)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return g, nil
+}
+
+// A wkbReader decodes WKB, in which each geometry sets its own byte order.
+type wkbReader struct {
+	b     []byte
+	i     int
+	order binary.ByteOrder
+	err   error
+}
+
+func (r *wkbReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s at offset %d", fmt.Sprintf(format, args...), r.i)
+	}
+}
+
+func (r *wkbReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.b)-r.i {
+		r.fail("need %d bytes, have %d", n, len(r.b)-r.i)
+		return nil
+	}
+	b := r.b[r.i : r.i+n]
+	r.i = r.i + n
+	return b
+}
+
+func (r *wkbReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return r.order.Uint32(b)
+	}
+	return 0
+}
+
+// count reads the number of items of size bytes each that follow, failing if
+// there's no room for them.
+func (r *wkbReader) count(size int) int {
+	n := r.uint32()
+	if r.err == nil && uint64(n)*uint64(size) > uint64(len(r.b)-r.i) {
+		r.fail("%d items of %d bytes exceed geometry size", n, size)
+	}
+	if r.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (r *wkbReader) point() [2]float64 {
+	b := r.bytes(16)
+	if b == nil {
+		return [2]float64{}
+	}
+
+	p := [2]float64{
+		math.Float64frombits(r.order.Uint64(b)),
+		math.Float64frombits(r.order.Uint64(b[8:])),
+	}
+	if !isCoordinate(p[0]) || !isCoordinate(p[1]) {
+		r.i = r.i - 16
+		r.fail("invalid point (%v %v)", p[0], p[1])
+	}
+	return p
+}
+
+// isCoordinate reports whether f is finite, as MySQL requires coordinates to be.
+func isCoordinate(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func (r *wkbReader) points() [][2]float64 {
+	n := r.count(16)
+	points := make([][2]float64, 0, n)
+	for k := 0; k < n && r.err == nil; k++ {
+		points = append(points, r.point())
+	}
+	return points
+}
+
+// shape reads a geometry nested depth collections deep.
+func (r *wkbReader) shape(depth int) shape {
+	switch order := r.bytes(1); {
+	case order == nil:
+		return shape{}
+	case order[0] == 0:
+		r.order = binary.BigEndian
+	case order[0] == 1:
+		r.order = binary.LittleEndian
+	default:
+		r.fail("invalid WKB byte order %d", order[0])
+		return shape{}
+	}
+
+	s := shape{kind: r.uint32()}
+	switch s.kind {
+	case WKB_POINT:
+		s.points = [][2]float64{r.point()}
+	case WKB_LINESTRING:
+		s.points = r.points()
+	case WKB_POLYGON:
+		n := r.count(4)
+		for k := 0; k < n && r.err == nil; k++ {
+			s.parts = append(s.parts, shape{kind: WKB_LINESTRING, points: r.points()})
+		}
+	case WKB_MULTIPOINT, WKB_MULTILINESTRING, WKB_MULTIPOLYGON, WKB_GEOMETRYCOLLECTION:
+		if depth >= maxGeometryDepth {
+			r.fail("geometry is nested more than %d levels deep", maxGeometryDepth)
+			return s
+		}
+		n := r.count(5)
+		for k := 0; k < n && r.err == nil; k++ {
+			part := r.shape(depth + 1)
+			if r.err == nil && s.kind != WKB_GEOMETRYCOLLECTION && part.kind != s.kind-3 {
+				r.fail("geometry type %d in geometry of type %d", part.kind, s.kind)
+			}
+			s.parts = append(s.parts, part)
+		}
+	default:
+		if r.err == nil {
+			r.fail("unsupported WKB geometry type %d", s.kind)
+		}
+	}
+	return s
+}
+
+var wktNames = map[uint32]string{
+	WKB_POINT:              "POINT",
+	WKB_LINESTRING:         "LINESTRING",
+	WKB_POLYGON:            "POLYGON",
+	WKB_MULTIPOINT:         "MULTIPOINT",
+	WKB_MULTILINESTRING:    "MULTILINESTRING",
+	WKB_MULTIPOLYGON:       "MULTIPOLYGON",
+	WKB_GEOMETRYCOLLECTION: "GEOMETRYCOLLECTION",
+}
+
+// WKT returns the shape of g as well-known text, e.g. "POINT(1 2)".
+func (g *Geometry) WKT() string {
+	var b bytes.Buffer
+	g.root.writeWKT(&b, true)
+	return b.String()
+}
+
+// writeWKT writes the shape, with its type name if named is set.
+func (s shape) writeWKT(b *bytes.Buffer, named bool) {
+	if named {
+		b.WriteString(wktNames[s.kind])
+	}
+	if s.kind == WKB_GEOMETRYCOLLECTION && len(s.parts) == 0 {
+		b.WriteString(" EMPTY")
+		return
+	}
+	b.WriteByte('(')
+	switch s.kind {
+	case WKB_POINT, WKB_LINESTRING:
+		for k, p := range s.points {
+			if k > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(formatCoordinate(p[0]))
+			b.WriteByte(' ')
+			b.WriteString(formatCoordinate(p[1]))
+		}
+	default:
+		for k, part := range s.parts {
+			if k > 0 {
+				b.WriteByte(',')
+			}
+			part.writeWKT(b, s.kind == WKB_GEOMETRYCOLLECTION)
+		}
+	}
+	b.WriteByte(')')
+}
+
+var geoJSONNames = map[uint32]string{
+	WKB_POINT:              "Point",
+	WKB_LINESTRING:         "LineString",
+	WKB_POLYGON:            "Polygon",
+	WKB_MULTIPOINT:         "MultiPoint",
+	WKB_MULTILINESTRING:    "MultiLineString",
+	WKB_MULTIPOLYGON:       "MultiPolygon",
+	WKB_GEOMETRYCOLLECTION: "GeometryCollection",
+}
+
+// GeoJSON returns g as a GeoJSON geometry object. A non-zero SRID is given as
+// its crs, e.g. "EPSG:4326".
+func (g *Geometry) GeoJSON() string {
+	var b bytes.Buffer
+	g.root.writeGeoJSON(&b, g.SRID)
+	return b.String()
+}
+
+func (s shape) writeGeoJSON(b *bytes.Buffer, srid uint32) {
+	b.WriteString(`{"type":"`)
+	b.WriteString(geoJSONNames[s.kind])
+	if s.kind == WKB_GEOMETRYCOLLECTION {
+		b.WriteString(`","geometries":[`)
+		for k, part := range s.parts {
+			if k > 0 {
+				b.WriteByte(',')
+			}
+			part.writeGeoJSON(b, 0)
+		}
+		b.WriteByte(']')
+	} else {
+		b.WriteString(`","coordinates":`)
+		s.writeCoordinates(b)
+	}
+	if srid != 0 {
+		fmt.Fprintf(b, `,"crs":{"type":"name","properties":{"name":"EPSG:%d"}}`, srid)
+	}
+	b.WriteByte('}')
+}
+
+// writeCoordinates writes the coordinates array of a shape.
+func (s shape) writeCoordinates(b *bytes.Buffer) {
+	if s.kind == WKB_POINT {
+		writeGeoJSONPoint(b, s.points[0])
+		return
+	}
+
+	b.WriteByte('[')
+	switch s.kind {
+	case WKB_LINESTRING:
+		for k, p := range s.points {
+			if k > 0 {
+				b.WriteByte(',')
+			}
+			writeGeoJSONPoint(b, p)
+		}
+	default:
+		for k, part := range s.parts {
+			if k > 0 {
+				b.WriteByte(',')
+			}
+			part.writeCoordinates(b)
+		}
+	}
+	b.WriteByte(']')
+}
+
+func writeGeoJSONPoint(b *bytes.Buffer, p [2]float64) {
+	b.WriteByte('[')
+	b.WriteString(formatCoordinate(p[0]))
+	b.WriteByte(',')
+	b.WriteString(formatCoordinate(p[1]))
+	b.WriteByte(']')
+}
+
+// formatCoordinate formats a coordinate as briefly as it can be read back.
+func formatCoordinate(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatGeometry converts a GEOMETRY value to the format f.
+func formatGeometry(b []byte, f GeometryFormat) (interface{}, error) {
+	if f == GeometryWKB {
+		return b, nil
+	}
+
+	g, err := ParseGeometry(b)
+	if err != nil {
+		return nil, err
+	}
+	if f == GeometryGeoJSON {
+		return g.GeoJSON(), nil
+	}
+	return g.WKT(), nil
+}
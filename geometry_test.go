@@ -0,0 +1,103 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wkb builds little-endian WKB from geometry types, counts and coordinates.
+type wkb []byte
+
+func (b wkb) geometry(kind uint32) wkb {
+	b = append(b, 1)
+	return b.count(kind)
+}
+
+func (b wkb) count(n uint32) wkb {
+	return append(b, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+func (b wkb) point(x, y float64) wkb {
+	b = append(b, make([]byte, 16)...)
+	binary.LittleEndian.PutUint64(b[len(b)-16:], math.Float64bits(x))
+	binary.LittleEndian.PutUint64(b[len(b)-8:], math.Float64bits(y))
+	return b
+}
+
+// srid prefixes a shape with a SRID, as MySQL stores geometries.
+func srid(id uint32, shape wkb) []byte {
+	return append(wkb{}.count(id), shape...)
+}
+
+func TestGeometryFormats(t *testing.T) {
+	square := wkb{}.geometry(WKB_POLYGON).count(1).count(4).
+		point(0, 0).point(1, 0).point(1, 1).point(0, 0)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wkt     string
+		geoJSON string
+	}{
+		{"point", srid(0, wkb{}.geometry(WKB_POINT).point(1, -2.5)),
+			"POINT(1 -2.5)", `{"type":"Point","coordinates":[1,-2.5]}`},
+		{"srid", srid(4326, wkb{}.geometry(WKB_POINT).point(37.75, -122.5)),
+			"POINT(37.75 -122.5)",
+			`{"type":"Point","coordinates":[37.75,-122.5],"crs":{"type":"name","properties":{"name":"EPSG:4326"}}}`},
+		{"linestring", srid(0, wkb{}.geometry(WKB_LINESTRING).count(2).point(0, 0).point(1, 1)),
+			"LINESTRING(0 0,1 1)", `{"type":"LineString","coordinates":[[0,0],[1,1]]}`},
+		{"polygon", srid(0, square),
+			"POLYGON((0 0,1 0,1 1,0 0))", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`},
+		{"multipoint", srid(0, wkb{}.geometry(WKB_MULTIPOINT).count(2).
+			geometry(WKB_POINT).point(0, 0).geometry(WKB_POINT).point(1, 1)),
+			"MULTIPOINT((0 0),(1 1))", `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`},
+		{"multipolygon", srid(0, append(wkb{}.geometry(WKB_MULTIPOLYGON).count(1), square...)),
+			"MULTIPOLYGON(((0 0,1 0,1 1,0 0)))", `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]]]}`},
+		{"collection", srid(0, wkb{}.geometry(WKB_GEOMETRYCOLLECTION).count(2).
+			geometry(WKB_POINT).point(1, 2).geometry(WKB_LINESTRING).count(2).point(0, 0).point(1, 1)),
+			"GEOMETRYCOLLECTION(POINT(1 2),LINESTRING(0 0,1 1))",
+			`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2]},{"type":"LineString","coordinates":[[0,0],[1,1]]}]}`},
+		{"empty collection", srid(0, wkb{}.geometry(WKB_GEOMETRYCOLLECTION).count(0)),
+			"GEOMETRYCOLLECTION EMPTY", `{"type":"GeometryCollection","geometries":[]}`},
+		{"big-endian", srid(0, wkb{0, 0, 0, 0, 1, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0, 0}),
+			"POINT(1 2)", `{"type":"Point","coordinates":[1,2]}`},
+	}
+
+	for _, tt := range tests {
+		g, err := ParseGeometry(tt.input)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.wkt, g.WKT(), tt.name)
+		assert.Equal(t, tt.geoJSON, g.GeoJSON(), tt.name)
+	}
+}
+
+func TestParsingMalformedGeometryFails(t *testing.T) {
+	point := srid(0, wkb{}.geometry(WKB_POINT).point(1, 2))
+
+	nested := wkb{}
+	for i := 0; i <= maxGeometryDepth; i++ {
+		nested = nested.geometry(WKB_GEOMETRYCOLLECTION).count(1)
+	}
+	nested = nested.geometry(WKB_POINT).point(0, 0)
+
+	tests := map[string][]byte{
+		"no srid":        {0, 0},
+		"truncated":      point[:len(point)-1],
+		"trailing bytes": append(point, 0),
+		"byte order":     srid(0, wkb{2, 1, 0, 0, 0}.point(1, 2)),
+		"type":           srid(0, wkb{}.geometry(8)),
+		"count":          srid(0, wkb{}.geometry(WKB_LINESTRING).count(0xffffffff).point(0, 0)),
+		"member type":    srid(0, wkb{}.geometry(WKB_MULTIPOINT).count(1).geometry(WKB_LINESTRING).count(0)),
+		"nan":            srid(0, wkb{}.geometry(WKB_POINT).point(math.NaN(), 0)),
+		"depth":          srid(0, nested),
+	}
+
+	for name, input := range tests {
+		_, err := ParseGeometry(input)
+		assert.Error(t, err, name)
+	}
+}
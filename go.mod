@@ -0,0 +1,16 @@
+module github.com/vsco/autobahn-binlog
+
+go 1.23
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/text v0.14.0
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,428 @@
+package binlog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Signal types written to and read from the signal table.
+const (
+	SignalWindowOpen      = "snapshot-window-open"
+	SignalWindowClose     = "snapshot-window-close"
+	SignalExecuteSnapshot = "execute-snapshot"
+)
+
+// IncrementalSnapshotConfig configures an IncrementalSnapshot.
+//
+// The signal table needs id, type and data string columns, with id as its
+// primary key, e.g.
+//
+//	CREATE TABLE signal (id VARCHAR(64) PRIMARY KEY, type VARCHAR(32) NOT NULL, data VARCHAR(2048))
+//
+// Inserting a row with type 'execute-snapshot' and a comma-separated list of
+// schema.table names as data snapshots those tables, just like Trigger.
+type IncrementalSnapshotConfig struct {
+	SignalTable TableName
+	Tables      []TableName // tables to snapshot as soon as streaming starts
+	ChunkSize   int         // rows per chunk; DefaultSnapshotChunkSize if zero
+}
+
+// An IncrementalSnapshot copies tables into the binlog stream chunk by chunk
+// while the Follower keeps streaming, without locking the leader. It follows
+// Netflix's DBLog: each chunk is selected between a low and a high watermark
+// written to the signal table, and rows changed by binlog events seen between
+// the two watermarks are dropped from the chunk, since the stream already
+// carries their newer versions. The rest of the chunk is emitted as synthetic
+// insert events (flagged LOG_EVENT_ARTIFICIAL_F) right where the high
+// watermark appears in the stream.
+type IncrementalSnapshot struct {
+	f         *Follower
+	c         *Conn
+	cfg       IncrementalSnapshotConfig
+	chunkSize int
+	signal    *TableSchema
+	signalCol [3]int // id, type and data column indexes
+
+	m         sync.Mutex
+	requested []TableName
+	notify    chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+
+	// Only touched by run
+	out         *Streamer
+	pending     []TableName
+	table       *TableSchema
+	tme         *TableMapEvent
+	after       []interface{}
+	chunk       *snapshotChunk
+	nextTableID uint64
+}
+
+// A snapshotChunk is a chunk of rows waiting for its high watermark.
+type snapshotChunk struct {
+	low      string
+	high     string
+	inWindow bool
+	last     bool // no rows after this chunk
+	rows     [][]interface{}
+	keys     []string
+	changed  map[string]bool
+}
+
+// NewIncrementalSnapshot returns an IncrementalSnapshot that streams through f,
+// which must already be registered.
+func NewIncrementalSnapshot(f *Follower, cfg IncrementalSnapshotConfig) *IncrementalSnapshot {
+	s := &IncrementalSnapshot{
+		f:           f,
+		cfg:         cfg,
+		chunkSize:   cfg.ChunkSize,
+		notify:      make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		nextTableID: snapshotTableIDBase,
+	}
+
+	if s.chunkSize <= 0 {
+		s.chunkSize = DefaultSnapshotChunkSize
+	}
+
+	s.Trigger(cfg.Tables...)
+
+	return s
+}
+
+// StartSync starts the Follower at the given position and returns a Streamer
+// carrying the binlog events interleaved with snapshot rows.
+func (s *IncrementalSnapshot) StartSync(binlogFile string, binlogPos uint32) (*Streamer, error) {
+	f := s.f
+
+	c, err := NewConn(f.host, f.port, f.user, f.password, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Read temporal values in UTC so they convert the same way binlog values do.
+	if _, err = c.execute("SET SESSION time_zone = '+00:00'"); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	if err = s.setSignalTable(c); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	in, err := f.StartSync(binlogFile, binlogPos)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	s.c = c
+	s.out = newStreamer()
+
+	s.wg.Add(1)
+	go s.run(in)
+
+	return s.out, nil
+}
+
+func (s *IncrementalSnapshot) setSignalTable(c *Conn) error {
+	t, err := loadTableSchema(c, s.cfg.SignalTable.Schema, s.cfg.SignalTable.Name)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range []string{"id", "type", "data"} {
+		if s.signalCol[i] = t.ColumnIndex(name); s.signalCol[i] < 0 {
+			return fmt.Errorf("signal table %s has no %s column", s.cfg.SignalTable, name)
+		}
+	}
+
+	s.signal = t
+	return nil
+}
+
+// Trigger queues tables to be snapshotted. It can be called at any time.
+func (s *IncrementalSnapshot) Trigger(tables ...TableName) {
+	if len(tables) == 0 {
+		return
+	}
+
+	s.m.Lock()
+	s.requested = append(s.requested, tables...)
+	s.m.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops interleaving snapshot rows and closes the snapshot connection.
+// The Follower itself has to be closed separately.
+func (s *IncrementalSnapshot) Close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+
+	s.wg.Wait()
+
+	if s.c != nil {
+		s.c.close()
+		s.c = nil
+	}
+}
+
+func (s *IncrementalSnapshot) run(in *Streamer) {
+	defer s.wg.Done()
+
+	for {
+		if s.chunk == nil && (s.table != nil || len(s.pending) > 0) {
+			if err := s.startChunk(); err != nil {
+				s.out.closeWithError(err)
+				return
+			}
+			continue
+		}
+
+		select {
+		case e := <-in.ch:
+			if err := s.handle(e); err != nil {
+				s.out.closeWithError(err)
+				return
+			}
+		case err := <-in.ech:
+			s.out.closeWithError(err)
+			return
+		case <-s.notify:
+			s.m.Lock()
+			s.pending = append(s.pending, s.requested...)
+			s.requested = nil
+			s.m.Unlock()
+		case <-s.stop:
+			s.out.closeWithError(errors.New("sync stopping"))
+			return
+		}
+	}
+}
+
+// send passes an event on to the output streamer.
+func (s *IncrementalSnapshot) send(e *EventContainer) error {
+	select {
+	case s.out.ch <- e:
+		return nil
+	case <-s.stop:
+		return errors.New("sync stopping")
+	}
+}
+
+// startChunk selects the next chunk of the current table between two
+// watermarks, moving on to the next pending table if there is no current one.
+func (s *IncrementalSnapshot) startChunk() error {
+	if s.table == nil {
+		name := s.pending[0]
+		s.pending = s.pending[1:]
+
+		t, err := loadTableSchema(s.c, name.Schema, name.Name)
+		if err != nil {
+			return err
+		}
+		if len(t.PrimaryKey) == 0 {
+			return fmt.Errorf("table %s has no primary key and can't be snapshotted incrementally", name)
+		}
+
+		s.table = t
+		s.tme = t.tableMapEvent(s.nextTableID)
+		s.nextTableID++
+		s.after = nil
+
+		if err = s.send(snapshotEvent(TABLE_MAP_EVENT, s.tme)); err != nil {
+			return err
+		}
+	}
+
+	chunk := &snapshotChunk{changed: make(map[string]bool)}
+
+	var err error
+	if chunk.low, err = s.writeSignal(SignalWindowOpen); err != nil {
+		return err
+	}
+
+	result, err := s.c.execute(s.table.chunkQuery(s.after, s.chunkSize))
+	if err != nil {
+		return err
+	}
+
+	if result.Resultset != nil && len(result.Values) > 0 {
+		o := s.f.parser.Options()
+		e, err := s.table.rowsEvent(s.tme, result.Values, &o)
+		if err != nil {
+			return err
+		}
+
+		chunk.rows = e.Rows
+		chunk.keys = make([]string, len(e.Rows))
+		for i, row := range e.Rows {
+			chunk.keys[i] = s.table.rowKey(row)
+		}
+
+		last := result.Values[len(result.Values)-1]
+		s.after = make([]interface{}, len(s.table.PrimaryKey))
+		for i, col := range s.table.PrimaryKey {
+			s.after[i] = last[col]
+		}
+	}
+	chunk.last = result.Resultset == nil || len(result.Values) < s.chunkSize
+
+	if chunk.high, err = s.writeSignal(SignalWindowClose); err != nil {
+		return err
+	}
+
+	s.chunk = chunk
+	return nil
+}
+
+// writeSignal inserts a watermark for the current table into the signal table
+// and returns its ID.
+func (s *IncrementalSnapshot) writeSignal(signalType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	query := fmt.Sprintf("INSERT INTO %s.%s (%s, %s, %s) VALUES (%s, %s, %s)",
+		quoteIdentifier(s.signal.Schema), quoteIdentifier(s.signal.Name),
+		quoteIdentifier(s.signal.Columns[s.signalCol[0]].Name),
+		quoteIdentifier(s.signal.Columns[s.signalCol[1]].Name),
+		quoteIdentifier(s.signal.Columns[s.signalCol[2]].Name),
+		quoteString(id), quoteString(signalType), quoteString(s.table.Schema+"."+s.table.Name))
+
+	if _, err := s.c.execute(query); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// handle processes one event from the Follower.
+func (s *IncrementalSnapshot) handle(e *EventContainer) error {
+	re, ok := e.Event.(*RowsEvent)
+	if !ok || re.Table == nil {
+		return s.send(e)
+	}
+
+	if s.isTable(re.Table, s.signal) {
+		return s.handleSignal(re)
+	}
+
+	if s.chunk != nil && s.chunk.inWindow && s.isTable(re.Table, s.table) {
+		for _, image := range re.Images() {
+			// MINIMAL after images leave out unchanged keys; the before image
+			// has them.
+			if s.table.hasKey(image) {
+				s.chunk.changed[s.table.rowKey(image.Values)] = true
+			}
+		}
+	}
+
+	return s.send(e)
+}
+
+func (s *IncrementalSnapshot) isTable(tme *TableMapEvent, t *TableSchema) bool {
+	return t != nil && string(tme.DatabaseName) == t.Schema && string(tme.TableName) == t.Name
+}
+
+// handleSignal acts on rows inserted into the signal table. The signal rows
+// themselves are not passed on.
+func (s *IncrementalSnapshot) handleSignal(re *RowsEvent) error {
+	for _, row := range re.Rows {
+		id, _ := row[s.signalCol[0]].(string)
+		signalType, _ := row[s.signalCol[1]].(string)
+		data, _ := row[s.signalCol[2]].(string)
+
+		switch {
+		case signalType == SignalExecuteSnapshot:
+			s.pending = append(s.pending, parseTableNames(data)...)
+		case s.chunk == nil:
+		case signalType == SignalWindowOpen && id == s.chunk.low:
+			s.chunk.inWindow = true
+		case signalType == SignalWindowClose && id == s.chunk.high:
+			if err := s.closeWindow(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// closeWindow emits the chunk rows that weren't changed inside the watermark
+// window.
+func (s *IncrementalSnapshot) closeWindow() error {
+	chunk := s.chunk
+	s.chunk = nil
+
+	e := &RowsEvent{
+		Table:         s.tme,
+		TableID:       s.tme.TableID,
+		ColumnCount:   s.tme.ColumnCount,
+		ColumnBitmap1: allColumnsBitmap(int(s.tme.ColumnCount)),
+	}
+	for i, row := range chunk.rows {
+		if !chunk.changed[chunk.keys[i]] {
+			e.Rows = append(e.Rows, row)
+		}
+	}
+
+	if chunk.last {
+		s.table = nil
+		s.tme = nil
+	}
+
+	if len(e.Rows) == 0 {
+		return nil
+	}
+
+	return s.send(snapshotEvent(WRITE_ROWS_EVENT_V1, e))
+}
+
+// hasKey reports whether image holds all the primary key columns.
+func (t *TableSchema) hasKey(image RowImage) bool {
+	for _, col := range t.PrimaryKey {
+		if !image.IsPresent(col) {
+			return false
+		}
+	}
+	return true
+}
+
+// rowKey identifies a row by its primary key values.
+func (t *TableSchema) rowKey(row []interface{}) string {
+	key := make([]string, len(t.PrimaryKey))
+	for i, col := range t.PrimaryKey {
+		if col < len(row) {
+			key[i] = fmt.Sprintf("%v", row[col])
+		}
+	}
+	return strings.Join(key, "\x00")
+}
+
+// parseTableNames parses a comma-separated list of schema.table names.
+func parseTableNames(s string) []TableName {
+	var names []TableName
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			names = append(names, TableName{Schema: name[:i], Name: name[i+1:]})
+		}
+	}
+	return names
+}
@@ -0,0 +1,189 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var signalTestTable = &TableSchema{
+	Schema: "ops",
+	Name:   "signal",
+	Columns: []*Column{
+		{Name: "id", Type: MYSQL_TYPE_VARCHAR},
+		{Name: "type", Type: MYSQL_TYPE_VARCHAR},
+		{Name: "data", Type: MYSQL_TYPE_VARCHAR, Nullable: true},
+	},
+	PrimaryKey: []int{0},
+}
+
+func newTestIncrementalSnapshot() *IncrementalSnapshot {
+	s := NewIncrementalSnapshot(NewFollower(followerID), IncrementalSnapshotConfig{})
+	s.signal = signalTestTable
+	s.signalCol = [3]int{0, 1, 2}
+	s.out = newStreamer()
+
+	s.table = snapshotTestTable
+	s.tme = snapshotTestTable.tableMapEvent(snapshotTableIDBase)
+	s.chunk = &snapshotChunk{
+		low:     "low",
+		high:    "high",
+		last:    true,
+		changed: make(map[string]bool),
+		rows: [][]interface{}{
+			{int32(12), "a", int64(1)},
+			{int32(12), "b", int64(2)},
+			{int32(12), "c", int64(3)},
+		},
+	}
+	for _, row := range s.chunk.rows {
+		s.chunk.keys = append(s.chunk.keys, s.table.rowKey(row))
+	}
+
+	return s
+}
+
+func signalEvent(id, signalType, data string) *EventContainer {
+	tme := &TableMapEvent{DatabaseName: []byte("ops"), TableName: []byte("signal"), ColumnCount: 3}
+	return &EventContainer{
+		Header: &EventHeader{EventType: WRITE_ROWS_EVENT_V1},
+		Event:  &RowsEvent{Table: tme, Rows: [][]interface{}{{id, signalType, data}}},
+	}
+}
+
+func uploadsEvent(t EventType, rows ...[]interface{}) *EventContainer {
+	tme := &TableMapEvent{DatabaseName: []byte("shard767"), TableName: []byte("uploads"), ColumnCount: 3}
+	e := &RowsEvent{Table: tme, ColumnCount: 3, ColumnBitmap1: []byte{0x07}, Rows: rows}
+	if isUpdateRowsEvent(t) {
+		e.ColumnBitmap2 = []byte{0x07}
+	}
+	return &EventContainer{
+		Header: &EventHeader{EventType: t},
+		Event:  e,
+	}
+}
+
+func drain(s *Streamer) []*EventContainer {
+	var events []*EventContainer
+	for {
+		select {
+		case e := <-s.ch:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestIncrementalSnapshotDropsRowsChangedInsideWindow(t *testing.T) {
+	s := newTestIncrementalSnapshot()
+
+	// Changes before the low watermark don't affect the chunk.
+	before := uploadsEvent(DELETE_ROWS_EVENT_V1, []interface{}{int32(12), "a", int64(1)})
+	inside := uploadsEvent(UPDATE_ROWS_EVENT_V1,
+		[]interface{}{int32(12), "b", int64(2)},
+		[]interface{}{int32(12), "B", int64(2)},
+	)
+
+	for _, e := range []*EventContainer{
+		before,
+		signalEvent("low", SignalWindowOpen, "shard767.uploads"),
+		inside,
+		signalEvent("high", SignalWindowClose, "shard767.uploads"),
+	} {
+		assert.NoError(t, s.handle(e))
+	}
+
+	events := drain(s.out)
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, before, events[0])
+		assert.Equal(t, inside, events[1])
+
+		assert.Equal(t, LOG_EVENT_ARTIFICIAL_F, events[2].Header.Flags)
+		assert.Equal(t, [][]interface{}{
+			{int32(12), "a", int64(1)},
+			{int32(12), "c", int64(3)},
+		}, events[2].Event.(*RowsEvent).Rows)
+	}
+
+	assert.Nil(t, s.chunk)
+	assert.Nil(t, s.table)
+}
+
+func TestIncrementalSnapshotKeysMinimalRowImages(t *testing.T) {
+	s := newTestIncrementalSnapshot()
+
+	// binlog_row_image=MINIMAL: the key in the before image, the changed
+	// column in the after image.
+	inside := uploadsEvent(UPDATE_ROWS_EVENT_V1,
+		[]interface{}{int32(12), nil, int64(3)},
+		[]interface{}{nil, "C", nil},
+	)
+	inside.Event.(*RowsEvent).ColumnBitmap1 = []byte{0x05}
+	inside.Event.(*RowsEvent).ColumnBitmap2 = []byte{0x02}
+
+	for _, e := range []*EventContainer{
+		signalEvent("low", SignalWindowOpen, "shard767.uploads"),
+		inside,
+		signalEvent("high", SignalWindowClose, "shard767.uploads"),
+	} {
+		assert.NoError(t, s.handle(e))
+	}
+
+	events := drain(s.out)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, [][]interface{}{
+			{int32(12), "a", int64(1)},
+			{int32(12), "b", int64(2)},
+		}, events[1].Event.(*RowsEvent).Rows)
+	}
+}
+
+func TestIncrementalSnapshotIgnoresOtherWatermarks(t *testing.T) {
+	s := newTestIncrementalSnapshot()
+
+	assert.NoError(t, s.handle(signalEvent("stale", SignalWindowOpen, "shard767.uploads")))
+	assert.NoError(t, s.handle(uploadsEvent(WRITE_ROWS_EVENT_V1, []interface{}{int32(12), "x", int64(3)})))
+	assert.NoError(t, s.handle(signalEvent("stale", SignalWindowClose, "shard767.uploads")))
+
+	assert.False(t, s.chunk.inWindow)
+	assert.Empty(t, s.chunk.changed)
+	assert.Len(t, drain(s.out), 1)
+}
+
+func TestIncrementalSnapshotKeepsTableOpenUntilLastChunk(t *testing.T) {
+	s := newTestIncrementalSnapshot()
+	s.chunk.last = false
+
+	assert.NoError(t, s.handle(signalEvent("low", SignalWindowOpen, "")))
+	assert.NoError(t, s.handle(signalEvent("high", SignalWindowClose, "")))
+
+	assert.Nil(t, s.chunk)
+	assert.Equal(t, snapshotTestTable, s.table)
+}
+
+func TestIncrementalSnapshotExecutesSignalledSnapshots(t *testing.T) {
+	s := newTestIncrementalSnapshot()
+
+	assert.NoError(t, s.handle(signalEvent("x", SignalExecuteSnapshot, "shard767.uploads, shard767.users")))
+
+	assert.Equal(t, []TableName{{"shard767", "uploads"}, {"shard767", "users"}}, s.pending)
+	assert.Empty(t, drain(s.out))
+}
+
+func TestIncrementalSnapshotTrigger(t *testing.T) {
+	s := NewIncrementalSnapshot(NewFollower(followerID), IncrementalSnapshotConfig{
+		Tables: []TableName{{"shard767", "uploads"}},
+	})
+	s.Trigger(TableName{"shard767", "users"})
+
+	assert.Equal(t, []TableName{{"shard767", "uploads"}, {"shard767", "users"}}, s.requested)
+	assert.Len(t, s.notify, 1)
+}
+
+func TestRowKeyUsesPrimaryKeyColumns(t *testing.T) {
+	assert.Equal(t, snapshotTestTable.rowKey([]interface{}{int32(12), "a", int64(1)}),
+		snapshotTestTable.rowKey([]interface{}{int32(12), "b", int64(1)}))
+	assert.NotEqual(t, snapshotTestTable.rowKey([]interface{}{int32(12), "a", int64(1)}),
+		snapshotTestTable.rowKey([]interface{}{int32(12), "a", int64(2)}))
+}
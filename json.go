@@ -0,0 +1,682 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// In this file: MySQL's binary JSON format, which JSON columns and JSON diffs
+// are logged in. Values are decoded to JSON text as MySQL prints it, e.g.
+// {"a": 1, "b": [true, null]}.
+
+// Binary JSON value types
+const (
+	JSONB_TYPE_SMALL_OBJECT byte = 0x00
+	JSONB_TYPE_LARGE_OBJECT byte = 0x01
+	JSONB_TYPE_SMALL_ARRAY  byte = 0x02
+	JSONB_TYPE_LARGE_ARRAY  byte = 0x03
+	JSONB_TYPE_LITERAL      byte = 0x04
+	JSONB_TYPE_INT16        byte = 0x05
+	JSONB_TYPE_UINT16       byte = 0x06
+	JSONB_TYPE_INT32        byte = 0x07
+	JSONB_TYPE_UINT32       byte = 0x08
+	JSONB_TYPE_INT64        byte = 0x09
+	JSONB_TYPE_UINT64       byte = 0x0a
+	JSONB_TYPE_DOUBLE       byte = 0x0b
+	JSONB_TYPE_STRING       byte = 0x0c
+	JSONB_TYPE_OPAQUE       byte = 0x0f
+)
+
+// Binary JSON literals
+const (
+	JSONB_NULL_LITERAL  byte = 0x00
+	JSONB_TRUE_LITERAL  byte = 0x01
+	JSONB_FALSE_LITERAL byte = 0x02
+)
+
+// A jsonObject is a decoded JSON object. Members keep the order MySQL stores
+// them in: keys sorted by length, then bytewise.
+type jsonObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// index returns the position of key, or where to insert it and false.
+func (o *jsonObject) index(key string) (int, bool) {
+	i := sort.Search(len(o.keys), func(i int) bool { return !jsonKeyLess(o.keys[i], key) })
+	return i, i < len(o.keys) && o.keys[i] == key
+}
+
+func (o *jsonObject) set(key string, v interface{}) {
+	i, ok := o.index(key)
+	if ok {
+		o.values[i] = v
+		return
+	}
+	o.keys = append(o.keys, "")
+	o.values = append(o.values, nil)
+	copy(o.keys[i+1:], o.keys[i:])
+	copy(o.values[i+1:], o.values[i:])
+	o.keys[i] = key
+	o.values[i] = v
+}
+
+func (o *jsonObject) remove(i int) {
+	o.keys = append(o.keys[:i], o.keys[i+1:]...)
+	o.values = append(o.values[:i], o.values[i+1:]...)
+}
+
+func jsonKeyLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// parseJSONBinary decodes a binary JSON document, a type byte followed by the
+// value, into JSON text. An empty document is a JSON null.
+func parseJSONBinary(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return []byte("null"), nil
+	}
+
+	d := &jsonDecoder{values: len(b)}
+	v, err := d.value(b[0], b[1:], 0)
+	if err != nil {
+		return nil, err
+	}
+	return formatJSON(v), nil
+}
+
+// maxJSONDepth is how deep MySQL lets JSON documents nest.
+const maxJSONDepth = 100
+
+// A jsonDecoder decodes a binary JSON document. As values are found by
+// offset, a corrupt document could refer to the same nested value many times
+// over; the decoder gives up once it has decoded more values than the document
+// has bytes.
+type jsonDecoder struct {
+	values int // values left to decode
+}
+
+// value decodes the value of type t at the start of b, nested depth levels
+// deep in the document.
+func (d *jsonDecoder) value(t byte, b []byte, depth int) (interface{}, error) {
+	if d.values--; d.values < 0 {
+		return nil, fmt.Errorf("JSON document has more values than bytes")
+	}
+
+	switch t {
+	case JSONB_TYPE_SMALL_OBJECT, JSONB_TYPE_LARGE_OBJECT, JSONB_TYPE_SMALL_ARRAY, JSONB_TYPE_LARGE_ARRAY:
+		if depth >= maxJSONDepth {
+			return nil, fmt.Errorf("JSON document is nested more than %d levels deep", maxJSONDepth)
+		}
+		large := t == JSONB_TYPE_LARGE_OBJECT || t == JSONB_TYPE_LARGE_ARRAY
+		isObject := t == JSONB_TYPE_SMALL_OBJECT || t == JSONB_TYPE_LARGE_OBJECT
+		return d.composite(b, large, isObject, depth+1)
+	case JSONB_TYPE_LITERAL:
+		if err := checkValueLength(b, 1); err != nil {
+			return nil, err
+		}
+		switch b[0] {
+		case JSONB_NULL_LITERAL:
+			return nil, nil
+		case JSONB_TRUE_LITERAL:
+			return true, nil
+		case JSONB_FALSE_LITERAL:
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid JSON literal %d", b[0])
+	case JSONB_TYPE_INT16:
+		if err := checkValueLength(b, 2); err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case JSONB_TYPE_UINT16:
+		if err := checkValueLength(b, 2); err != nil {
+			return nil, err
+		}
+		return int64(binary.LittleEndian.Uint16(b)), nil
+	case JSONB_TYPE_INT32:
+		if err := checkValueLength(b, 4); err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	case JSONB_TYPE_UINT32:
+		if err := checkValueLength(b, 4); err != nil {
+			return nil, err
+		}
+		return int64(binary.LittleEndian.Uint32(b)), nil
+	case JSONB_TYPE_INT64:
+		if err := checkValueLength(b, 8); err != nil {
+			return nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case JSONB_TYPE_UINT64:
+		if err := checkValueLength(b, 8); err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.Uint64(b), nil
+	case JSONB_TYPE_DOUBLE:
+		if err := checkValueLength(b, 8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case JSONB_TYPE_STRING:
+		s, _, err := decodeJSONVariableLengthBytes(b)
+		return string(s), err
+	case JSONB_TYPE_OPAQUE:
+		if err := checkValueLength(b, 1); err != nil {
+			return nil, err
+		}
+		data, _, err := decodeJSONVariableLengthBytes(b[1:])
+		if err != nil {
+			return nil, err
+		}
+		return decodeJSONOpaque(b[0], data)
+	}
+	return nil, fmt.Errorf("invalid JSON value type %d", t)
+}
+
+// Objects and arrays are structured as follows, with offsets and sizes of 2
+// bytes in small and 4 bytes in large ones:
+//
+//	element count
+//	size in bytes of the whole object or array
+//	objects only: for each key, its offset and 2 bytes for its length
+//	for each value, 1 byte for its type, then either the value itself if it
+//	  fits (literals and 16-bit integers, and 32-bit integers in large ones)
+//	  or its offset
+//	the keys
+//	the values that weren't inlined
+//
+// Offsets are from the start of the object or array.
+func (d *jsonDecoder) composite(b []byte, large bool, isObject bool, depth int) (interface{}, error) {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+	readOffset := func(b []byte) int {
+		return int(getLittleEndianFixedLengthInt(b[:offsetSize]))
+	}
+
+	if err := checkValueLength(b, 2*offsetSize); err != nil {
+		return nil, err
+	}
+	count := readOffset(b)
+	size := readOffset(b[offsetSize:])
+	if err := checkValueLength(b, size); err != nil {
+		return nil, err
+	}
+	b = b[:size]
+
+	keyEntrySize := 0
+	if isObject {
+		keyEntrySize = offsetSize + 2
+	}
+	valueEntrySize := 1 + offsetSize
+	headerSize := 2*offsetSize + count*(keyEntrySize+valueEntrySize)
+	if headerSize > size {
+		return nil, fmt.Errorf("%d JSON elements don't fit in %d bytes", count, size)
+	}
+
+	keys := make([]string, 0, count)
+	if isObject {
+		for i := 0; i < count; i++ {
+			entry := b[2*offsetSize+i*keyEntrySize:]
+			offset := readOffset(entry)
+			length := int(binary.LittleEndian.Uint16(entry[offsetSize:]))
+			if offset < headerSize || offset+length > size {
+				return nil, fmt.Errorf("JSON key %d is out of bounds", i)
+			}
+			keys = append(keys, string(b[offset:offset+length]))
+		}
+	}
+
+	values := make([]interface{}, count)
+	for i := 0; i < count; i++ {
+		entry := b[2*offsetSize+count*keyEntrySize+i*valueEntrySize:]
+		t := entry[0]
+
+		var v interface{}
+		var err error
+		if isInlinedJSONValue(t, large) {
+			v, err = d.value(t, entry[1:1+offsetSize], depth)
+		} else {
+			offset := readOffset(entry[1:])
+			if offset < headerSize || offset >= size {
+				return nil, fmt.Errorf("JSON value %d is out of bounds", i)
+			}
+			v, err = d.value(t, b[offset:], depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	if isObject {
+		return &jsonObject{keys: keys, values: values}, nil
+	}
+	return values, nil
+}
+
+func isInlinedJSONValue(t byte, large bool) bool {
+	switch t {
+	case JSONB_TYPE_LITERAL, JSONB_TYPE_INT16, JSONB_TYPE_UINT16:
+		return true
+	case JSONB_TYPE_INT32, JSONB_TYPE_UINT32:
+		return large
+	}
+	return false
+}
+
+// decodeJSONVariableLengthBytes reads bytes prefixed with their length, stored
+// 7 bits per byte with the high bit set on all but the last byte.
+func decodeJSONVariableLengthBytes(b []byte) ([]byte, int, error) {
+	length := 0
+	for i := 0; i < 5; i++ {
+		if i >= len(b) {
+			return nil, 0, fmt.Errorf("need a variable-length integer, have %d bytes", len(b))
+		}
+		length |= int(b[i]&0x7f) << uint(7*i)
+		if b[i]&0x80 == 0 {
+			n := i + 1 + length
+			if length < 0 || n > len(b) {
+				return nil, 0, fmt.Errorf("need %d bytes, have %d", n, len(b))
+			}
+			return b[i+1 : n], n, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("variable-length integer is too long")
+}
+
+func encodeJSONVariableLength(w *eventWriter, n int) {
+	for n >= 0x80 {
+		w.uint8(uint8(n&0x7f) | 0x80)
+		n >>= 7
+	}
+	w.uint8(uint8(n))
+}
+
+// decodeJSONOpaque decodes a value of a MySQL type without a JSON counterpart.
+// Decimals become numbers and temporal values strings, as MySQL prints them;
+// anything else is a base64 string tagged with its type.
+func decodeJSONOpaque(tp byte, data []byte) (interface{}, error) {
+	switch tp {
+	case MYSQL_TYPE_NEWDECIMAL:
+		if err := checkValueLength(data, 2); err != nil {
+			return nil, err
+		}
+		s, _, err := parseDecimalString(data[2:], uint16(data[0])<<8|uint16(data[1]))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(normalizeDecimal(s)), nil
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_DATETIME, MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIME:
+		if err := checkValueLength(data, 8); err != nil {
+			return nil, err
+		}
+		return formatPackedTemporal(tp, int64(binary.LittleEndian.Uint64(data))), nil
+	}
+	return fmt.Sprintf("base64:type%d:%s", tp, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// normalizeDecimal drops the leading zeros and the trailing point
+// parseDecimalString leaves in.
+func normalizeDecimal(s string) string {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(strings.TrimPrefix(s, "-"), "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || s[0] == '.' {
+		s = "0" + s
+	}
+	if neg && strings.Trim(s, "0.") != "" {
+		s = "-" + s
+	}
+	return s
+}
+
+// formatPackedTemporal formats a date, time or datetime packed into an
+// integer: the fraction in the low 24 bits, and above it the seconds, minutes
+// and hours in 6, 6 and 10 bits, then for dates the day in 5 bits and
+// year*13+month.
+func formatPackedTemporal(tp byte, v int64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	frac := v % (1 << 24)
+	ymdhms := v >> 24
+	hms := ymdhms % (1 << 17)
+	ymd := ymdhms >> 17
+	hour, minute, second := hms>>12, (hms>>6)%64, hms%64
+	year, month, day := ymd>>5/13, ymd>>5%13, ymd%32
+
+	switch tp {
+	case MYSQL_TYPE_DATE:
+		return fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+	case MYSQL_TYPE_TIME:
+		return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, ymdhms>>12, minute, second, frac)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.%06d", year, month, day, hour, minute, second, frac)
+}
+
+// formatJSON renders a decoded value as MySQL does.
+func formatJSON(v interface{}) []byte {
+	var b bytes.Buffer
+	writeJSON(&b, v)
+	return b.Bytes()
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case uint64:
+		b.WriteString(strconv.FormatUint(v, 10))
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		s = strings.Replace(s, "e+", "e", 1)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		b.WriteString(s)
+	case json.Number:
+		b.WriteString(string(v))
+	case string:
+		writeJSONString(b, v)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeJSON(b, e)
+		}
+		b.WriteByte(']')
+	case *jsonObject:
+		b.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeJSONString(b, k)
+			b.WriteString(": ")
+			writeJSON(b, v.values[i])
+		}
+		b.WriteByte('}')
+	}
+}
+
+func writeJSONString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// parseJSONText parses JSON text into the values a jsonDecoder returns.
+// Integers become int64, or uint64 if too large, and other numbers float64.
+func parseJSONText(text []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(text))
+	d.UseNumber()
+
+	v, err := parseJSONTextValue(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err == nil {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+func parseJSONTextValue(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			a := []interface{}{}
+			for d.More() {
+				v, err := parseJSONTextValue(d)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			}
+			_, err := d.Token()
+			return a, err
+		case '{':
+			o := new(jsonObject)
+			for d.More() {
+				k, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := parseJSONTextValue(d)
+				if err != nil {
+					return nil, err
+				}
+				o.set(k.(string), v)
+			}
+			_, err := d.Token()
+			return o, err
+		}
+		return nil, fmt.Errorf("unexpected %v in JSON", t)
+	case json.Number:
+		if i, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(string(t), 10, 64); err == nil {
+			return u, nil
+		}
+		return t.Float64()
+	default: // nil, bool or string
+		return t, nil
+	}
+}
+
+// encodeJSONBinary is the inverse of parseJSONBinary.
+func encodeJSONBinary(text []byte) ([]byte, error) {
+	v, err := parseJSONText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(eventWriter)
+	t, data, err := encodeJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	w.uint8(t)
+	w.bytes(data)
+	return w.b, nil
+}
+
+// encodeJSONValue returns the type and encoding of a decoded value. Integers
+// take the smallest type that holds them.
+func encodeJSONValue(v interface{}) (byte, []byte, error) {
+	w := new(eventWriter)
+
+	switch v := v.(type) {
+	case nil:
+		return JSONB_TYPE_LITERAL, []byte{JSONB_NULL_LITERAL}, nil
+	case bool:
+		if v {
+			return JSONB_TYPE_LITERAL, []byte{JSONB_TRUE_LITERAL}, nil
+		}
+		return JSONB_TYPE_LITERAL, []byte{JSONB_FALSE_LITERAL}, nil
+	case int64:
+		switch {
+		case v >= math.MinInt16 && v <= math.MaxInt16:
+			w.uint16(uint16(v))
+			return JSONB_TYPE_INT16, w.b, nil
+		case v >= math.MinInt32 && v <= math.MaxInt32:
+			w.uint32(uint32(v))
+			return JSONB_TYPE_INT32, w.b, nil
+		}
+		w.uint64(uint64(v))
+		return JSONB_TYPE_INT64, w.b, nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return encodeJSONValue(int64(v))
+		}
+		w.uint64(v)
+		return JSONB_TYPE_UINT64, w.b, nil
+	case float64:
+		w.uint64(math.Float64bits(v))
+		return JSONB_TYPE_DOUBLE, w.b, nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, nil, err
+		}
+		return encodeJSONValue(f)
+	case string:
+		encodeJSONVariableLength(w, len(v))
+		w.bytes([]byte(v))
+		return JSONB_TYPE_STRING, w.b, nil
+	case []interface{}:
+		return encodeJSONComposite(false, nil, v)
+	case *jsonObject:
+		return encodeJSONComposite(true, v.keys, v.values)
+	}
+	return 0, nil, fmt.Errorf("can't encode %T as JSON", v)
+}
+
+// encodeJSONComposite encodes an object or an array, in the small format if
+// it fits and the large one otherwise.
+func encodeJSONComposite(isObject bool, keys []string, values []interface{}) (byte, []byte, error) {
+	if isObject {
+		// MySQL looks keys up by binary search.
+		o := new(jsonObject)
+		for i, k := range keys {
+			o.set(k, values[i])
+		}
+		keys, values = o.keys, o.values
+	}
+
+	for _, large := range []bool{false, true} {
+		b, ok, err := encodeJSONCompositeWithSize(isObject, keys, values, large)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		switch {
+		case isObject && large:
+			return JSONB_TYPE_LARGE_OBJECT, b, nil
+		case isObject:
+			return JSONB_TYPE_SMALL_OBJECT, b, nil
+		case large:
+			return JSONB_TYPE_LARGE_ARRAY, b, nil
+		default:
+			return JSONB_TYPE_SMALL_ARRAY, b, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("JSON value is too large")
+}
+
+func encodeJSONCompositeWithSize(isObject bool, keys []string, values []interface{}, large bool) ([]byte, bool, error) {
+	offsetSize := 2
+	maxOffset := uint64(math.MaxUint16)
+	if large {
+		offsetSize = 4
+		maxOffset = math.MaxUint32
+	}
+
+	keyEntrySize := 0
+	if isObject {
+		keyEntrySize = offsetSize + 2
+	}
+	size := 2*offsetSize + len(values)*(keyEntrySize+1+offsetSize)
+	for _, k := range keys {
+		size += len(k)
+	}
+
+	keyEntries := new(eventWriter)
+	valueEntries := new(eventWriter)
+	data := new(eventWriter)
+
+	offset := 2*offsetSize + len(values)*(keyEntrySize+1+offsetSize)
+	for _, k := range keys {
+		if len(k) > math.MaxUint16 {
+			return nil, false, fmt.Errorf("JSON key of %d bytes is too long", len(k))
+		}
+		keyEntries.uintN(uint64(offset), offsetSize)
+		keyEntries.uint16(uint16(len(k)))
+		data.bytes([]byte(k))
+		offset += len(k)
+	}
+
+	for _, v := range values {
+		t, b, err := encodeJSONValue(v)
+		if err != nil {
+			return nil, false, err
+		}
+
+		valueEntries.uint8(t)
+		if isInlinedJSONValue(t, large) {
+			valueEntries.bytes(padBytes(b, offsetSize))
+			continue
+		}
+		valueEntries.uintN(uint64(size), offsetSize)
+		data.bytes(b)
+		size += len(b)
+	}
+
+	if uint64(size) > maxOffset || uint64(len(values)) > maxOffset {
+		return nil, false, nil
+	}
+
+	w := new(eventWriter)
+	w.uintN(uint64(len(values)), offsetSize)
+	w.uintN(uint64(size), offsetSize)
+	w.bytes(keyEntries.b)
+	w.bytes(valueEntries.b)
+	w.bytes(data.b)
+	return w.b, true, nil
+}
@@ -0,0 +1,138 @@
+package binlog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// {"a": 1} as MySQL stores it
+var jsonObjectFixture = []byte{0x00, 0x01, 0x00, 0x0c, 0x00, 0x0b, 0x00, 0x01, 0x00, 0x05, 0x01, 0x00, 0x61}
+
+func TestJSONBinaryIsParsedProperly(t *testing.T) {
+	v, err := parseJSONBinary(jsonObjectFixture)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a": 1}`, string(v))
+
+	v, err = parseJSONBinary(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(v))
+}
+
+func TestJSONBinaryIsEncodedProperly(t *testing.T) {
+	b, err := encodeJSONBinary([]byte(`{"a":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, jsonObjectFixture, b)
+}
+
+func TestJSONRoundTrips(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`null`, `null`},
+		{`true`, `true`},
+		{`false`, `false`},
+		{`-12`, `-12`},
+		{`70000`, `70000`},
+		{`-5000000000`, `-5000000000`},
+		{`18446744073709551615`, `18446744073709551615`},
+		{`2.5`, `2.5`},
+		{`3.0`, `3.0`},
+		{`1e100`, `1e100`},
+		{`"tab\tquote\" \u0001"`, `"tab\tquote\" \u0001"`},
+		{`[]`, `[]`},
+		{`{}`, `{}`},
+		{`[1, "two", [3.5, null], {"k": false}]`, `[1, "two", [3.5, null], {"k": false}]`},
+		// Keys are sorted by length, then bytewise.
+		{`{"bb": 1, "a": 2, "ab": 3}`, `{"a": 2, "ab": 3, "bb": 1}`},
+		{`{"a": {"b": {"c": [1, 2, {"d": "e"}]}}}`, `{"a": {"b": {"c": [1, 2, {"d": "e"}]}}}`},
+	}
+
+	for _, tt := range tests {
+		b, err := encodeJSONBinary([]byte(tt.in))
+		require.NoError(t, err, tt.in)
+
+		v, err := parseJSONBinary(b)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, string(v), tt.in)
+	}
+}
+
+func TestLargeJSONDocumentsRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	in := `{"long": "` + long + `", "list": [1, 2, 3]}`
+
+	b, err := encodeJSONBinary([]byte(in))
+	require.NoError(t, err)
+	assert.Equal(t, JSONB_TYPE_LARGE_OBJECT, b[0])
+
+	v, err := parseJSONBinary(b)
+	require.NoError(t, err)
+	assert.Equal(t, `{"list": [1, 2, 3], "long": "`+long+`"}`, string(v))
+}
+
+func TestJSONOpaqueValuesAreParsed(t *testing.T) {
+	// DECIMAL(4,2) -12.34
+	decimal := []byte{JSONB_TYPE_OPAQUE, MYSQL_TYPE_NEWDECIMAL, 0x04, 4, 2, 0x73, 0xdd}
+	v, err := parseJSONBinary(decimal)
+	require.NoError(t, err)
+	assert.Equal(t, "-12.34", string(v))
+
+	// DATETIME 2017-07-14 02:40:00.000005
+	datetime := []byte{JSONB_TYPE_OPAQUE, MYSQL_TYPE_DATETIME, 0x08}
+	packed := (((2017*13+7)<<5|14)<<17|(2<<12|40<<6))<<24 | 5
+	for i := 0; i < 8; i++ {
+		datetime = append(datetime, byte(packed>>(8*uint(i))))
+	}
+	v, err = parseJSONBinary(datetime)
+	require.NoError(t, err)
+	assert.Equal(t, `"2017-07-14 02:40:00.000005"`, string(v))
+
+	blob := []byte{JSONB_TYPE_OPAQUE, MYSQL_TYPE_BLOB, 0x02, 'h', 'i'}
+	v, err = parseJSONBinary(blob)
+	require.NoError(t, err)
+	assert.Equal(t, `"base64:type252:aGk="`, string(v))
+}
+
+func TestMalformedJSONBinaryFails(t *testing.T) {
+	for n := 1; n < len(jsonObjectFixture); n++ {
+		_, err := parseJSONBinary(jsonObjectFixture[:n])
+		assert.Error(t, err, "cut to %d bytes", n)
+	}
+
+	for _, b := range [][]byte{
+		{0x0d},
+		{JSONB_TYPE_LITERAL, 0x03},
+		{JSONB_TYPE_STRING, 0x80},
+		// A key offset pointing outside the object.
+		{0x00, 0x01, 0x00, 0x0c, 0x00, 0xff, 0x00, 0x01, 0x00, 0x05, 0x01, 0x00, 0x61},
+	} {
+		_, err := parseJSONBinary(b)
+		assert.Error(t, err, "%x", b)
+	}
+}
+
+func TestDeeplyNestedJSONBinaryFails(t *testing.T) {
+	in := strings.Repeat("[", maxJSONDepth+1) + strings.Repeat("]", maxJSONDepth+1)
+	b, err := encodeJSONBinary([]byte(in))
+	require.NoError(t, err)
+
+	_, err = parseJSONBinary(b)
+	assert.Error(t, err)
+}
+
+func TestJSONColumnIsParsedProperly(t *testing.T) {
+	data := append([]byte{byte(len(jsonObjectFixture)), 0, 0, 0}, jsonObjectFixture...)
+
+	v, n, err := parseValue(data, MYSQL_TYPE_JSON, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`{"a": 1}`), v)
+	assert.Equal(t, len(data), n)
+
+	w := new(eventWriter)
+	require.NoError(t, encodeValue(w, MYSQL_TYPE_JSON, 4, `{"a":1}`))
+	assert.Equal(t, data, w.b)
+}
@@ -0,0 +1,300 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// binlog_row_value_options flags, logged before the after image of each row
+// in a PARTIAL_UPDATE_ROWS_EVENT
+const (
+	PARTIAL_JSON_UPDATES uint64 = 1
+)
+
+// A JSONDiffOperation is the change a JSONDiff makes at its path.
+type JSONDiffOperation byte
+
+const (
+	JSON_DIFF_REPLACE JSONDiffOperation = iota
+	JSON_DIFF_INSERT
+	JSON_DIFF_REMOVE
+)
+
+func (op JSONDiffOperation) String() string {
+	switch op {
+	case JSON_DIFF_REPLACE:
+		return "REPLACE"
+	case JSON_DIFF_INSERT:
+		return "INSERT"
+	case JSON_DIFF_REMOVE:
+		return "REMOVE"
+	default:
+		return fmt.Sprintf("JSONDiffOperation(%d)", byte(op))
+	}
+}
+
+// A JSONDiff is one change to a JSON document, logged in place of the whole
+// document when a statement updated it in place (JSON_SET, JSON_REPLACE or
+// JSON_REMOVE) with binlog_row_value_options=PARTIAL_JSON. In the rows of a
+// PARTIAL_UPDATE_ROWS_EVENT, the after-image value of such a column is a
+// []JSONDiff to apply in order to the before-image document.
+type JSONDiff struct {
+	Operation JSONDiffOperation
+	Path      []byte // e.g. $.a[2]
+	Value     []byte // JSON text; nil for JSON_DIFF_REMOVE
+}
+
+// parseJSONDiffs decodes the diffs of a partially updated JSON column: their
+// total length in meta bytes, like a blob, then each of them:
+//
+//	1 byte for the operation
+//	packed integer for the path length, then the path
+//	except for JSON_DIFF_REMOVE, packed integer for the value length, then
+//	  the value in binary JSON
+func parseJSONDiffs(data []byte, meta uint16) ([]JSONDiff, int, error) {
+	if meta < 1 || meta > 4 {
+		return nil, 0, fmt.Errorf("invalid JSON packlen = %d", meta)
+	}
+	if err := checkValueLength(data, int(meta)); err != nil {
+		return nil, 0, err
+	}
+	length := getLittleEndianFixedLengthInt(data[:meta])
+	if length > uint64(len(data)-int(meta)) {
+		return nil, 0, fmt.Errorf("need %d bytes, have %d", length, len(data)-int(meta))
+	}
+	n := int(meta) + int(length)
+
+	var diffs []JSONDiff
+	r := newEventReader(data[meta:n])
+	for r.err == nil && r.len() > 0 {
+		var d JSONDiff
+		d.Operation = JSONDiffOperation(r.uint8())
+		if r.err == nil && d.Operation > JSON_DIFF_REMOVE {
+			return nil, 0, fmt.Errorf("invalid JSON diff operation %d", d.Operation)
+		}
+		d.Path = r.lengthEncodedBytes()
+
+		if d.Operation != JSON_DIFF_REMOVE {
+			b := r.lengthEncodedBytes()
+			if r.err != nil {
+				break
+			}
+			v, err := parseJSONBinary(b)
+			if err != nil {
+				return nil, 0, fmt.Errorf("JSON diff at %s: %v", d.Path, err)
+			}
+			d.Value = v
+		}
+		diffs = append(diffs, d)
+	}
+	if r.err != nil {
+		return nil, 0, fmt.Errorf("JSON diff: %s", r.err.(*decodeError).msg)
+	}
+
+	return diffs, n, nil
+}
+
+func encodeJSONDiffs(w *eventWriter, meta uint16, diffs []JSONDiff) error {
+	d := new(eventWriter)
+	for _, diff := range diffs {
+		d.uint8(uint8(diff.Operation))
+		d.lengthEncodedBytes(diff.Path)
+		if diff.Operation != JSON_DIFF_REMOVE {
+			v, err := encodeJSONBinary(diff.Value)
+			if err != nil {
+				return err
+			}
+			d.lengthEncodedBytes(v)
+		}
+	}
+
+	if meta < 1 || meta > 4 {
+		return fmt.Errorf("invalid JSON packlen = %d", meta)
+	}
+	w.uintN(uint64(len(d.b)), int(meta))
+	w.bytes(d.b)
+	return nil
+}
+
+// ApplyJSONDiffs applies diffs in order to the JSON document doc and returns
+// the resulting document.
+func ApplyJSONDiffs(doc []byte, diffs []JSONDiff) ([]byte, error) {
+	v, err := parseJSONText(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range diffs {
+		legs, err := parseJSONPath(d.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		if d.Operation != JSON_DIFF_REMOVE {
+			if value, err = parseJSONText(d.Value); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", d.Operation, d.Path, err)
+			}
+		}
+
+		if v, err = applyJSONDiff(v, legs, d.Operation, value); err != nil {
+			return nil, fmt.Errorf("%s %s: %v", d.Operation, d.Path, err)
+		}
+	}
+
+	return formatJSON(v), nil
+}
+
+// A jsonPathLeg is a step of a JSON path: an object member if key is set, an
+// array element otherwise.
+type jsonPathLeg struct {
+	key   *string
+	index int
+}
+
+func (l jsonPathLeg) String() string {
+	if l.key != nil {
+		return "." + strconv.Quote(*l.key)
+	}
+	return fmt.Sprintf("[%d]", l.index)
+}
+
+// parseJSONPath parses the paths of JSON diffs: $ followed by .key, ."key"
+// and [index] legs. Wildcards and ranges never appear in diffs.
+func parseJSONPath(path []byte) ([]jsonPathLeg, error) {
+	p := bytes.TrimSpace(path)
+	if len(p) == 0 || p[0] != '$' {
+		return nil, fmt.Errorf("invalid JSON path %q", path)
+	}
+	p = p[1:]
+
+	var legs []jsonPathLeg
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			var key string
+			if len(p) > 0 && p[0] == '"' {
+				end := 1
+				for end < len(p) && p[end] != '"' {
+					if p[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(p) || json.Unmarshal(p[:end+1], &key) != nil {
+					return nil, fmt.Errorf("invalid JSON path %q", path)
+				}
+				p = p[end+1:]
+			} else {
+				end := bytes.IndexAny(p, ".[")
+				if end < 0 {
+					end = len(p)
+				}
+				key = string(p[:end])
+				p = p[end:]
+			}
+			if key == "" || key == "*" {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			legs = append(legs, jsonPathLeg{key: &key})
+		case '[':
+			end := bytes.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			i, err := strconv.Atoi(string(bytes.TrimSpace(p[1:end])))
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			legs = append(legs, jsonPathLeg{index: i})
+			p = p[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+
+	return legs, nil
+}
+
+// applyJSONDiff applies one operation at the path legs of doc, and returns
+// the changed document.
+func applyJSONDiff(doc interface{}, legs []jsonPathLeg, op JSONDiffOperation, value interface{}) (interface{}, error) {
+	if len(legs) == 0 {
+		if op != JSON_DIFF_REPLACE {
+			return nil, fmt.Errorf("can't insert or remove the whole document")
+		}
+		return value, nil
+	}
+
+	leg := legs[0]
+	switch d := doc.(type) {
+	case *jsonObject:
+		if leg.key == nil {
+			return nil, fmt.Errorf("%s on an object", leg)
+		}
+		i, ok := d.index(*leg.key)
+
+		if len(legs) > 1 {
+			if !ok {
+				return nil, fmt.Errorf("no member %s", leg)
+			}
+			v, err := applyJSONDiff(d.values[i], legs[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			d.values[i] = v
+			return d, nil
+		}
+
+		switch {
+		case op == JSON_DIFF_INSERT:
+			d.set(*leg.key, value)
+		case !ok:
+			return nil, fmt.Errorf("no member %s", leg)
+		case op == JSON_DIFF_REPLACE:
+			d.values[i] = value
+		default:
+			d.remove(i)
+		}
+		return d, nil
+	case []interface{}:
+		if leg.key != nil {
+			return nil, fmt.Errorf("%s on an array", leg)
+		}
+		i := leg.index
+
+		if len(legs) > 1 {
+			if i >= len(d) {
+				return nil, fmt.Errorf("no element %s", leg)
+			}
+			v, err := applyJSONDiff(d[i], legs[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			d[i] = v
+			return d, nil
+		}
+
+		switch {
+		case op == JSON_DIFF_INSERT:
+			if i >= len(d) {
+				return append(d, value), nil
+			}
+			d = append(d, nil)
+			copy(d[i+1:], d[i:])
+			d[i] = value
+		case i >= len(d):
+			return nil, fmt.Errorf("no element %s", leg)
+		case op == JSON_DIFF_REPLACE:
+			d[i] = value
+		default:
+			d = append(d[:i], d[i+1:]...)
+		}
+		return d, nil
+	}
+
+	return nil, fmt.Errorf("%s on a scalar", leg)
+}
@@ -0,0 +1,183 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPathIsParsed(t *testing.T) {
+	key := func(k string) jsonPathLeg { return jsonPathLeg{key: &k} }
+
+	legs, err := parseJSONPath([]byte(`$.a[2]."b c".d`))
+	require.NoError(t, err)
+	assert.Equal(t, []jsonPathLeg{key("a"), {index: 2}, key("b c"), key("d")}, legs)
+
+	legs, err = parseJSONPath([]byte(`$`))
+	require.NoError(t, err)
+	assert.Empty(t, legs)
+
+	for _, path := range []string{``, `a`, `$.`, `$.*`, `$[`, `$[-1]`, `$[*]`, `$."a`, `$**`} {
+		_, err := parseJSONPath([]byte(path))
+		assert.Error(t, err, path)
+	}
+}
+
+func TestJSONDiffsAreApplied(t *testing.T) {
+	tests := []struct {
+		doc   string
+		diffs []JSONDiff
+		want  string
+	}{
+		{`{"a": 1, "b": [1, 2]}`, []JSONDiff{{JSON_DIFF_REPLACE, []byte("$.a"), []byte(`"x"`)}}, `{"a": "x", "b": [1, 2]}`},
+		{`{"a": 1}`, []JSONDiff{{JSON_DIFF_INSERT, []byte("$.c"), []byte(`{"d": null}`)}}, `{"a": 1, "c": {"d": null}}`},
+		{`{"a": 1, "b": 2}`, []JSONDiff{{JSON_DIFF_REMOVE, []byte("$.a"), nil}}, `{"b": 2}`},
+		{`{"b": [1, 2]}`, []JSONDiff{{JSON_DIFF_REPLACE, []byte("$.b[1]"), []byte(`3`)}}, `{"b": [1, 3]}`},
+		{`{"b": [1, 2]}`, []JSONDiff{{JSON_DIFF_INSERT, []byte("$.b[0]"), []byte(`0`)}}, `{"b": [0, 1, 2]}`},
+		{`{"b": [1, 2]}`, []JSONDiff{{JSON_DIFF_INSERT, []byte("$.b[9]"), []byte(`3`)}}, `{"b": [1, 2, 3]}`},
+		{`{"b": [1, 2]}`, []JSONDiff{{JSON_DIFF_REMOVE, []byte("$.b[0]"), nil}}, `{"b": [2]}`},
+		{`[1]`, []JSONDiff{{JSON_DIFF_REPLACE, []byte("$"), []byte(`true`)}}, `true`},
+		{`{"a": 1}`, []JSONDiff{
+			{JSON_DIFF_INSERT, []byte("$.b"), []byte(`[]`)},
+			{JSON_DIFF_INSERT, []byte("$.b[0]"), []byte(`2.5`)},
+			{JSON_DIFF_REMOVE, []byte("$.a"), nil},
+		}, `{"b": [2.5]}`},
+	}
+
+	for _, tt := range tests {
+		doc, err := ApplyJSONDiffs([]byte(tt.doc), tt.diffs)
+		require.NoError(t, err, tt.doc)
+		assert.Equal(t, tt.want, string(doc), tt.doc)
+	}
+}
+
+func TestBadJSONDiffsFail(t *testing.T) {
+	tests := []struct {
+		doc  string
+		diff JSONDiff
+	}{
+		{`{"a": 1}`, JSONDiff{JSON_DIFF_REPLACE, []byte("$.b"), []byte(`1`)}},
+		{`{"a": 1}`, JSONDiff{JSON_DIFF_REMOVE, []byte("$.b"), nil}},
+		{`{"a": 1}`, JSONDiff{JSON_DIFF_REPLACE, []byte("$[0]"), []byte(`1`)}},
+		{`[1]`, JSONDiff{JSON_DIFF_REPLACE, []byte("$.a"), []byte(`1`)}},
+		{`[1]`, JSONDiff{JSON_DIFF_REMOVE, []byte("$[1]"), nil}},
+		{`[1]`, JSONDiff{JSON_DIFF_REPLACE, []byte("$[0].a"), []byte(`1`)}},
+		{`[1]`, JSONDiff{JSON_DIFF_REMOVE, []byte("$"), nil}},
+		{`[1]`, JSONDiff{JSON_DIFF_REPLACE, []byte("$[0]"), []byte(`{`)}},
+	}
+
+	for _, tt := range tests {
+		_, err := ApplyJSONDiffs([]byte(tt.doc), []JSONDiff{tt.diff})
+		assert.Error(t, err, "%s %s", tt.diff.Operation, tt.diff.Path)
+	}
+}
+
+func testPartialUpdate() (*TableMapEvent, *RowsEvent) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    3,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_JSON, MYSQL_TYPE_JSON},
+		ColumnMetadata: []uint16{0, 4, 4},
+		NullBitVector:  []byte{0x06},
+	}
+
+	e := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   3,
+		ColumnBitmap1: []byte{0x07},
+		ColumnBitmap2: []byte{0x07},
+		Rows: [][]interface{}{
+			{int64(1), []byte(`{"a": 1, "b": [1, 2]}`), []byte(`[]`)},
+			{int64(1), []JSONDiff{
+				{JSON_DIFF_REPLACE, []byte("$.a"), []byte(`"x"`)},
+				{JSON_DIFF_REMOVE, []byte("$.b[0]"), nil},
+			}, []byte(`[true]`)},
+		},
+	}
+	return tme, e
+}
+
+func encodePartialUpdate(t testing.TB, tme *TableMapEvent, e *RowsEvent) [][]byte {
+	enc := NewBinlogEncoder()
+	var events [][]byte
+	for _, ev := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{PARTIAL_UPDATE_ROWS_EVENT, e},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: ev.t, ServerId: 1}, ev.e)
+		require.NoError(t, err)
+		events = append(events, b)
+	}
+	return events
+}
+
+func TestPartialUpdateRowsEventIsParsed(t *testing.T) {
+	tme, e := testPartialUpdate()
+	events := encodePartialUpdate(t, tme, e)
+
+	p := NewBinlogParser()
+	var parsed *EventContainer
+	for _, b := range events {
+		var err error
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, e.Rows, parsed.Event.(*RowsEvent).Rows)
+
+	applying := NewBinlogParser()
+	applying.ApplyJSONDiffs()
+	for _, p := range []*BinlogParser{NewBinlogParserWithOptions(ParserOptions{ApplyJSONDiffs: true}), applying} {
+		for _, b := range events {
+			var err error
+			parsed, err = p.Parse(b)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, []interface{}{int64(1), []byte(`{"a": "x", "b": [2]}`), []byte(`[true]`)},
+			parsed.Event.(*RowsEvent).Rows[1])
+	}
+}
+
+func TestPartialUpdateOfNullDocumentFails(t *testing.T) {
+	_, e := testPartialUpdate()
+	e.Rows[0][1] = nil
+
+	assert.Error(t, e.ApplyJSONDiffs())
+
+	// Diffs to a column missing from the before image are left alone.
+	e.ColumnBitmap1 = []byte{0x05}
+	e.Rows[0] = []interface{}{int64(1), nil, []byte(`[]`)}
+	require.NoError(t, e.ApplyJSONDiffs())
+	assert.IsType(t, []JSONDiff{}, e.Rows[1][1])
+}
+
+func TestParsingTruncatedPartialUpdateRowsEventNeverPanics(t *testing.T) {
+	tme, e := testPartialUpdate()
+	events := encodePartialUpdate(t, tme, e)
+	body := events[2][EventHeaderSize:]
+
+	for n := 0; n < len(body); n++ {
+		p := NewBinlogParser()
+		for _, b := range events[:2] {
+			_, err := p.Parse(b)
+			require.NoError(t, err)
+		}
+
+		input := eventWithHeader(PARTIAL_UPDATE_ROWS_EVENT, body[:n])
+		_, err := p.Parse(input)
+		if err == nil {
+			continue
+		}
+
+		ee, ok := err.(*EventError)
+		if assert.True(t, ok, "cut to %d bytes: %v", n, err) {
+			assert.True(t, ee.Offset <= len(input), "cut to %d bytes: offset %d", n, ee.Offset)
+		}
+	}
+}
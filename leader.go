@@ -0,0 +1,246 @@
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A BinaryLog describes one binary log file as listed by SHOW BINARY LOGS.
+type BinaryLog struct {
+	Name      string
+	Size      uint64
+	Encrypted bool // always false before MySQL 8.0.14
+}
+
+// LeaderInfo identifies the MySQL leader a Follower is registered to.
+type LeaderInfo struct {
+	ServerID   uint32
+	ServerUUID string // empty before MySQL 5.6
+	GTIDPurged string // empty before MySQL 5.6 or when GTIDs are disabled
+}
+
+// A PositionPurgedError means the requested binlog position is no longer
+// available on the leader, usually because the file holding it was purged.
+// The only way to recover is to start from a fresh snapshot.
+type PositionPurgedError struct {
+	Position       Position
+	FirstAvailable string // oldest binlog still on the leader, if known
+	Err            error  // error reported by the leader, if any
+}
+
+func (e *PositionPurgedError) Error() string {
+	msg := fmt.Sprintf("binlog position %s:%d has been purged", e.Position.Name, e.Position.Pos)
+	if e.FirstAvailable != "" {
+		msg = msg + fmt.Sprintf(" (oldest available binlog is %s)", e.FirstAvailable)
+	}
+	if e.Err != nil {
+		msg = msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// IsPositionPurged reports whether err means the requested binlog position is
+// gone from the leader.
+func IsPositionPurged(err error) bool {
+	_, ok := err.(*PositionPurgedError)
+	return ok
+}
+
+// GetBinaryLogs returns the binary logs the leader still has, oldest first.
+func (f *Follower) GetBinaryLogs() ([]BinaryLog, error) {
+	if err := f.checkExec(); err != nil {
+		return nil, err
+	}
+
+	result, err := f.c.execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBinaryLogs(result)
+}
+
+func parseBinaryLogs(r *Result) ([]BinaryLog, error) {
+	if r.Resultset == nil {
+		return nil, errors.New("SHOW BINARY LOGS returned no result set")
+	}
+
+	encryptedColumn, hasEncrypted := r.FieldNames["Encrypted"]
+
+	logs := make([]BinaryLog, len(r.Values))
+	for i := range logs {
+		name, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := r.GetUint64(i, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		logs[i].Name = name
+		logs[i].Size = size
+
+		if hasEncrypted {
+			encrypted, err := r.GetString(i, encryptedColumn)
+			if err != nil {
+				return nil, err
+			}
+			logs[i].Encrypted = strings.EqualFold(encrypted, "Yes")
+		}
+	}
+
+	return logs, nil
+}
+
+// GetLeaderInfo returns the leader's server_id, server_uuid and gtid_purged.
+func (f *Follower) GetLeaderInfo() (*LeaderInfo, error) {
+	if err := f.checkExec(); err != nil {
+		return nil, err
+	}
+
+	// SHOW VARIABLES simply leaves out variables that don't exist on older servers.
+	result, err := f.c.execute("SHOW GLOBAL VARIABLES WHERE Variable_name IN ('server_id', 'server_uuid', 'gtid_purged')")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLeaderInfo(result)
+}
+
+func parseLeaderInfo(r *Result) (*LeaderInfo, error) {
+	vars, err := variablesFromResult(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info := new(LeaderInfo)
+
+	serverID, ok := vars["server_id"]
+	if !ok {
+		return nil, errors.New("leader did not report server_id")
+	}
+	id, err := strconv.ParseUint(serverID, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server_id %q: %v", serverID, err)
+	}
+	info.ServerID = uint32(id)
+
+	info.ServerUUID = vars["server_uuid"]
+
+	// gtid_purged comes back with embedded newlines once it spans several UUIDs
+	info.GTIDPurged = strings.Replace(vars["gtid_purged"], "\n", "", -1)
+
+	return info, nil
+}
+
+// variablesFromResult turns the (Variable_name, Value) rows returned by SHOW
+// VARIABLES into a map keyed by lower-cased variable name.
+func variablesFromResult(r *Result) (map[string]string, error) {
+	if r.Resultset == nil {
+		return nil, errors.New("SHOW VARIABLES returned no result set")
+	}
+
+	vars := make(map[string]string, len(r.Values))
+	for i := range r.Values {
+		name, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := r.GetString(i, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		vars[strings.ToLower(name)] = value
+	}
+
+	return vars, nil
+}
+
+// CheckPosition verifies that the leader can still serve the binlog stream
+// starting at pos. It returns a *PositionPurgedError if the file holding pos has
+// already been purged, so callers can fall back to a new snapshot instead of
+// letting StartSync fail with error 1236.
+func (f *Follower) CheckPosition(pos Position) error {
+	logs, err := f.GetBinaryLogs()
+	if err != nil {
+		return err
+	}
+
+	return checkPosition(logs, pos)
+}
+
+func checkPosition(logs []BinaryLog, pos Position) error {
+	if len(logs) == 0 {
+		return errors.New("leader has no binary logs")
+	}
+
+	for _, l := range logs {
+		if l.Name == pos.Name {
+			if uint64(pos.Pos) > l.Size {
+				return fmt.Errorf("binlog position %d is past the end of %s (%d bytes)", pos.Pos, l.Name, l.Size)
+			}
+			return nil
+		}
+	}
+
+	if compareBinlogNames(pos.Name, logs[0].Name) < 0 {
+		return &PositionPurgedError{Position: pos, FirstAvailable: logs[0].Name}
+	}
+
+	return fmt.Errorf("binlog %s does not exist on the leader", pos.Name)
+}
+
+// compareBinlogNames orders binlog file names by their numeric extension
+// (mysql-bin.000009 < mysql-bin.000010). Files with a different base name than
+// the leader's current ones can never be served again, so they sort first.
+func compareBinlogNames(a, b string) int {
+	aBase, aSeq := splitBinlogName(a)
+	bBase, bSeq := splitBinlogName(b)
+
+	switch {
+	case aBase != bBase:
+		return -1
+	case aSeq < bSeq:
+		return -1
+	case aSeq > bSeq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func splitBinlogName(name string) (string, uint64) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return name, 0
+	}
+
+	seq, err := strconv.ParseUint(name[i+1:], 10, 64)
+	if err != nil {
+		return name, 0
+	}
+
+	return name[:i], seq
+}
+
+// streamError converts an error received on the binlog stream into a
+// *PositionPurgedError when the leader says it can no longer serve pos.
+func streamError(err error, pos Position) error {
+	e, ok := err.(*MySQLError)
+	if !ok || e.Code != ER_MASTER_FATAL_ERROR_READING_BINLOG {
+		return err
+	}
+
+	if strings.Contains(e.Message, "purged") ||
+		strings.Contains(e.Message, "Could not find first log file name") {
+		return &PositionPurgedError{Position: pos, Err: e}
+	}
+
+	return err
+}
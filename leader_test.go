@@ -0,0 +1,136 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResult(names []string, rows ...[]interface{}) *Result {
+	r := &Result{Resultset: &Resultset{
+		Fields:     make([]*Field, len(names)),
+		FieldNames: make(map[string]int, len(names)),
+		Values:     rows,
+	}}
+
+	for i, name := range names {
+		r.Fields[i] = &Field{Name: []byte(name)}
+		r.FieldNames[name] = i
+	}
+
+	return r
+}
+
+func TestParseBinaryLogs(t *testing.T) {
+	r := newTestResult([]string{"Log_name", "File_size"},
+		[]interface{}{[]byte("mysql-bin.000009"), uint64(1073741937)},
+		[]interface{}{[]byte("mysql-bin.000010"), uint64(154)},
+	)
+
+	logs, err := parseBinaryLogs(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []BinaryLog{
+			{Name: "mysql-bin.000009", Size: 1073741937},
+			{Name: "mysql-bin.000010", Size: 154},
+		}, logs)
+	}
+}
+
+func TestParseBinaryLogsWithEncryptedColumn(t *testing.T) {
+	r := newTestResult([]string{"Log_name", "File_size", "Encrypted"},
+		[]interface{}{[]byte("binlog.000001"), uint64(180), []byte("No")},
+		[]interface{}{[]byte("binlog.000002"), uint64(4096), []byte("Yes")},
+	)
+
+	logs, err := parseBinaryLogs(r)
+	if assert.NoError(t, err) {
+		assert.False(t, logs[0].Encrypted)
+		assert.True(t, logs[1].Encrypted)
+	}
+}
+
+func TestParseLeaderInfo(t *testing.T) {
+	r := newTestResult([]string{"Variable_name", "Value"},
+		[]interface{}{[]byte("gtid_purged"), []byte("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2")},
+		[]interface{}{[]byte("server_id"), []byte("62344")},
+		[]interface{}{[]byte("server_uuid"), []byte("3e11fa47-71ca-11e1-9e33-c80aa9429562")},
+	)
+
+	info, err := parseLeaderInfo(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &LeaderInfo{
+			ServerID:   62344,
+			ServerUUID: "3e11fa47-71ca-11e1-9e33-c80aa9429562",
+			GTIDPurged: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2",
+		}, info)
+	}
+}
+
+func TestParseLeaderInfoWithoutGTIDs(t *testing.T) {
+	r := newTestResult([]string{"Variable_name", "Value"},
+		[]interface{}{[]byte("server_id"), []byte("7")},
+	)
+
+	info, err := parseLeaderInfo(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &LeaderInfo{ServerID: 7}, info)
+	}
+}
+
+var testBinaryLogs = []BinaryLog{
+	{Name: "mysql-bin.000009", Size: 1073741937},
+	{Name: "mysql-bin.000010", Size: 154},
+}
+
+func TestCheckPositionAcceptsAvailablePosition(t *testing.T) {
+	assert.NoError(t, checkPosition(testBinaryLogs, Position{"mysql-bin.000009", 4}))
+	assert.NoError(t, checkPosition(testBinaryLogs, Position{"mysql-bin.000010", 154}))
+}
+
+func TestCheckPositionReportsPurgedPosition(t *testing.T) {
+	pos := Position{"mysql-bin.000008", 1200}
+	err := checkPosition(testBinaryLogs, pos)
+
+	assert.True(t, IsPositionPurged(err))
+	assert.Equal(t, &PositionPurgedError{Position: pos, FirstAvailable: "mysql-bin.000009"}, err)
+}
+
+func TestCheckPositionReportsPositionPastEndOfFile(t *testing.T) {
+	err := checkPosition(testBinaryLogs, Position{"mysql-bin.000010", 155})
+
+	assert.Error(t, err)
+	assert.False(t, IsPositionPurged(err))
+}
+
+func TestCheckPositionReportsFutureFile(t *testing.T) {
+	err := checkPosition(testBinaryLogs, Position{"mysql-bin.000011", 4})
+
+	assert.Error(t, err)
+	assert.False(t, IsPositionPurged(err))
+}
+
+func TestCompareBinlogNames(t *testing.T) {
+	assert.Equal(t, -1, compareBinlogNames("mysql-bin.000999", "mysql-bin.001000"))
+	assert.Equal(t, 1, compareBinlogNames("mysql-bin.001000", "mysql-bin.000999"))
+	assert.Equal(t, 0, compareBinlogNames("mysql-bin.000001", "mysql-bin.000001"))
+	assert.Equal(t, -1, compareBinlogNames("old-bin.000500", "mysql-bin.000001"))
+}
+
+func TestStreamErrorDetectsPurgedPosition(t *testing.T) {
+	pos := Position{"mysql-bin.000001", 4}
+	serverErr := &MySQLError{
+		Code:    ER_MASTER_FATAL_ERROR_READING_BINLOG,
+		State:   "HY000",
+		Message: "Could not find first log file name in binary log index file",
+	}
+
+	err := streamError(serverErr, pos)
+
+	assert.Equal(t, &PositionPurgedError{Position: pos, Err: serverErr}, err)
+}
+
+func TestStreamErrorPassesOtherErrorsThrough(t *testing.T) {
+	serverErr := &MySQLError{Code: 1045, State: "28000", Message: "Access denied"}
+
+	assert.Equal(t, serverErr, streamError(serverErr, Position{}))
+}
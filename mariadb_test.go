@@ -0,0 +1,42 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlavorIsDetectedFromServerVersion(t *testing.T) {
+	assert.Equal(t, MySQLFlavor, flavorOfVersion("5.7.22-log"))
+	assert.Equal(t, MySQLFlavor, flavorOfVersion("8.0.32"))
+	assert.Equal(t, MariaDBFlavor, flavorOfVersion("5.5.5-10.4.12-MariaDB-log"))
+	assert.Equal(t, MariaDBFlavor, flavorOfVersion("10.6.7-MariaDB"))
+	assert.Equal(t, "mariadb", MariaDBFlavor.String())
+}
+
+func TestParseMariadbGTID(t *testing.T) {
+	g, err := ParseMariadbGTID("0-1-100")
+	require.NoError(t, err)
+	assert.Equal(t, MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 100}, g)
+	assert.Equal(t, "0-1-100", g.String())
+
+	for _, s := range []string{"", "0-1", "0-1-2-3", "a-1-2", "0-1-x", "4294967296-1-1"} {
+		_, err := ParseMariadbGTID(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseMariadbGTIDList(t *testing.T) {
+	l, err := ParseMariadbGTIDList("0-1-100, 1-2-7,0-1-101")
+	require.NoError(t, err)
+	assert.Equal(t, MariadbGTIDList{{0, 1, 101}, {1, 2, 7}}, l)
+	assert.Equal(t, "0-1-101,1-2-7", l.String())
+
+	l, err = ParseMariadbGTIDList("")
+	require.NoError(t, err)
+	assert.Empty(t, l)
+
+	_, err = ParseMariadbGTIDList("0-1-100,oops")
+	assert.Error(t, err)
+}
@@ -2,23 +2,133 @@ package binlog
 
 import (
 	"errors"
+	"time"
 )
 
+// A ZeroDatePolicy is what zero dates such as 0000-00-00, and dates with a
+// zero month or day, decode to.
+type ZeroDatePolicy int
+
+const (
+	ZeroDateString ZeroDatePolicy = iota // "0000-00-00 00:00:00" or "0000-00-00"
+	ZeroDateNull                         // nil, as a NULL
+	ZeroDateTime                         // the zero time.Time
+	ZeroDateError                        // fail the event
+)
+
+// ParserOptions control how a BinlogParser decodes row values. The zero value
+// decodes them as NewBinlogParser always has.
+type ParserOptions struct {
+	// Location is the time zone TIMESTAMP values are shown in, and the one
+	// DATETIME and DATE values are taken to be in when decoded to time.Time.
+	// nil means time.Local for TIMESTAMP values and UTC for the others.
+	Location *time.Location
+
+	// ParseTime decodes DATE, DATETIME and TIMESTAMP values to time.Time with
+	// their fractional seconds, TIME values to time.Duration and YEAR values
+	// to int64, rather than to strings.
+	ParseTime bool
+
+	// ExactDecimals decodes DECIMAL values to their exact decimal text with
+	// as many fractional digits as their scale, e.g. "-12.50", rather than to
+	// float64, which can't hold every value of a wide DECIMAL.
+	ExactDecimals bool
+
+	// ZeroDates is what zero dates decode to.
+	ZeroDates ZeroDatePolicy
+
+	// CopyBytes makes string and blob values copies. Otherwise they alias the
+	// event's bytes, EventContainer.Bytes, and change if those do.
+	CopyBytes bool
+
+	// ApplyJSONDiffs makes partial updates carry whole JSON documents in
+	// their after images rather than diffs; see RowsEvent.ApplyJSONDiffs.
+	ApplyJSONDiffs bool
+
+	// DecodeCharsets converts CHAR, VARCHAR and TEXT values to UTF-8 strings
+	// from their character sets, and makes BINARY, VARBINARY and BLOB values
+	// []byte. Character sets come from the collations in table maps, or for
+	// tables whose table maps carry none, from the schema Schemas returns.
+	// Values of tables with neither are decoded as they are without it.
+	DecodeCharsets bool
+
+	// DecodeEnums makes ENUM values their labels, and SET values the []string
+	// of theirs, from the labels in table maps or the schema Schemas returns.
+	// Values of tables with neither are decoded as they are without it.
+	DecodeEnums bool
+
+	// BitStrings makes BIT values strings of binary digits as wide as their
+	// columns, e.g. "00101" for BIT(5), rather than int64.
+	BitStrings bool
+
+	// Geometry is what GEOMETRY values decode to.
+	Geometry GeometryFormat
+
+	// Schemas returns the schema of a table, or nil if it isn't known.
+	Schemas func(database, table string) *TableSchema
+
+	// LazyRows leaves the rows of rows events undecoded, for their Cursor to
+	// decode a value at a time; Rows is nil.
+	LazyRows bool
+
+	// Projection returns the indexes of the columns of a table to decode, or
+	// nil to decode them all. The others are left out of rows events as if
+	// missing from their images. Rows events of tables it selects no columns
+	// of are Skipped.
+	Projection func(database, table string) []int
+
+	// Filter selects the tables and event types to decode. Rows events of the
+	// tables it filters out are Skipped after their post-header, and their
+	// table maps aren't kept. Events of the types it filters out are parsed
+	// as GenericEvents, unless the parser needs them to parse later events.
+	// Either way their EventContainers are Filtered, and Followers don't
+	// stream them.
+	Filter *ReplicationFilter
+}
+
 // A BinlogParser keeps track of the current event-formatting parameters and
 // parses incoming events accordingly.
 type BinlogParser struct {
-	format *FormatDescriptionEvent
-	tables map[uint64]*TableMapEvent
+	format   *FormatDescriptionEvent
+	tables   map[uint64]*TableMapEvent
+	filtered map[uint64]bool // IDs of the tables the filter leaves out
+	options  ParserOptions
+
+	rowsQuery *RowsQueryEvent // statement of the rows events that follow
 }
 
 func NewBinlogParser() *BinlogParser {
+	return NewBinlogParserWithOptions(ParserOptions{})
+}
+
+// NewBinlogParserWithOptions returns a BinlogParser that decodes row values
+// as the options say.
+func NewBinlogParserWithOptions(o ParserOptions) *BinlogParser {
 	p := new(BinlogParser)
 
 	p.tables = make(map[uint64]*TableMapEvent)
+	p.filtered = make(map[uint64]bool)
+	p.options = o
 
 	return p
 }
 
+// Options returns the options the parser decodes row values with.
+func (p *BinlogParser) Options() ParserOptions {
+	return p.options
+}
+
+// SetOptions changes how the parser decodes the row values of later events.
+func (p *BinlogParser) SetOptions(o ParserOptions) {
+	p.options = o
+}
+
+// ApplyJSONDiffs makes partial updates carry whole JSON documents in their
+// after images rather than diffs. It sets ParserOptions.ApplyJSONDiffs.
+func (p *BinlogParser) ApplyJSONDiffs() {
+	p.options.ApplyJSONDiffs = true
+}
+
 func (p *BinlogParser) Parse(b []byte) (*EventContainer, error) {
 	bytes := b
 
@@ -34,12 +144,12 @@ func (p *BinlogParser) Parse(b []byte) (*EventContainer, error) {
 		return nil, errors.New("invalid event size")
 	}
 
-	e, err := p.parseEvent(h, b)
+	e, filtered, err := p.parseEvent(h, b)
 	if err != nil {
 		return nil, err
 	}
 
-	return &EventContainer{h, e, bytes}, nil
+	return &EventContainer{Header: h, Event: e, Bytes: bytes, Filtered: filtered}, nil
 }
 
 func parseHeader(b []byte) (*EventHeader, error) {
@@ -54,10 +164,21 @@ func parseHeader(b []byte) (*EventHeader, error) {
 // true, so they have a single return value. Methods that might fail even if
 // IsValid() is true return an error value also. Methods that require data from
 // the initial FORMAT_DESCRIPTION_EVENT take a BinlogFormat parameter.
-func (p *BinlogParser) parseEvent(h *EventHeader, data []byte) (Event, error) {
+//
+// It also reports whether the parser's filter leaves the event out.
+func (p *BinlogParser) parseEvent(h *EventHeader, data []byte) (Event, bool, error) {
 	var e Event
 	var err error
 
+	filtered := !p.options.Filter.MatchEvent(h.EventType)
+	if filtered && !changesParserState(h.EventType) {
+		e, err = NewGenericEvent(data)
+		if err != nil {
+			return nil, false, newEventError(h, data, err)
+		}
+		return e, true, nil
+	}
+
 	switch h.EventType {
 	// We need to catch and save any format description events, because they govern
 	// how future events are parsed.
@@ -70,29 +191,115 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte) (Event, error) {
 		e, err = NewRotateEvent(data)
 		if err == nil {
 			p.tables = make(map[uint64]*TableMapEvent) // need to reset tables after a rotate event
+			p.filtered = make(map[uint64]bool)
+			p.rowsQuery = nil
 		}
 	case TABLE_MAP_EVENT:
 		e, err = NewTableMapEvent(p.format, data)
 		if err == nil {
-			p.tables[e.(*TableMapEvent).TableID] = e.(*TableMapEvent)
+			t := e.(*TableMapEvent)
+			if p.options.Filter.MatchTable(string(t.DatabaseName), string(t.TableName)) {
+				p.tables[t.TableID] = t
+				delete(p.filtered, t.TableID)
+			} else {
+				delete(p.tables, t.TableID)
+				p.filtered[t.TableID] = true
+				filtered = true
+			}
+		}
+	case PRE_GA_WRITE_ROWS_EVENT, PRE_GA_DELETE_ROWS_EVENT, PRE_GA_UPDATE_ROWS_EVENT,
+		WRITE_ROWS_EVENT_V1, DELETE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT_V1,
+		WRITE_ROWS_EVENT_V2, DELETE_ROWS_EVENT_V2, UPDATE_ROWS_EVENT_V2,
+		PARTIAL_UPDATE_ROWS_EVENT:
+		if p.filtered[rowsEventTableID(p.format, h.EventType, data)] {
+			e, err = newFilteredRowsEvent(p.format, h.EventType, data)
+			filtered = true
+			break
+		}
+		e, err = newRowsEvent(p.format, p.tables, h.EventType, data, &p.options)
+		if err == nil && p.rowsQuery != nil {
+			e.(*RowsEvent).Query = p.rowsQuery.Query
+		}
+		if err == nil && h.EventType == PARTIAL_UPDATE_ROWS_EVENT && p.options.ApplyJSONDiffs {
+			err = e.(*RowsEvent).ApplyJSONDiffs()
+		}
+	case WRITE_ROWS_COMPRESSED_EVENT_V1, DELETE_ROWS_COMPRESSED_EVENT_V1, UPDATE_ROWS_COMPRESSED_EVENT_V1,
+		WRITE_ROWS_COMPRESSED_EVENT, DELETE_ROWS_COMPRESSED_EVENT, UPDATE_ROWS_COMPRESSED_EVENT:
+		if p.filtered[rowsEventTableID(nil, h.EventType, data)] {
+			e, err = newFilteredRowsEvent(nil, h.EventType, data)
+			filtered = true
+			break
+		}
+		e, err = newCompressedRowsEvent(p.tables, h.EventType, data, &p.options)
+		if err == nil && p.rowsQuery != nil {
+			e.(*RowsEvent).Query = p.rowsQuery.Query
+		}
+	case ROWS_QUERY_EVENT:
+		e, err = NewRowsQueryEvent(data)
+		if err == nil {
+			p.rowsQuery = e.(*RowsQueryEvent)
+		}
+	case ANNOTATE_ROWS_EVENT:
+		e, err = NewAnnotateRowsEvent(data)
+		if err == nil {
+			p.rowsQuery = e.(*RowsQueryEvent)
 		}
-	case WRITE_ROWS_EVENT_V1, DELETE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT_V1:
-		e, err = NewRowsEvent(p.tables, h.EventType, data)
 	case QUERY_EVENT: // for transaction-grouping
 		e, err = NewQueryEvent(data)
+		p.rowsQuery = nil
+	case QUERY_COMPRESSED_EVENT:
+		e, err = NewCompressedQueryEvent(data)
+		p.rowsQuery = nil
 	case XID_EVENT: // for transaction-grouping; equivalent to a COMMIT
 		e, err = NewXidEvent(data)
+		p.rowsQuery = nil
 	case BEGIN_LOAD_QUERY_EVENT:
 		e, err = NewBeginLoadQueryEvent(data)
 	case EXECUTE_LOAD_QUERY_EVENT:
 		e, err = NewExecuteLoadQueryEvent(data)
-	default: // otherwise could be GTID, INTVAR, RAND, ROWS_QUERY, PRE_GA_WRITE_ROWS_EVENT, PRE_GA_UPDATE_ROWS_EVENT, PRE_GA_DELETE_ROWS_EVENT, WRITE_ROWS_EVENT_V2, UPDATE_ROWS_EVENT_V2, DELETE_ROWS_EVENT_V2 _EVENT
+	case GTID_LOG_EVENT, ANONYMOUS_GTID_LOG_EVENT:
+		e, err = NewGtidEvent(data)
+	case PREVIOUS_GTIDS_LOG_EVENT:
+		e, err = NewPreviousGTIDsEvent(data)
+	case MARIADB_GTID_EVENT:
+		e, err = NewMariadbGtidEvent(h.ServerId, data)
+		p.rowsQuery = nil
+	case MARIADB_GTID_LIST_EVENT:
+		e, err = NewMariadbGtidListEvent(data)
+	case BINLOG_CHECKPOINT_EVENT:
+		e, err = NewBinlogCheckpointEvent(data)
+	case TRANSACTION_PAYLOAD_EVENT:
+		e, err = p.parseTransactionPayloadEvent(h, data)
+	case INTVAR_EVENT:
+		e, err = NewIntVarEvent(data)
+	case RAND_EVENT:
+		e, err = NewRandEvent(data)
+	case USER_VAR_EVENT:
+		e, err = NewUserVarEvent(data)
+	default: // otherwise could be START_ENCRYPTION_EVENT
 		e, err = NewGenericEvent(data)
 	}
 
 	if err != nil {
-		return nil, &EventError{h, err.Error(), data}
+		return nil, false, newEventError(h, data, err)
 	}
 
-	return e, nil
+	// A ROWS_QUERY statement ends with the last of its rows events
+	if re, ok := e.(*RowsEvent); ok && re.Flags&STMT_END_F != 0 {
+		p.rowsQuery = nil
+	}
+
+	return e, filtered, nil
+}
+
+// changesParserState reports whether the parser keeps track of events of type
+// t, or of the events they hold, to parse later events.
+func changesParserState(t EventType) bool {
+	switch t {
+	case FORMAT_DESCRIPTION_EVENT, ROTATE_EVENT, TABLE_MAP_EVENT, TRANSACTION_PAYLOAD_EVENT,
+		ROWS_QUERY_EVENT, ANNOTATE_ROWS_EVENT, QUERY_EVENT, QUERY_COMPRESSED_EVENT, XID_EVENT,
+		MARIADB_GTID_EVENT:
+		return true
+	}
+	return false
 }
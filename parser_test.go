@@ -2,9 +2,12 @@ package binlog
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -134,3 +137,273 @@ func (suite *BinlogParserTestSuite) TestParsingFormatDescriptionEventWorksCorrec
 func (suite *BinlogParserTestSuite) SetupSuite() {
 	suite.parser = NewBinlogParser()
 }
+
+// eventWithHeader prepends a v4 event header to an event body.
+func eventWithHeader(t EventType, body []byte) []byte {
+	b := make([]byte, EventHeaderSize, EventHeaderSize+len(body))
+	b[4] = byte(t)
+	binary.LittleEndian.PutUint32(b[9:], uint32(EventHeaderSize+len(body)))
+	return append(b, body...)
+}
+
+// writeRowsEvent inserts (1, 2) into the table defined by tableMapEvent.
+var writeRowsEvent = []byte{
+	// Table ID
+	76, 0, 0, 0, 0, 0,
+	// Flags
+	1, 0,
+	// Number of columns
+	2,
+	// Columns present
+	0x3,
+	// NULL bitmap
+	0x0,
+	// LONG
+	1, 0, 0, 0,
+	// SHORT
+	2, 0,
+}
+
+func parserWithTableMap(t *testing.T) *BinlogParser {
+	p := NewBinlogParser()
+	_, err := p.Parse(eventWithHeader(FORMAT_DESCRIPTION_EVENT, formatDescriptionEvent))
+	require.NoError(t, err)
+	_, err = p.Parse(eventWithHeader(TABLE_MAP_EVENT, tableMapEvent))
+	require.NoError(t, err)
+	return p
+}
+
+func TestParsingWriteRowsEventWorksCorrectly(t *testing.T) {
+	ev, err := parserWithTableMap(t).Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent))
+	require.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{int32(1), int16(2)}}, ev.Event.(*RowsEvent).Rows)
+}
+
+// writeRowsEventWithFlags returns writeRowsEvent with other rows event flags.
+func writeRowsEventWithFlags(flags uint16) []byte {
+	b := append([]byte(nil), writeRowsEvent...)
+	binary.LittleEndian.PutUint16(b[6:], flags)
+	return b
+}
+
+var rowsQueryEvent = []byte{
+	// Length
+	27,
+	// Query
+	'I', 'N', 'S', 'E', 'R', 'T', ' ', 'I', 'N', 'T', 'O', ' ', 't', ' ',
+	'V', 'A', 'L', 'U', 'E', 'S', ' ', '(', '1', ',', ' ', '2', ')',
+}
+
+func TestRowsQueryIsAttachedToFollowingRowsEvents(t *testing.T) {
+	p := parserWithTableMap(t)
+
+	ev, err := p.Parse(eventWithHeader(ROWS_QUERY_EVENT, rowsQueryEvent))
+	require.NoError(t, err)
+	assert.Equal(t, &RowsQueryEvent{Query: rowsQueryEvent[1:]}, ev.Event)
+
+	// A statement's rows events all carry it, the last ending the statement
+	for _, flags := range []uint16{0, STMT_END_F} {
+		ev, err = p.Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEventWithFlags(flags)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("INSERT INTO t VALUES (1, 2)"), ev.Event.(*RowsEvent).Query)
+	}
+
+	_, err = p.Parse(eventWithHeader(XID_EVENT, xidEvent))
+	require.NoError(t, err)
+
+	ev, err = p.Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent))
+	require.NoError(t, err)
+	assert.Nil(t, ev.Event.(*RowsEvent).Query)
+}
+
+func TestRowsQueryEndsWithItsStatement(t *testing.T) {
+	p := parserWithTableMap(t)
+
+	// Only the first statement of the transaction was logged with its query
+	for _, input := range [][]byte{
+		eventWithHeader(QUERY_EVENT, queryEvent),
+		eventWithHeader(ROWS_QUERY_EVENT, rowsQueryEvent),
+	} {
+		_, err := p.Parse(input)
+		require.NoError(t, err)
+	}
+
+	ev, err := p.Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("INSERT INTO t VALUES (1, 2)"), ev.Event.(*RowsEvent).Query)
+
+	ev, err = p.Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent))
+	require.NoError(t, err)
+	assert.Nil(t, ev.Event.(*RowsEvent).Query)
+}
+
+func TestAnnotateRowsIsAttachedToFollowingRowsEvents(t *testing.T) {
+	p := parserWithTableMap(t)
+
+	ev, err := p.Parse(eventWithHeader(ANNOTATE_ROWS_EVENT, rowsQueryEvent[1:]))
+	require.NoError(t, err)
+	assert.Equal(t, &RowsQueryEvent{Query: rowsQueryEvent[1:]}, ev.Event)
+
+	ev, err = p.Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("INSERT INTO t VALUES (1, 2)"), ev.Event.(*RowsEvent).Query)
+}
+
+func TestRowsQueryEventsRoundTripThroughEncoder(t *testing.T) {
+	for _, input := range [][]byte{
+		eventWithHeader(ROWS_QUERY_EVENT, rowsQueryEvent),
+		eventWithHeader(ANNOTATE_ROWS_EVENT, rowsQueryEvent[1:]),
+	} {
+		e, err := NewBinlogParser().Parse(input)
+		require.NoError(t, err)
+
+		output, err := NewBinlogEncoder().Encode(e.Header, e.Event)
+		require.NoError(t, err)
+		assert.Equal(t, input[EventHeaderSize:], output[EventHeaderSize:])
+	}
+}
+
+func TestParsingTruncatedEventsNeverPanics(t *testing.T) {
+	events := []struct {
+		t    EventType
+		body []byte
+	}{
+		{FORMAT_DESCRIPTION_EVENT, formatDescriptionEvent},
+		{TABLE_MAP_EVENT, tableMapEvent},
+		{WRITE_ROWS_EVENT_V1, writeRowsEvent},
+		{UPDATE_ROWS_EVENT_V1, writeRowsEvent},
+		{ROTATE_EVENT, rotateEvent},
+		{QUERY_EVENT, queryEvent},
+		{XID_EVENT, xidEvent},
+		{BEGIN_LOAD_QUERY_EVENT, xidEvent},
+		{EXECUTE_LOAD_QUERY_EVENT, queryEvent},
+		{GTID_LOG_EVENT, gtidEvent},
+		{PREVIOUS_GTIDS_LOG_EVENT, previousGTIDsEvent},
+		{INTVAR_EVENT, intVarEvent},
+		{RAND_EVENT, randEvent},
+		{USER_VAR_EVENT, userVarEvent(DECIMAL_RESULT, 33, append([]byte{4, 2}, decimalTests[0].inData[:2]...), 0)},
+		{ROWS_QUERY_EVENT, rowsQueryEvent},
+		{MARIADB_GTID_EVENT, mariadbGtidEvent},
+		{MARIADB_GTID_LIST_EVENT, mariadbGtidListEvent},
+		{WRITE_ROWS_COMPRESSED_EVENT_V1, append(writeRowsEvent[:8:8], mariadbCompress(writeRowsEvent[8:])...)},
+		{TRANSACTION_PAYLOAD_EVENT, encodeTransactionPayload(t, testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_ZSTD))[EventHeaderSize:]},
+	}
+
+	for _, e := range events {
+		for n := 0; n < len(e.body); n++ {
+			input := eventWithHeader(e.t, e.body[:n])
+
+			_, err := parserWithTableMap(t).Parse(input)
+			if err == nil {
+				continue
+			}
+
+			ee, ok := err.(*EventError)
+			if assert.True(t, ok, "%s cut to %d bytes: %v", e.t, n, err) {
+				assert.Equal(t, e.t, ee.EventType)
+				assert.True(t, ee.Offset <= len(input), "%s cut to %d bytes: offset %d", e.t, n, ee.Offset)
+			}
+		}
+	}
+}
+
+func TestTruncatedRowValueIsReportedWithColumn(t *testing.T) {
+	input := eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent[:len(writeRowsEvent)-1])
+
+	_, err := parserWithTableMap(t).Parse(input)
+	require.Error(t, err)
+
+	ee := err.(*EventError)
+	assert.Equal(t, WRITE_ROWS_EVENT_V1, ee.EventType)
+	assert.Equal(t, 1, ee.Column)
+	assert.Equal(t, EventHeaderSize+15, ee.Offset)
+	assert.Equal(t, "WriteRowsEventV1: column 1: need 2 bytes, have 1 at offset 34", ee.Error())
+}
+
+func TestRowsEventWithMoreColumnsThanTableFails(t *testing.T) {
+	body := append([]byte(nil), writeRowsEvent...)
+	body[8] = 3
+
+	_, err := parserWithTableMap(t).Parse(eventWithHeader(WRITE_ROWS_EVENT_V1, body))
+	require.Error(t, err)
+	assert.Equal(t, -1, err.(*EventError).Column)
+}
+
+func TestTableMapEventBeforeFormatDescriptionIsParsed(t *testing.T) {
+	_, err := NewBinlogParser().Parse(eventWithHeader(TABLE_MAP_EVENT, tableMapEvent))
+	assert.NoError(t, err)
+}
+
+func FuzzBinlogParserParse(f *testing.F) {
+	f.Add(eventWithHeader(FORMAT_DESCRIPTION_EVENT, formatDescriptionEvent))
+	f.Add(eventWithHeader(TABLE_MAP_EVENT, tableMapEvent))
+	f.Add(eventWithHeader(WRITE_ROWS_EVENT_V1, writeRowsEvent))
+	update := append(append([]byte(nil), writeRowsEvent[:10]...), 0x3)
+	update = append(append(update, writeRowsEvent[10:]...), writeRowsEvent[10:]...)
+	f.Add(eventWithHeader(UPDATE_ROWS_EVENT_V1, update))
+	f.Add(eventWithHeader(ROTATE_EVENT, rotateEvent))
+	f.Add(eventWithHeader(QUERY_EVENT, queryEvent))
+	f.Add(eventWithHeader(XID_EVENT, xidEvent))
+	f.Add(eventWithHeader(GTID_LOG_EVENT, gtidEvent))
+	f.Add(eventWithHeader(USER_VAR_EVENT, userVarEvent(STRING_RESULT, 33, []byte("x"), 0)))
+	f.Add(eventWithHeader(ROWS_QUERY_EVENT, rowsQueryEvent))
+	f.Add(eventWithHeader(MARIADB_GTID_EVENT, mariadbGtidEvent))
+	f.Add(eventWithHeader(MARIADB_GTID_LIST_EVENT, mariadbGtidListEvent))
+	f.Add(eventWithHeader(WRITE_ROWS_COMPRESSED_EVENT_V1, append(writeRowsEvent[:8:8], mariadbCompress(writeRowsEvent[8:])...)))
+	f.Add(encodeTransactionPayload(f, testTransactionPayload(TRANSACTION_PAYLOAD_COMPRESSION_ZSTD)))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p := parserWithTableMap(t)
+
+		e, err := p.Parse(b)
+		if err == nil && e == nil {
+			t.Fatal("Parse returned neither an event nor an error")
+		}
+		if ee, ok := err.(*EventError); ok && ee.Offset > len(b) {
+			t.Fatalf("error offset %d is past the end of the event", ee.Offset)
+		}
+	})
+}
+
+func TestParserOptionsApplyToRowsEvents(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    2,
+		ColumnTypes:    []byte{MYSQL_TYPE_VARCHAR, MYSQL_TYPE_DATETIME2},
+		ColumnMetadata: []uint16{255, 0},
+		NullBitVector:  []byte{0x03},
+	}
+	write := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   2,
+		ColumnBitmap1: []byte{0x03},
+		Rows:          [][]interface{}{{"first", "2017-07-14 02:40:00"}},
+	}
+
+	enc := NewBinlogEncoder()
+	p := NewBinlogParserWithOptions(ParserOptions{ParseTime: true, CopyBytes: true})
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{WRITE_ROWS_EVENT_V2, write},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+
+	// Values don't change with the event's bytes.
+	for i := range parsed.Bytes {
+		parsed.Bytes[i] = 0
+	}
+	assert.Equal(t, [][]interface{}{{"first", time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)}},
+		parsed.Event.(*RowsEvent).Rows)
+	assert.True(t, p.Options().ParseTime)
+}
@@ -0,0 +1,358 @@
+package binlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PreflightStatus is the outcome of a single preflight check.
+type PreflightStatus int
+
+const (
+	PreflightOK PreflightStatus = iota
+	PreflightWarning
+	PreflightFailed
+)
+
+func (s PreflightStatus) String() string {
+	switch s {
+	case PreflightOK:
+		return "ok"
+	case PreflightWarning:
+		return "warning"
+	case PreflightFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// A PreflightCheck describes one setting of the leader and whether it lets a
+// Follower replicate correctly.
+type PreflightCheck struct {
+	Name    string
+	Value   string // value reported by the leader; empty if it doesn't have the setting
+	Status  PreflightStatus
+	Message string // explanation for warnings and failures
+}
+
+// A PreflightReport collects the results of Preflight. Deploy tooling should
+// refuse to start a Follower when OK returns false.
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// OK reports whether no check failed. Warnings don't count as failures.
+func (r *PreflightReport) OK() bool {
+	return len(r.Failures()) == 0
+}
+
+// Failures returns the checks that failed.
+func (r *PreflightReport) Failures() []PreflightCheck {
+	return r.withStatus(PreflightFailed)
+}
+
+// Warnings returns the checks that passed with a warning.
+func (r *PreflightReport) Warnings() []PreflightCheck {
+	return r.withStatus(PreflightWarning)
+}
+
+func (r *PreflightReport) withStatus(s PreflightStatus) []PreflightCheck {
+	var checks []PreflightCheck
+	for _, c := range r.Checks {
+		if c.Status == s {
+			checks = append(checks, c)
+		}
+	}
+	return checks
+}
+
+func (r *PreflightReport) add(name, value string, status PreflightStatus, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, PreflightCheck{
+		Name:    name,
+		Value:   value,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+var preflightVariables = []string{
+	"log_bin",
+	"binlog_format",
+	"binlog_row_image",
+	"server_id",
+	"gtid_mode",
+	"binlog_row_metadata",
+	"binlog_checksum",
+}
+
+// Preflight inspects the server at the other end of c and reports whether a
+// Follower with the given followerID can replicate from it: row-based binary
+// logging, row image and metadata settings, checksums, the connecting user's
+// privileges, and followerID collisions with replicas that are already
+// connected. Run it on a plain connection before registering the Follower, or
+// the Follower will collide with itself.
+//
+// An error is only returned when the leader can't be queried at all; problems
+// with its configuration are reported as failed checks.
+func Preflight(c *Conn, followerID uint32) (*PreflightReport, error) {
+	in := new(preflightInput)
+
+	query := fmt.Sprintf("SHOW GLOBAL VARIABLES WHERE Variable_name IN ('%s')", strings.Join(preflightVariables, "', '"))
+	result, err := c.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	if in.variables, err = variablesFromResult(result); err != nil {
+		return nil, err
+	}
+
+	if result, err = c.execute("SHOW GRANTS FOR CURRENT_USER()"); err != nil {
+		in.grantsErr = err
+	} else {
+		in.grants, in.grantsErr = columnStrings(result, 0)
+	}
+
+	if result, err = c.execute("SHOW SLAVE HOSTS"); err != nil {
+		in.replicasErr = err
+	} else {
+		in.replicaIDs, in.replicasErr = columnStrings(result, 0)
+	}
+
+	return in.evaluate(followerID), nil
+}
+
+// preflightInput holds everything Preflight reads from the leader.
+type preflightInput struct {
+	variables   map[string]string
+	grants      []string
+	grantsErr   error
+	replicaIDs  []string
+	replicasErr error
+}
+
+func (in *preflightInput) evaluate(followerID uint32) *PreflightReport {
+	r := new(PreflightReport)
+
+	in.checkLogBin(r)
+	in.checkBinlogFormat(r)
+	in.checkRowImage(r)
+	in.checkServerID(r, followerID)
+	in.checkGTIDMode(r)
+	in.checkRowMetadata(r)
+	in.checkChecksum(r)
+	in.checkPrivileges(r)
+	in.checkReplicas(r, followerID)
+
+	return r
+}
+
+func (in *preflightInput) checkLogBin(r *PreflightReport) {
+	v := in.variables["log_bin"]
+	if strings.EqualFold(v, "ON") || v == "1" {
+		r.add("log_bin", v, PreflightOK, "")
+	} else {
+		r.add("log_bin", v, PreflightFailed, "binary logging is disabled")
+	}
+}
+
+func (in *preflightInput) checkBinlogFormat(r *PreflightReport) {
+	v := in.variables["binlog_format"]
+	if strings.EqualFold(v, "ROW") {
+		r.add("binlog_format", v, PreflightOK, "")
+	} else {
+		r.add("binlog_format", v, PreflightFailed, "binlog_format must be ROW; other formats log statements instead of row changes")
+	}
+}
+
+func (in *preflightInput) checkRowImage(r *PreflightReport) {
+	v, ok := in.variables["binlog_row_image"]
+	switch {
+	case !ok:
+		r.add("binlog_row_image", v, PreflightOK, "server always logs full row images")
+	case strings.EqualFold(v, "FULL"):
+		r.add("binlog_row_image", v, PreflightOK, "")
+	default:
+		r.add("binlog_row_image", v, PreflightWarning, "row images will leave out unchanged columns; use FULL to receive whole rows")
+	}
+}
+
+func (in *preflightInput) checkServerID(r *PreflightReport, followerID uint32) {
+	v := in.variables["server_id"]
+	id, err := strconv.ParseUint(v, 10, 32)
+	switch {
+	case err != nil:
+		r.add("server_id", v, PreflightFailed, "invalid server_id")
+	case id == 0:
+		r.add("server_id", v, PreflightFailed, "server_id must be set to a non-zero value for the leader to accept replicas")
+	case uint32(id) == followerID:
+		r.add("server_id", v, PreflightFailed, "followerID %d is the leader's own server_id", followerID)
+	default:
+		r.add("server_id", v, PreflightOK, "")
+	}
+}
+
+func (in *preflightInput) checkGTIDMode(r *PreflightReport) {
+	v, ok := in.variables["gtid_mode"]
+	switch {
+	case !ok:
+		r.add("gtid_mode", v, PreflightOK, "server does not support GTIDs")
+	case strings.EqualFold(v, "ON"), strings.EqualFold(v, "OFF"):
+		r.add("gtid_mode", v, PreflightOK, "")
+	default:
+		r.add("gtid_mode", v, PreflightWarning, "gtid_mode is changing; the stream may mix GTID and anonymous transactions")
+	}
+}
+
+func (in *preflightInput) checkRowMetadata(r *PreflightReport) {
+	v, ok := in.variables["binlog_row_metadata"]
+	switch {
+	case !ok:
+		r.add("binlog_row_metadata", v, PreflightOK, "server does not log column metadata; column names must come from the schema")
+	case strings.EqualFold(v, "FULL"):
+		r.add("binlog_row_metadata", v, PreflightOK, "")
+	default:
+		r.add("binlog_row_metadata", v, PreflightWarning, "table maps won't carry column names, charsets or enum values; use FULL to have them")
+	}
+}
+
+func (in *preflightInput) checkChecksum(r *PreflightReport) {
+	v, ok := in.variables["binlog_checksum"]
+	switch {
+	case !ok, strings.EqualFold(v, "NONE"), strings.EqualFold(v, "CRC32"):
+		r.add("binlog_checksum", v, PreflightOK, "")
+	default:
+		r.add("binlog_checksum", v, PreflightFailed, "unsupported binlog checksum algorithm")
+	}
+}
+
+func (in *preflightInput) checkPrivileges(r *PreflightReport) {
+	if in.grantsErr != nil {
+		r.add("privileges", "", PreflightFailed, "could not read grants: %v", in.grantsErr)
+		return
+	}
+
+	global := make(map[string]bool)
+	selectAnywhere := false
+	for _, g := range in.grants {
+		privs, object := parseGrant(g)
+		for _, p := range privs {
+			if object == "*.*" {
+				global[p] = true
+			}
+			if p == "SELECT" || p == "ALL PRIVILEGES" {
+				selectAnywhere = true
+			}
+		}
+	}
+
+	has := func(privs ...string) bool {
+		if global["ALL PRIVILEGES"] {
+			return true
+		}
+		for _, p := range privs {
+			if global[p] {
+				return true
+			}
+		}
+		return false
+	}
+
+	granted := strings.Join(in.grants, "; ")
+	var missing []string
+	if !has("REPLICATION SLAVE", "REPLICATION REPLICA") {
+		missing = append(missing, "REPLICATION SLAVE")
+	}
+	if !has("REPLICATION CLIENT") {
+		missing = append(missing, "REPLICATION CLIENT")
+	}
+
+	switch {
+	case len(missing) > 0:
+		r.add("privileges", granted, PreflightFailed, "missing %s on *.*", strings.Join(missing, ", "))
+	case has("SELECT"):
+		r.add("privileges", granted, PreflightOK, "")
+	case selectAnywhere:
+		r.add("privileges", granted, PreflightWarning, "SELECT is only granted on some schemas; snapshots of other tables will fail")
+	default:
+		r.add("privileges", granted, PreflightFailed, "missing SELECT, which is needed to snapshot tables")
+	}
+}
+
+// parseGrant splits a SHOW GRANTS line such as "GRANT SELECT, REPLICATION
+// SLAVE ON *.* TO 'repl'@'%'" into its upper-cased privileges and the object
+// they are granted on.
+func parseGrant(grant string) (privs []string, object string) {
+	upper := strings.ToUpper(grant)
+	if !strings.HasPrefix(upper, "GRANT ") {
+		return nil, ""
+	}
+
+	on := strings.Index(upper, " ON ")
+	if on < 0 {
+		return nil, "" // role grant
+	}
+
+	// Column-level grants look like SELECT (`a`, `b`), so only split on commas
+	// outside of parentheses.
+	depth, start := 0, len("GRANT ")
+	for i := start; i <= on; i++ {
+		switch {
+		case i == on || (upper[i] == ',' && depth == 0):
+			p := upper[start:i]
+			if j := strings.IndexByte(p, '('); j >= 0 {
+				p = p[:j]
+			}
+			privs = append(privs, strings.TrimSpace(p))
+			start = i + 1
+		case upper[i] == '(':
+			depth++
+		case upper[i] == ')':
+			depth--
+		}
+	}
+
+	rest := strings.TrimSpace(grant[on+len(" ON "):])
+	if i := strings.Index(strings.ToUpper(rest), " TO "); i >= 0 {
+		rest = rest[:i]
+	}
+	object = strings.Replace(strings.TrimSpace(rest), "`", "", -1)
+
+	return privs, object
+}
+
+func (in *preflightInput) checkReplicas(r *PreflightReport, followerID uint32) {
+	if in.replicasErr != nil {
+		r.add("follower_id", "", PreflightFailed, "could not list connected replicas: %v", in.replicasErr)
+		return
+	}
+
+	id := strconv.FormatUint(uint64(followerID), 10)
+	for _, replicaID := range in.replicaIDs {
+		if replicaID == id {
+			r.add("follower_id", id, PreflightFailed, "a replica with server_id %s is already connected; the leader would disconnect one of the two", id)
+			return
+		}
+	}
+
+	r.add("follower_id", id, PreflightOK, "")
+}
+
+// columnStrings returns every value of one column of a result set as strings.
+func columnStrings(r *Result, column int) ([]string, error) {
+	if r.Resultset == nil {
+		return nil, nil
+	}
+
+	values := make([]string, len(r.Values))
+	for i := range r.Values {
+		s, err := r.GetString(i, column)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = s
+	}
+
+	return values, nil
+}
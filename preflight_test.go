@@ -0,0 +1,151 @@
+package binlog
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func goodPreflightInput() *preflightInput {
+	return &preflightInput{
+		variables: map[string]string{
+			"log_bin":             "ON",
+			"binlog_format":       "ROW",
+			"binlog_row_image":    "FULL",
+			"server_id":           "62344",
+			"gtid_mode":           "ON",
+			"binlog_row_metadata": "FULL",
+			"binlog_checksum":     "CRC32",
+		},
+		grants: []string{
+			"GRANT SELECT, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `repl`@`%`",
+		},
+		replicaIDs: []string{"1000", "1001"},
+	}
+}
+
+func findCheck(r *PreflightReport, name string) PreflightCheck {
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	return PreflightCheck{}
+}
+
+func TestPreflightPassesOnWellConfiguredLeader(t *testing.T) {
+	r := goodPreflightInput().evaluate(999)
+
+	assert.True(t, r.OK())
+	assert.Empty(t, r.Warnings())
+	assert.Len(t, r.Checks, 9)
+}
+
+func TestPreflightPassesOnMySQL55(t *testing.T) {
+	in := goodPreflightInput()
+	in.variables = map[string]string{
+		"log_bin":       "ON",
+		"binlog_format": "ROW",
+		"server_id":     "1",
+	}
+
+	r := in.evaluate(999)
+
+	assert.True(t, r.OK())
+	assert.Empty(t, r.Warnings())
+}
+
+func TestPreflightFailsOnStatementBasedLogging(t *testing.T) {
+	in := goodPreflightInput()
+	in.variables["binlog_format"] = "MIXED"
+
+	r := in.evaluate(999)
+
+	assert.False(t, r.OK())
+	assert.Equal(t, PreflightFailed, findCheck(r, "binlog_format").Status)
+}
+
+func TestPreflightFailsWithoutBinaryLogging(t *testing.T) {
+	in := goodPreflightInput()
+	in.variables["log_bin"] = "OFF"
+
+	assert.Equal(t, PreflightFailed, findCheck(in.evaluate(999), "log_bin").Status)
+}
+
+func TestPreflightWarnsOnMinimalRowImageAndMetadata(t *testing.T) {
+	in := goodPreflightInput()
+	in.variables["binlog_row_image"] = "MINIMAL"
+	in.variables["binlog_row_metadata"] = "MINIMAL"
+
+	r := in.evaluate(999)
+
+	assert.True(t, r.OK())
+	assert.Len(t, r.Warnings(), 2)
+}
+
+func TestPreflightFailsOnZeroServerID(t *testing.T) {
+	in := goodPreflightInput()
+	in.variables["server_id"] = "0"
+
+	assert.Equal(t, PreflightFailed, findCheck(in.evaluate(999), "server_id").Status)
+}
+
+func TestPreflightFailsWhenFollowerIDIsLeaderID(t *testing.T) {
+	assert.Equal(t, PreflightFailed, findCheck(goodPreflightInput().evaluate(62344), "server_id").Status)
+}
+
+func TestPreflightFailsWhenFollowerIDCollides(t *testing.T) {
+	r := goodPreflightInput().evaluate(1001)
+
+	assert.False(t, r.OK())
+	assert.Equal(t, PreflightFailed, findCheck(r, "follower_id").Status)
+}
+
+func TestPreflightFailsWhenReplicasCannotBeListed(t *testing.T) {
+	in := goodPreflightInput()
+	in.replicaIDs = nil
+	in.replicasErr = errors.New("access denied")
+
+	assert.Equal(t, PreflightFailed, findCheck(in.evaluate(999), "follower_id").Status)
+}
+
+func TestPreflightFailsWithoutReplicationPrivileges(t *testing.T) {
+	in := goodPreflightInput()
+	in.grants = []string{"GRANT SELECT ON *.* TO `app`@`%`"}
+
+	c := findCheck(in.evaluate(999), "privileges")
+
+	assert.Equal(t, PreflightFailed, c.Status)
+	assert.Contains(t, c.Message, "REPLICATION SLAVE, REPLICATION CLIENT")
+}
+
+func TestPreflightAcceptsAllPrivileges(t *testing.T) {
+	in := goodPreflightInput()
+	in.grants = []string{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'localhost' WITH GRANT OPTION"}
+
+	assert.Equal(t, PreflightOK, findCheck(in.evaluate(999), "privileges").Status)
+}
+
+func TestPreflightWarnsOnSchemaLevelSelect(t *testing.T) {
+	in := goodPreflightInput()
+	in.grants = []string{
+		"GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `repl`@`%`",
+		"GRANT SELECT ON `shard767`.* TO `repl`@`%`",
+	}
+
+	assert.Equal(t, PreflightWarning, findCheck(in.evaluate(999), "privileges").Status)
+}
+
+func TestParseGrant(t *testing.T) {
+	privs, object := parseGrant("GRANT SELECT (`id`, `name`), REPLICATION CLIENT ON `shard767`.`users` TO `repl`@`%`")
+
+	assert.Equal(t, []string{"SELECT", "REPLICATION CLIENT"}, privs)
+	assert.Equal(t, "shard767.users", object)
+}
+
+func TestParseRoleGrant(t *testing.T) {
+	privs, _ := parseGrant("GRANT `replicator`@`%` TO `repl`@`%`")
+
+	assert.Empty(t, privs)
+}
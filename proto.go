@@ -0,0 +1,244 @@
+package binlog
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vsco/autobahn-binlog/binlogpb"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var protoOps = map[ChangeOp]binlogpb.Op{
+	ChangeCreate: binlogpb.Op_OP_CREATE,
+	ChangeUpdate: binlogpb.Op_OP_UPDATE,
+	ChangeDelete: binlogpb.Op_OP_DELETE,
+	ChangeRead:   binlogpb.Op_OP_READ,
+}
+
+// Proto converts a change to a binlogpb.ChangeEvent; see
+// binlogpb/changeevent.proto. Values are converted by their kind; DATE and
+// DATETIME values are UTC timestamps of their wall clock times.
+func (e *ChangeEvent) Proto() (*binlogpb.ChangeEvent, error) {
+	s := &e.Source
+	m := &binlogpb.ChangeEvent{
+		Source: &binlogpb.Source{
+			ServerId:  s.ServerID,
+			File:      s.File,
+			Pos:       s.Pos,
+			Row:       uint32(s.Row),
+			Gtid:      s.GTID,
+			Thread:    s.Thread,
+			Timestamp: timestamppb.New(s.Timestamp),
+			Snapshot:  s.Snapshot,
+			Query:     s.Query,
+		},
+		Table: &binlogpb.Table{Database: e.Database, Name: e.Table},
+		Op:    protoOps[e.Op],
+	}
+
+	var keys []int
+	if e.table != nil {
+		m.Table.TableId = e.table.table.TableID
+		keys = e.table.keys
+	}
+
+	var err error
+	if m.Before, err = protoRow(e.Before, nil); err != nil {
+		return nil, fmt.Errorf("%s.%s: before %v", e.Database, e.Table, err)
+	}
+	if m.After, err = protoRow(e.After, nil); err != nil {
+		return nil, fmt.Errorf("%s.%s: after %v", e.Database, e.Table, err)
+	}
+	if m.Key, err = protoRow(e.Key, keys); err != nil {
+		return nil, fmt.Errorf("%s.%s: key %v", e.Database, e.Table, err)
+	}
+
+	if t := e.Transaction; t != nil {
+		m.Transaction = &binlogpb.Transaction{Id: t.ID, Sequence: uint64(t.Sequence)}
+	}
+	return m, nil
+}
+
+// MarshalProto encodes a change as a binlogpb.ChangeEvent.
+func (e *ChangeEvent) MarshalProto() ([]byte, error) {
+	m, err := e.Proto()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// protoRow converts the present columns of a row, or returns nil for the zero
+// Row. indexes, if not nil, are the indexes in the table of the row's
+// columns.
+func protoRow(r Row, indexes []int) (*binlogpb.Row, error) {
+	if r.Values == nil {
+		return nil, nil
+	}
+
+	m := &binlogpb.Row{}
+	for j, v := range r.Values {
+		if !v.IsPresent() {
+			continue
+		}
+
+		c := &binlogpb.Column{Index: uint32(j), Name: fmt.Sprintf("@%d", j+1), Type: uint32(v.tp)}
+		if j < len(indexes) {
+			c.Index = uint32(indexes[j])
+		}
+		if j < len(r.Names) {
+			c.Name = r.Names[j]
+		}
+		var err error
+		if c.Value, err = protoValue(v); err != nil {
+			return nil, fmt.Errorf("column %s: %v", c.Name, err)
+		}
+		m.Columns = append(m.Columns, c)
+	}
+	return m, nil
+}
+
+// protoValue converts a value as Proto describes.
+func protoValue(v Value) (*binlogpb.Value, error) {
+	var err error
+	m := &binlogpb.Value{}
+	switch v.Kind() {
+	case NullKind:
+		m.Kind = &binlogpb.Value_NullValue{NullValue: structpb.NullValue_NULL_VALUE}
+	case IntKind:
+		var i int64
+		i, err = v.Int64()
+		m.Kind = &binlogpb.Value_IntValue{IntValue: i}
+	case UintKind:
+		var u uint64
+		u, err = v.Uint64()
+		m.Kind = &binlogpb.Value_UintValue{UintValue: u}
+	case FloatKind:
+		var f float64
+		f, err = v.Float64()
+		m.Kind = &binlogpb.Value_FloatValue{FloatValue: f}
+	case DecimalKind:
+		var d string
+		d, err = v.Decimal()
+		m.Kind = &binlogpb.Value_DecimalValue{DecimalValue: d}
+	case TimeKind:
+		t, terr := v.Time()
+		if terr != nil {
+			s, ok := v.Interface().(string)
+			if !ok {
+				return nil, terr
+			}
+			m.Kind = &binlogpb.Value_ZeroDateValue{ZeroDateValue: s}
+			break
+		}
+		if v.tp != MYSQL_TYPE_TIMESTAMP && v.tp != MYSQL_TYPE_TIMESTAMP2 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		m.Kind = &binlogpb.Value_TimeValue{TimeValue: timestamppb.New(t)}
+	case DurationKind:
+		var d time.Duration
+		d, err = v.Duration()
+		m.Kind = &binlogpb.Value_DurationValue{DurationValue: durationpb.New(d)}
+	case StringKind:
+		m.Kind = &binlogpb.Value_StringValue{StringValue: v.String()}
+	case BytesKind:
+		var b []byte
+		b, err = v.Bytes()
+		m.Kind = &binlogpb.Value_BytesValue{BytesValue: b}
+	case JSONKind:
+		var doc []byte
+		doc, err = v.JSON()
+		m.Kind = &binlogpb.Value_JsonValue{JsonValue: string(doc)}
+	case JSONDiffKind:
+		var diffs []JSONDiff
+		diffs, err = v.JSONDiffs()
+		pb := &binlogpb.JsonDiffs{Diffs: make([]*binlogpb.JsonDiff, len(diffs))}
+		for i, d := range diffs {
+			pb.Diffs[i] = &binlogpb.JsonDiff{
+				Operation: binlogpb.JsonDiff_Operation(d.Operation),
+				Path:      string(d.Path),
+				Value:     string(d.Value),
+			}
+		}
+		m.Kind = &binlogpb.Value_JsonDiffsValue{JsonDiffsValue: pb}
+	case SetKind:
+		var labels []string
+		labels, err = v.Labels()
+		m.Kind = &binlogpb.Value_SetValue{SetValue: &binlogpb.Labels{Labels: labels}}
+	default:
+		return nil, fmt.Errorf("can't convert %s value", v.Kind())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// A ProtoConverter turns the rows of events into binlogpb.ChangeEvents, as a
+// ChangeStream turns them into ChangeEvents.
+type ProtoConverter struct {
+	tracker changeTracker
+}
+
+// NewProtoConverter names the columns of tables whose table maps don't by
+// schemas; see NewChangeStream.
+func NewProtoConverter(schemas func(database, table string) *TableSchema) *ProtoConverter {
+	return &ProtoConverter{tracker: changeTracker{schemas: schemas}}
+}
+
+// Convert returns the changes an event holds. Events must be passed in the
+// order they were streamed, for the converter to follow binlog positions and
+// transactions.
+func (c *ProtoConverter) Convert(e *EventContainer) ([]*binlogpb.ChangeEvent, error) {
+	changes, err := c.tracker.changes(e)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*binlogpb.ChangeEvent, len(changes))
+	for i, change := range changes {
+		if messages[i], err = change.Proto(); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// A ProtoEncoder writes changes as binlogpb.ChangeEvents, each after its size
+// as a varint, as protodelim and Java's writeDelimitedTo write messages.
+type ProtoEncoder struct {
+	w io.Writer
+}
+
+func NewProtoEncoder(w io.Writer) *ProtoEncoder {
+	return &ProtoEncoder{w: w}
+}
+
+// Encode writes a change; see ChangeEvent.Proto.
+func (enc *ProtoEncoder) Encode(e *ChangeEvent) error {
+	m, err := e.Proto()
+	if err != nil {
+		return err
+	}
+	_, err = protodelim.MarshalTo(enc.w, m)
+	return err
+}
+
+// EncodeStream writes the changes of a stream until it fails, and returns its
+// error, or the first error writing them.
+func (enc *ProtoEncoder) EncodeStream(s *ChangeStream) error {
+	for {
+		e, err := s.Next()
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+}
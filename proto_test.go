@@ -0,0 +1,166 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vsco/autobahn-binlog/binlogpb"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestChangeEventIsConvertedToProto(t *testing.T) {
+	changes, parsed := streamChanges(t, ParserOptions{ExactDecimals: true}, nil, changeTransactions(changeTable()))
+	require.Len(t, changes, 4)
+
+	m, err := changes[2].Proto()
+	require.NoError(t, err)
+	gtid := "30313233-3435-3637-3839-616263646566:23"
+	want := &binlogpb.ChangeEvent{
+		Source: &binlogpb.Source{
+			ServerId:  1,
+			File:      "mysql-bin.000003",
+			Pos:       parsed[6].Header.LogPos,
+			Gtid:      gtid,
+			Timestamp: &timestamppb.Timestamp{Seconds: 1600000000},
+		},
+		Table: &binlogpb.Table{Database: "shard767", Name: "uploads", TableId: 12},
+		Op:    binlogpb.Op_OP_UPDATE,
+		Before: &binlogpb.Row{Columns: []*binlogpb.Column{
+			{Index: 0, Name: "id", Type: uint32(MYSQL_TYPE_LONGLONG), Value: &binlogpb.Value{Kind: &binlogpb.Value_UintValue{UintValue: 2}}},
+			{Index: 1, Name: "name", Type: uint32(MYSQL_TYPE_VARCHAR),
+				Value: &binlogpb.Value{Kind: &binlogpb.Value_NullValue{NullValue: structpb.NullValue_NULL_VALUE}}},
+			{Index: 2, Name: "size", Type: uint32(MYSQL_TYPE_NEWDECIMAL),
+				Value: &binlogpb.Value{Kind: &binlogpb.Value_DecimalValue{DecimalValue: "-0.25"}}},
+			{Index: 3, Name: "data", Type: uint32(MYSQL_TYPE_BLOB),
+				Value: &binlogpb.Value{Kind: &binlogpb.Value_NullValue{NullValue: structpb.NullValue_NULL_VALUE}}},
+		}},
+		// Columns the row image leaves out are left out
+		After: &binlogpb.Row{Columns: []*binlogpb.Column{
+			{Index: 0, Name: "id", Type: uint32(MYSQL_TYPE_LONGLONG), Value: &binlogpb.Value{Kind: &binlogpb.Value_UintValue{UintValue: 2}}},
+			{Index: 2, Name: "size", Type: uint32(MYSQL_TYPE_NEWDECIMAL),
+				Value: &binlogpb.Value{Kind: &binlogpb.Value_DecimalValue{DecimalValue: "12345678.90"}}},
+		}},
+		Key: &binlogpb.Row{Columns: []*binlogpb.Column{
+			{Index: 0, Name: "id", Type: uint32(MYSQL_TYPE_LONGLONG), Value: &binlogpb.Value{Kind: &binlogpb.Value_UintValue{UintValue: 2}}},
+		}},
+		Transaction: &binlogpb.Transaction{Id: gtid, Sequence: 3},
+	}
+	assert.True(t, proto.Equal(want, m), "got %v", m)
+
+	// Binary encoding round trips
+	b, err := changes[2].MarshalProto()
+	require.NoError(t, err)
+	var decoded binlogpb.ChangeEvent
+	require.NoError(t, proto.Unmarshal(b, &decoded))
+	assert.True(t, proto.Equal(want, &decoded))
+
+	m, err = changes[3].Proto()
+	require.NoError(t, err)
+	assert.Equal(t, binlogpb.Op_OP_DELETE, m.Op)
+	assert.Nil(t, m.After)
+	assert.Equal(t, "", m.Source.Gtid)
+
+	_, err = (&ChangeEvent{Before: Row{Values: []Value{{kind: UintKind, v: "x", tp: MYSQL_TYPE_LONG}}}}).Proto()
+	assert.Error(t, err)
+}
+
+func TestProtoValues(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.FixedZone("", 3600))
+	wall := time.Date(2021, 3, 4, 5, 6, 7, 500000000, time.UTC)
+
+	for _, tc := range []struct {
+		v    Value
+		want *binlogpb.Value
+	}{
+		{NewValue(int8(-1), MYSQL_TYPE_TINY, 0, nil), &binlogpb.Value{Kind: &binlogpb.Value_IntValue{IntValue: -1}}},
+		{NewValue(int8(-1), MYSQL_TYPE_TINY, 0, &Column{Unsigned: true}),
+			&binlogpb.Value{Kind: &binlogpb.Value_UintValue{UintValue: 255}}},
+		{NewValue("2021", MYSQL_TYPE_YEAR, 0, nil), &binlogpb.Value{Kind: &binlogpb.Value_IntValue{IntValue: 2021}}},
+		{NewValue(float32(1.5), MYSQL_TYPE_FLOAT, 4, nil), &binlogpb.Value{Kind: &binlogpb.Value_FloatValue{FloatValue: 1.5}}},
+		{NewValue(1.5, MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 2), nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_DecimalValue{DecimalValue: "1.50"}}},
+		{NewValue("2021-03-04 05:06:07.5", MYSQL_TYPE_DATETIME2, 1, nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_TimeValue{TimeValue: timestamppb.New(wall)}}},
+		{NewValue(ts, MYSQL_TYPE_TIMESTAMP2, 2, nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_TimeValue{TimeValue: timestamppb.New(ts)}}},
+		{NewValue("0000-00-00", MYSQL_TYPE_DATE, 0, nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_ZeroDateValue{ZeroDateValue: "0000-00-00"}}},
+		{NewValue("-838:59:59", MYSQL_TYPE_TIME2, 0, nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_DurationValue{DurationValue: durationpb.New(-3020399 * time.Second)}}},
+		{NewValue("small", MYSQL_TYPE_ENUM, 1, nil), &binlogpb.Value{Kind: &binlogpb.Value_StringValue{StringValue: "small"}}},
+		{NewValue([]byte{0xff}, MYSQL_TYPE_BLOB, 2, nil), &binlogpb.Value{Kind: &binlogpb.Value_BytesValue{BytesValue: []byte{0xff}}}},
+		{NewValue([]byte(`{"a": 1}`), MYSQL_TYPE_JSON, 4, nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_JsonValue{JsonValue: `{"a": 1}`}}},
+		{NewValue([]JSONDiff{
+			{Operation: JSON_DIFF_INSERT, Path: []byte("$.a"), Value: []byte("1")},
+			{Operation: JSON_DIFF_REMOVE, Path: []byte("$.b")},
+		}, MYSQL_TYPE_JSON, 4, nil), &binlogpb.Value{Kind: &binlogpb.Value_JsonDiffsValue{JsonDiffsValue: &binlogpb.JsonDiffs{
+			Diffs: []*binlogpb.JsonDiff{
+				{Operation: binlogpb.JsonDiff_INSERT, Path: "$.a", Value: "1"},
+				{Operation: binlogpb.JsonDiff_REMOVE, Path: "$.b"},
+			}}}}},
+		{NewValue([]string{"a", "c"}, MYSQL_TYPE_SET, 1, nil),
+			&binlogpb.Value{Kind: &binlogpb.Value_SetValue{SetValue: &binlogpb.Labels{Labels: []string{"a", "c"}}}}},
+	} {
+		got, err := protoValue(tc.v)
+		if assert.NoError(t, err, "%v", tc.v) {
+			assert.True(t, proto.Equal(tc.want, got), "%v: got %v", tc.v, got)
+		}
+	}
+
+	_, err := protoValue(Value{})
+	assert.Error(t, err)
+}
+
+func TestProtoConverterConvertsEvents(t *testing.T) {
+	changes, parsed := streamChanges(t, ParserOptions{ExactDecimals: true}, nil, changeTransactions(changeTable()))
+
+	c := NewProtoConverter(nil)
+	var messages []*binlogpb.ChangeEvent
+	for _, e := range parsed {
+		m, err := c.Convert(e)
+		require.NoError(t, err)
+		messages = append(messages, m...)
+	}
+
+	require.Len(t, messages, len(changes))
+	for i, change := range changes {
+		want, err := change.Proto()
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(want, messages[i]), "%d", i)
+	}
+}
+
+func TestProtoEncoderWritesDelimitedMessages(t *testing.T) {
+	var b bytes.Buffer
+	enc := NewProtoEncoder(&b)
+
+	s := newStreamer()
+	for _, c := range parseChangeEvents(t, ParserOptions{ExactDecimals: true}, changeTransactions(changeTable())) {
+		s.ch <- c
+	}
+	s.closeWithError(errEndOfChanges)
+	assert.Equal(t, errEndOfChanges, enc.EncodeStream(NewChangeStream(s, nil)))
+
+	var ops []binlogpb.Op
+	r := bufio.NewReader(&b)
+	for {
+		var m binlogpb.ChangeEvent
+		err := protodelim.UnmarshalFrom(r, &m)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ops = append(ops, m.Op)
+	}
+	assert.Equal(t, []binlogpb.Op{binlogpb.Op_OP_CREATE, binlogpb.Op_OP_CREATE, binlogpb.Op_OP_UPDATE, binlogpb.Op_OP_DELETE}, ops)
+}
@@ -0,0 +1,169 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// An eventReader decodes the fields of an event body with bounds checks. The
+// first read that runs past the end of the body records an error, and every
+// read after it returns zero values, so a decoder can read a whole structure
+// and check err once at the end.
+type eventReader struct {
+	b   []byte
+	i   int
+	err error
+}
+
+func newEventReader(b []byte) *eventReader {
+	return &eventReader{b: b}
+}
+
+// A decodeError describes a malformed field at a byte offset in an event
+// body, and for row values the index of the column being decoded.
+type decodeError struct {
+	offset int
+	column int // -1 outside of row values
+	msg    string
+}
+
+func (e *decodeError) Error() string {
+	if e.column >= 0 {
+		return fmt.Sprintf("column %d: %s at offset %d", e.column, e.msg, e.offset)
+	}
+	return fmt.Sprintf("%s at offset %d", e.msg, e.offset)
+}
+
+// fail records an error at the current offset, unless one was recorded already.
+func (r *eventReader) fail(format string, args ...interface{}) {
+	r.failColumn(-1, format, args...)
+}
+
+func (r *eventReader) failColumn(column int, format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = &decodeError{offset: r.i, column: column, msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+// len returns the number of unread bytes.
+func (r *eventReader) len() int {
+	return len(r.b) - r.i
+}
+
+// bytes returns the next n bytes, or nil if there aren't that many.
+func (r *eventReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.len() {
+		r.fail("need %d bytes, have %d", n, r.len())
+		return nil
+	}
+
+	b := r.b[r.i : r.i+n]
+	r.i = r.i + n
+	return b
+}
+
+func (r *eventReader) skip(n int) {
+	r.bytes(n)
+}
+
+// rest returns all unread bytes.
+func (r *eventReader) rest() []byte {
+	return r.bytes(r.len())
+}
+
+func (r *eventReader) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *eventReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *eventReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *eventReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// uintN reads an n-byte little-endian integer.
+func (r *eventReader) uintN(n int) uint64 {
+	return getLittleEndianFixedLengthInt(r.bytes(n))
+}
+
+// lengthEncodedInt reads a packed integer (net_store_length).
+func (r *eventReader) lengthEncodedInt() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.len() < 1 {
+		r.fail("need a length-encoded integer, have 0 bytes")
+		return 0
+	}
+
+	switch r.b[r.i] {
+	case 0xfc:
+		r.skip(1)
+		return r.uintN(2)
+	case 0xfd:
+		r.skip(1)
+		return r.uintN(3)
+	case 0xfe:
+		r.skip(1)
+		return r.uint64()
+	default:
+		return uint64(r.uint8())
+	}
+}
+
+// lengthEncodedBytes reads a string prefixed with its packed length.
+func (r *eventReader) lengthEncodedBytes() []byte {
+	n := r.lengthEncodedInt()
+	if n > uint64(r.len()) {
+		r.fail("need %d bytes, have %d", n, r.len())
+		return nil
+	}
+	return r.bytes(int(n))
+}
+
+// nullTerminatedBytes reads a string up to a [00] byte, and skips the [00].
+func (r *eventReader) nullTerminatedBytes() []byte {
+	if r.err != nil {
+		return nil
+	}
+	for j := r.i; j < len(r.b); j++ {
+		if r.b[j] == 0 {
+			b := r.bytes(j - r.i)
+			r.skip(1)
+			return b
+		}
+	}
+	r.fail("unterminated string")
+	return nil
+}
+
+// sub returns a reader over the next n bytes and skips them. Offsets reported
+// by the sub-reader stay relative to the start of the body.
+func (r *eventReader) sub(n int) *eventReader {
+	start := r.i
+	if r.bytes(n) == nil && n != 0 {
+		return &eventReader{err: r.err}
+	}
+	return &eventReader{b: r.b[:start+n], i: start}
+}
@@ -0,0 +1,227 @@
+package binlog
+
+import "fmt"
+
+// lazyRows holds the row images of a rows event parsed with LazyRows, or
+// skipped, as they are in the event.
+type lazyRows struct {
+	b       []byte    // the event body
+	start   int       // offset of the first row image in b
+	bitmaps [2][]byte // the columns of the images, before projection
+	count   int       // the event's column count
+	update  bool      // images come in pairs of before and after images
+	partial bool      // after images may hold JSON diffs
+	decoder *rowDecoder
+}
+
+// A RowCursor steps through the row images of a rows event, in the order of
+// RowsEvent.Rows, decoding values only when they're asked for. Columns the
+// parser's Projection leaves out are missing from every image.
+//
+//	c := e.Cursor()
+//	for c.Next() {
+//		v, err := c.Value(0)
+//		...
+//	}
+//	if err := c.Err(); err != nil {
+//		...
+//	}
+type RowCursor struct {
+	rows  *lazyRows
+	r     *eventReader
+	index int // of the current image; -1 before the first
+	pair  int // offset of the current image, or of the before image of its pair
+
+	values []rowValue // of the current image, by column
+	before []rowValue // of the image before it
+}
+
+// A rowValue locates the value of a column in a row image.
+type rowValue struct {
+	present bool
+	null    bool
+	diff    bool   // a list of JSON diffs
+	offset  int    // in the event body
+	data    []byte // the encoded value
+}
+
+// Cursor returns a cursor over the rows of an event parsed with LazyRows, or
+// nil if they were decoded into Rows.
+func (e *RowsEvent) Cursor() *RowCursor {
+	if e.lazy == nil {
+		return nil
+	}
+
+	r := newEventReader(e.lazy.b)
+	r.i = e.lazy.start
+	return &RowCursor{
+		rows:   e.lazy,
+		r:      r,
+		index:  -1,
+		values: make([]rowValue, e.lazy.count),
+		before: make([]rowValue, e.lazy.count),
+	}
+}
+
+// Next steps to the next row image. It returns false at the end of the rows,
+// or if the image can't be read; Err tells the two apart.
+func (c *RowCursor) Next() bool {
+	if c.r.err != nil || c.r.len() == 0 {
+		return false
+	}
+
+	c.index++
+	isAfter := c.rows.update && c.index%2 == 1
+	if !isAfter {
+		c.pair = c.r.i
+	}
+	c.before, c.values = c.values, c.before
+
+	bitmap := c.rows.bitmaps[0]
+	if isAfter {
+		bitmap = c.rows.bitmaps[1]
+	}
+	c.scan(bitmap, isAfter && c.rows.partial)
+
+	if c.r.err == nil && (isAfter || !c.rows.update) && c.r.i == c.pair {
+		c.r.fail("%d trailing bytes after empty row image", c.r.len())
+	}
+	return c.r.err == nil
+}
+
+// scan locates the values of a row image, which is the after image of a
+// partial update if partial is set.
+func (c *RowCursor) scan(bitmap []byte, partial bool) {
+	r := c.r
+	table := c.rows.decoder.table
+
+	var partialBits []byte
+	if partial && r.lengthEncodedInt()&PARTIAL_JSON_UPDATES != 0 {
+		partialBits = r.bytes(bitmapByteSize(jsonColumnCount(table)))
+	}
+
+	nullBitmap := r.bytes(byteCountFromBitCount(bitCount(bitmap)))
+	nullBitIndex := 0
+	jsonIndex := 0
+
+	for j := range c.values {
+		c.values[j] = rowValue{}
+	}
+
+	for j := 0; j < c.rows.count && r.err == nil; j++ {
+		v := &c.values[j]
+		if partialBits != nil && table.ColumnTypes[j] == MYSQL_TYPE_JSON {
+			v.diff = getBit(partialBits, jsonIndex) != 0
+			jsonIndex++
+		}
+
+		if getBit(bitmap, j) == 0 {
+			continue
+		}
+		v.present = true
+
+		if getBit(nullBitmap, nullBitIndex) != 0 {
+			v.null = true
+			nullBitIndex = nullBitIndex + 1
+			continue
+		}
+
+		n, err := valueSize(r.b[r.i:], table.ColumnTypes[j], table.ColumnMetadata[j])
+		if err != nil {
+			r.failColumn(j, "%v", err)
+			return
+		}
+		v.offset = r.i
+		v.data = r.bytes(n)
+		nullBitIndex = nullBitIndex + 1
+	}
+}
+
+// Err returns the error that stopped Next, if any. Rows with values of types
+// the parser doesn't know stop it, as it can't tell where those values end.
+func (c *RowCursor) Err() error {
+	return c.r.err
+}
+
+// Index returns the index of the current image in the order of Rows.
+func (c *RowCursor) Index() int {
+	return c.index
+}
+
+// IsAfter reports whether the current image is the after image of an update.
+func (c *RowCursor) IsAfter() bool {
+	return c.rows.update && c.index%2 == 1
+}
+
+// IsPresent reports whether the current image holds column j.
+func (c *RowCursor) IsPresent(j int) bool {
+	return j >= 0 && j < len(c.values) && c.values[j].present && c.rows.decoder.decodes(j)
+}
+
+// IsNull reports whether the current image holds column j and it is NULL.
+func (c *RowCursor) IsNull(j int) bool {
+	return c.IsPresent(j) && c.values[j].null
+}
+
+// Value decodes the value of column j in the current image as the parser's
+// options say. It returns nil for NULLs and columns the image doesn't hold.
+func (c *RowCursor) Value(j int) (interface{}, error) {
+	if !c.IsPresent(j) {
+		return nil, nil
+	}
+	v, err := c.decode(c.values[j], j)
+	if err != nil {
+		return nil, err
+	}
+
+	o := c.rows.decoder.o
+	if !c.values[j].diff || o == nil || !o.ApplyJSONDiffs || !c.before[j].present {
+		return v, nil
+	}
+
+	// Apply the diffs to the document of the before image, as
+	// RowsEvent.ApplyJSONDiffs does
+	before, err := c.decode(c.before[j], j)
+	if err != nil {
+		return nil, err
+	}
+	document, ok := before.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("column %d: JSON diffs to a NULL document", j)
+	}
+	after, err := ApplyJSONDiffs(document, v.([]JSONDiff))
+	if err != nil {
+		return nil, fmt.Errorf("column %d: %v", j, err)
+	}
+	return after, nil
+}
+
+// decode decodes a value of column j.
+func (c *RowCursor) decode(v rowValue, j int) (interface{}, error) {
+	if v.null {
+		return nil, nil
+	}
+	value, _, err := c.rows.decoder.decode(v.data, j, v.diff)
+	if err != nil {
+		return nil, &decodeError{offset: v.offset, column: j, msg: err.Error()}
+	}
+	return value, nil
+}
+
+// Image decodes the current image, as RowsEvent.Image would return it.
+func (c *RowCursor) Image() (RowImage, error) {
+	bitmap := c.rows.decoder.project(c.rows.bitmaps[0])
+	if c.IsAfter() {
+		bitmap = c.rows.decoder.project(c.rows.bitmaps[1])
+	}
+
+	values := make([]interface{}, len(c.values))
+	for j := range values {
+		v, err := c.Value(j)
+		if err != nil {
+			return RowImage{}, err
+		}
+		values[j] = v
+	}
+	return RowImage{Values: values, Columns: bitmap, location: c.rows.decoder.o.stringLocation()}, nil
+}
@@ -0,0 +1,256 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueSizeAgreesWithParseValue(t *testing.T) {
+	for _, tc := range []struct {
+		tp   byte
+		meta uint16
+		v    interface{}
+	}{
+		{MYSQL_TYPE_LONG, 0, int32(7)},
+		{MYSQL_TYPE_LONGLONG, 0, int64(7)},
+		{MYSQL_TYPE_DOUBLE, 0, float64(1.5)},
+		{MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 2), float64(12.25)},
+		{MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(30, 12), float64(-1.5)},
+		{MYSQL_TYPE_BIT, 1<<8 | 2, int64(3)},
+		{MYSQL_TYPE_DATE, 0, "2020-01-02"},
+		{MYSQL_TYPE_YEAR, 0, "2020"},
+		{MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_ENUM)<<8 | 2, int64(300)},
+		{MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_SET)<<8 | 8, int64(1 << 40)},
+		{MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_STRING)<<8 | 40, "fixed"},
+		{MYSQL_TYPE_STRING, 0xce<<8 | 0xfc, "over 255"}, // CHAR(255) in utf8mb4
+		{MYSQL_TYPE_VARCHAR, 255, "short"},
+		{MYSQL_TYPE_VARCHAR, 1024, "long"},
+		{MYSQL_TYPE_BLOB, 2, []byte("blob")},
+		{MYSQL_TYPE_LONG_BLOB, 4, []byte("long blob")},
+		{MYSQL_TYPE_JSON, 4, []byte(`{"a": [1, 2]}`)},
+	} {
+		w := new(eventWriter)
+		require.NoError(t, encodeValue(w, tc.tp, tc.meta, tc.v), "type %d", tc.tp)
+		data := append(w.b, 0xff) // sizes mustn't depend on what follows
+
+		_, n, err := parseValue(data, tc.tp, tc.meta)
+		require.NoError(t, err, "type %d", tc.tp)
+		size, err := valueSize(data, tc.tp, tc.meta)
+		require.NoError(t, err, "type %d", tc.tp)
+		assert.Equal(t, len(w.b), n, "type %d", tc.tp)
+		assert.Equal(t, n, size, "type %d", tc.tp)
+
+		_, err = valueSize(w.b[:len(w.b)-1], tc.tp, tc.meta)
+		assert.Error(t, err, "type %d", tc.tp)
+	}
+
+	for _, tc := range []struct {
+		tp   byte
+		meta uint16
+		size int
+	}{
+		{MYSQL_TYPE_NULL, 0, 0},
+		{MYSQL_TYPE_TIMESTAMP2, 0, 4},
+		{MYSQL_TYPE_TIMESTAMP2, 6, 7},
+		{MYSQL_TYPE_DATETIME2, 3, 7},
+		{MYSQL_TYPE_TIME2, 1, 4},
+	} {
+		size, err := valueSize(make([]byte, 8), tc.tp, tc.meta)
+		require.NoError(t, err)
+		assert.Equal(t, tc.size, size, "type %d", tc.tp)
+	}
+
+	_, err := valueSize(make([]byte, 8), MYSQL_TYPE_DECIMAL, 0)
+	assert.Equal(t, unknownTypeError(MYSQL_TYPE_DECIMAL), err)
+}
+
+func cursorTable() *TableMapEvent {
+	return &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    4,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_BLOB},
+		ColumnMetadata: []uint16{0, 255, metaFromPrecAndDec(10, 2), 2},
+		NullBitVector:  []byte{0x0e},
+	}
+}
+
+func cursorUpdate() *RowsEvent {
+	return &RowsEvent{
+		TableID:       12,
+		ColumnCount:   4,
+		ColumnBitmap1: []byte{0x0f},
+		ColumnBitmap2: []byte{0x0b},
+		Rows: [][]interface{}{
+			{int64(1), "before", float64(1.5), []byte("blob")},
+			{int64(1), nil, nil, []byte("new blob")},
+			{int64(2), nil, float64(-2.25), nil},
+			{int64(2), "after", nil, nil},
+		},
+	}
+}
+
+// parseUpdate encodes a table map and an update of the table and parses them
+// with the options.
+func parseUpdate(t *testing.T, o ParserOptions, tme *TableMapEvent, update *RowsEvent) *EventContainer {
+	enc := NewBinlogEncoder()
+	p := NewBinlogParserWithOptions(o)
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{UPDATE_ROWS_EVENT_V2, update},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+	return parsed
+}
+
+// cursorImages reads all the images of a cursor.
+func cursorImages(t *testing.T, c *RowCursor) []RowImage {
+	var images []RowImage
+	for c.Next() {
+		assert.Equal(t, len(images), c.Index())
+		image, err := c.Image()
+		require.NoError(t, err)
+		images = append(images, image)
+	}
+	require.NoError(t, c.Err())
+	return images
+}
+
+func TestLazyRowsAreDecodedByTheirCursor(t *testing.T) {
+	eager := parseUpdate(t, ParserOptions{}, cursorTable(), cursorUpdate()).Event.(*RowsEvent)
+	parsed := parseUpdate(t, ParserOptions{LazyRows: true}, cursorTable(), cursorUpdate())
+	lazy := parsed.Event.(*RowsEvent)
+
+	assert.Nil(t, eager.Cursor())
+	assert.Nil(t, lazy.Rows)
+	assert.False(t, lazy.Skipped)
+	assert.Equal(t, eager.Images(), cursorImages(t, lazy.Cursor()))
+
+	c := lazy.Cursor()
+	require.True(t, c.Next())
+	assert.False(t, c.IsAfter())
+	v, err := c.Value(1)
+	require.NoError(t, err)
+	assert.Equal(t, "before", v)
+
+	require.True(t, c.Next())
+	assert.True(t, c.IsAfter())
+	assert.True(t, c.IsNull(1))
+	assert.False(t, c.IsPresent(2))
+	v, err = c.Value(2)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	// Lazy events encode back to the bytes they were parsed from.
+	b, err := NewBinlogEncoder().Encode(parsed.Header, lazy)
+	require.NoError(t, err)
+	assert.Equal(t, parsed.Bytes[EventHeaderSize:], b[EventHeaderSize:])
+}
+
+func TestLazyPartialUpdatesApplyJSONDiffs(t *testing.T) {
+	tme, e := testPartialUpdate()
+	events := encodePartialUpdate(t, tme, e)
+
+	for _, o := range []ParserOptions{{}, {ApplyJSONDiffs: true}} {
+		var eager, lazy *EventContainer
+		eagerParser := NewBinlogParserWithOptions(o)
+		o.LazyRows = true
+		lazyParser := NewBinlogParserWithOptions(o)
+		for _, b := range events {
+			var err error
+			eager, err = eagerParser.Parse(b)
+			require.NoError(t, err)
+			lazy, err = lazyParser.Parse(b)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, eager.Event.(*RowsEvent).Images(), cursorImages(t, lazy.Event.(*RowsEvent).Cursor()))
+	}
+}
+
+func TestProjectionLeavesColumnsOutOfImages(t *testing.T) {
+	var tables []string
+	projection := func(database, table string) []int {
+		tables = append(tables, database+"."+table)
+		return []int{0, 2, 9}
+	}
+
+	e := parseUpdate(t, ParserOptions{Projection: projection}, cursorTable(), cursorUpdate()).Event.(*RowsEvent)
+	assert.Equal(t, []string{"shard767.uploads"}, tables)
+	assert.Equal(t, []byte{0x05}, e.ColumnBitmap1)
+	assert.Equal(t, []byte{0x01}, e.ColumnBitmap2)
+	assert.Equal(t, [][]interface{}{
+		{int64(1), nil, float64(1.5), nil},
+		{int64(1), nil, nil, nil},
+		{int64(2), nil, float64(-2.25), nil},
+		{int64(2), nil, nil, nil},
+	}, e.Rows)
+	assert.False(t, e.Image(1).IsPresent(2))
+
+	lazy := parseUpdate(t, ParserOptions{Projection: projection, LazyRows: true}, cursorTable(), cursorUpdate()).Event.(*RowsEvent)
+	assert.Equal(t, e.ColumnBitmap1, lazy.ColumnBitmap1)
+	assert.Equal(t, e.Images(), cursorImages(t, lazy.Cursor()))
+}
+
+func TestRowsEventsOfIgnoredTablesAreSkipped(t *testing.T) {
+	o := ParserOptions{
+		DecodeCharsets: true,
+		Projection: func(database, table string) []int {
+			if table == "uploads" {
+				return []int{}
+			}
+			return nil
+		},
+		Schemas: func(database, table string) *TableSchema {
+			t.Errorf("schema of skipped table %s.%s looked up", database, table)
+			return nil
+		},
+	}
+
+	parsed := parseUpdate(t, o, cursorTable(), cursorUpdate())
+	e := parsed.Event.(*RowsEvent)
+	assert.True(t, e.Skipped)
+	assert.Nil(t, e.Rows)
+	assert.Equal(t, []byte{0x00}, e.ColumnBitmap1)
+
+	b, err := NewBinlogEncoder().Encode(parsed.Header, e)
+	require.NoError(t, err)
+	assert.Equal(t, parsed.Bytes[EventHeaderSize:], b[EventHeaderSize:])
+
+	o.Projection = nil
+	o.Schemas = nil
+	assert.False(t, parseUpdate(t, o, cursorTable(), cursorUpdate()).Event.(*RowsEvent).Skipped)
+}
+
+func TestCursorReportsUndecodableValues(t *testing.T) {
+	parsed := parseUpdate(t, ParserOptions{LazyRows: true}, cursorTable(), cursorUpdate())
+	e := parsed.Event.(*RowsEvent)
+
+	// Change the decimal's scale to one its precision can't hold
+	e.lazy.decoder.table.ColumnMetadata[2] = metaFromPrecAndDec(1, 2)
+	c := e.Cursor()
+	assert.False(t, c.Next())
+	assert.Error(t, c.Err())
+
+	// Take the blobs for JSON documents, which are as long but don't decode
+	e.lazy.decoder.table.ColumnMetadata[2] = metaFromPrecAndDec(10, 2)
+	e.lazy.decoder.table.ColumnTypes[3] = MYSQL_TYPE_JSON
+	c = e.Cursor()
+	require.True(t, c.Next())
+	_, err := c.Value(0)
+	assert.NoError(t, err)
+	_, err = c.Image()
+	assert.Error(t, err)
+}
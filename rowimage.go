@@ -0,0 +1,121 @@
+package binlog
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+)
+
+// A RowImage is one image of a row in a RowsEvent. With binlog_row_image set
+// to MINIMAL or NOBLOB the server leaves columns out of the images, and those
+// are nil in the row like SQL NULLs; Columns tells the two apart.
+type RowImage struct {
+	Values  []interface{}
+	Columns []byte // bitmap of the columns the image holds
+
+	location *time.Location // temporal strings are shown in, or nil
+}
+
+// IsPresent reports whether the image holds column j.
+func (r RowImage) IsPresent(j int) bool {
+	return j >= 0 && j < len(r.Values) && j/8 < len(r.Columns) && getBit(r.Columns, j) != 0
+}
+
+// IsNull reports whether the image holds column j and it is NULL.
+func (r RowImage) IsNull(j int) bool {
+	return r.IsPresent(j) && r.Values[j] == nil
+}
+
+// Value returns the value of column j and whether the image holds it.
+func (r RowImage) Value(j int) (interface{}, bool) {
+	if !r.IsPresent(j) {
+		return nil, false
+	}
+	return r.Values[j], true
+}
+
+// PresentColumns returns the indexes of the columns the image holds.
+func (r RowImage) PresentColumns() []int {
+	var columns []int
+	for j := range r.Values {
+		if r.IsPresent(j) {
+			columns = append(columns, j)
+		}
+	}
+	return columns
+}
+
+// A RowUpdate pairs the before and after images of an updated row.
+type RowUpdate struct {
+	Before RowImage
+	After  RowImage
+}
+
+// ChangedColumns returns the indexes of the columns the update changed: those
+// in the after image that aren't in the before image, or hold another value
+// there. Columns missing from the after image weren't changed, as MINIMAL and
+// NOBLOB images only leave out unchanged columns.
+func (u RowUpdate) ChangedColumns() []int {
+	var columns []int
+	for j := range u.After.Values {
+		if !u.After.IsPresent(j) {
+			continue
+		}
+		before, ok := u.Before.Value(j)
+		if !ok || !valuesEqual(before, u.After.Values[j]) {
+			columns = append(columns, j)
+		}
+	}
+	return columns
+}
+
+// valuesEqual reports whether two decoded column values are the same.
+func valuesEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case []byte:
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// IsUpdate reports whether the rows of e are pairs of before and after images.
+func (e *RowsEvent) IsUpdate() bool {
+	return e.ColumnBitmap2 != nil
+}
+
+// Image returns row i of e with the columns its image holds: those in
+// ColumnBitmap1, or for the after images of updates ColumnBitmap2.
+func (e *RowsEvent) Image(i int) RowImage {
+	bitmap := e.ColumnBitmap1
+	if e.IsUpdate() && i%2 == 1 {
+		bitmap = e.ColumnBitmap2
+	}
+	return RowImage{Values: e.Rows[i], Columns: bitmap, location: e.location}
+}
+
+// Images returns all the rows of e as images.
+func (e *RowsEvent) Images() []RowImage {
+	images := make([]RowImage, len(e.Rows))
+	for i := range e.Rows {
+		images[i] = e.Image(i)
+	}
+	return images
+}
+
+// Updates pairs the before and after images of the rows of an update; it
+// returns nil for other events.
+func (e *RowsEvent) Updates() []RowUpdate {
+	if !e.IsUpdate() {
+		return nil
+	}
+
+	updates := make([]RowUpdate, 0, len(e.Rows)/2)
+	for i := 0; i+1 < len(e.Rows); i = i + 2 {
+		updates = append(updates, RowUpdate{Before: e.Image(i), After: e.Image(i + 1)})
+	}
+	return updates
+}
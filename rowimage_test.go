@@ -0,0 +1,117 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowImageTellsAbsentColumnsFromNulls(t *testing.T) {
+	image := RowImage{Values: []interface{}{int64(1), nil, nil}, Columns: []byte{0x03}}
+
+	assert.True(t, image.IsPresent(0))
+	assert.True(t, image.IsPresent(1))
+	assert.False(t, image.IsPresent(2))
+	assert.False(t, image.IsPresent(3))
+	assert.False(t, image.IsPresent(-1))
+
+	assert.False(t, image.IsNull(0))
+	assert.True(t, image.IsNull(1))
+	assert.False(t, image.IsNull(2))
+
+	v, ok := image.Value(1)
+	assert.True(t, ok)
+	assert.Nil(t, v)
+	_, ok = image.Value(2)
+	assert.False(t, ok)
+
+	assert.Equal(t, []int{0, 1}, image.PresentColumns())
+}
+
+func TestChangedColumns(t *testing.T) {
+	ts := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		update RowUpdate
+		want   []int
+	}{
+		{"full", RowUpdate{
+			Before: RowImage{Values: []interface{}{int64(1), "a", []byte("x"), ts, nil}, Columns: []byte{0x1f}},
+			After:  RowImage{Values: []interface{}{int64(1), "b", []byte("x"), ts.In(time.Local), int64(2)}, Columns: []byte{0x1f}},
+		}, []int{1, 4}},
+		{"minimal", RowUpdate{
+			Before: RowImage{Values: []interface{}{int64(1), nil, nil}, Columns: []byte{0x01}},
+			After:  RowImage{Values: []interface{}{nil, nil, "c"}, Columns: []byte{0x06}},
+		}, []int{1, 2}},
+		{"noblob", RowUpdate{
+			Before: RowImage{Values: []interface{}{int64(1), "a", nil}, Columns: []byte{0x03}},
+			After:  RowImage{Values: []interface{}{int64(1), "a", nil}, Columns: []byte{0x03}},
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.update.ChangedColumns(), tt.name)
+	}
+}
+
+func TestMinimalUpdateImagesAreParsed(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    3,
+		ColumnTypes:    []byte{MYSQL_TYPE_LONGLONG, MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VARCHAR},
+		ColumnMetadata: []uint16{0, 255, 255},
+		NullBitVector:  []byte{0x06},
+	}
+	update := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   3,
+		ColumnBitmap1: []byte{0x01},
+		ColumnBitmap2: []byte{0x06},
+		Rows: [][]interface{}{
+			{int64(1), nil, nil},
+			{nil, nil, "renamed"},
+		},
+	}
+
+	enc := NewBinlogEncoder()
+	p := NewBinlogParser()
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{UPDATE_ROWS_EVENT_V2, update},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+
+	re := parsed.Event.(*RowsEvent)
+	assert.True(t, re.IsUpdate())
+
+	updates := re.Updates()
+	require.Len(t, updates, 1)
+	assert.Equal(t, []int{0}, updates[0].Before.PresentColumns())
+	assert.Equal(t, []int{1, 2}, updates[0].After.PresentColumns())
+	assert.True(t, updates[0].After.IsNull(1))
+	assert.Equal(t, []int{1, 2}, updates[0].ChangedColumns())
+
+	assert.Len(t, re.Images(), 2)
+}
+
+func TestUpdatesOfOtherRowsEventsAreNil(t *testing.T) {
+	e := &RowsEvent{ColumnCount: 1, ColumnBitmap1: []byte{0x01}, Rows: [][]interface{}{{int64(1)}}}
+
+	assert.False(t, e.IsUpdate())
+	assert.Nil(t, e.Updates())
+	assert.Equal(t, RowImage{Values: []interface{}{int64(1)}, Columns: []byte{0x01}}, e.Image(0))
+}
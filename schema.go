@@ -0,0 +1,543 @@
+package binlog
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Column describes one table column as reported by information_schema.
+type Column struct {
+	Name       string
+	DataType   string // e.g. "varchar"
+	ColumnType string // e.g. "varchar(255)", "int(10) unsigned", "enum('a','b')"
+	Nullable   bool
+	Unsigned   bool
+	Charset    string
+	Collation  string
+	Values     []string // ENUM and SET members, in definition order
+	Type       byte     // binlog column type (MYSQL_TYPE_*)
+	Metadata   uint16   // binlog column metadata, as TableMapEvent.ColumnMetadata
+}
+
+// A TableSchema describes a table's columns and primary key.
+type TableSchema struct {
+	Schema     string
+	Name       string
+	Columns    []*Column
+	PrimaryKey []int // indexes into Columns, in key order
+	UniqueKey  []int // a unique key of NOT NULL columns, for tables without a primary key
+}
+
+const columnsQuery = "SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, CHARACTER_SET_NAME, COLLATION_NAME, " +
+	"CHARACTER_OCTET_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE " +
+	"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s ORDER BY ORDINAL_POSITION"
+
+const primaryKeyQuery = "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE " +
+	"WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION"
+
+const uniqueKeysQuery = "SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS " +
+	"WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s AND NON_UNIQUE = 0 ORDER BY INDEX_NAME, SEQ_IN_INDEX"
+
+// loadTableSchema reads a table's definition from information_schema.
+func loadTableSchema(c *Conn, schema, table string) (*TableSchema, error) {
+	result, err := c.execute(fmt.Sprintf(columnsQuery, quoteString(schema), quoteString(table)))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TableSchema{Schema: schema, Name: table}
+	if t.Columns, err = parseColumns(result); err != nil {
+		return nil, err
+	}
+	if len(t.Columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s does not exist", schema, table)
+	}
+
+	if result, err = c.execute(fmt.Sprintf(primaryKeyQuery, quoteString(schema), quoteString(table))); err != nil {
+		return nil, err
+	}
+
+	keyColumns, err := columnStrings(result, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range keyColumns {
+		i := t.ColumnIndex(name)
+		if i < 0 {
+			return nil, fmt.Errorf("primary key column %s not found in %s.%s", name, schema, table)
+		}
+		t.PrimaryKey = append(t.PrimaryKey, i)
+	}
+
+	if len(t.PrimaryKey) == 0 {
+		if result, err = c.execute(fmt.Sprintf(uniqueKeysQuery, quoteString(schema), quoteString(table))); err != nil {
+			return nil, err
+		}
+		if t.UniqueKey, err = t.parseUniqueKey(result); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// parseUniqueKey picks the first of the unique keys listed by uniqueKeysQuery
+// whose columns are all NOT NULL, as such a key identifies rows as well as a
+// primary key does. It returns nil if there is none.
+func (t *TableSchema) parseUniqueKey(r *Result) ([]int, error) {
+	if r.Resultset == nil {
+		return nil, nil
+	}
+
+	var key []int
+	var name string
+	usable := false
+	for i := range r.Values {
+		index, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+		column, err := r.GetString(i, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if index != name {
+			if usable {
+				return key, nil
+			}
+			key, name, usable = nil, index, true
+		}
+
+		j := t.ColumnIndex(column)
+		if j < 0 || t.Columns[j].Nullable {
+			usable = false
+			continue
+		}
+		key = append(key, j)
+	}
+
+	if usable {
+		return key, nil
+	}
+	return nil, nil
+}
+
+// chunkKey returns the columns snapshots read the table in order of: its
+// primary key, or failing that its unique key.
+func (t *TableSchema) chunkKey() []int {
+	if len(t.PrimaryKey) > 0 {
+		return t.PrimaryKey
+	}
+	return t.UniqueKey
+}
+
+func parseColumns(r *Result) ([]*Column, error) {
+	if r.Resultset == nil {
+		return nil, errors.New("information_schema query returned no result set")
+	}
+
+	columns := make([]*Column, len(r.Values))
+	for i := range r.Values {
+		var s [6]string
+		for j := range s {
+			var err error
+			if s[j], err = r.GetString(i, j); err != nil {
+				return nil, err
+			}
+		}
+
+		var n [3]uint64
+		for j := range n {
+			var err error
+			if n[j], err = r.GetUint64(i, len(s)+j); err != nil {
+				return nil, err
+			}
+		}
+
+		c := &Column{
+			Name:       s[0],
+			DataType:   strings.ToLower(s[1]),
+			ColumnType: s[2],
+			Nullable:   s[3] == "YES",
+			Charset:    s[4],
+			Collation:  s[5],
+		}
+		c.Unsigned = strings.Contains(strings.ToLower(c.ColumnType), "unsigned")
+		if c.DataType == "enum" || c.DataType == "set" {
+			c.Values = parseEnumValues(c.ColumnType)
+		}
+		c.Type, c.Metadata = binlogColumnType(c, n[0], n[1], n[2])
+
+		columns[i] = c
+	}
+
+	return columns, nil
+}
+
+// ColumnIndex returns the index of the named column, or -1.
+func (t *TableSchema) ColumnIndex(name string) int {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// binlogColumnType works out the type and metadata MySQL would write for c
+// in a TableMapEvent.
+func binlogColumnType(c *Column, octetLength, precision, scale uint64) (byte, uint16) {
+	switch c.DataType {
+	case "tinyint", "bool", "boolean":
+		return MYSQL_TYPE_TINY, 0
+	case "smallint":
+		return MYSQL_TYPE_SHORT, 0
+	case "mediumint":
+		return MYSQL_TYPE_INT24, 0
+	case "int", "integer":
+		return MYSQL_TYPE_LONG, 0
+	case "bigint":
+		return MYSQL_TYPE_LONGLONG, 0
+	case "decimal", "numeric":
+		return MYSQL_TYPE_NEWDECIMAL, uint16(precision<<8 | scale)
+	case "float":
+		return MYSQL_TYPE_FLOAT, 4
+	case "double", "real":
+		return MYSQL_TYPE_DOUBLE, 8
+	case "bit":
+		bits := precision
+		return MYSQL_TYPE_BIT, uint16((bits/8)<<8 | bits%8)
+	case "date":
+		return MYSQL_TYPE_DATE, 0
+	case "time":
+		return MYSQL_TYPE_TIME2, uint16(fractionalSecondsPrecision(c.ColumnType))
+	case "datetime":
+		return MYSQL_TYPE_DATETIME2, uint16(fractionalSecondsPrecision(c.ColumnType))
+	case "timestamp":
+		return MYSQL_TYPE_TIMESTAMP2, uint16(fractionalSecondsPrecision(c.ColumnType))
+	case "year":
+		return MYSQL_TYPE_YEAR, 0
+	case "char", "binary":
+		return MYSQL_TYPE_STRING, stringColumnMetadata(MYSQL_TYPE_STRING, octetLength)
+	case "varchar", "varbinary":
+		return MYSQL_TYPE_VARCHAR, uint16(octetLength)
+	case "tinyblob", "tinytext":
+		return MYSQL_TYPE_BLOB, 1
+	case "blob", "text":
+		return MYSQL_TYPE_BLOB, 2
+	case "mediumblob", "mediumtext":
+		return MYSQL_TYPE_BLOB, 3
+	case "enum":
+		packLength := uint64(1)
+		if len(c.Values) > 255 {
+			packLength = 2
+		}
+		return MYSQL_TYPE_STRING, stringColumnMetadata(MYSQL_TYPE_ENUM, packLength)
+	case "set":
+		return MYSQL_TYPE_STRING, stringColumnMetadata(MYSQL_TYPE_SET, uint64(setPackLength(len(c.Values))))
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon",
+		"geometrycollection", "geomcollection":
+		return MYSQL_TYPE_GEOMETRY, 4
+	case "json":
+		return MYSQL_TYPE_JSON, 4
+	default: // longblob, longtext and anything else stored as a blob
+		return MYSQL_TYPE_BLOB, 4
+	}
+}
+
+// stringColumnMetadata packs a MYSQL_TYPE_STRING column's real type and byte
+// length the way MySQL does; lengths above 255 borrow two bits of the type byte.
+func stringColumnMetadata(realType byte, length uint64) uint16 {
+	b0 := realType ^ byte((length&0x300)>>4)
+	b1 := byte(length & 0xFF)
+	return uint16(b0)<<8 | uint16(b1)
+}
+
+func setPackLength(members int) int {
+	n := (members + 7) / 8
+	if n > 4 {
+		return 8
+	}
+	if n == 3 {
+		return 4
+	}
+	return n
+}
+
+// fractionalSecondsPrecision returns the fsp of a temporal COLUMN_TYPE such as
+// "datetime(6)".
+func fractionalSecondsPrecision(columnType string) int {
+	i := strings.IndexByte(columnType, '(')
+	j := strings.IndexByte(columnType, ')')
+	if i < 0 || j < i {
+		return 0
+	}
+
+	fsp, err := strconv.Atoi(columnType[i+1 : j])
+	if err != nil {
+		return 0
+	}
+	return fsp
+}
+
+// parseEnumValues extracts the members of an ENUM or SET COLUMN_TYPE such as
+// "enum('a','b')". Quotes inside members are doubled.
+func parseEnumValues(columnType string) []string {
+	var values []string
+
+	i := strings.IndexByte(columnType, '(')
+	if i < 0 {
+		return nil
+	}
+
+	var cur []byte
+	inQuote := false
+	for i = i + 1; i < len(columnType); i++ {
+		ch := columnType[i]
+		switch {
+		case inQuote && ch == '\'' && i+1 < len(columnType) && columnType[i+1] == '\'':
+			cur = append(cur, '\'')
+			i++
+		case ch == '\'':
+			inQuote = !inQuote
+			if !inQuote {
+				values = append(values, string(cur))
+				cur = cur[:0]
+			}
+		case inQuote:
+			cur = append(cur, ch)
+		}
+	}
+
+	return values
+}
+
+// tableMapEvent builds a TableMapEvent equivalent to the one MySQL would log
+// for the table.
+func (t *TableSchema) tableMapEvent(tableID uint64) *TableMapEvent {
+	e := &TableMapEvent{
+		TableID:        tableID,
+		DatabaseName:   []byte(t.Schema),
+		TableName:      []byte(t.Name),
+		ColumnCount:    uint64(len(t.Columns)),
+		ColumnTypes:    make([]byte, len(t.Columns)),
+		ColumnMetadata: make([]uint16, len(t.Columns)),
+		NullBitVector:  make([]byte, bitmapByteSize(len(t.Columns))),
+	}
+
+	e.ColumnUnsigned = make([]bool, len(t.Columns))
+	e.ColumnNames = make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		e.ColumnTypes[i] = c.Type
+		e.ColumnMetadata[i] = c.Metadata
+		if c.Nullable {
+			e.NullBitVector[i/8] |= 1 << uint(i%8)
+		}
+		e.ColumnUnsigned[i] = c.Unsigned
+		e.ColumnNames[i] = c.Name
+	}
+	if len(t.PrimaryKey) > 0 {
+		e.PrimaryKey = append([]int(nil), t.PrimaryKey...)
+	}
+
+	return e
+}
+
+// valueFromText converts a value read over the text protocol into the same Go
+// type that parseValue produces for the column in a rows event, so snapshot
+// rows and binlog rows look alike. Temporal values are expected in UTC.
+func (c *Column) valueFromText(b []byte) (interface{}, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	s := string(b)
+
+	switch c.DataType {
+	case "enum":
+		for i, v := range c.Values {
+			if v == s {
+				return int64(i + 1), nil
+			}
+		}
+		return int64(0), nil
+	case "set":
+		var bits int64
+		if s != "" {
+			for _, member := range strings.Split(s, ",") {
+				for i, v := range c.Values {
+					if v == member {
+						bits |= 1 << uint(i)
+					}
+				}
+			}
+		}
+		return bits, nil
+	}
+
+	switch c.Type {
+	case MYSQL_TYPE_TINY:
+		n, err := parseTextInt(s)
+		return int8(n), err
+	case MYSQL_TYPE_SHORT:
+		n, err := parseTextInt(s)
+		return int16(n), err
+	case MYSQL_TYPE_INT24:
+		n, err := parseTextInt(s)
+		return getBinaryInt24(putBinaryUint32(uint32(n))[:3]), err
+	case MYSQL_TYPE_LONG:
+		n, err := parseTextInt(s)
+		return int32(n), err
+	case MYSQL_TYPE_LONGLONG:
+		return parseTextInt(s)
+	case MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_DOUBLE:
+		return strconv.ParseFloat(s, 64)
+	case MYSQL_TYPE_FLOAT:
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case MYSQL_TYPE_BIT:
+		return int64(getBigEndianFixedLengthInt(b)), nil
+	case MYSQL_TYPE_TIMESTAMP2:
+		if strings.HasPrefix(s, "0000-00-00") {
+			return "0000-00-00 00:00:00", nil
+		}
+		t, err := time.ParseInLocation(TimeFormat, truncateFraction(s), time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		return t.Local().Format(TimeFormat), nil
+	case MYSQL_TYPE_DATETIME2, MYSQL_TYPE_TIME2:
+		return truncateFraction(s), nil
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_YEAR, MYSQL_TYPE_STRING, MYSQL_TYPE_VARCHAR:
+		return s, nil
+	default:
+		v := make([]byte, len(b))
+		copy(v, b)
+		return v, nil
+	}
+}
+
+// valueFromText converts a value read over the text protocol as
+// Column.valueFromText does, then decodes temporal, character, DECIMAL, ENUM,
+// SET, BIT and GEOMETRY values as the options say, as a BinlogParser with them
+// would.
+func (o *ParserOptions) valueFromText(c *Column, b []byte) (interface{}, error) {
+	v, err := c.valueFromText(b)
+	if o != nil && o.DecodeCharsets && v != nil && isCharacterColumn(c.Type, c.Metadata) {
+		// Text arrives in the connection's character set, UTF-8.
+		if c.Charset == "" {
+			return append([]byte(nil), b...), err
+		}
+		return string(b), err
+	}
+	if o != nil && v != nil && err == nil {
+		switch {
+		case o.DecodeEnums && c.DataType == "enum":
+			return enumLabel(v, c.Values)
+		case o.DecodeEnums && c.DataType == "set":
+			return setLabels(v, c.Values)
+		case o.ExactDecimals && c.Type == MYSQL_TYPE_NEWDECIMAL:
+			return string(b), nil
+		case o.BitStrings && c.Type == MYSQL_TYPE_BIT:
+			return formatBits(v.(int64), c.Metadata), nil
+		case o.Geometry != GeometryWKB && c.Type == MYSQL_TYPE_GEOMETRY:
+			return formatGeometry(v.([]byte), o.Geometry)
+		}
+	}
+	s, ok := v.(string)
+	if o == nil || err != nil || !ok {
+		return v, err
+	}
+
+	isTimestamp := c.Type == MYSQL_TYPE_TIMESTAMP || c.Type == MYSQL_TYPE_TIMESTAMP2
+	switch c.Type {
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_DATETIME, MYSQL_TYPE_DATETIME2, MYSQL_TYPE_DATE:
+		if len(s) >= 10 && (s[5:7] == "00" || s[8:10] == "00") {
+			return o.zeroDate(s)
+		}
+		if !o.ParseTime && !(isTimestamp && o.Location != nil) {
+			return s, nil
+		}
+
+		// Parse the text as read, with its fraction; timestamps are read in UTC.
+		layout := TimeFormat
+		if c.Type == MYSQL_TYPE_DATE {
+			layout = "2006-01-02"
+		}
+		loc := o.dateLocation()
+		if isTimestamp {
+			loc = time.UTC
+		}
+		t, err := time.ParseInLocation(layout, string(b), loc)
+		if err != nil {
+			return nil, err
+		}
+
+		if isTimestamp {
+			tl := o.Location
+			if tl == nil {
+				tl = time.Local
+			}
+			t = t.In(tl)
+			if !o.ParseTime {
+				return t.Format(TimeFormat), nil
+			}
+		}
+		return t, nil
+	case MYSQL_TYPE_TIME, MYSQL_TYPE_TIME2:
+		if o.ParseTime {
+			return parseTimeValue(string(b))
+		}
+	case MYSQL_TYPE_YEAR:
+		if o.ParseTime {
+			return strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return v, nil
+}
+
+// parseTextInt parses a signed or unsigned integer; unsigned values that don't
+// fit an int64 wrap around, as they do when read from a rows event.
+func parseTextInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return n, nil
+	}
+
+	u, uerr := strconv.ParseUint(s, 10, 64)
+	if uerr != nil {
+		return 0, err
+	}
+	return int64(u), nil
+}
+
+func truncateFraction(s string) string {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// quoteIdentifier quotes a schema, table or column name for use in a query.
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteString quotes a string literal for use in a query. It's written as a
+// utf8mb4 hex literal, which holds any character and reads the same whatever
+// the server's sql_mode, where a backslash might or might not escape. (utf8
+// is utf8mb3, which has no 4-byte characters.)
+func quoteString(s string) string {
+	return "_utf8mb4 X'" + hex.EncodeToString([]byte(s)) + "'"
+}
+
+// quoteBinary quotes a binary string literal for use in a query.
+func quoteBinary(b []byte) string {
+	return "_binary X'" + hex.EncodeToString(b) + "'"
+}
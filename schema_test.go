@@ -0,0 +1,258 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var columnsResultNames = []string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "IS_NULLABLE", "CHARACTER_SET_NAME",
+	"COLLATION_NAME", "CHARACTER_OCTET_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE"}
+
+func TestParseColumns(t *testing.T) {
+	r := newTestResult(columnsResultNames,
+		[]interface{}{[]byte("id"), []byte("bigint"), []byte("bigint(20) unsigned"), []byte("NO"), nil, nil, nil, uint64(20), uint64(0)},
+		[]interface{}{[]byte("name"), []byte("varchar"), []byte("varchar(64)"), []byte("YES"), []byte("utf8mb4"), []byte("utf8mb4_general_ci"), uint64(256), nil, nil},
+		[]interface{}{[]byte("price"), []byte("decimal"), []byte("decimal(10,2)"), []byte("NO"), nil, nil, nil, uint64(10), uint64(2)},
+		[]interface{}{[]byte("state"), []byte("enum"), []byte("enum('new','it''s done')"), []byte("NO"), []byte("utf8"), []byte("utf8_general_ci"), uint64(27), nil, nil},
+	)
+
+	columns, err := parseColumns(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Column{
+			Name:       "id",
+			DataType:   "bigint",
+			ColumnType: "bigint(20) unsigned",
+			Unsigned:   true,
+			Type:       MYSQL_TYPE_LONGLONG,
+		}, columns[0])
+
+		assert.Equal(t, &Column{
+			Name:       "name",
+			DataType:   "varchar",
+			ColumnType: "varchar(64)",
+			Nullable:   true,
+			Charset:    "utf8mb4",
+			Collation:  "utf8mb4_general_ci",
+			Type:       MYSQL_TYPE_VARCHAR,
+			Metadata:   256,
+		}, columns[1])
+
+		assert.Equal(t, metaFromPrecAndDec(10, 2), columns[2].Metadata)
+
+		assert.Equal(t, []string{"new", "it's done"}, columns[3].Values)
+		assert.Equal(t, MYSQL_TYPE_STRING, columns[3].Type)
+		assert.Equal(t, uint16(MYSQL_TYPE_ENUM)<<8|1, columns[3].Metadata)
+	}
+}
+
+type binlogColumnTypeTest struct {
+	column   Column
+	length   uint64
+	wantType byte
+	wantMeta uint16
+}
+
+func TestBinlogColumnType(t *testing.T) {
+	tests := []binlogColumnTypeTest{
+		{Column{DataType: "bit"}, 0, MYSQL_TYPE_BIT, 0x0101},
+		{Column{DataType: "datetime", ColumnType: "datetime(6)"}, 0, MYSQL_TYPE_DATETIME2, 6},
+		{Column{DataType: "timestamp", ColumnType: "timestamp"}, 0, MYSQL_TYPE_TIMESTAMP2, 0},
+		{Column{DataType: "char"}, 10, MYSQL_TYPE_STRING, 0xfe0a},
+		{Column{DataType: "char"}, 765, MYSQL_TYPE_STRING, 0xdefd},
+		{Column{DataType: "mediumtext"}, 0, MYSQL_TYPE_BLOB, 3},
+		{Column{DataType: "longblob"}, 0, MYSQL_TYPE_BLOB, 4},
+		{Column{DataType: "point"}, 0, MYSQL_TYPE_GEOMETRY, 4},
+		{Column{DataType: "json"}, 0, MYSQL_TYPE_JSON, 4},
+		{Column{DataType: "set", Values: make([]string, 20)}, 0, MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_SET)<<8 | 4},
+	}
+
+	for _, tt := range tests {
+		// BIT(9) reports a precision of 9
+		tp, meta := binlogColumnType(&tt.column, tt.length, 9, 0)
+
+		assert.Equal(t, tt.wantType, tp, tt.column.DataType)
+		assert.Equal(t, tt.wantMeta, meta, tt.column.DataType)
+	}
+}
+
+func TestCharColumnMetadataDecodesToLength(t *testing.T) {
+	v, n, err := parseValue([]byte{0x02, 0x00, 'h', 'i'}, MYSQL_TYPE_STRING, stringColumnMetadata(MYSQL_TYPE_STRING, 765))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", v)
+	assert.Equal(t, 4, n)
+}
+
+func TestTableSchemaBuildsTableMapEvent(t *testing.T) {
+	ts := &TableSchema{
+		Schema: "shard767",
+		Name:   "camera_upload_index_summary_v3",
+		Columns: []*Column{
+			{Name: "id", Type: MYSQL_TYPE_LONG},
+			{Name: "kind", Type: MYSQL_TYPE_SHORT, Nullable: true},
+		},
+	}
+
+	e := ts.tableMapEvent(76)
+
+	assert.Equal(t, &TableMapEvent{
+		TableID:        uint64(76),
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("camera_upload_index_summary_v3"),
+		ColumnCount:    uint64(2),
+		ColumnTypes:    []byte{0x3, 0x2},
+		ColumnMetadata: []uint16{0x0, 0x0},
+		NullBitVector:  []byte{0x2},
+		ColumnUnsigned: []bool{false, false},
+		ColumnNames:    []string{"id", "kind"},
+	}, e)
+}
+
+type textValueTest struct {
+	column Column
+	input  string
+	want   interface{}
+}
+
+func TestValueFromTextMatchesRowsEventTypes(t *testing.T) {
+	tests := []textValueTest{
+		{Column{Type: MYSQL_TYPE_TINY}, "127", int8(127)},
+		{Column{Type: MYSQL_TYPE_TINY, Unsigned: true}, "255", int8(-1)},
+		{Column{Type: MYSQL_TYPE_SHORT}, "1535", int16(1535)},
+		{Column{Type: MYSQL_TYPE_INT24, Unsigned: true}, "16645887", int32(-131329)},
+		{Column{Type: MYSQL_TYPE_LONG}, "16909060", int32(0x01020304)},
+		{Column{Type: MYSQL_TYPE_LONGLONG, Unsigned: true}, "18446744073709551615", int64(-1)},
+		{Column{Type: MYSQL_TYPE_NEWDECIMAL}, "-3699.01", float64(-3699.01)},
+		{Column{Type: MYSQL_TYPE_FLOAT}, "-2", float32(-2)},
+		{Column{Type: MYSQL_TYPE_DOUBLE}, "-2", float64(-2)},
+		{Column{Type: MYSQL_TYPE_BIT}, "\x01\x02", int64(258)},
+		{Column{Type: MYSQL_TYPE_DATE}, "2016-02-29", "2016-02-29"},
+		{Column{Type: MYSQL_TYPE_YEAR}, "1989", "1989"},
+		{Column{Type: MYSQL_TYPE_DATETIME2}, "2016-02-29 12:30:45.123456", "2016-02-29 12:30:45"},
+		{Column{Type: MYSQL_TYPE_TIME2}, "-838:59:59.000000", "-838:59:59"},
+		{Column{Type: MYSQL_TYPE_TIMESTAMP2}, "0000-00-00 00:00:00", "0000-00-00 00:00:00"},
+		{Column{Type: MYSQL_TYPE_VARCHAR}, "camera", "camera"},
+		{Column{Type: MYSQL_TYPE_BLOB}, "\x00\x01", []byte{0, 1}},
+		{Column{DataType: "enum", Type: MYSQL_TYPE_STRING, Values: []string{"new", "done"}}, "done", int64(2)},
+		{Column{DataType: "set", Type: MYSQL_TYPE_STRING, Values: []string{"a", "b", "c"}}, "a,c", int64(5)},
+		{Column{DataType: "set", Type: MYSQL_TYPE_STRING, Values: []string{"a", "b", "c"}}, "", int64(0)},
+	}
+
+	for _, tt := range tests {
+		v, err := tt.column.valueFromText([]byte(tt.input))
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, v, tt.input)
+	}
+}
+
+func TestValueFromTextConvertsTimestampsLikeRowsEvents(t *testing.T) {
+	c := &Column{Type: MYSQL_TYPE_TIMESTAMP2}
+
+	v, err := c.valueFromText([]byte("2014-08-11 23:31:30"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1407799890, 0).Format(TimeFormat), v)
+}
+
+func TestValueFromTextKeepsNull(t *testing.T) {
+	c := &Column{Type: MYSQL_TYPE_LONG}
+
+	v, err := c.valueFromText(nil)
+
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestQuoteString(t *testing.T) {
+	assert.Equal(t, "_utf8mb4 X'69742773205c22'", quoteString("it's \\\""))
+	assert.Equal(t, "_utf8mb4 X''", quoteString(""))
+	assert.Equal(t, "_binary X'00ff'", quoteBinary([]byte{0x00, 0xff}))
+}
+
+func TestParseUniqueKey(t *testing.T) {
+	table := &TableSchema{Columns: []*Column{
+		{Name: "a", Nullable: true},
+		{Name: "b"},
+		{Name: "c"},
+	}}
+	names := []string{"INDEX_NAME", "COLUMN_NAME"}
+
+	// Keys with nullable columns don't identify rows
+	key, err := table.parseUniqueKey(newTestResult(names,
+		[]interface{}{[]byte("ab"), []byte("a")},
+		[]interface{}{[]byte("ab"), []byte("b")},
+		[]interface{}{[]byte("cb"), []byte("c")},
+		[]interface{}{[]byte("cb"), []byte("B")},
+		[]interface{}{[]byte("d"), []byte("b")},
+	))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{2, 1}, key)
+	}
+
+	key, err = table.parseUniqueKey(newTestResult(names, []interface{}{[]byte("a"), []byte("a")}))
+	if assert.NoError(t, err) {
+		assert.Nil(t, key)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "`odd``name`", quoteIdentifier("odd`name"))
+}
+
+func TestValueFromTextFollowsParserOptions(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	o := &ParserOptions{ParseTime: true, Location: tokyo, ZeroDates: ZeroDateNull}
+
+	tests := []struct {
+		column Column
+		input  string
+		want   interface{}
+	}{
+		{Column{Type: MYSQL_TYPE_DATETIME2}, "2016-02-29 12:30:45.123456", time.Date(2016, 2, 29, 12, 30, 45, 123456000, tokyo)},
+		{Column{Type: MYSQL_TYPE_TIMESTAMP2}, "2014-08-11 23:31:30", time.Unix(1407799890, 0).In(tokyo)},
+		{Column{Type: MYSQL_TYPE_DATE}, "2016-02-29", time.Date(2016, 2, 29, 0, 0, 0, 0, tokyo)},
+		{Column{Type: MYSQL_TYPE_DATE}, "0000-00-00", nil},
+		{Column{Type: MYSQL_TYPE_TIME2}, "-838:59:59.000000", -(838*time.Hour + 59*time.Minute + 59*time.Second)},
+		{Column{Type: MYSQL_TYPE_YEAR}, "1989", int64(1989)},
+		{Column{Type: MYSQL_TYPE_VARCHAR}, "camera", "camera"},
+	}
+
+	for _, tt := range tests {
+		v, err := o.valueFromText(&tt.column, []byte(tt.input))
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, v, tt.input)
+	}
+
+	v, err := (*ParserOptions)(nil).valueFromText(&Column{Type: MYSQL_TYPE_DATETIME2}, []byte("0000-00-00 00:00:00"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0000-00-00 00:00:00", v)
+}
+
+func TestValueFromTextDecodesEnumsSetsBitsAndGeometry(t *testing.T) {
+	o := &ParserOptions{DecodeEnums: true, BitStrings: true, Geometry: GeometryWKT}
+	values := []string{"a", "b", "c"}
+
+	tests := []struct {
+		column Column
+		input  string
+		want   interface{}
+	}{
+		{Column{DataType: "enum", Values: values}, "b", "b"},
+		{Column{DataType: "set", Values: values}, "a,c", []string{"a", "c"}},
+		{Column{DataType: "set", Values: values}, "", []string{}},
+		{Column{Type: MYSQL_TYPE_BIT, Metadata: 1<<8 | 2}, "\x01\x02", "0100000010"},
+		{Column{Type: MYSQL_TYPE_GEOMETRY, Metadata: 4}, "\x00\x00\x00\x00\x01\x01\x00\x00\x00" +
+			"\x00\x00\x00\x00\x00\x00\xf0\x3f\x00\x00\x00\x00\x00\x00\x00\x40", "POINT(1 2)"},
+	}
+
+	for _, tt := range tests {
+		v, err := o.valueFromText(&tt.column, []byte(tt.input))
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, v, tt.input)
+	}
+}
@@ -0,0 +1,321 @@
+package binlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSnapshotChunkSize is the number of rows a snapshot reads per query,
+// and so the number of rows in each synthetic rows event.
+const DefaultSnapshotChunkSize = 1000
+
+// snapshotTableIDBase keeps the table IDs of synthetic TableMapEvents well away
+// from the ones MySQL hands out.
+const snapshotTableIDBase uint64 = 1 << 47
+
+// A TableName identifies a table.
+type TableName struct {
+	Schema string
+	Name   string
+}
+
+func (t TableName) String() string {
+	return t.Schema + "." + t.Name
+}
+
+// SnapshotConfig describes which tables a snapshot copies and how.
+type SnapshotConfig struct {
+	Tables    []TableName
+	ChunkSize int // rows per query; DefaultSnapshotChunkSize if zero
+}
+
+// A Snapshot is a consistent read view of the leader, opened on its own
+// connection, together with the binlog position that view corresponds to.
+type Snapshot struct {
+	c           *Conn
+	Position    Position // first binlog position not reflected in the snapshot
+	GTIDSet     string   // GTIDs executed as of the snapshot; empty if GTIDs are off
+	chunkSize   int
+	nextTableID uint64
+	options     *ParserOptions // how to decode values, as the Follower's parser does
+}
+
+// beginSnapshot opens a consistent snapshot on c. The leader is briefly locked
+// with FLUSH TABLES WITH READ LOCK so that the binlog position can be read at
+// exactly the point the snapshot is taken.
+func beginSnapshot(c *Conn, chunkSize int) (*Snapshot, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultSnapshotChunkSize
+	}
+
+	s := &Snapshot{c: c, chunkSize: chunkSize, nextTableID: snapshotTableIDBase}
+
+	// Read temporal values in UTC so they convert the same way binlog values do.
+	for _, query := range []string{
+		"SET SESSION time_zone = '+00:00'",
+		"FLUSH TABLES WITH READ LOCK",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	} {
+		if _, err := c.execute(query); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := c.execute("SHOW MASTER STATUS")
+	if err != nil {
+		return nil, err
+	}
+	if s.Position, s.GTIDSet, err = parseMasterStatus(result); err != nil {
+		return nil, err
+	}
+
+	if _, err = c.execute("UNLOCK TABLES"); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func parseMasterStatus(r *Result) (pos Position, gtidSet string, err error) {
+	if r.Resultset == nil || len(r.Values) == 0 {
+		return pos, "", errors.New("binary logging is disabled on the leader")
+	}
+
+	if pos.Name, err = r.GetString(0, 0); err != nil {
+		return
+	}
+
+	var p uint64
+	if p, err = r.GetUint64(0, 1); err != nil {
+		return
+	}
+	pos.Pos = uint32(p)
+
+	if i, ok := r.FieldNames["Executed_Gtid_Set"]; ok {
+		if gtidSet, err = r.GetString(0, i); err != nil {
+			return
+		}
+		gtidSet = strings.Replace(gtidSet, "\n", "", -1)
+	}
+
+	return pos, gtidSet, nil
+}
+
+// readTable streams the contents of a table as a synthetic TableMapEvent
+// followed by one WRITE_ROWS_EVENT_V1 per chunk of rows. Chunks are read in
+// primary key order, or for tables without a primary key in the order of a
+// unique key of NOT NULL columns; tables with neither can't be read in chunks
+// and are refused. It stops early, without error, when emit returns false.
+func (s *Snapshot) readTable(name TableName, emit func(*EventContainer) bool) error {
+	t, err := loadTableSchema(s.c, name.Schema, name.Name)
+	if err != nil {
+		return err
+	}
+	if len(t.chunkKey()) == 0 {
+		return fmt.Errorf("table %s has neither a primary key nor a unique key of NOT NULL columns and can't be snapshotted", name)
+	}
+
+	tme := t.tableMapEvent(s.nextTableID)
+	s.nextTableID++
+
+	if !emit(snapshotEvent(TABLE_MAP_EVENT, tme)) {
+		return nil
+	}
+
+	var after []interface{}
+	for {
+		result, err := s.c.execute(t.chunkQuery(after, s.chunkSize))
+		if err != nil {
+			return err
+		}
+		if result.Resultset == nil || len(result.Values) == 0 {
+			return nil
+		}
+
+		e, err := t.rowsEvent(tme, result.Values, s.options)
+		if err != nil {
+			return err
+		}
+		if !emit(snapshotEvent(WRITE_ROWS_EVENT_V1, e)) {
+			return nil
+		}
+
+		if len(result.Values) < s.chunkSize {
+			return nil
+		}
+
+		key := t.chunkKey()
+		last := result.Values[len(result.Values)-1]
+		after = make([]interface{}, len(key))
+		for i, col := range key {
+			after[i] = last[col]
+		}
+	}
+}
+
+// close ends the snapshot transaction and closes its connection.
+func (s *Snapshot) close() error {
+	_, err := s.c.execute("COMMIT")
+	s.c.close()
+	return err
+}
+
+// snapshotEvent wraps an event read from a snapshot. Snapshot events carry
+// LOG_EVENT_ARTIFICIAL_F and no log position, so consumers can tell them apart
+// from binlog events.
+func snapshotEvent(t EventType, e Event) *EventContainer {
+	return &EventContainer{
+		Header: &EventHeader{
+			Timestamp: uint32(time.Now().Unix()),
+			EventType: t,
+			Flags:     LOG_EVENT_ARTIFICIAL_F,
+		},
+		Event: e,
+	}
+}
+
+// chunkQuery selects the next chunk of rows whose key, as chunkKey picks it,
+// sorts after the key values in after, or the first chunk if after is nil.
+func (t *TableSchema) chunkQuery(after []interface{}, limit int) string {
+	key := t.chunkKey()
+
+	var b bytes.Buffer
+
+	b.WriteString("SELECT ")
+	for i, c := range t.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdentifier(c.Name))
+	}
+	b.WriteString(" FROM ")
+	b.WriteString(quoteIdentifier(t.Schema))
+	b.WriteString(".")
+	b.WriteString(quoteIdentifier(t.Name))
+
+	if len(key) == 0 {
+		return b.String()
+	}
+
+	// (a, b) > (x, y) written out as a > x OR (a = x AND b > y), which older
+	// servers can turn into an index range scan.
+	if after != nil {
+		b.WriteString(" WHERE ")
+		for i := range key {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			b.WriteString("(")
+			for j := 0; j <= i; j++ {
+				if j > 0 {
+					b.WriteString(" AND ")
+				}
+				c := t.Columns[key[j]]
+				b.WriteString(quoteIdentifier(c.Name))
+				if j < i {
+					b.WriteString(" = ")
+				} else {
+					b.WriteString(" > ")
+				}
+				b.WriteString(sqlLiteral(after[j], c))
+			}
+			b.WriteString(")")
+		}
+	}
+
+	b.WriteString(" ORDER BY ")
+	for i, col := range key {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdentifier(t.Columns[col].Name))
+	}
+	b.WriteString(" LIMIT ")
+	b.WriteString(strconv.Itoa(limit))
+
+	return b.String()
+}
+
+// rowsEvent converts rows read over the text protocol into a synthetic rows
+// event for the table, decoding values as o says.
+func (t *TableSchema) rowsEvent(tme *TableMapEvent, values [][]interface{}, o *ParserOptions) (*RowsEvent, error) {
+	e := &RowsEvent{
+		Table:         tme,
+		TableID:       tme.TableID,
+		ColumnCount:   tme.ColumnCount,
+		ColumnBitmap1: allColumnsBitmap(len(t.Columns)),
+		Rows:          make([][]interface{}, len(values)),
+		location:      o.stringLocation(),
+	}
+
+	for i, v := range values {
+		row := make([]interface{}, len(t.Columns))
+		for j, c := range t.Columns {
+			var err error
+			if row[j], err = o.valueFromText(c, textValue(v[j])); err != nil {
+				return nil, err
+			}
+		}
+		e.Rows[i] = row
+	}
+
+	return e, nil
+}
+
+func allColumnsBitmap(columnCount int) []byte {
+	b := make([]byte, bitmapByteSize(columnCount))
+	for i := 0; i < columnCount; i++ {
+		b[i/8] |= 1 << uint(i%8)
+	}
+	return b
+}
+
+// textValue turns a value parsed by RowData.parseText back into its text form.
+func textValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case int64:
+		return []byte(strconv.FormatInt(v, 10))
+	case uint64:
+		return []byte(strconv.FormatUint(v, 10))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		return nil
+	}
+}
+
+// sqlLiteral formats a value of column c parsed by RowData.parseText as a SQL
+// literal. Numbers are written as they are, so they compare exactly; other text
+// is quoted as binary for columns without a character set.
+func sqlLiteral(v interface{}, c *Column) string {
+	b := textValue(v)
+	if b == nil {
+		return "NULL"
+	}
+	if _, ok := v.([]byte); ok {
+		if isNumericType(c.Type) && len(b) > 0 && strings.Trim(string(b), "0123456789+-.eE") == "" {
+			return string(b)
+		}
+		if c.Charset == "" {
+			return quoteBinary(b)
+		}
+		return quoteString(string(b))
+	}
+	return string(b)
+}
+
+func isNumericType(tp byte) bool {
+	switch tp {
+	case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_INT24, MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG,
+		MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE, MYSQL_TYPE_YEAR:
+		return true
+	}
+	return false
+}
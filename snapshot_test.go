@@ -0,0 +1,121 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var snapshotTestTable = &TableSchema{
+	Schema: "shard767",
+	Name:   "uploads",
+	Columns: []*Column{
+		{Name: "user_id", DataType: "int", Type: MYSQL_TYPE_LONG},
+		{Name: "name", DataType: "varchar", Type: MYSQL_TYPE_VARCHAR, Nullable: true},
+		{Name: "seq", DataType: "bigint", Type: MYSQL_TYPE_LONGLONG},
+	},
+	PrimaryKey: []int{0, 2},
+}
+
+func TestFirstChunkQuery(t *testing.T) {
+	want := "SELECT `user_id`, `name`, `seq` FROM `shard767`.`uploads` ORDER BY `user_id`, `seq` LIMIT 100"
+
+	assert.Equal(t, want, snapshotTestTable.chunkQuery(nil, 100))
+}
+
+func TestNextChunkQuery(t *testing.T) {
+	want := "SELECT `user_id`, `name`, `seq` FROM `shard767`.`uploads` " +
+		"WHERE (`user_id` > 12) OR (`user_id` = 12 AND `seq` > 4000) ORDER BY `user_id`, `seq` LIMIT 100"
+
+	assert.Equal(t, want, snapshotTestTable.chunkQuery([]interface{}{[]byte("12"), int64(4000)}, 100))
+}
+
+func TestNextChunkQueryQuotesText(t *testing.T) {
+	table := &TableSchema{
+		Schema: "db",
+		Name:   "files",
+		Columns: []*Column{
+			{Name: "path", Type: MYSQL_TYPE_VARCHAR, Charset: "utf8mb4"},
+			{Name: "hash", Type: MYSQL_TYPE_STRING},
+		},
+		PrimaryKey: []int{0, 1},
+	}
+	want := "SELECT `path`, `hash` FROM `db`.`files` " +
+		"WHERE (`path` > _utf8mb4 X'615c27') OR (`path` = _utf8mb4 X'615c27' AND `hash` > _binary X'ff00') " +
+		"ORDER BY `path`, `hash` LIMIT 10"
+
+	assert.Equal(t, want, table.chunkQuery([]interface{}{[]byte(`a\'`), []byte{0xff, 0x00}}, 10))
+
+	// 4-byte characters need utf8mb4 rather than utf8, which is utf8mb3
+	table.Columns, table.PrimaryKey = table.Columns[:1], []int{0}
+	want = "SELECT `path` FROM `db`.`files` WHERE (`path` > _utf8mb4 X'f09f9880') ORDER BY `path` LIMIT 10"
+	assert.Equal(t, want, table.chunkQuery([]interface{}{[]byte("\U0001F600")}, 10))
+}
+
+func TestChunkQueryWithUniqueKey(t *testing.T) {
+	table := &TableSchema{
+		Schema:    "db",
+		Name:      "log",
+		Columns:   []*Column{{Name: "line"}, {Name: "seq", Type: MYSQL_TYPE_LONG}},
+		UniqueKey: []int{1},
+	}
+
+	assert.Equal(t, "SELECT `line`, `seq` FROM `db`.`log` WHERE (`seq` > 7) ORDER BY `seq` LIMIT 100",
+		table.chunkQuery([]interface{}{[]byte("7")}, 100))
+}
+
+func TestChunkQueryWithoutKey(t *testing.T) {
+	table := &TableSchema{Schema: "db", Name: "log", Columns: []*Column{{Name: "line"}}}
+
+	assert.Equal(t, "SELECT `line` FROM `db`.`log`", table.chunkQuery(nil, 100))
+}
+
+func TestSnapshotRowsEvent(t *testing.T) {
+	tme := snapshotTestTable.tableMapEvent(snapshotTableIDBase)
+
+	e, err := snapshotTestTable.rowsEvent(tme, [][]interface{}{
+		{[]byte("12"), []byte("camera"), int64(4000)},
+		{[]byte("12"), nil, int64(4001)},
+	}, nil)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, &RowsEvent{
+			Table:         tme,
+			TableID:       snapshotTableIDBase,
+			ColumnCount:   3,
+			ColumnBitmap1: []byte{0x07},
+			Rows: [][]interface{}{
+				{int32(12), "camera", int64(4000)},
+				{int32(12), nil, int64(4001)},
+			},
+		}, e)
+	}
+}
+
+func TestSnapshotEventIsArtificial(t *testing.T) {
+	e := snapshotEvent(WRITE_ROWS_EVENT_V1, &RowsEvent{})
+
+	assert.Equal(t, WRITE_ROWS_EVENT_V1, e.Header.EventType)
+	assert.Equal(t, LOG_EVENT_ARTIFICIAL_F, e.Header.Flags)
+	assert.Equal(t, uint32(0), e.Header.LogPos)
+}
+
+func TestParseMasterStatus(t *testing.T) {
+	r := newTestResult([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"},
+		[]interface{}{[]byte("mysql-bin.000010"), uint64(154), []byte(""), []byte(""), []byte("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2")},
+	)
+
+	pos, gtidSet, err := parseMasterStatus(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, Position{"mysql-bin.000010", 154}, pos)
+		assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2", gtidSet)
+	}
+}
+
+func TestParseMasterStatusWithoutBinaryLogging(t *testing.T) {
+	r := newTestResult([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB"})
+
+	_, _, err := parseMasterStatus(r)
+
+	assert.Error(t, err)
+}
@@ -6,22 +6,68 @@ import (
 
 // Stream handles the routing of events/errors from the follower to client channels.
 type Streamer struct {
-	ch  chan *EventContainer
-	ech chan error
-	err error
+	ch      chan *EventContainer
+	ech     chan error
+	err     error
+	pending error // error received while events were still queued
+
+	context *StatementContext // context events seen since the last query
 }
 
+// GetEvent returns the next event. Events sent before the stream failed are
+// returned before its error.
+//
+// INTVAR, RAND and USER_VAR events are returned as they arrive, and are also
+// attached as the Context of the QueryEvent that follows them.
 func (s *Streamer) GetEvent() (*EventContainer, error) {
+	c, err := s.nextEvent()
+	if err != nil {
+		return nil, err
+	}
+
+	s.trackContext(c.Event)
+
+	return c, nil
+}
+
+func (s *Streamer) nextEvent() (*EventContainer, error) {
 	if s.err != nil {
 		return nil, errors.New("last sync failed")
 	}
 
+	if s.pending != nil {
+		select {
+		case c := <-s.ch:
+			return c, nil
+		default:
+			s.err = s.pending
+			return nil, s.err
+		}
+	}
+
 	select {
 	case c := <-s.ch:
 		return c, nil
-	case s.err = <-s.ech:
-		return nil, s.err
+	case err := <-s.ech:
+		s.pending = err
+		return s.nextEvent()
+	}
+}
+
+// trackContext collects statement context events and hands them to the next
+// QueryEvent. Any other event in between discards them.
+func (s *Streamer) trackContext(e Event) {
+	if s.context == nil {
+		s.context = new(StatementContext)
+	}
+	if s.context.add(e) {
+		return
+	}
+
+	if q, ok := e.(*QueryEvent); ok && !s.context.empty() {
+		q.Context = s.context
 	}
+	s.context = nil
 }
 
 func (s *Streamer) Close() {
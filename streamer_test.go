@@ -0,0 +1,50 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamerAttachesContextToFollowingQuery(t *testing.T) {
+	s := newStreamer()
+
+	intVar := &IntVarEvent{Type: INSERT_ID_EVENT, Value: 42}
+	rand := &RandEvent{Seed1: 1, Seed2: 2}
+	userVar := &UserVarEvent{Name: []byte("v"), IsNull: true}
+	query := &QueryEvent{Query: []byte("INSERT INTO t VALUES (NULL, RAND(), @v)")}
+	next := &QueryEvent{Query: []byte("COMMIT")}
+
+	for _, e := range []Event{intVar, rand, userVar, query, next} {
+		s.ch <- &EventContainer{Event: e}
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err := s.GetEvent()
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, &StatementContext{
+		IntVars:  []*IntVarEvent{intVar},
+		Rand:     rand,
+		UserVars: []*UserVarEvent{userVar},
+	}, query.Context)
+	assert.Nil(t, next.Context)
+}
+
+func TestStreamerDiscardsContextBeforeOtherEvents(t *testing.T) {
+	s := newStreamer()
+
+	query := &QueryEvent{Query: []byte("BEGIN")}
+	for _, e := range []Event{&IntVarEvent{Value: 1}, &XidEvent{Xid: 1}, query} {
+		s.ch <- &EventContainer{Event: e}
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetEvent()
+		require.NoError(t, err)
+	}
+
+	assert.Nil(t, query.Context)
+}
@@ -0,0 +1,560 @@
+package binlog
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ValueKind is what a Value holds, whatever Go type the column was decoded
+// to.
+type ValueKind int
+
+const (
+	AbsentKind   ValueKind = iota // column left out of the row image
+	NullKind                      // SQL NULL
+	IntKind                       // signed integers and YEAR
+	UintKind                      // unsigned integers, BIT, ENUM and SET
+	FloatKind                     // FLOAT and DOUBLE
+	DecimalKind                   // DECIMAL
+	TimeKind                      // DATE, DATETIME and TIMESTAMP
+	DurationKind                  // TIME
+	StringKind                    // CHAR, VARCHAR and TEXT
+	BytesKind                     // BINARY, VARBINARY, BLOB and GEOMETRY
+	JSONKind                      // JSON documents
+	JSONDiffKind                  // JSON diffs of a partial update
+	SetKind                       // SET labels, with ParserOptions.DecodeEnums
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case AbsentKind:
+		return "absent"
+	case NullKind:
+		return "null"
+	case IntKind:
+		return "int"
+	case UintKind:
+		return "uint"
+	case FloatKind:
+		return "float"
+	case DecimalKind:
+		return "decimal"
+	case TimeKind:
+		return "time"
+	case DurationKind:
+		return "duration"
+	case StringKind:
+		return "string"
+	case BytesKind:
+		return "bytes"
+	case JSONKind:
+		return "json"
+	case JSONDiffKind:
+		return "jsondiff"
+	case SetKind:
+		return "set"
+	default:
+		return fmt.Sprintf("ValueKind(%d)", int(k))
+	}
+}
+
+// A Value is one column of a row, with accessors that convert it from the Go
+// type it was decoded to. Accessors fail for values of other kinds, and for
+// NULL and absent ones.
+type Value struct {
+	kind ValueKind
+	v    interface{}
+	tp   byte           // column type (MYSQL_TYPE_*), with the real type of MYSQL_TYPE_STRING
+	meta uint16         // column metadata
+	loc  *time.Location // of a temporal string, or nil for the defaults
+}
+
+// NewValue makes a Value of v, decoded from a column of type tp with metadata
+// meta. column, if not nil, tells unsigned integers and text blobs apart.
+func NewValue(v interface{}, tp byte, meta uint16, column *Column) Value {
+	if tp == MYSQL_TYPE_STRING {
+		tp, _ = stringRealType(meta)
+	}
+
+	val := Value{v: v, tp: tp, meta: meta}
+	switch {
+	case v == nil:
+		val.kind = NullKind
+		return val
+	case tp == MYSQL_TYPE_JSON:
+		if _, ok := v.([]JSONDiff); ok {
+			val.kind = JSONDiffKind
+			return val
+		}
+	}
+
+	switch tp {
+	case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_INT24, MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG:
+		val.kind = IntKind
+		if column != nil && column.Unsigned {
+			val.kind = UintKind
+		}
+	case MYSQL_TYPE_YEAR:
+		val.kind = IntKind
+	case MYSQL_TYPE_BIT, MYSQL_TYPE_ENUM, MYSQL_TYPE_SET:
+		// Labels and bit strings with ParserOptions.DecodeEnums and BitStrings
+		switch v.(type) {
+		case string:
+			val.kind = StringKind
+		case []string:
+			val.kind = SetKind
+		default:
+			val.kind = UintKind
+		}
+	case MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE:
+		val.kind = FloatKind
+	case MYSQL_TYPE_DECIMAL, MYSQL_TYPE_NEWDECIMAL:
+		val.kind = DecimalKind
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_DATETIME, MYSQL_TYPE_DATETIME2,
+		MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
+		val.kind = TimeKind
+	case MYSQL_TYPE_TIME, MYSQL_TYPE_TIME2:
+		val.kind = DurationKind
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_STRING:
+		// Binary strings are []byte with ParserOptions.DecodeCharsets.
+		val.kind = StringKind
+		if _, ok := v.([]byte); ok {
+			val.kind = BytesKind
+		}
+	case MYSQL_TYPE_JSON:
+		val.kind = JSONKind
+	case MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB:
+		// Text is a string with ParserOptions.DecodeCharsets.
+		val.kind = BytesKind
+		if _, ok := v.(string); ok || column != nil && column.Charset != "" {
+			val.kind = StringKind
+		}
+	default:
+		val.kind = BytesKind
+		if _, ok := v.(string); ok {
+			val.kind = StringKind
+		}
+	}
+	return val
+}
+
+// Kind returns what the value holds.
+func (v Value) Kind() ValueKind {
+	return v.kind
+}
+
+// IsPresent reports whether the row image holds the column.
+func (v Value) IsPresent() bool {
+	return v.kind != AbsentKind
+}
+
+// IsNull reports whether the column is present and NULL.
+func (v Value) IsNull() bool {
+	return v.kind == NullKind
+}
+
+// Interface returns the value as decoded, as in RowsEvent.Rows.
+func (v Value) Interface() interface{} {
+	return v.v
+}
+
+func (v Value) kindError(want string) error {
+	return fmt.Errorf("can't read %s value as %s", v.kind, want)
+}
+
+// Int64 returns integer values, failing for unsigned ones that don't fit.
+func (v Value) Int64() (int64, error) {
+	switch v.kind {
+	case IntKind:
+		if s, ok := v.v.(string); ok { // YEAR
+			return strconv.ParseInt(s, 10, 64)
+		}
+		return signedInt(v.v)
+	case UintKind:
+		u, err := v.Uint64()
+		if err != nil {
+			return 0, err
+		}
+		if u > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", u)
+		}
+		return int64(u), nil
+	}
+	return 0, v.kindError("int64")
+}
+
+// Uint64 returns integer values, failing for negative signed ones. Unsigned
+// columns are decoded as signed integers of their width; Uint64 undoes that.
+func (v Value) Uint64() (uint64, error) {
+	switch v.kind {
+	case IntKind:
+		i, err := v.Int64()
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("%d is negative", i)
+		}
+		return uint64(i), nil
+	case UintKind:
+		i, err := signedInt(v.v)
+		if err != nil {
+			return 0, err
+		}
+		switch v.tp {
+		case MYSQL_TYPE_TINY:
+			return uint64(uint8(i)), nil
+		case MYSQL_TYPE_SHORT:
+			return uint64(uint16(i)), nil
+		case MYSQL_TYPE_INT24:
+			return uint64(uint32(i) & 0xffffff), nil
+		case MYSQL_TYPE_LONG:
+			return uint64(uint32(i)), nil
+		}
+		return uint64(i), nil
+	}
+	return 0, v.kindError("uint64")
+}
+
+// signedInt widens the integer types parseValue returns.
+func signedInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("can't read %T as an integer", v)
+}
+
+// Float64 returns floating point and decimal values.
+func (v Value) Float64() (float64, error) {
+	switch v.kind {
+	case FloatKind, DecimalKind:
+		switch f := v.v.(type) {
+		case float32:
+			return float64(f), nil
+		case float64:
+			return f, nil
+		case string:
+			return strconv.ParseFloat(f, 64)
+		}
+		return 0, fmt.Errorf("can't read %T as a float", v.v)
+	}
+	return 0, v.kindError("float64")
+}
+
+// Decimal returns decimal and integer values as decimal text, with as many
+// fractional digits as the column's scale.
+func (v Value) Decimal() (string, error) {
+	switch v.kind {
+	case DecimalKind:
+		switch d := v.v.(type) {
+		case string:
+			return d, nil
+		case float64:
+			return strconv.FormatFloat(d, 'f', int(v.meta&0xff), 64), nil
+		}
+		return "", fmt.Errorf("can't read %T as a decimal", v.v)
+	case IntKind:
+		i, err := v.Int64()
+		return strconv.FormatInt(i, 10), err
+	case UintKind:
+		u, err := v.Uint64()
+		return strconv.FormatUint(u, 10), err
+	}
+	return "", v.kindError("decimal")
+}
+
+// Time returns temporal values. Values decoded to strings are taken to be in
+// the ParserOptions.Location they were decoded with, or without one, in UTC
+// or for TIMESTAMP values in the local time zone. Strings keep only the
+// fractional seconds they show, which without ParseTime is none. Zero dates
+// fail.
+func (v Value) Time() (time.Time, error) {
+	if v.kind != TimeKind {
+		return time.Time{}, v.kindError("time")
+	}
+
+	switch t := v.v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		if strings.HasPrefix(t, "0000-00-00") {
+			return time.Time{}, fmt.Errorf("zero date %s", t)
+		}
+
+		loc := v.loc
+		switch {
+		case loc != nil:
+		case v.tp == MYSQL_TYPE_TIMESTAMP || v.tp == MYSQL_TYPE_TIMESTAMP2:
+			loc = time.Local
+		default:
+			loc = time.UTC
+		}
+		layout := TimeFormat
+		if len(t) == len("2006-01-02") {
+			layout = "2006-01-02"
+		}
+		return time.ParseInLocation(layout, t, loc)
+	}
+	return time.Time{}, fmt.Errorf("can't read %T as a time", v.v)
+}
+
+// Duration returns TIME values.
+func (v Value) Duration() (time.Duration, error) {
+	if v.kind != DurationKind {
+		return 0, v.kindError("duration")
+	}
+
+	switch d := v.v.(type) {
+	case time.Duration:
+		return d, nil
+	case string:
+		return parseTimeValue(d)
+	}
+	return 0, fmt.Errorf("can't read %T as a duration", v.v)
+}
+
+// parseTimeValue parses [-]hhh:mm:ss[.ffffff].
+func parseTimeValue(s string) (time.Duration, error) {
+	neg := strings.HasPrefix(s, "-")
+	parts := strings.Split(strings.TrimPrefix(s, "-"), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid TIME value %q", s)
+	}
+
+	h, err1 := strconv.ParseUint(parts[0], 10, 16)
+	m, err2 := strconv.ParseUint(parts[1], 10, 8)
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || m > 59 || sec >= 60 {
+		return 0, fmt.Errorf("invalid TIME value %q", s)
+	}
+
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(math.Round(sec*1e6))*time.Microsecond
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// formatTimeValue formats d as MySQL prints TIME values.
+func formatTimeValue(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	s := fmt.Sprintf("%s%02d:%02d:%02d", sign, d/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second)
+	if us := d % time.Second / time.Microsecond; us != 0 {
+		s += fmt.Sprintf(".%06d", us)
+	}
+	return s
+}
+
+// Bytes returns string, binary and JSON values.
+func (v Value) Bytes() ([]byte, error) {
+	switch v.kind {
+	case StringKind, BytesKind, JSONKind:
+		switch b := v.v.(type) {
+		case []byte:
+			return b, nil
+		case string:
+			return []byte(b), nil
+		}
+		return nil, fmt.Errorf("can't read %T as bytes", v.v)
+	}
+	return nil, v.kindError("bytes")
+}
+
+// JSON returns JSON documents as text.
+func (v Value) JSON() ([]byte, error) {
+	if v.kind != JSONKind {
+		return nil, v.kindError("JSON")
+	}
+	return v.Bytes()
+}
+
+// JSONDiffs returns the diffs of a partially updated JSON column.
+func (v Value) JSONDiffs() ([]JSONDiff, error) {
+	if v.kind != JSONDiffKind {
+		return nil, v.kindError("JSON diffs")
+	}
+	return v.v.([]JSONDiff), nil
+}
+
+// Labels returns the labels of a SET value.
+func (v Value) Labels() ([]string, error) {
+	if v.kind != SetKind {
+		return nil, v.kindError("labels")
+	}
+	return v.v.([]string), nil
+}
+
+// String returns the value as text, as MySQL prints it: NULL for NULLs and
+// empty for absent columns.
+func (v Value) String() string {
+	switch v.kind {
+	case AbsentKind:
+		return ""
+	case NullKind:
+		return "NULL"
+	case IntKind, UintKind, DecimalKind:
+		if s, err := v.Decimal(); err == nil {
+			return s
+		}
+	case FloatKind:
+		if f, err := v.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case TimeKind:
+		if t, ok := v.v.(time.Time); ok {
+			return t.Format(TimeFormat)
+		}
+	case DurationKind:
+		if d, ok := v.v.(time.Duration); ok {
+			return formatTimeValue(d)
+		}
+	case JSONDiffKind:
+		var b bytes.Buffer
+		for i, d := range v.v.([]JSONDiff) {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s %s", d.Operation, d.Path)
+			if d.Operation != JSON_DIFF_REMOVE {
+				fmt.Fprintf(&b, " %s", d.Value)
+			}
+		}
+		return b.String()
+	case SetKind:
+		return strings.Join(v.v.([]string), ",")
+	}
+
+	switch s := v.v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return fmt.Sprint(v.v)
+}
+
+// A Row is one image of a row as Values, with the names of its columns if
+// they are known.
+type Row struct {
+	Values []Value
+	Names  []string // nil if unknown
+}
+
+// Len returns the number of columns of the row.
+func (r Row) Len() int {
+	return len(r.Values)
+}
+
+// Index returns column i; columns past the end of the row are absent.
+func (r Row) Index(i int) Value {
+	if i < 0 || i >= len(r.Values) {
+		return Value{}
+	}
+	return r.Values[i]
+}
+
+// Get returns the named column, ignoring case as MySQL does, and whether the
+// row has a column of that name.
+func (r Row) Get(name string) (Value, bool) {
+	for i, n := range r.Names {
+		if strings.EqualFold(n, name) && i < len(r.Values) {
+			return r.Values[i], true
+		}
+	}
+	return Value{}, false
+}
+
+// NewRow makes a Row of an image of a row of the table. schema, if not nil,
+// names the columns and tells unsigned integers and text blobs apart; if it
+// is nil, the column names, signedness and collations of the table map do,
+// when the server logs them.
+func NewRow(image RowImage, table *TableMapEvent, schema *TableSchema) Row {
+	r := Row{Values: make([]Value, len(image.Values))}
+
+	var columns []*Column
+	switch {
+	case schema != nil:
+		columns = schema.Columns
+		r.Names = make([]string, len(columns))
+		for i, c := range columns {
+			r.Names[i] = c.Name
+		}
+	default:
+		columns = tableMapColumns(table)
+		if len(table.ColumnNames) == len(table.ColumnTypes) {
+			r.Names = table.ColumnNames
+		}
+	}
+
+	for j, v := range image.Values {
+		if !image.IsPresent(j) || j >= len(table.ColumnTypes) {
+			continue
+		}
+
+		var column *Column
+		if j < len(columns) {
+			column = columns[j]
+		}
+		r.Values[j] = NewValue(v, table.ColumnTypes[j], table.ColumnMetadata[j], column)
+		r.Values[j].loc = image.location
+	}
+	return r
+}
+
+// tableMapColumns makes Columns of what the table map tells of its columns:
+// their names, signedness and character sets. It returns nil if it tells
+// none of them.
+func tableMapColumns(table *TableMapEvent) []*Column {
+	if table.ColumnNames == nil && table.ColumnUnsigned == nil && table.ColumnCollations == nil {
+		return nil
+	}
+
+	columns := make([]*Column, len(table.ColumnTypes))
+	for j := range columns {
+		c := new(Column)
+		if j < len(table.ColumnNames) {
+			c.Name = table.ColumnNames[j]
+		}
+		if j < len(table.ColumnUnsigned) {
+			c.Unsigned = table.ColumnUnsigned[j]
+		}
+		if j < len(table.ColumnCollations) && isCharacterColumn(table.ColumnTypes[j], table.ColumnMetadata[j]) {
+			c.Charset = CollationCharset(table.ColumnCollations[j])
+			if c.Charset == "binary" {
+				c.Charset = ""
+			}
+		}
+		columns[j] = c
+	}
+	return columns
+}
+
+// Row returns row i of e as a Row; see NewRow.
+func (e *RowsEvent) Row(i int, schema *TableSchema) Row {
+	return NewRow(e.Image(i), e.Table, schema)
+}
+
+// TypedRows returns all the rows of e as Rows; see NewRow.
+func (e *RowsEvent) TypedRows(schema *TableSchema) []Row {
+	rows := make([]Row, len(e.Rows))
+	for i := range e.Rows {
+		rows[i] = e.Row(i, schema)
+	}
+	return rows
+}
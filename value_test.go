@@ -0,0 +1,268 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegerValues(t *testing.T) {
+	signed := NewValue(int8(-1), MYSQL_TYPE_TINY, 0, nil)
+	assert.Equal(t, IntKind, signed.Kind())
+	i, err := signed.Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), i)
+	_, err = signed.Uint64()
+	assert.Error(t, err)
+
+	unsigned := &Column{Unsigned: true}
+	for _, tt := range []struct {
+		v    interface{}
+		tp   byte
+		want uint64
+	}{
+		{int8(-1), MYSQL_TYPE_TINY, 0xff},
+		{int16(-1), MYSQL_TYPE_SHORT, 0xffff},
+		{int32(-1), MYSQL_TYPE_INT24, 0xffffff},
+		{int32(-1), MYSQL_TYPE_LONG, 0xffffffff},
+		{int64(-1), MYSQL_TYPE_LONGLONG, 0xffffffffffffffff},
+	} {
+		v := NewValue(tt.v, tt.tp, 0, unsigned)
+		assert.Equal(t, UintKind, v.Kind())
+		u, err := v.Uint64()
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, u, "%d", tt.tp)
+	}
+
+	_, err = NewValue(int64(-1), MYSQL_TYPE_LONGLONG, 0, unsigned).Int64()
+	assert.Error(t, err)
+
+	year := NewValue("2017", MYSQL_TYPE_YEAR, 0, nil)
+	i, err = year.Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2017), i)
+
+	enum := NewValue(int64(2), MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_ENUM)<<8|1, nil)
+	assert.Equal(t, UintKind, enum.Kind())
+	assert.Equal(t, "2", enum.String())
+}
+
+func TestDecimalAndFloatValues(t *testing.T) {
+	d := NewValue(float64(12.5), MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(10, 2), nil)
+	assert.Equal(t, DecimalKind, d.Kind())
+	s, err := d.Decimal()
+	require.NoError(t, err)
+	assert.Equal(t, "12.50", s)
+	f, err := d.Float64()
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, f)
+
+	exact := NewValue("123456789012345678.90", MYSQL_TYPE_NEWDECIMAL, metaFromPrecAndDec(20, 2), nil)
+	s, err = exact.Decimal()
+	require.NoError(t, err)
+	assert.Equal(t, "123456789012345678.90", s)
+
+	fl := NewValue(float32(0.5), MYSQL_TYPE_FLOAT, 4, nil)
+	assert.Equal(t, FloatKind, fl.Kind())
+	f, err = fl.Float64()
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, f)
+	_, err = fl.Int64()
+	assert.Error(t, err)
+}
+
+func TestTemporalValues(t *testing.T) {
+	datetime := NewValue("2017-07-14 02:40:00", MYSQL_TYPE_DATETIME2, 0, nil)
+	ts, err := datetime.Time()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC), ts)
+
+	date := NewValue("2017-07-14", MYSQL_TYPE_DATE, 0, nil)
+	ts, err = date.Time()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC), ts)
+
+	now := time.Unix(1500000000, 0)
+	timestamp := NewValue(now.Format(TimeFormat), MYSQL_TYPE_TIMESTAMP2, 0, nil)
+	ts, err = timestamp.Time()
+	require.NoError(t, err)
+	assert.True(t, now.Equal(ts))
+
+	_, err = NewValue("0000-00-00 00:00:00", MYSQL_TYPE_DATETIME2, 0, nil).Time()
+	assert.Error(t, err)
+
+	tm := NewValue("-838:59:59", MYSQL_TYPE_TIME2, 0, nil)
+	assert.Equal(t, DurationKind, tm.Kind())
+	d, err := tm.Duration()
+	require.NoError(t, err)
+	assert.Equal(t, -(838*time.Hour + 59*time.Minute + 59*time.Second), d)
+	assert.Equal(t, "-838:59:59", tm.String())
+}
+
+func TestStringBytesAndJSONValues(t *testing.T) {
+	s := NewValue("hi", MYSQL_TYPE_VARCHAR, 255, nil)
+	assert.Equal(t, StringKind, s.Kind())
+	b, err := s.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hi"), b)
+
+	blob := NewValue([]byte("data"), MYSQL_TYPE_BLOB, 2, nil)
+	assert.Equal(t, BytesKind, blob.Kind())
+	text := NewValue([]byte("data"), MYSQL_TYPE_BLOB, 2, &Column{Charset: "utf8mb4"})
+	assert.Equal(t, StringKind, text.Kind())
+	assert.Equal(t, "data", text.String())
+
+	doc := NewValue([]byte(`{"a": 1}`), MYSQL_TYPE_JSON, 4, nil)
+	j, err := doc.JSON()
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`{"a": 1}`), j)
+
+	diffs := []JSONDiff{{JSON_DIFF_REMOVE, []byte("$.a"), nil}}
+	diff := NewValue(diffs, MYSQL_TYPE_JSON, 4, nil)
+	assert.Equal(t, JSONDiffKind, diff.Kind())
+	got, err := diff.JSONDiffs()
+	require.NoError(t, err)
+	assert.Equal(t, diffs, got)
+	_, err = diff.JSON()
+	assert.Error(t, err)
+}
+
+func TestNullAndAbsentValues(t *testing.T) {
+	null := NewValue(nil, MYSQL_TYPE_LONG, 0, nil)
+	assert.True(t, null.IsPresent())
+	assert.True(t, null.IsNull())
+	assert.Equal(t, "NULL", null.String())
+	_, err := null.Int64()
+	assert.Error(t, err)
+
+	var absent Value
+	assert.False(t, absent.IsPresent())
+	assert.False(t, absent.IsNull())
+	assert.Equal(t, AbsentKind, absent.Kind())
+}
+
+func TestRowsEventTypedRows(t *testing.T) {
+	schema := &TableSchema{
+		Schema: "shard767",
+		Name:   "uploads",
+		Columns: []*Column{
+			{Name: "id", Type: MYSQL_TYPE_LONGLONG, Unsigned: true},
+			{Name: "name", Type: MYSQL_TYPE_VARCHAR, Metadata: 255, Nullable: true},
+			{Name: "body", Type: MYSQL_TYPE_BLOB, Metadata: 2, Nullable: true, Charset: "utf8mb4"},
+		},
+		PrimaryKey: []int{0},
+	}
+	e := &RowsEvent{
+		Table:         schema.tableMapEvent(12),
+		ColumnCount:   3,
+		ColumnBitmap1: []byte{0x07},
+		ColumnBitmap2: []byte{0x02},
+		Rows: [][]interface{}{
+			{int64(-1), "first", []byte("text")},
+			{nil, nil, nil},
+		},
+	}
+
+	rows := e.TypedRows(schema)
+	require.Len(t, rows, 2)
+
+	id, ok := rows[0].Get("ID")
+	require.True(t, ok)
+	u, err := id.Uint64()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0xffffffffffffffff), u)
+	assert.Equal(t, StringKind, rows[0].Index(2).Kind())
+
+	assert.False(t, rows[1].Index(0).IsPresent())
+	assert.True(t, rows[1].Index(1).IsNull())
+	assert.False(t, rows[1].Index(3).IsPresent())
+	_, ok = rows[1].Get("missing")
+	assert.False(t, ok)
+
+	// Without a schema, the table map's metadata names the columns and tells
+	// unsigned integers and text blobs apart.
+	e.Table.ColumnCollations = []uint16{0, 255, 255}
+	row := e.Row(0, nil)
+	id, ok = row.Get("id")
+	require.True(t, ok)
+	assert.Equal(t, UintKind, id.Kind())
+	assert.Equal(t, StringKind, row.Index(2).Kind())
+
+	// Without either, there are no names and integers are signed.
+	e.Table.ColumnNames, e.Table.ColumnUnsigned, e.Table.ColumnCollations = nil, nil, nil
+	row = e.Row(0, nil)
+	assert.Equal(t, 3, row.Len())
+	assert.Equal(t, IntKind, row.Index(0).Kind())
+	assert.Equal(t, BytesKind, row.Index(2).Kind())
+	_, ok = row.Get("id")
+	assert.False(t, ok)
+}
+
+func TestLabelAndBitStringValues(t *testing.T) {
+	set := NewValue([]string{"a", "c"}, MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_SET)<<8|1, nil)
+	assert.Equal(t, SetKind, set.Kind())
+	labels, err := set.Labels()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, labels)
+	assert.Equal(t, "a,c", set.String())
+
+	enum := NewValue("large", MYSQL_TYPE_STRING, uint16(MYSQL_TYPE_ENUM)<<8|1, nil)
+	assert.Equal(t, StringKind, enum.Kind())
+	_, err = enum.Labels()
+	assert.Error(t, err)
+
+	bits := NewValue("00101", MYSQL_TYPE_BIT, 5, nil)
+	assert.Equal(t, StringKind, bits.Kind())
+	assert.Equal(t, "00101", bits.String())
+}
+
+func TestTimestampStringsAreReadInTheParserLocation(t *testing.T) {
+	tme := &TableMapEvent{
+		TableID:        12,
+		DatabaseName:   []byte("shard767"),
+		TableName:      []byte("uploads"),
+		ColumnCount:    2,
+		ColumnTypes:    []byte{MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_DATETIME2},
+		ColumnMetadata: []uint16{0, 0},
+		NullBitVector:  []byte{0x03},
+	}
+	instant := time.Unix(1500000000, 0)
+	write := &RowsEvent{
+		TableID:       12,
+		ColumnCount:   2,
+		ColumnBitmap1: []byte{0x03},
+		Rows:          [][]interface{}{{instant, "2017-07-14 02:40:00"}},
+	}
+
+	enc := NewBinlogEncoder()
+	loc := time.FixedZone("KST", 9*3600)
+	p := NewBinlogParserWithOptions(ParserOptions{Location: loc})
+
+	var parsed *EventContainer
+	for _, e := range []struct {
+		t EventType
+		e Event
+	}{
+		{FORMAT_DESCRIPTION_EVENT, testFormatDescription()},
+		{TABLE_MAP_EVENT, tme},
+		{WRITE_ROWS_EVENT_V1, write},
+	} {
+		b, err := enc.Encode(&EventHeader{EventType: e.t, ServerId: 1}, e.e)
+		require.NoError(t, err)
+		parsed, err = p.Parse(b)
+		require.NoError(t, err)
+	}
+
+	row := parsed.Event.(*RowsEvent).Row(0, nil)
+	assert.Equal(t, instant.In(loc).Format(TimeFormat), row.Index(0).Interface())
+
+	ts, err := row.Index(0).Time()
+	require.NoError(t, err)
+	assert.True(t, instant.Equal(ts), "%s", ts)
+
+	dt, err := row.Index(1).Time()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 0, loc), dt)
+}